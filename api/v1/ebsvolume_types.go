@@ -0,0 +1,159 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EbsVolumeSpec defines the desired state of EbsVolume.
+// The volume lives independently of any instance: Ec2Instances attach it by listing it in spec.volumes.
+type EbsVolumeSpec struct {
+	// Region the volume is created in.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="region is immutable"
+	Region string `json:"region"`
+	// AvailabilityZone the volume is created in. Instances attaching the volume are launched in the same zone.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="availabilityZone is immutable"
+	AvailabilityZone string `json:"availabilityZone"`
+
+	// Size in GiB. Required unless snapshotId is set, in which case it defaults to the snapshot size.
+	// The volume can grow, but never shrink.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:XValidation:rule="self >= oldSelf",message="size cannot be decreased"
+	// +optional
+	Size int32 `json:"size,omitempty"`
+	// Type of the volume. Defaults to the AWS default (gp2, or gp3 in newer regions).
+	// +kubebuilder:validation:Enum=gp2;gp3;io1;io2;st1;sc1;standard
+	// +optional
+	Type string `json:"type,omitempty"`
+	// IOPS provisioned for gp3, io1 and io2 volumes.
+	// +optional
+	IOPS int32 `json:"iops,omitempty"`
+	// Throughput in MiB/s provisioned for gp3 volumes.
+	// +optional
+	Throughput int32 `json:"throughput,omitempty"`
+
+	// Encrypted creates an encrypted volume. Volumes restored from an encrypted snapshot are always encrypted.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="encrypted is immutable"
+	// +optional
+	Encrypted bool `json:"encrypted,omitempty"`
+	// KMSKeyID is the ID, alias or ARN of the KMS key used to encrypt the volume. Requires encrypted.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="kmsKeyId is immutable"
+	// +optional
+	KMSKeyID string `json:"kmsKeyId,omitempty"`
+	// SnapshotID the volume is restored from.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="snapshotId is immutable"
+	// +optional
+	SnapshotID string `json:"snapshotId,omitempty"`
+
+	// Tags applied to the volume.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+	// DeletionPolicy decides whether the AWS volume is deleted or kept when the EbsVolume is deleted.
+	// Defaults to Delete.
+	// +optional
+	DeletionPolicy VolumeDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// EbsVolumeStatus defines the observed state of EbsVolume.
+type EbsVolumeStatus struct {
+	// VolumeID is the AWS ID of the volume, set once it has been created.
+	VolumeID string `json:"volumeId,omitempty"`
+	// State of the volume: creating, available, in-use, deleting, deleted or error.
+	State      string `json:"state,omitempty"`
+	Size       int32  `json:"size,omitempty"`
+	Type       string `json:"type,omitempty"`
+	IOPS       int32  `json:"iops,omitempty"`
+	Throughput int32  `json:"throughput,omitempty"`
+
+	// AttachedTo is the name of the Ec2Instance holding the volume. When several instances reference the volume,
+	// the holder keeps it until it no longer references it or is deleted; then the next instance gets it.
+	AttachedTo string `json:"attachedTo,omitempty"`
+	// InstanceID the volume is attached to.
+	InstanceID string `json:"instanceId,omitempty"`
+	// DeviceName the volume is attached as.
+	DeviceName string `json:"deviceName,omitempty"`
+	// AttachmentState of the volume: attaching, attached, detaching or detached.
+	AttachmentState string `json:"attachmentState,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the status was computed from.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions represent the latest available observations of the volume's state.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types and reasons reported on EbsVolume.
+const (
+	// ConditionVolumeReady tells whether the volume exists and can be attached.
+	ConditionVolumeReady = "Ready"
+	// ConditionVolumeAttached tells whether the volume is attached to the instance holding it.
+	ConditionVolumeAttached = "Attached"
+
+	ReasonVolumeCreating = "Creating"
+	ReasonVolumeReady    = "Ready"
+	ReasonVolumeLost     = "VolumeNotFound"
+	ReasonVolumeInUse    = "InUse"
+
+	ReasonVolumeAttached         = "Attached"
+	ReasonVolumeAttaching        = "Attaching"
+	ReasonVolumeDetaching        = "Detaching"
+	ReasonVolumeNotReferenced    = "NotReferenced"
+	ReasonWaitingForInstance     = "WaitingForInstance"
+	ReasonAvailabilityZoneDiffer = "AvailabilityZoneMismatch"
+	ReasonAttachFailed           = "AttachFailed"
+)
+
+// EbsVolumeAttachment references an EbsVolume in the namespace of the Ec2Instance.
+type EbsVolumeAttachment struct {
+	// Name of the EbsVolume.
+	Name string `json:"name"`
+	// DeviceName the volume is attached as, e.g. /dev/sdh.
+	DeviceName string `json:"deviceName"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Zone",type="string",JSONPath=".spec.availabilityZone",description="The availability zone of the volume"
+// +kubebuilder:printcolumn:name="Size",type="integer",JSONPath=".status.size",description="The size of the volume in GiB"
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state",description="The state of the volume"
+// +kubebuilder:printcolumn:name="AttachedTo",type="string",JSONPath=".status.attachedTo",description="The Ec2Instance holding the volume"
+// +kubebuilder:printcolumn:name="VolumeID",type="string",JSONPath=".status.volumeId",description="The AWS volume ID"
+
+// EbsVolume is the Schema for the ebsvolumes API.
+type EbsVolume struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EbsVolumeSpec   `json:"spec,omitempty"`
+	Status EbsVolumeStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EbsVolumeList contains a list of EbsVolume.
+type EbsVolumeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EbsVolume `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EbsVolume{}, &EbsVolumeList{})
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Ec2ImageSpec defines the desired state of Ec2Image.
+// The image is created once, when the Ec2Image is created; the spec cannot be changed afterwards.
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+type Ec2ImageSpec struct {
+	// InstanceName is the Ec2Instance of the namespace the image is created from.
+	// +kubebuilder:validation:MinLength=1
+	InstanceName string `json:"instanceName"`
+
+	// ImageName is the name of the AMI, unique within the account and region.
+	// Defaults to <namespace>-<name>-<first 8 characters of the UID>.
+	// +kubebuilder:validation:MaxLength=128
+	// +optional
+	ImageName string `json:"imageName,omitempty"`
+	// Description of the AMI.
+	// +optional
+	Description string `json:"description,omitempty"`
+	// NoReboot creates the image without shutting down the instance first. The file systems are then
+	// only crash-consistent.
+	// +optional
+	NoReboot bool `json:"noReboot,omitempty"`
+	// Tags applied to the AMI and its snapshots.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+	// DeletionPolicy decides whether the AMI is deregistered and its snapshots deleted, or both are kept,
+	// when the Ec2Image is deleted. Defaults to Delete.
+	// +kubebuilder:validation:Enum=Delete;Retain
+	// +optional
+	DeletionPolicy VolumeDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// Ec2ImageStatus defines the observed state of Ec2Image.
+type Ec2ImageStatus struct {
+	// ImageID is the ID of the AMI.
+	ImageID string `json:"imageId,omitempty"`
+	// ImageName is the name the AMI was registered with.
+	ImageName string `json:"imageName,omitempty"`
+	// Region the AMI was created in. Only Ec2Instances of this region can launch from it.
+	Region string `json:"region,omitempty"`
+	// State of the AMI: pending, available, failed, invalid, deregistered or error.
+	State string `json:"state,omitempty"`
+	// SnapshotIDs of the EBS snapshots backing the AMI.
+	// +optional
+	SnapshotIDs []string `json:"snapshotIds,omitempty"`
+	// CreationTime is the time the AMI creation was started.
+	// +optional
+	CreationTime *metav1.Time `json:"creationTime,omitempty"`
+
+	// Conditions represent the latest available observations of the image's state.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types and reasons reported on Ec2Image. While the instance cannot be imaged yet,
+// the Ready condition has the reason SourceNotFound or SourceNotReady, like on Ec2Snapshot.
+const (
+	// ConditionImageReady tells whether the AMI is available for launching instances.
+	ConditionImageReady = "Ready"
+
+	ReasonImagePending   = "Pending"
+	ReasonImageAvailable = "Available"
+	ReasonImageFailed    = "Failed"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Instance",type="string",JSONPath=".spec.instanceName",description="The Ec2Instance the image is created from"
+// +kubebuilder:printcolumn:name="ImageID",type="string",JSONPath=".status.imageId",description="The AMI ID"
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state",description="The state of the AMI"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Ec2Image is the Schema for the ec2images API.
+type Ec2Image struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Ec2ImageSpec   `json:"spec,omitempty"`
+	Status Ec2ImageStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// Ec2ImageList contains a list of Ec2Image.
+type Ec2ImageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Ec2Image `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Ec2Image{}, &Ec2ImageList{})
+}
@@ -20,31 +20,550 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// ForceDeleteAnnotation, set to "true" on an Ec2Instance, lets it be deleted while other instances depend on it.
+const ForceDeleteAnnotation = "compute.cloud.com/force-delete"
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // Ec2InstanceSpec defines the desired state of Ec2Instance.
 
 type Ec2InstanceSpec struct {
-	InstanceType      string            `json:"instanceType"`
-	AMIId             string            `json:"amiId"`
-	Region            string            `json:"region"`
-	AvailabilityZone  string            `json:"availabilityZone,omitempty"`
-	KeyPair           string            `json:"keyPair,omitempty"`
-	SecurityGroups    []string          `json:"securityGroups,omitempty"`
-	Subnet            string            `json:"subnet,omitempty"`
-	UserData          string            `json:"userData,omitempty"`
-	Tags              map[string]string `json:"tags,omitempty"`
-	Storage           StorageConfig     `json:"storage,omitempty"`
-	AssociatePublicIP bool              `json:"associatePublicIP,omitempty"`
+	// ClassName references the cluster-scoped Ec2InstanceClass the instance is launched from.
+	// Fields set in this spec override the ones from the class, as far as the class allows it.
+	// instanceType, amiId (or image) and region are only required when no class is referenced.
+	ClassName string `json:"className,omitempty"`
+
+	InstanceType string `json:"instanceType,omitempty"`
+	AMIId        string `json:"amiId,omitempty"`
+	// Image resolves the AMI at launch time instead of hardcoding amiId. Only one of amiId and image may be set.
+	// The resolved AMI ID is pinned in status.resolvedAmiId, so later image releases do not affect the instance.
+	// +optional
+	Image *ImageSelector `json:"image,omitempty"`
+
+	Region             string            `json:"region,omitempty"`
+	AvailabilityZone   string            `json:"availabilityZone,omitempty"`
+	KeyPair            string            `json:"keyPair,omitempty"`
+	SecurityGroups     []string          `json:"securityGroups,omitempty"`
+	Subnet             string            `json:"subnet,omitempty"`
+	IAMInstanceProfile string            `json:"iamInstanceProfile,omitempty"`
+	UserData           string            `json:"userData,omitempty"`
+	Tags               map[string]string `json:"tags,omitempty"`
+	Storage            StorageConfig     `json:"storage,omitempty"`
+	AssociatePublicIP  bool              `json:"associatePublicIP,omitempty"`
+
+	// UserDataTemplate renders userData as a Go template before it is used. The template can refer to the
+	// instance as .Name, .Namespace, .Region and .Labels, and look up values of its namespace with
+	// privateIP, publicIP and instanceID of another Ec2Instance, and configMapKey and secretKey.
+	// The instance is not launched until every value it looks up exists. Values read from Secrets end up in the
+	// user data, which anyone allowed to describe the instance attributes can read.
+	// +optional
+	UserDataTemplate bool `json:"userDataTemplate,omitempty"`
+	// CloudInit is rendered to a #cloud-config document, which becomes the user data of the instance.
+	// Together with userData or userDataFrom, it is the first part of a MIME multipart archive.
+	// +optional
+	CloudInit *CloudInitConfig `json:"cloudInit,omitempty"`
+	// UserDataFrom assembles the user data from keys of ConfigMaps and Secrets of the instance's namespace,
+	// so that scripts and secrets do not have to be written into the manifest. A single part without userData
+	// is the user data as is; otherwise userData and the parts are combined into a MIME multipart archive,
+	// which cloud-init runs part by part.
+	// +optional
+	UserDataFrom []UserDataSource `json:"userDataFrom,omitempty"`
+	// UserDataChangePolicy decides what happens when the user data rendered from cloudInit or the userData
+	// template, or assembled from userDataFrom, changes after launch. With Ignore (the default) the change is only reported in the UserDataUpToDate condition;
+	// with Replace the instance is terminated and launched again with the new user data.
+	// +kubebuilder:validation:Enum=Ignore;Replace
+	// +optional
+	UserDataChangePolicy UserDataChangePolicy `json:"userDataChangePolicy,omitempty"`
+
+	// SecurityGroupRefs are SecurityGroups of the instance's namespace, in the instance's region.
+	// Their group IDs are added to securityGroups when the instance is launched.
+	// +listType=set
+	// +optional
+	SecurityGroupRefs []string `json:"securityGroupRefs,omitempty"`
+	// KeyPairRef is a KeyPair of the instance's namespace, in the instance's region, whose key is installed
+	// on the instance. It replaces keyPair, which must then be empty.
+	// +optional
+	KeyPairRef string `json:"keyPairRef,omitempty"`
+
+	// Volumes attaches EbsVolumes of the instance's namespace. Unlike storage, their lifecycle is independent
+	// of the instance: they are detached when the instance goes away and attached again to its replacement.
+	// The instance is launched in the availability zone of its volumes.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Volumes []EbsVolumeAttachment `json:"volumes,omitempty"`
+
+	// FinalSnapshot snapshots the root and additional volumes before the instance is terminated on deletion.
+	// The snapshots are recorded in an Ec2Snapshot named <name>-final-<instanceId>, which outlives the instance.
+	// +optional
+	FinalSnapshot *FinalSnapshot `json:"finalSnapshot,omitempty"`
+
+	// WriteConnectionSecretToRef maintains a Secret of the instance's namespace with the addresses and
+	// SSH settings to connect to the instance, so that pods can mount it instead of reading the status.
+	// +optional
+	WriteConnectionSecretToRef *ConnectionSecretReference `json:"writeConnectionSecretToRef,omitempty"`
+
+	// Service exposes the instance inside the cluster under a stable name, through a Service without selector
+	// and an EndpointSlice with the private IP of the instance. The endpoint is ready while the instance is,
+	// and removed while the instance is stopped.
+	// +optional
+	Service *InstanceService `json:"service,omitempty"`
+
+	// DNS maintains a Route 53 record pointing at the instance. The record follows the addresses of the
+	// instance, which change when it is stopped and started, and is deleted when the instance is terminated.
+	// +optional
+	DNS *InstanceDNS `json:"dns,omitempty"`
+
+	// TargetGroups registers the instance as a target of ELBv2 target groups once it is Ready. The instance is
+	// deregistered, waiting for connection draining, before it is replaced or terminated, and while it is not running.
+	// +listType=map
+	// +listMapKey=arn
+	// +optional
+	TargetGroups []TargetGroupRegistration `json:"targetGroups,omitempty"`
+
+	// DependsOn are Ec2Instances of the same namespace that have to be Ready, or meet another condition,
+	// before the instance is launched. It only orders the launch: a dependency that stops being Ready later
+	// does not affect the launched instance. An instance is not deleted while other instances depend on it,
+	// unless it is annotated with compute.cloud.com/force-delete: "true".
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	DependsOn []InstanceDependency `json:"dependsOn,omitempty"`
+
+	// HealthCheck makes a running instance Ready only while its EC2 system and instance status checks pass,
+	// and the TCP or HTTP probe, if any, succeeds. The probes are run from the operator, which has to be
+	// able to reach the instance.
+	// +optional
+	HealthCheck *InstanceHealthCheck `json:"healthCheck,omitempty"`
+	// Remediation reboots, stops and starts, or replaces an instance that keeps failing its health checks.
+	// Requires healthCheck.
+	// +optional
+	Remediation *InstanceRemediation `json:"remediation,omitempty"`
+}
+
+// InstanceRemediation is what is done about an instance failing its health checks, and how often.
+type InstanceRemediation struct {
+	// Action is Reboot, StopStart, which moves the instance to another host and helps with failed system
+	// status checks, or Replace, which terminates the instance and launches it again.
+	// +kubebuilder:validation:Enum=Reboot;StopStart;Replace
+	Action RemediationAction `json:"action"`
+	// FailureThreshold is the number of consecutive failed health checks after which the instance is remediated.
+	// Defaults to the failureThreshold of the health check.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+	// BackoffSeconds is the time after a remediation before the instance is remediated again. It doubles with
+	// every further remediation within the window. Defaults to 300.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	BackoffSeconds *int32 `json:"backoffSeconds,omitempty"`
+	// MaxRemediations within windowSeconds. Once reached, the instance is left as it is until the window moves on.
+	// Defaults to 3.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxRemediations int32 `json:"maxRemediations,omitempty"`
+	// WindowSeconds over which remediations are counted for maxRemediations. Defaults to 3600.
+	// +kubebuilder:validation:Minimum=60
+	// +optional
+	WindowSeconds int32 `json:"windowSeconds,omitempty"`
+}
+
+// RemediationAction is done about an instance failing its health checks.
+type RemediationAction string
+
+const (
+	// RemediationReboot reboots the instance.
+	RemediationReboot RemediationAction = "Reboot"
+	// RemediationStopStart stops the instance and starts it again, on another host.
+	RemediationStopStart RemediationAction = "StopStart"
+	// RemediationReplace terminates the instance and launches it again.
+	RemediationReplace RemediationAction = "Replace"
+)
+
+// InstanceHealthCheck checks the health of a running instance, with thresholds and periods like Kubernetes probes.
+type InstanceHealthCheck struct {
+	// TCP probes a port of the instance by opening a connection.
+	// +optional
+	TCP *TCPHealthProbe `json:"tcp,omitempty"`
+	// HTTP probes the instance with a GET request, which succeeds with a status code from 200 to 399.
+	// +optional
+	HTTP *HTTPHealthProbe `json:"http,omitempty"`
+	// Address of the instance the probes connect to: Private (the default) or Public.
+	// +kubebuilder:validation:Enum=Private;Public
+	// +optional
+	Address ProbeAddress `json:"address,omitempty"`
+	// InitialDelaySeconds after the instance was started before it is checked.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	// PeriodSeconds between checks. Defaults to 30.
+	// +kubebuilder:validation:Minimum=10
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+	// TimeoutSeconds after which a probe fails. Defaults to 5.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// SuccessThreshold is the number of consecutive successful checks after which the instance is Ready. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SuccessThreshold int32 `json:"successThreshold,omitempty"`
+	// FailureThreshold is the number of consecutive failed checks after which the instance is no longer Ready. Defaults to 3.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// TCPHealthProbe probes a port of an instance.
+type TCPHealthProbe struct {
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+}
+
+// HTTPHealthProbe probes an HTTP endpoint of an instance.
+type HTTPHealthProbe struct {
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// Path of the request. Defaults to /.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Scheme of the request: HTTP (the default) or HTTPS. The certificate of the instance is not verified.
+	// +kubebuilder:validation:Enum=HTTP;HTTPS
+	// +optional
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// ProbeAddress is the address of an instance a health probe connects to.
+type ProbeAddress string
+
+const (
+	// ProbeAddressPrivate connects to the private IP of the instance.
+	ProbeAddressPrivate ProbeAddress = "Private"
+	// ProbeAddressPublic connects to the public IP of the instance.
+	ProbeAddressPublic ProbeAddress = "Public"
+)
+
+// InstanceDependency is an Ec2Instance another instance waits for before it is launched.
+type InstanceDependency struct {
+	// Name of the Ec2Instance, in the namespace of the dependent instance.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Condition of the Ec2Instance that has to be True, e.g. DNSRecordSynced. Defaults to Ready.
+	// +optional
+	Condition string `json:"condition,omitempty"`
+}
+
+// TargetGroupRegistration registers an instance in a target group of type instance.
+type TargetGroupRegistration struct {
+	// ARN of the target group, in the region of the instance.
+	// +kubebuilder:validation:Pattern=`^arn:[^:]+:elasticloadbalancing:[^:]+:[0-9]+:targetgroup/.+$`
+	ARN string `json:"arn"`
+	// Port the target receives traffic on. Defaults to the port of the target group.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+}
+
+// InstanceDNS configures the Route 53 record of an instance.
+type InstanceDNS struct {
+	// HostedZoneID is the ID of the Route 53 hosted zone the record is created in, e.g. Z0123456789ABCDEFGHIJ.
+	// +kubebuilder:validation:MinLength=1
+	HostedZoneID string `json:"hostedZoneId"`
+	// RecordName is the fully qualified name of the record, e.g. web.example.com. It must be in the hosted zone.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	RecordName string `json:"recordName"`
+	// RecordType is A for the IPv4 address of the instance, AAAA for its IPv6 address,
+	// or CNAME for its DNS name. Defaults to A.
+	// +kubebuilder:validation:Enum=A;AAAA;CNAME
+	// +optional
+	RecordType string `json:"recordType,omitempty"`
+	// Target is the address of the instance the record points at, Public or Private. Defaults to Public.
+	// The public address of an instance goes away while it is stopped, and with it the record.
+	// AAAA records always point at the IPv6 address, which is both.
+	// +kubebuilder:validation:Enum=Public;Private
+	// +optional
+	Target DNSTarget `json:"target,omitempty"`
+	// TTL of the record, in seconds. Defaults to 300.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=2147483647
+	// +optional
+	TTL *int64 `json:"ttl,omitempty"`
+}
+
+// DNSTarget is the address of an instance a DNS record points at.
+type DNSTarget string
+
+const (
+	// DNSTargetPublic points the record at the public IP or DNS name of the instance.
+	DNSTargetPublic DNSTarget = "Public"
+	// DNSTargetPrivate points the record at the private IP or DNS name of the instance.
+	DNSTargetPrivate DNSTarget = "Private"
+)
+
+// CloudInitConfig is the structured cloud-init configuration of an instance. The rendered user data,
+// gzip compressed if needed, must fit into the 16 KB EC2 allows.
+type CloudInitConfig struct {
+	// Users created on the instance, next to the default user of the AMI.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Users []CloudInitUser `json:"users,omitempty"`
+	// Packages installed on first boot.
+	// +listType=set
+	// +optional
+	Packages []string `json:"packages,omitempty"`
+	// PackageUpgrade upgrades the installed packages on first boot.
+	// +optional
+	PackageUpgrade bool `json:"packageUpgrade,omitempty"`
+	// WriteFiles are files written on first boot, before runcmd runs.
+	// +listType=map
+	// +listMapKey=path
+	// +optional
+	WriteFiles []CloudInitFile `json:"writeFiles,omitempty"`
+	// Mounts formats additional volumes of spec.storage that have no file system yet, and mounts them.
+	// +listType=map
+	// +listMapKey=deviceName
+	// +optional
+	Mounts []CloudInitMount `json:"mounts,omitempty"`
+	// Runcmd are shell commands run at the end of the first boot.
+	// +optional
+	Runcmd []string `json:"runcmd,omitempty"`
+}
+
+// CloudInitUser is a user created by cloud-init.
+type CloudInitUser struct {
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=32
+	Name string `json:"name"`
+	// Groups the user is added to.
+	// +optional
+	Groups []string `json:"groups,omitempty"`
+	// Sudo allows the user to run any command as root without password.
+	// +optional
+	Sudo bool `json:"sudo,omitempty"`
+	// Shell of the user, e.g. /bin/bash.
+	// +optional
+	Shell string `json:"shell,omitempty"`
+	// SSHAuthorizedKeys are public keys the user can log in with.
+	// +optional
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+}
+
+// CloudInitFile is a file written by cloud-init.
+type CloudInitFile struct {
+	// Path of the file, absolute.
+	Path string `json:"path"`
+	// Content of the file.
+	Content string `json:"content"`
+	// Permissions of the file in octal, e.g. "0644".
+	// +kubebuilder:validation:Pattern=`^0?[0-7]{3}$`
+	// +optional
+	Permissions string `json:"permissions,omitempty"`
+	// Owner of the file as user:group. Defaults to root:root.
+	// +optional
+	Owner string `json:"owner,omitempty"`
+}
+
+// CloudInitMount mounts an additional volume.
+type CloudInitMount struct {
+	// DeviceName of an additional volume of spec.storage.
+	DeviceName string `json:"deviceName"`
+	// MountPoint is the absolute path the volume is mounted at.
+	MountPoint string `json:"mountPoint"`
+	// FileSystem the volume is formatted with, unless it already has one. Defaults to ext4.
+	// +kubebuilder:validation:Enum=ext4;xfs
+	// +optional
+	FileSystem string `json:"fileSystem,omitempty"`
+	// Options of the mount. Defaults to defaults,nofail, so that the instance boots without the volume.
+	// +optional
+	Options string `json:"options,omitempty"`
+}
+
+// UserDataSource is a part of the user data, read from a key of a ConfigMap or Secret.
+// Exactly one of configMapKeyRef and secretKeyRef must be set.
+type UserDataSource struct {
+	// ConfigMapKeyRef selects a key of a ConfigMap.
+	// +optional
+	ConfigMapKeyRef *UserDataKeyReference `json:"configMapKeyRef,omitempty"`
+	// SecretKeyRef selects a key of a Secret.
+	// +optional
+	SecretKeyRef *UserDataKeyReference `json:"secretKeyRef,omitempty"`
+	// ContentType of the part in the MIME multipart archive, e.g. text/x-shellscript or text/cloud-config.
+	// When unset, it is detected from the first line of the part, e.g. #! or #cloud-config.
+	// +optional
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// UserDataKeyReference selects a key of a ConfigMap or Secret.
+type UserDataKeyReference struct {
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+}
+
+// UserDataReference is an object the userData template of an instance looked up a value of.
+type UserDataReference struct {
+	// Kind of the object: Ec2Instance, ConfigMap or Secret.
+	// +kubebuilder:validation:Enum=Ec2Instance;ConfigMap;Secret
+	Kind string `json:"kind"`
+	// Name of the object, in the namespace of the instance.
+	Name string `json:"name"`
+}
+
+// UserDataChangePolicy is what happens to a launched instance when its user data changes.
+type UserDataChangePolicy string
+
+const (
+	// UserDataChangeIgnore keeps the instance running with the user data it was launched with.
+	UserDataChangeIgnore UserDataChangePolicy = "Ignore"
+	// UserDataChangeReplace replaces the instance to run the new user data.
+	UserDataChangeReplace UserDataChangePolicy = "Replace"
+)
+
+// InstanceService configures the Service of an instance.
+type InstanceService struct {
+	// Name of the Service. Defaults to the name of the instance.
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Ports of the Service.
+	// +kubebuilder:validation:MinItems=1
+	Ports []InstanceServicePort `json:"ports"`
+}
+
+// InstanceServicePort is a port of the Service of an instance.
+type InstanceServicePort struct {
+	// Name of the port. Required when the Service has more than one port.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Port the Service listens on.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// TargetPort is the port on the instance. Defaults to port.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	TargetPort int32 `json:"targetPort,omitempty"`
+	// Protocol of the port. Defaults to TCP.
+	// +kubebuilder:validation:Enum=TCP;UDP;SCTP
+	// +optional
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// ConnectionSecretReference configures the connection Secret of an instance. The Secret has the keys
+// publicIP, privateIP, publicDNS, privateDNS, sshUser and sshPort, and sshPrivateKey if requested.
+type ConnectionSecretReference struct {
+	// Name of the Secret. It is created and owned by the Ec2Instance.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// SSHUser is the user to log in as. Defaults to ec2-user, the user of Amazon Linux.
+	// +optional
+	SSHUser string `json:"sshUser,omitempty"`
+	// SSHPort is the port sshd listens on. Defaults to 22.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	SSHPort int32 `json:"sshPort,omitempty"`
+	// IncludePrivateKey copies the private key of the KeyPair of keyPairRef into the Secret.
+	// Only key pairs generated by the KeyPair have a private key; imported ones do not.
+	// +optional
+	IncludePrivateKey bool `json:"includePrivateKey,omitempty"`
+}
+
+// FinalSnapshot configures the Ec2Snapshot taken before an instance is terminated.
+type FinalSnapshot struct {
+	// Tags applied to the EBS snapshots, in addition to the instance's tags.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+	// DeletionPolicy of the Ec2Snapshot. With Delete (the default), the EBS snapshots are deleted
+	// together with the Ec2Snapshot; deleting the instance never deletes them.
+	// +kubebuilder:validation:Enum=Delete;Retain
+	// +optional
+	DeletionPolicy VolumeDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// ImageSelector finds an AMI through an SSM parameter, through image filters, or from an Ec2Image.
+// Exactly one of ssmParameter, name and ec2Image must be set.
+type ImageSelector struct {
+	// Ec2Image is an Ec2Image of the instance's namespace, in the instance's region.
+	// The instance is launched once the AMI is available.
+	// +optional
+	Ec2Image string `json:"ec2Image,omitempty"`
+
+	// SSMParameter is the path of an SSM parameter holding an AMI ID, e.g. the AWS public parameter
+	// /aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64.
+	// +optional
+	SSMParameter string `json:"ssmParameter,omitempty"`
+
+	// Owners of the image, as account IDs or aliases such as "amazon". Required together with name.
+	// +optional
+	Owners []string `json:"owners,omitempty"`
+	// Name pattern of the image, with * and ? wildcards, e.g. "ubuntu/images/hvm-ssd-gp3/ubuntu-noble-24.04-*".
+	// The newest available image matching the filters is used.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Architecture of the image. When unset, images of any architecture match.
+	// +kubebuilder:validation:Enum=i386;x86_64;arm64;x86_64_mac;arm64_mac
+	// +optional
+	Architecture string `json:"architecture,omitempty"`
+
+	// Refresh decides what happens when the image resolves to a newer AMI than the one the instance runs.
+	// With Never (the default) the newer AMI is only reported in the status; with OnNewVersion the
+	// instance is terminated and launched again from the newer AMI, within the maintenance window.
+	// +kubebuilder:validation:Enum=Never;OnNewVersion
+	// +optional
+	Refresh ImageRefreshPolicy `json:"refresh,omitempty"`
+	// CheckInterval is how often the image is resolved again to look for a newer AMI. Defaults to 1h.
+	// +optional
+	CheckInterval *metav1.Duration `json:"checkInterval,omitempty"`
+	// MaintenanceWindow restricts when an instance may be replaced by a refresh.
+	// When unset, a refresh happens as soon as a newer AMI is found.
+	// +optional
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
 }
 
+// ImageRefreshPolicy is the refresh policy of an image.
+type ImageRefreshPolicy string
+
+const (
+	// ImageRefreshNever keeps the instance on the AMI it was launched from.
+	ImageRefreshNever ImageRefreshPolicy = "Never"
+	// ImageRefreshOnNewVersion replaces the instance when the image resolves to a newer AMI.
+	ImageRefreshOnNewVersion ImageRefreshPolicy = "OnNewVersion"
+)
+
+// MaintenanceWindow is a weekly recurring time window, in UTC.
+type MaintenanceWindow struct {
+	// Days of the week the window opens on. When empty, the window opens every day.
+	// +optional
+	Days []MaintenanceDay `json:"days,omitempty"`
+	// StartTime is the time of day the window opens, as HH:MM in UTC.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	StartTime string `json:"startTime"`
+	// Duration of the window, e.g. 2h.
+	Duration metav1.Duration `json:"duration"`
+}
+
+// MaintenanceDay is a day of the week.
+// +kubebuilder:validation:Enum=Monday;Tuesday;Wednesday;Thursday;Friday;Saturday;Sunday
+type MaintenanceDay string
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="InstanceType",type="string",JSONPath=".spec.instanceType",description="The EC2 instance type"
+// +kubebuilder:printcolumn:name="Class",type="string",JSONPath=".spec.className",description="The Ec2InstanceClass the instance is launched from",priority=1
 // +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state",description="The current state of the EC2 instance"
 // +kubebuilder:printcolumn:name="PublicIP",type="string",JSONPath=".status.publicIP",description="The public IP of the EC2 instance"
 // +kubebuilder:printcolumn:name="InstanceID",type="string",JSONPath=".status.instanceId",description="The AWS instance ID"
+// +kubebuilder:printcolumn:name="AMI",type="string",JSONPath=".status.resolvedAmiId",description="The AMI the image resolved to at launch",priority=1
+// +kubebuilder:printcolumn:name="AvailableAMI",type="string",JSONPath=".status.availableAmiId",description="The newest AMI the image resolves to",priority=1
 // Ec2Instance is the Schema for the ec2instances API.
 
 type Ec2Instance struct {
@@ -66,6 +585,247 @@ type Ec2InstanceStatus struct {
 	PublicDNS  string       `json:"publicDNS,omitempty"`
 	PrivateDNS string       `json:"privateDNS,omitempty"`
 	LaunchTime *metav1.Time `json:"launchTime,omitempty"`
+	// IPv6Address is the first IPv6 address of the instance, if it has one.
+	// +optional
+	IPv6Address string `json:"ipv6Address,omitempty"`
+
+	// Region the instance was launched in. It is kept so that the instance can still be
+	// terminated when the region came from a class that has since changed or been deleted.
+	Region string `json:"region,omitempty"`
+	// ResolvedAMIId is the AMI ID spec.image resolved to, i.e. the AMI the instance currently runs.
+	// It only changes when the instance is refreshed.
+	ResolvedAMIId string `json:"resolvedAmiId,omitempty"`
+	// AvailableAMIId is the AMI ID spec.image resolved to at the last check. When it differs from
+	// resolvedAmiId, a newer image is available that the instance does not run yet.
+	AvailableAMIId string `json:"availableAmiId,omitempty"`
+	// ImageCheckedAt is the time spec.image was last resolved.
+	ImageCheckedAt *metav1.Time `json:"imageCheckedAt,omitempty"`
+	// Volumes reports the EBS volumes of the spec that are attached to the instance, by device name.
+	// +listType=map
+	// +listMapKey=deviceName
+	// +optional
+	Volumes []VolumeStatus `json:"volumes,omitempty"`
+	// ClassGeneration is the generation of the Ec2InstanceClass the instance was launched from.
+	ClassGeneration int64 `json:"classGeneration,omitempty"`
+	// UserDataHash is the SHA-256 hash of the user data the instance was launched with, when it was
+	// rendered from cloudInit or the userData template, or assembled from userDataFrom.
+	// +optional
+	UserDataHash string `json:"userDataHash,omitempty"`
+	// UserDataReferences are the objects the userData template looked up values of when it was last rendered.
+	// A change to any of them renders the template again.
+	// +optional
+	UserDataReferences []UserDataReference `json:"userDataReferences,omitempty"`
+	// CloudInitHash is the SHA-256 hash of the #cloud-config document rendered from cloudInit at launch.
+	// +optional
+	CloudInitHash string `json:"cloudInitHash,omitempty"`
+	// DNS is the Route 53 record of spec.dns as last written, which is deleted again when the instance
+	// is terminated or the record changes.
+	// +optional
+	DNS *DNSRecordStatus `json:"dns,omitempty"`
+	// TargetGroups reports the health of the instance in the target groups it is registered in.
+	// +listType=map
+	// +listMapKey=arn
+	// +optional
+	TargetGroups []TargetGroupStatus `json:"targetGroups,omitempty"`
+	// Health reports the last checks of spec.healthCheck while the instance is running.
+	// +optional
+	Health *InstanceHealthStatus `json:"health,omitempty"`
+	// Remediation counts the remediations of spec.remediation performed on the instance.
+	// +optional
+	Remediation *RemediationStatus `json:"remediation,omitempty"`
+
+	// Conditions represent the latest available observations of the instance's state.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types and reasons reported on Ec2Instance.
+const (
+	// ConditionReady tells whether the launched instance is running, as last observed in AWS,
+	// and passes its health checks if spec.healthCheck is set.
+	ConditionReady = "Ready"
+
+	ReasonInstanceRunning    = "Running"
+	ReasonInstanceNotRunning = "NotRunning"
+	// With spec.healthCheck, a running instance is Healthy, Unhealthy, or HealthCheckPending until the
+	// first checks reached a threshold.
+	ReasonInstanceHealthy    = "Healthy"
+	ReasonInstanceUnhealthy  = "Unhealthy"
+	ReasonHealthCheckPending = "HealthCheckPending"
+
+	// ConditionRemediating tells whether an instance failing its health checks is being remediated, and
+	// otherwise why not.
+	ConditionRemediating = "Remediating"
+
+	ReasonRemediationNotNeeded    = "NotNeeded"
+	ReasonRemediationBackingOff   = "BackingOff"
+	ReasonRemediationLimitReached = "LimitReached"
+	ReasonRemediationRebooting    = "Rebooting"
+	ReasonRemediationStopStarting = "StopStarting"
+	ReasonRemediationReplacing    = "Replacing"
+
+	// ConditionDependenciesReady tells whether the Ec2Instances of spec.dependsOn met their condition,
+	// so that the instance could be launched.
+	ConditionDependenciesReady = "DependenciesReady"
+
+	ReasonDependenciesReady  = "Ready"
+	ReasonDependencyNotFound = "DependencyNotFound"
+	ReasonDependencyNotReady = "DependencyNotReady"
+	ReasonDependencyCycle    = "DependencyCycle"
+
+	// ConditionDeletionBlocked tells whether the deletion of the instance waits for the instances depending on it.
+	ConditionDeletionBlocked = "DeletionBlocked"
+
+	ReasonDependentsExist = "DependentsExist"
+
+	// ConditionClassResolved tells whether the referenced Ec2InstanceClass could be merged into the spec.
+	ConditionClassResolved = "ClassResolved"
+
+	// ConditionImageResolved tells whether spec.image could be resolved to an AMI ID.
+	ConditionImageResolved = "ImageResolved"
+
+	ReasonClassNotFound  = "ClassNotFound"
+	ReasonClassForbidden = "ClassForbidden"
+	ReasonClassResolved  = "Resolved"
+
+	// ConditionImageUpToDate tells whether the instance runs the newest AMI spec.image resolves to.
+	ConditionImageUpToDate = "ImageUpToDate"
+
+	ReasonImageResolved = "Resolved"
+	ReasonImageNotFound = "ImageNotFound"
+
+	ReasonImageCurrent        = "Current"
+	ReasonNewVersionAvailable = "NewVersionAvailable"
+	ReasonRefreshScheduled    = "RefreshScheduled"
+	ReasonRefreshing          = "Refreshing"
+
+	// ConditionVolumesResolved tells whether the EbsVolumes of spec.volumes exist and share an availability zone.
+	ConditionVolumesResolved = "VolumesResolved"
+
+	ReasonVolumesResolved      = "Resolved"
+	ReasonVolumeNotFound       = "VolumeNotFound"
+	ReasonVolumeZoneConflict   = "AvailabilityZoneConflict"
+	ReasonVolumeRegionConflict = "RegionConflict"
+
+	// ConditionSecurityGroupsResolved tells whether the SecurityGroups of spec.securityGroupRefs have been created.
+	ConditionSecurityGroupsResolved = "SecurityGroupsResolved"
+
+	ReasonSecurityGroupsResolved      = "Resolved"
+	ReasonSecurityGroupNotFound       = "SecurityGroupNotFound"
+	ReasonSecurityGroupNotReady       = "SecurityGroupNotReady"
+	ReasonSecurityGroupRegionConflict = "RegionConflict"
+
+	// ConditionKeyPairResolved tells whether the KeyPair of spec.keyPairRef has been created.
+	ConditionKeyPairResolved = "KeyPairResolved"
+
+	ReasonKeyPairResolved       = "Resolved"
+	ReasonKeyPairNotFound       = "KeyPairNotFound"
+	ReasonKeyPairNotReady       = "KeyPairNotReady"
+	ReasonKeyPairRegionConflict = "RegionConflict"
+
+	// ConditionUserDataUpToDate tells whether the instance runs the user data currently rendered from cloudInit
+	// and the userData template, and assembled from userDataFrom.
+	ConditionUserDataUpToDate = "UserDataUpToDate"
+
+	ReasonUserDataCurrent        = "Current"
+	ReasonUserDataChanged        = "Changed"
+	ReasonUserDataReplacing      = "Replacing"
+	ReasonUserDataSourceNotFound = "SourceNotFound"
+	ReasonUserDataTooLarge       = "TooLarge"
+	// ReasonUserDataReferenceNotFound and ReasonUserDataReferencePending report a value the userData template
+	// looks up that does not exist (yet), e.g. the private IP of an Ec2Instance that has not been launched.
+	ReasonUserDataReferenceNotFound = "ReferenceNotFound"
+	ReasonUserDataReferencePending  = "ReferencePending"
+	ReasonUserDataTemplateInvalid   = "TemplateInvalid"
+
+	// ConditionDNSRecordSynced tells whether the Route 53 record of spec.dns points at the instance
+	// and has propagated to all Route 53 name servers.
+	ConditionDNSRecordSynced = "DNSRecordSynced"
+
+	ReasonDNSRecordInSync    = "InSync"
+	ReasonDNSRecordPending   = "Pending"
+	ReasonDNSRecordNoAddress = "NoAddress"
+	ReasonDNSChangeFailed    = "ChangeFailed"
+
+	// ConditionFinalSnapshotTaken tells whether the final snapshot of a deleted instance is ready to use,
+	// with the reason and message of the Ec2Snapshot's Ready condition. Termination waits for it.
+	ConditionFinalSnapshotTaken = "FinalSnapshotTaken"
+)
+
+// InstanceHealthStatus reports the health checks of a running instance.
+type InstanceHealthStatus struct {
+	// SystemStatus and InstanceStatus are the EC2 status checks, e.g. ok, impaired or initializing.
+	SystemStatus   string `json:"systemStatus,omitempty"`
+	InstanceStatus string `json:"instanceStatus,omitempty"`
+	// Message describes the result of the last check.
+	Message string `json:"message,omitempty"`
+	// ConsecutiveSuccesses and ConsecutiveFailures count the checks since the result last changed.
+	ConsecutiveSuccesses int32 `json:"consecutiveSuccesses,omitempty"`
+	ConsecutiveFailures  int32 `json:"consecutiveFailures,omitempty"`
+	// LastCheckTime is when the instance was last checked.
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+}
+
+// RemediationStatus records the remediations performed on an instance.
+type RemediationStatus struct {
+	// Total number of remediations, and of reboots, stop/starts and replacements.
+	Total        int32 `json:"total,omitempty"`
+	Reboots      int32 `json:"reboots,omitempty"`
+	StopStarts   int32 `json:"stopStarts,omitempty"`
+	Replacements int32 `json:"replacements,omitempty"`
+	// LastAction is the action of the last remediation, performed at LastRemediationTime.
+	// +optional
+	LastAction RemediationAction `json:"lastAction,omitempty"`
+	// +optional
+	LastRemediationTime *metav1.Time `json:"lastRemediationTime,omitempty"`
+	// Recent are the times of the remediations within the window of spec.remediation.
+	// +listType=atomic
+	// +optional
+	Recent []metav1.Time `json:"recent,omitempty"`
+	// InProgress is StopStart while the stopped instance is still to be started again.
+	// +optional
+	InProgress RemediationAction `json:"inProgress,omitempty"`
+	// HealthChecksResumeAt is when the remediated instance is checked again: after the initial delay of
+	// spec.healthCheck, and at least one period after the last remediation. Checks failing while the
+	// instance reboots would otherwise count towards the next remediation.
+	// +optional
+	HealthChecksResumeAt *metav1.Time `json:"healthChecksResumeAt,omitempty"`
+}
+
+// DNSRecordStatus is a Route 53 record written for an instance, and the change that wrote it.
+type DNSRecordStatus struct {
+	HostedZoneID string `json:"hostedZoneId"`
+	RecordName   string `json:"recordName"`
+	RecordType   string `json:"recordType"`
+	TTL          int64  `json:"ttl"`
+	// Value of the record, an address or DNS name of the instance.
+	Value string `json:"value"`
+	// ChangeID is the ID of the Route 53 change that wrote the record.
+	// +optional
+	ChangeID string `json:"changeId,omitempty"`
+	// ChangeStatus is PENDING until the change has propagated to all Route 53 name servers, then INSYNC.
+	// +optional
+	ChangeStatus string `json:"changeStatus,omitempty"`
+	// SubmittedAt is the time the change was submitted.
+	// +optional
+	SubmittedAt *metav1.Time `json:"submittedAt,omitempty"`
+}
+
+// TargetGroupStatus is the health of an instance in a target group, as reported by DescribeTargetHealth.
+type TargetGroupStatus struct {
+	ARN  string `json:"arn"`
+	Port int32  `json:"port,omitempty"`
+	// State of the target: initial, healthy, unhealthy, unhealthy.draining, unused, draining or unavailable.
+	// +optional
+	State string `json:"state,omitempty"`
+	// Reason code of a state other than healthy, e.g. Target.FailedHealthChecks.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// +optional
+	Description string `json:"description,omitempty"`
 }
 
 // StorageConfig defines the storage configuration for the EC2 instance.
@@ -75,11 +835,72 @@ type StorageConfig struct {
 }
 
 // VolumeConfig defines the configuration for a volume.
+// Size, type, IOPS and throughput of a launched volume are changed in place with ModifyVolume;
+// volumes can only grow, and encryption settings only apply when the volume is created.
+// Additional volumes added to or removed from the spec of a launched instance are created and attached,
+// or detached and deleted or retained according to their deletion policy.
 type VolumeConfig struct {
 	Size       int32  `json:"size"`
 	Type       string `json:"type,omitempty"`
 	DeviceName string `json:"deviceName,omitempty"`
 	Encrypted  bool   `json:"encrypted,omitempty"`
+	// IOPS provisioned for io1, io2 and gp3 volumes.
+	// +optional
+	IOPS int32 `json:"iops,omitempty"`
+	// Throughput in MiB/s provisioned for gp3 volumes.
+	// +optional
+	Throughput int32 `json:"throughput,omitempty"`
+	// KMSKeyID is the ID, alias or ARN of the KMS key used to encrypt the volume. Requires encrypted.
+	// +optional
+	KMSKeyID string `json:"kmsKeyId,omitempty"`
+	// DeletionPolicy decides what happens to an additional volume when it is removed from the spec
+	// or the instance is terminated. Defaults to Delete.
+	// +optional
+	DeletionPolicy VolumeDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// VolumeDeletionPolicy is what happens to a volume once it is no longer used.
+// +kubebuilder:validation:Enum=Delete;Retain
+type VolumeDeletionPolicy string
+
+const (
+	// VolumeDeletionPolicyDelete deletes the volume.
+	VolumeDeletionPolicyDelete VolumeDeletionPolicy = "Delete"
+	// VolumeDeletionPolicyRetain detaches the volume and keeps it.
+	VolumeDeletionPolicyRetain VolumeDeletionPolicy = "Retain"
+)
+
+// VolumeStatus is the observed state of an EBS volume attached to the instance.
+type VolumeStatus struct {
+	DeviceName string `json:"deviceName"`
+	VolumeID   string `json:"volumeId,omitempty"`
+	Size       int32  `json:"size,omitempty"`
+	Type       string `json:"type,omitempty"`
+	IOPS       int32  `json:"iops,omitempty"`
+	Throughput int32  `json:"throughput,omitempty"`
+
+	// State of the volume: creating, available, in-use, deleting, deleted or error.
+	// +optional
+	State string `json:"state,omitempty"`
+	// AttachmentState of the volume to the instance: attaching, attached, detaching or detached.
+	// +optional
+	AttachmentState string `json:"attachmentState,omitempty"`
+	// DeletionPolicy the volume was managed with, applied once the volume is removed from the spec.
+	// +optional
+	DeletionPolicy VolumeDeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// ModificationState of the latest modification of the volume: modifying, optimizing, completed or failed.
+	// +optional
+	ModificationState string `json:"modificationState,omitempty"`
+	// ModificationProgress of the latest modification, in percent.
+	// +optional
+	ModificationProgress int64 `json:"modificationProgress,omitempty"`
+	// Message explains why the volume does not match the spec, e.g. a rejected modification.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// ModificationRetryAt is when a modification AWS rejected is requested again.
+	// +optional
+	ModificationRetryAt *metav1.Time `json:"modificationRetryAt,omitempty"`
 }
 
 type Condition struct {
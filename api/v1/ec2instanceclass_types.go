@@ -0,0 +1,86 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Ec2InstanceClassSpec defines the template an Ec2Instance referencing the class is launched from.
+// Every field is optional; an Ec2Instance only has to set what its class leaves open or what it overrides.
+type Ec2InstanceClassSpec struct {
+	InstanceType       string            `json:"instanceType,omitempty"`
+	AMIId              string            `json:"amiId,omitempty"`
+	Image              *ImageSelector    `json:"image,omitempty"`
+	Region             string            `json:"region,omitempty"`
+	AvailabilityZone   string            `json:"availabilityZone,omitempty"`
+	KeyPair            string            `json:"keyPair,omitempty"`
+	SecurityGroups     []string          `json:"securityGroups,omitempty"`
+	Subnet             string            `json:"subnet,omitempty"`
+	IAMInstanceProfile string            `json:"iamInstanceProfile,omitempty"`
+	UserData           string            `json:"userData,omitempty"`
+	Tags               map[string]string `json:"tags,omitempty"`
+	Storage            *StorageConfig    `json:"storage,omitempty"`
+	AssociatePublicIP  *bool             `json:"associatePublicIP,omitempty"`
+
+	// AllowedOverrides lists the Ec2Instance spec fields (by their JSON name, e.g. "instanceType" or "storage")
+	// that instances of this class may set themselves. When empty, instances may override any field.
+	// keyPairRef counts as overriding keyPair, securityGroupRefs as securityGroups, volumes as availabilityZone,
+	// and userDataFrom, userDataTemplate and cloudInit as userData.
+	// Tags set on an instance are always merged with the class tags, but can never replace a class tag.
+	// +optional
+	AllowedOverrides []string `json:"allowedOverrides,omitempty"`
+
+	// AllowedInstanceTypes restricts the instance types that may be launched with this class.
+	// Entries are shell patterns, e.g. "t3.*". When empty, any instance type is allowed.
+	// +optional
+	AllowedInstanceTypes []string `json:"allowedInstanceTypes,omitempty"`
+
+	// NamespaceSelector restricts the namespaces whose Ec2Instances may use this class.
+	// When unset, the class may be used from any namespace.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="InstanceType",type="string",JSONPath=".spec.instanceType",description="The EC2 instance type"
+// +kubebuilder:printcolumn:name="AMI",type="string",JSONPath=".spec.amiId",description="The AMI instances are launched from"
+// +kubebuilder:printcolumn:name="Region",type="string",JSONPath=".spec.region",description="The AWS region"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Ec2InstanceClass is the Schema for the ec2instanceclasses API.
+// Like a StorageClass for volumes, it lets platform teams define what tenants can launch.
+type Ec2InstanceClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec Ec2InstanceClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// Ec2InstanceClassList contains a list of Ec2InstanceClass.
+type Ec2InstanceClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Ec2InstanceClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Ec2InstanceClass{}, &Ec2InstanceClassList{})
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// InstanceDeploymentLabel is set on the Ec2InstanceSets and Ec2Instances of an Ec2InstanceDeployment,
+	// with the deployment's name as value.
+	InstanceDeploymentLabel = "compute.cloud.com/instance-deployment"
+	// TemplateHashLabel identifies the template revision an Ec2InstanceSet of a deployment was created for.
+	TemplateHashLabel = "compute.cloud.com/template-hash"
+	// RevisionAnnotation holds the revision number of an Ec2InstanceSet within its deployment.
+	RevisionAnnotation = "compute.cloud.com/revision"
+)
+
+// Ec2InstanceDeploymentStrategyType is the way instances are replaced when the template changes.
+// +kubebuilder:validation:Enum=RollingUpdate;Recreate
+type Ec2InstanceDeploymentStrategyType string
+
+const (
+	// RollingUpdateStrategyType replaces instances gradually, within maxSurge and maxUnavailable.
+	RollingUpdateStrategyType Ec2InstanceDeploymentStrategyType = "RollingUpdate"
+	// RecreateStrategyType terminates all old instances before launching the new ones.
+	RecreateStrategyType Ec2InstanceDeploymentStrategyType = "Recreate"
+)
+
+// Ec2InstanceDeploymentStrategy describes how to replace instances on template changes.
+type Ec2InstanceDeploymentStrategy struct {
+	// Type of the strategy. Defaults to RollingUpdate.
+	// +optional
+	Type Ec2InstanceDeploymentStrategyType `json:"type,omitempty"`
+
+	// RollingUpdate parameters, only used with the RollingUpdate strategy.
+	// +optional
+	RollingUpdate *RollingUpdateEc2InstanceDeployment `json:"rollingUpdate,omitempty"`
+}
+
+// RollingUpdateEc2InstanceDeployment controls the pace of a rolling update.
+type RollingUpdateEc2InstanceDeployment struct {
+	// MaxUnavailable is the number or percentage of instances that may be unready during the update.
+	// Percentages are rounded down. Defaults to 25%.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// MaxSurge is the number or percentage of instances that may be launched above the desired replicas.
+	// Percentages are rounded up. Defaults to 25%.
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+}
+
+// Ec2InstanceRollback asks the deployment to go back to an earlier template.
+type Ec2InstanceRollback struct {
+	// Revision to roll back to. 0 means the revision before the current one.
+	// +optional
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// Ec2InstanceDeploymentSpec defines the desired state of Ec2InstanceDeployment.
+type Ec2InstanceDeploymentSpec struct {
+	// Replicas is the number of instances to run. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Template is the Ec2Instance every replica is created from. Changing it rolls out new instances.
+	Template Ec2InstanceTemplateSpec `json:"template"`
+
+	// Placements to spread the replicas over, see Ec2InstanceSetSpec.
+	// +optional
+	Placements []Ec2InstancePlacement `json:"placements,omitempty"`
+
+	// Strategy used to replace existing instances with new ones.
+	// +optional
+	Strategy Ec2InstanceDeploymentStrategy `json:"strategy,omitempty"`
+
+	// Paused stops the rollout where it is. Scaling and template changes are picked up once resumed.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// RevisionHistoryLimit is the number of old Ec2InstanceSets kept to allow rollback. Defaults to 10.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// RollbackTo, when set, replaces the template with the one of the given revision.
+	// The controller clears the field once the rollback has been applied.
+	// +optional
+	RollbackTo *Ec2InstanceRollback `json:"rollbackTo,omitempty"`
+}
+
+// Ec2InstanceDeploymentStatus defines the observed state of Ec2InstanceDeployment.
+type Ec2InstanceDeploymentStatus struct {
+	// Replicas is the number of instances owned by all Ec2InstanceSets of the deployment.
+	Replicas int32 `json:"replicas"`
+	// UpdatedReplicas is the number of instances created from the current template.
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
+	// ReadyReplicas is the number of ready instances, old and new.
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// UnavailableReplicas is the number of desired instances that are not ready yet.
+	UnavailableReplicas int32 `json:"unavailableReplicas,omitempty"`
+	// Revision of the current template.
+	Revision int64 `json:"revision,omitempty"`
+	// Selector is the label selector of the instances, in string form, for the scale subresource.
+	Selector string `json:"selector,omitempty"`
+	// ObservedGeneration is the generation of the deployment last processed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the rollout.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types and reasons reported on Ec2InstanceDeployment.
+const (
+	// ConditionProgressing tells whether a rollout is under way, complete or paused.
+	ConditionProgressing = "Progressing"
+	// ConditionAvailable tells whether at least replicas - maxUnavailable instances are ready.
+	ConditionAvailable = "Available"
+
+	ReasonRolloutInProgress  = "RolloutInProgress"
+	ReasonRolloutComplete    = "RolloutComplete"
+	ReasonRolloutPaused      = "RolloutPaused"
+	ReasonRollbackFailed     = "RollbackFailed"
+	ReasonMinimumAvailable   = "MinimumReplicasAvailable"
+	ReasonMinimumUnavailable = "MinimumReplicasUnavailable"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Desired",type="integer",JSONPath=".spec.replicas",description="The desired number of instances"
+// +kubebuilder:printcolumn:name="Up-To-Date",type="integer",JSONPath=".status.updatedReplicas",description="The number of instances running the current template"
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.readyReplicas",description="The number of ready instances"
+// +kubebuilder:printcolumn:name="Revision",type="integer",JSONPath=".status.revision",description="The revision of the current template"
+// +kubebuilder:printcolumn:name="Paused",type="boolean",JSONPath=".spec.paused",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Ec2InstanceDeployment is the Schema for the ec2instancedeployments API.
+// It rolls a fleet of instances from one template to the next through Ec2InstanceSets,
+// like a Deployment does for pods through ReplicaSets.
+type Ec2InstanceDeployment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Ec2InstanceDeploymentSpec   `json:"spec,omitempty"`
+	Status Ec2InstanceDeploymentStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// Ec2InstanceDeploymentList contains a list of Ec2InstanceDeployment.
+type Ec2InstanceDeploymentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Ec2InstanceDeployment `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Ec2InstanceDeployment{}, &Ec2InstanceDeploymentList{})
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// InstanceSetLabel is set on every Ec2Instance created by an Ec2InstanceSet, with the set's name as value.
+// It is the label selector reported in the set's status and used by the scale subresource.
+const InstanceSetLabel = "compute.cloud.com/instance-set"
+
+// Ec2InstanceTemplateSpec describes the Ec2Instances an Ec2InstanceSet creates.
+type Ec2InstanceTemplateSpec struct {
+	// Labels and annotations copied to every created Ec2Instance.
+	// +optional
+	Metadata Ec2InstanceTemplateMetadata `json:"metadata,omitempty"`
+
+	Spec Ec2InstanceSpec `json:"spec"`
+}
+
+// Ec2InstanceTemplateMetadata is the subset of object metadata a template may set.
+type Ec2InstanceTemplateMetadata struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Ec2InstancePlacement is one availability zone / subnet combination instances can be spread over.
+type Ec2InstancePlacement struct {
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+	Subnet           string `json:"subnet,omitempty"`
+}
+
+// Ec2InstanceSetSpec defines the desired state of Ec2InstanceSet.
+type Ec2InstanceSetSpec struct {
+	// Replicas is the number of identical instances to run. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Template is the Ec2Instance every replica is created from.
+	Template Ec2InstanceTemplateSpec `json:"template"`
+
+	// Placements to spread the replicas over. New replicas go to the placement with the fewest
+	// instances, and scale-down removes from the most crowded one. The availability zone and subnet
+	// of a placement replace the ones of the template. When empty, the template is used as-is.
+	// +optional
+	Placements []Ec2InstancePlacement `json:"placements,omitempty"`
+}
+
+// Ec2InstanceSetStatus defines the observed state of Ec2InstanceSet.
+type Ec2InstanceSetStatus struct {
+	// Replicas is the number of Ec2Instances currently owned by the set.
+	Replicas int32 `json:"replicas"`
+	// ReadyReplicas is the number of owned Ec2Instances that are ready.
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// Selector is the label selector of the owned Ec2Instances, in string form, for the scale subresource.
+	Selector string `json:"selector,omitempty"`
+	// ObservedGeneration is the generation of the set last processed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Desired",type="integer",JSONPath=".spec.replicas",description="The desired number of instances"
+// +kubebuilder:printcolumn:name="Current",type="integer",JSONPath=".status.replicas",description="The number of instances owned by the set"
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.readyReplicas",description="The number of ready instances"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Ec2InstanceSet is the Schema for the ec2instancesets API.
+// It keeps a number of identical Ec2Instances running, like a ReplicaSet does for pods.
+type Ec2InstanceSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Ec2InstanceSetSpec   `json:"spec,omitempty"`
+	Status Ec2InstanceSetStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// Ec2InstanceSetList contains a list of Ec2InstanceSet.
+type Ec2InstanceSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Ec2InstanceSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Ec2InstanceSet{}, &Ec2InstanceSetList{})
+}
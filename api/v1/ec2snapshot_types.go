@@ -0,0 +1,133 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FinalSnapshotLabel is set on the Ec2Snapshot taken before an Ec2Instance is terminated,
+// with the instance's name as value.
+const FinalSnapshotLabel = "compute.cloud.com/final-snapshot-of"
+
+// SnapshotSource selects the volumes to snapshot. Exactly one of instanceName and volumeName must be set.
+// +kubebuilder:validation:XValidation:rule="has(self.instanceName) != has(self.volumeName)",message="exactly one of instanceName and volumeName must be set"
+type SnapshotSource struct {
+	// InstanceName is an Ec2Instance of the namespace. All EBS volumes attached to it are snapshotted together,
+	// crash-consistent across volumes.
+	// +optional
+	InstanceName string `json:"instanceName,omitempty"`
+	// VolumeName is an EbsVolume of the namespace.
+	// +optional
+	VolumeName string `json:"volumeName,omitempty"`
+}
+
+// Ec2SnapshotSpec defines the desired state of Ec2Snapshot.
+// A snapshot is taken once, when the Ec2Snapshot is created; the spec cannot be changed afterwards.
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+type Ec2SnapshotSpec struct {
+	Source SnapshotSource `json:"source"`
+
+	// Description of the EBS snapshots.
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Tags applied to the EBS snapshots.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+	// DeletionPolicy decides whether the EBS snapshots are deleted or kept when the Ec2Snapshot is deleted.
+	// Defaults to Delete.
+	// +optional
+	DeletionPolicy VolumeDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// VolumeSnapshotStatus is the snapshot of one volume.
+type VolumeSnapshotStatus struct {
+	// DeviceName the volume was attached as, when it was snapshotted through an instance.
+	// +optional
+	DeviceName string `json:"deviceName,omitempty"`
+	VolumeID   string `json:"volumeId"`
+	SnapshotID string `json:"snapshotId"`
+	// State of the snapshot: pending, completed, error, recoverable or recovering.
+	State string `json:"state,omitempty"`
+	// Progress of the snapshot, e.g. "80%".
+	// +optional
+	Progress string `json:"progress,omitempty"`
+	// Message explains a failed snapshot.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// Ec2SnapshotStatus defines the observed state of Ec2Snapshot.
+type Ec2SnapshotStatus struct {
+	// Region the snapshots were taken in. It is kept so that they can be deleted after the source is gone.
+	Region string `json:"region,omitempty"`
+	// Snapshots of the source volumes.
+	// +optional
+	Snapshots []VolumeSnapshotStatus `json:"snapshots,omitempty"`
+	// CreationTime is the time the snapshots were started.
+	// +optional
+	CreationTime *metav1.Time `json:"creationTime,omitempty"`
+	// ReadyToUse is true once every snapshot has completed, so volumes can be restored from them.
+	ReadyToUse bool `json:"readyToUse,omitempty"`
+
+	// Conditions represent the latest available observations of the snapshot's state.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types and reasons reported on Ec2Snapshot.
+const (
+	// ConditionSnapshotReady tells whether all snapshots have completed.
+	ConditionSnapshotReady = "Ready"
+
+	ReasonSnapshotSourceNotFound = "SourceNotFound"
+	ReasonSnapshotSourceNotReady = "SourceNotReady"
+	ReasonSnapshotPending        = "Pending"
+	ReasonSnapshotCompleted      = "Completed"
+	ReasonSnapshotFailed         = "Failed"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Instance",type="string",JSONPath=".spec.source.instanceName",description="The Ec2Instance snapshotted"
+// +kubebuilder:printcolumn:name="Volume",type="string",JSONPath=".spec.source.volumeName",description="The EbsVolume snapshotted"
+// +kubebuilder:printcolumn:name="ReadyToUse",type="boolean",JSONPath=".status.readyToUse",description="Whether all snapshots have completed"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Ec2Snapshot is the Schema for the ec2snapshots API.
+type Ec2Snapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Ec2SnapshotSpec   `json:"spec,omitempty"`
+	Status Ec2SnapshotStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// Ec2SnapshotList contains a list of Ec2Snapshot.
+type Ec2SnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Ec2Snapshot `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Ec2Snapshot{}, &Ec2SnapshotList{})
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SnapshotScheduleLabel is set on every Ec2Snapshot created by an Ec2SnapshotSchedule, with the schedule's name as value.
+const SnapshotScheduleLabel = "compute.cloud.com/snapshot-schedule"
+
+// SnapshotRetention decides which snapshots of a schedule are pruned. Snapshots still in progress are never pruned.
+type SnapshotRetention struct {
+	// Count is the number of most recent snapshots to keep.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Count *int32 `json:"count,omitempty"`
+	// MaxAge prunes snapshots older than this, e.g. 720h.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// Ec2SnapshotScheduleSpec defines the desired state of Ec2SnapshotSchedule.
+type Ec2SnapshotScheduleSpec struct {
+	// Schedule in cron format, e.g. "0 3 * * *" for every night at 03:00 UTC.
+	// +kubebuilder:validation:MinLength=1
+	Schedule string         `json:"schedule"`
+	Source   SnapshotSource `json:"source"`
+
+	// Retention prunes old snapshots. When unset, every snapshot is kept.
+	// +optional
+	Retention SnapshotRetention `json:"retention,omitempty"`
+	// Tags applied to the EBS snapshots.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+	// DeletionPolicy of the Ec2Snapshots the schedule creates, applied when they are pruned or the schedule is deleted.
+	// Defaults to Delete.
+	// +optional
+	DeletionPolicy VolumeDeletionPolicy `json:"deletionPolicy,omitempty"`
+	// Suspend stops new snapshots from being taken; existing ones are still pruned.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// Ec2SnapshotScheduleStatus defines the observed state of Ec2SnapshotSchedule.
+type Ec2SnapshotScheduleStatus struct {
+	// LastScheduleTime is the time the last snapshot was scheduled for.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// NextScheduleTime is the time the next snapshot is scheduled for.
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+	// LastSuccessfulSnapshot is the name of the most recent Ec2Snapshot that is ready to use.
+	// +optional
+	LastSuccessfulSnapshot string `json:"lastSuccessfulSnapshot,omitempty"`
+	// Snapshots is the number of Ec2Snapshots the schedule currently keeps.
+	Snapshots int32 `json:"snapshots,omitempty"`
+
+	// Conditions represent the latest available observations of the schedule's state.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types and reasons reported on Ec2SnapshotSchedule.
+const (
+	// ConditionScheduleValid tells whether spec.schedule could be parsed.
+	ConditionScheduleValid = "ScheduleValid"
+
+	ReasonScheduleValid   = "Valid"
+	ReasonScheduleInvalid = "InvalidSchedule"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Schedule",type="string",JSONPath=".spec.schedule",description="The cron schedule"
+// +kubebuilder:printcolumn:name="Suspend",type="boolean",JSONPath=".spec.suspend",description="Whether new snapshots are suspended"
+// +kubebuilder:printcolumn:name="Last",type="date",JSONPath=".status.lastScheduleTime",description="The time of the last scheduled snapshot"
+// +kubebuilder:printcolumn:name="Snapshots",type="integer",JSONPath=".status.snapshots",description="The number of kept snapshots"
+
+// Ec2SnapshotSchedule is the Schema for the ec2snapshotschedules API.
+type Ec2SnapshotSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Ec2SnapshotScheduleSpec   `json:"spec,omitempty"`
+	Status Ec2SnapshotScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// Ec2SnapshotScheduleList contains a list of Ec2SnapshotSchedule.
+type Ec2SnapshotScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Ec2SnapshotSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Ec2SnapshotSchedule{}, &Ec2SnapshotScheduleList{})
+}
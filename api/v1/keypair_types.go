@@ -0,0 +1,123 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KeyPairSpec defines the desired state of KeyPair.
+// AWS key pairs cannot be changed once created, so neither can the spec.
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+// +kubebuilder:validation:XValidation:rule="!has(self.publicKeyFrom) || !has(self.secretName)",message="secretName is only used for generated keys, not with publicKeyFrom"
+type KeyPairSpec struct {
+	// +kubebuilder:validation:MinLength=1
+	Region string `json:"region"`
+
+	// KeyName is the name of the key pair in AWS, unique within the region. Defaults to <namespace>-<name>.
+	// +kubebuilder:validation:MaxLength=255
+	// +optional
+	KeyName string `json:"keyName,omitempty"`
+	// KeyType of a generated key pair. Defaults to ed25519.
+	// +kubebuilder:validation:Enum=ed25519;rsa
+	// +kubebuilder:default=ed25519
+	// +optional
+	KeyType string `json:"keyType,omitempty"`
+	// PublicKeyFrom imports the OpenSSH public key stored in a Secret of the namespace, instead of
+	// generating a new key pair. The key is read once, when the key pair is imported.
+	// +optional
+	PublicKeyFrom *SecretKeyReference `json:"publicKeyFrom,omitempty"`
+	// SecretName is the Secret the private key of a generated key pair is stored in, under ssh-privatekey.
+	// The Secret is owned by the KeyPair. Defaults to <name>-ssh-key.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// Tags applied to the key pair.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// SecretKeyReference selects a key of a Secret in the namespace of the referencing object.
+type SecretKeyReference struct {
+	// Name of the Secret.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Key within the Secret. Defaults to ssh-publickey.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// KeyPairStatus defines the observed state of KeyPair.
+type KeyPairStatus struct {
+	// KeyPairID is the ID of the key pair.
+	KeyPairID string `json:"keyPairId,omitempty"`
+	// KeyName is the name of the key pair, to be used as keyPair of Ec2Instances.
+	KeyName string `json:"keyName,omitempty"`
+	// Fingerprint of the key, as computed by AWS.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Region the key pair was created in. It is kept so that the key pair can be deleted.
+	Region string `json:"region,omitempty"`
+	// SecretName is the Secret holding the private key. It is empty for imported keys.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// Conditions represent the latest available observations of the key pair's state.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types and reasons reported on KeyPair.
+const (
+	// ConditionKeyPairReady tells whether the key pair exists in AWS and, for generated keys,
+	// its private key is stored in the Secret.
+	ConditionKeyPairReady = "Ready"
+
+	ReasonKeyPairCreated           = "Created"
+	ReasonKeyPairImported          = "Imported"
+	ReasonKeyPairPublicKeyNotFound = "PublicKeyNotFound"
+	ReasonKeyPairPrivateKeyLost    = "PrivateKeyLost"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="KeyName",type="string",JSONPath=".status.keyName",description="The name of the key pair in AWS"
+// +kubebuilder:printcolumn:name="Secret",type="string",JSONPath=".status.secretName",description="The Secret holding the private key"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status",description="Whether the key pair can be used"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KeyPair is the Schema for the keypairs API.
+type KeyPair struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KeyPairSpec   `json:"spec,omitempty"`
+	Status KeyPairStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KeyPairList contains a list of KeyPair.
+type KeyPairList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KeyPair `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KeyPair{}, &KeyPairList{})
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecurityGroupSpec defines the desired state of SecurityGroup.
+type SecurityGroupSpec struct {
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="region is immutable"
+	Region string `json:"region"`
+	// VpcID is the VPC the group is created in.
+	// +kubebuilder:validation:Pattern=`^vpc-[0-9a-f]+$`
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="vpcId is immutable"
+	VpcID string `json:"vpcId"`
+	// GroupName is the name of the security group, unique within the VPC. Defaults to <namespace>-<name>.
+	// +kubebuilder:validation:MaxLength=255
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="groupName is immutable"
+	// +optional
+	GroupName string `json:"groupName,omitempty"`
+	// Description of the security group.
+	// +kubebuilder:validation:MaxLength=255
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="description is immutable"
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Tags applied to the security group.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="tags are immutable"
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Ingress rules allow inbound traffic. Rules of the group not listed here are revoked.
+	// +optional
+	Ingress []SecurityGroupRule `json:"ingress,omitempty"`
+	// Egress rules allow outbound traffic. Rules of the group not listed here are revoked.
+	// When empty, all outbound traffic is allowed, as for any new security group.
+	// +optional
+	Egress []SecurityGroupRule `json:"egress,omitempty"`
+}
+
+// SecurityGroupRule allows traffic of a protocol and port range from or to the listed peers.
+// Every peer becomes a separate rule of the security group.
+// +kubebuilder:validation:XValidation:rule="!(self.protocol in ['tcp', 'udp']) || (has(self.fromPort) && has(self.toPort))",message="fromPort and toPort are required for tcp and udp"
+// +kubebuilder:validation:XValidation:rule="self.protocol != 'all' || (!has(self.fromPort) && !has(self.toPort))",message="ports cannot be set for protocol all"
+// +kubebuilder:validation:XValidation:rule="has(self.cidrBlocks) || has(self.ipv6CidrBlocks) || has(self.prefixListIds) || has(self.securityGroupRefs)",message="at least one of cidrBlocks, ipv6CidrBlocks, prefixListIds and securityGroupRefs must be set"
+type SecurityGroupRule struct {
+	// Description of the rule.
+	// +kubebuilder:validation:MaxLength=255
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Protocol of the traffic.
+	// +kubebuilder:validation:Enum=tcp;udp;icmp;icmpv6;all
+	Protocol string `json:"protocol"`
+	// FromPort is the start of the port range, or the ICMP type. Defaults to all ICMP types.
+	// +kubebuilder:validation:Minimum=-1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	FromPort *int32 `json:"fromPort,omitempty"`
+	// ToPort is the end of the port range, or the ICMP code. Defaults to all ICMP codes.
+	// +kubebuilder:validation:Minimum=-1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	ToPort *int32 `json:"toPort,omitempty"`
+
+	// CIDRBlocks are IPv4 ranges, e.g. 10.0.0.0/16.
+	// +optional
+	CIDRBlocks []string `json:"cidrBlocks,omitempty"`
+	// IPv6CIDRBlocks are IPv6 ranges, e.g. ::/0.
+	// +optional
+	IPv6CIDRBlocks []string `json:"ipv6CidrBlocks,omitempty"`
+	// PrefixListIDs are managed prefix lists, e.g. pl-6ea54007 for S3.
+	// +optional
+	PrefixListIDs []string `json:"prefixListIds,omitempty"`
+	// SecurityGroupRefs are SecurityGroups of the namespace, including this one, whose members are peers.
+	// +optional
+	SecurityGroupRefs []string `json:"securityGroupRefs,omitempty"`
+}
+
+// SecurityGroupStatus defines the observed state of SecurityGroup.
+type SecurityGroupStatus struct {
+	// GroupID is the ID of the security group.
+	GroupID string `json:"groupId,omitempty"`
+	// Region the group was created in. It is kept so that the group can be deleted.
+	Region string `json:"region,omitempty"`
+	// Rules is the number of rules the group has.
+	Rules int32 `json:"rules,omitempty"`
+	// ObservedGeneration is the generation whose rules were last applied.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the group's state.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types and reasons reported on SecurityGroup.
+const (
+	// ConditionSecurityGroupReady tells whether the group exists with the rules of the spec.
+	ConditionSecurityGroupReady = "Ready"
+
+	ReasonSecurityGroupReady           = "Ready"
+	ReasonSecurityGroupRefNotFound     = "ReferenceNotFound"
+	ReasonSecurityGroupRefNotReady     = "ReferenceNotReady"
+	ReasonSecurityGroupRefInOtherVpc   = "ReferenceInOtherVpc"
+	ReasonSecurityGroupInUse           = "InUse"
+	ReasonSecurityGroupRulesNotApplied = "RulesNotApplied"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="VPC",type="string",JSONPath=".spec.vpcId",description="The VPC of the group"
+// +kubebuilder:printcolumn:name="GroupID",type="string",JSONPath=".status.groupId",description="The security group ID"
+// +kubebuilder:printcolumn:name="Rules",type="integer",JSONPath=".status.rules",description="The number of rules"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status",description="Whether the rules are applied"
+
+// SecurityGroup is the Schema for the securitygroups API.
+type SecurityGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SecurityGroupSpec   `json:"spec,omitempty"`
+	Status SecurityGroupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecurityGroupList contains a list of SecurityGroup.
+type SecurityGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecurityGroup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecurityGroup{}, &SecurityGroupList{})
+}
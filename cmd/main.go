@@ -17,8 +17,10 @@ limitations under the License.
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"os"
+	"path/filepath"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -35,6 +37,7 @@ import (
 
 	computev1 "github.com/shkatara/ec2Operator/api/v1"
 	"github.com/shkatara/ec2Operator/internal/controller"
+	webhookcomputev1 "github.com/shkatara/ec2Operator/internal/webhook/v1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -58,8 +61,20 @@ func init() {
 func main() {
 	var probeAddr string
 	var metricsAddr string
+	var webhookCertPath, webhookCertName, webhookCertKey string
+	var defaultsNamespace string
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metrics endpoint binds to.")
+	flag.StringVar(&webhookCertPath, "webhook-cert-path", "", "The directory that contains the webhook certificate.")
+	flag.StringVar(&webhookCertName, "webhook-cert-name", "tls.crt", "The name of the webhook certificate file.")
+	flag.StringVar(&webhookCertKey, "webhook-cert-key", "tls.key", "The name of the webhook key file.")
+	// The manager's own namespace, from the downward API, unless it runs outside the cluster.
+	podNamespace := os.Getenv("POD_NAMESPACE")
+	if podNamespace == "" {
+		podNamespace = "ec2operator-system"
+	}
+	flag.StringVar(&defaultsNamespace, "defaults-namespace", podNamespace,
+		"The namespace holding the cluster-wide ec2instance-defaults ConfigMap. Defaults to the namespace of the manager.")
 
 	opts := zap.Options{
 		Development: true,
@@ -76,11 +91,34 @@ func main() {
 	// certificate rotation without restarting the manager. If not used, it remains nil.
 	var webhookCertWatcher *certwatcher.CertWatcher
 
+	// webhookTLSOpts holds the TLS customizations for the webhook server. When a certificate directory
+	// is given (e.g. the cert-manager secret mounted by config/default/manager_webhook_patch.yaml), the
+	// server takes its certificate from the watcher instead of the files it would otherwise generate.
+	var webhookTLSOpts []func(*tls.Config)
+	if len(webhookCertPath) > 0 {
+		setupLog.Info("Initializing webhook certificate watcher using provided certificates",
+			"webhook-cert-path", webhookCertPath, "webhook-cert-name", webhookCertName, "webhook-cert-key", webhookCertKey)
+
+		var err error
+		webhookCertWatcher, err = certwatcher.New(
+			filepath.Join(webhookCertPath, webhookCertName),
+			filepath.Join(webhookCertPath, webhookCertKey),
+		)
+		if err != nil {
+			setupLog.Error(err, "Failed to initialize webhook certificate watcher")
+			os.Exit(1)
+		}
+
+		webhookTLSOpts = append(webhookTLSOpts, func(config *tls.Config) {
+			config.GetCertificate = webhookCertWatcher.GetCertificate
+		})
+	}
+
 	// Create a new webhook server. The webhook server is responsible for serving admission webhooks
-	// (such as mutating or validating webhooks) for custom resources. The TLSOpts field can be used
-	// to customize TLS configuration, but is set to nil here for default behavior.
+	// (such as mutating or validating webhooks) for custom resources. The TLSOpts field carries the
+	// certificate watcher configured above, or is empty for default behavior.
 	webhookServer := webhook.NewServer(webhook.Options{
-		TLSOpts: nil,
+		TLSOpts: webhookTLSOpts,
 	})
 
 	// Create a new controller-runtime Manager. The Manager is the main entry point for running controllers,
@@ -102,10 +140,91 @@ func main() {
 	if err = (&controller.Ec2InstanceReconciler{
 		Client: mgr.GetClient(), // Kubernetes client for interacting with API server
 		Scheme: mgr.GetScheme(), // Scheme defines the types the client can work with
+		// Recorder records the remediations of unhealthy instances as events
+		Recorder: mgr.GetEventRecorderFor("ec2instance-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Ec2Instance")
 		os.Exit(1)
 	}
+
+	// Set up the Ec2InstanceSetReconciler, which keeps a number of identical Ec2Instance objects around.
+	if err = (&controller.Ec2InstanceSetReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Ec2InstanceSet")
+		os.Exit(1)
+	}
+	// Set up the Ec2InstanceDeploymentReconciler, which rolls out template changes through Ec2InstanceSets.
+	if err = (&controller.Ec2InstanceDeploymentReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Ec2InstanceDeployment")
+		os.Exit(1)
+	}
+
+	// Set up the EbsVolumeReconciler, which attaches standalone volumes to the Ec2Instances referencing them.
+	if err = (&controller.EbsVolumeReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EbsVolume")
+		os.Exit(1)
+	}
+
+	// Set up the Ec2SnapshotReconciler and the Ec2SnapshotScheduleReconciler, which back up instances and volumes.
+	if err = (&controller.Ec2SnapshotReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Ec2Snapshot")
+		os.Exit(1)
+	}
+	if err = (&controller.Ec2SnapshotScheduleReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Ec2SnapshotSchedule")
+		os.Exit(1)
+	}
+
+	// Set up the Ec2ImageReconciler, which bakes AMIs from Ec2Instances.
+	if err = (&controller.Ec2ImageReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Ec2Image")
+		os.Exit(1)
+	}
+
+	// Set up the SecurityGroupReconciler, which manages security groups and their rules.
+	if err = (&controller.SecurityGroupReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SecurityGroup")
+		os.Exit(1)
+	}
+
+	// Set up the KeyPairReconciler, which generates or imports key pairs and stores private keys in Secrets.
+	if err = (&controller.KeyPairReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KeyPair")
+		os.Exit(1)
+	}
+
+	// Register the Ec2Instance admission webhooks on the webhook server created above.
+	// Set ENABLE_WEBHOOKS=false to skip them, e.g. when running the manager locally with `make run`.
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = webhookcomputev1.SetupEc2InstanceWebhookWithManager(mgr, defaultsNamespace); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Ec2Instance")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	// If a webhook certificate watcher is configured, add it to the manager.
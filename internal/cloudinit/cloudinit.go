@@ -0,0 +1,143 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cloudinit renders the cloudInit block and the userData template of an Ec2Instance,
+// and fits user data into the size EC2 allows. It is shared by the controller and the webhook.
+package cloudinit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	// MaxUserDataSize is the size EC2 allows for the user data of an instance, before base64 encoding.
+	MaxUserDataSize = 16 * 1024
+
+	header = "#cloud-config\n"
+
+	defaultFileSystem   = "ext4"
+	defaultMountOptions = "defaults,nofail"
+	sudoRule            = "ALL=(ALL) NOPASSWD:ALL"
+)
+
+// cloudConfig is the subset of the cloud-config format the cloudInit block renders to.
+type cloudConfig struct {
+	Users          []any       `json:"users,omitempty"`
+	PackageUpgrade bool        `json:"package_upgrade,omitempty"`
+	Packages       []string    `json:"packages,omitempty"`
+	WriteFiles     []writeFile `json:"write_files,omitempty"`
+	FSSetup        []fsSetup   `json:"fs_setup,omitempty"`
+	Mounts         [][]string  `json:"mounts,omitempty"`
+	Runcmd         []string    `json:"runcmd,omitempty"`
+}
+
+type user struct {
+	Name              string   `json:"name"`
+	Groups            string   `json:"groups,omitempty"`
+	Sudo              string   `json:"sudo,omitempty"`
+	Shell             string   `json:"shell,omitempty"`
+	SSHAuthorizedKeys []string `json:"ssh_authorized_keys,omitempty"`
+}
+
+type writeFile struct {
+	Path        string `json:"path"`
+	Content     string `json:"content"`
+	Permissions string `json:"permissions,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+}
+
+type fsSetup struct {
+	Device     string `json:"device"`
+	Filesystem string `json:"filesystem"`
+}
+
+// Render renders the cloudInit block to a #cloud-config document. The same block always renders to the
+// same document. Users are created next to the default user of the AMI, which the connection Secret uses.
+func Render(config *computev1.CloudInitConfig) (string, error) {
+	rendered := cloudConfig{
+		PackageUpgrade: config.PackageUpgrade,
+		Packages:       config.Packages,
+		Runcmd:         config.Runcmd,
+	}
+	if len(config.Users) > 0 {
+		rendered.Users = append(rendered.Users, "default")
+	}
+	for _, u := range config.Users {
+		entry := user{
+			Name:              u.Name,
+			Groups:            strings.Join(u.Groups, ","),
+			Shell:             u.Shell,
+			SSHAuthorizedKeys: u.SSHAuthorizedKeys,
+		}
+		if u.Sudo {
+			entry.Sudo = sudoRule
+		}
+		rendered.Users = append(rendered.Users, entry)
+	}
+	for _, file := range config.WriteFiles {
+		rendered.WriteFiles = append(rendered.WriteFiles, writeFile(file))
+	}
+	for _, mount := range config.Mounts {
+		fileSystem := mount.FileSystem
+		if fileSystem == "" {
+			fileSystem = defaultFileSystem
+		}
+		options := mount.Options
+		if options == "" {
+			options = defaultMountOptions
+		}
+		// fs_setup leaves a device alone that already has a file system, e.g. a volume restored from a snapshot.
+		rendered.FSSetup = append(rendered.FSSetup, fsSetup{Device: mount.DeviceName, Filesystem: fileSystem})
+		rendered.Mounts = append(rendered.Mounts, []string{mount.DeviceName, mount.MountPoint, fileSystem, options, "0", "2"})
+	}
+
+	document, err := yaml.Marshal(rendered)
+	if err != nil {
+		return "", fmt.Errorf("failed to render cloud-config: %w", err)
+	}
+	return header + string(document), nil
+}
+
+// Encode returns user data as it is sent to EC2: as is when it fits into MaxUserDataSize, and gzip compressed
+// otherwise, which cloud-init detects and decompresses. User data that does not fit compressed either is an error.
+func Encode(userData string) ([]byte, error) {
+	if len(userData) <= MaxUserDataSize {
+		return []byte(userData), nil
+	}
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write([]byte(userData)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() > MaxUserDataSize {
+		return nil, fmt.Errorf("user data is %d bytes, %d bytes gzip compressed, more than the %d bytes EC2 allows",
+			len(userData), buf.Len(), MaxUserDataSize)
+	}
+	return buf.Bytes(), nil
+}
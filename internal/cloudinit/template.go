@@ -0,0 +1,69 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"strings"
+	"text/template"
+)
+
+// TemplateData is what a userData template refers to as its data, e.g. {{ .Name }}.
+type TemplateData struct {
+	Name      string
+	Namespace string
+	Region    string
+	Labels    map[string]string
+}
+
+// Resolver looks up the values a userData template refers to, in the namespace of the instance.
+// It returns an error when a value does not exist (yet), which stops the rendering.
+type Resolver interface {
+	PrivateIP(instance string) (string, error)
+	PublicIP(instance string) (string, error)
+	InstanceID(instance string) (string, error)
+	ConfigMapKey(name, key string) (string, error)
+	SecretKey(name, key string) (string, error)
+}
+
+// ParseTemplate parses a userData template. The resolver is only called when the template is executed;
+// the webhook parses templates with a nil resolver to check their syntax.
+func ParseTemplate(userData string, resolver Resolver) (*template.Template, error) {
+	return template.New("userData").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"privateIP":    func(instance string) (string, error) { return resolver.PrivateIP(instance) },
+			"publicIP":     func(instance string) (string, error) { return resolver.PublicIP(instance) },
+			"instanceID":   func(instance string) (string, error) { return resolver.InstanceID(instance) },
+			"configMapKey": func(name, key string) (string, error) { return resolver.ConfigMapKey(name, key) },
+			"secretKey":    func(name, key string) (string, error) { return resolver.SecretKey(name, key) },
+		}).
+		Parse(userData)
+}
+
+// RenderTemplate renders a userData template with the given data, looking up values through the resolver.
+// An error of the resolver is returned wrapped, so that callers can tell it apart from a broken template.
+func RenderTemplate(userData string, data TemplateData, resolver Resolver) (string, error) {
+	tmpl, err := ParseTemplate(userData, resolver)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
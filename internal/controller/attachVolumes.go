@@ -0,0 +1,273 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	// volumeInstanceTag and volumeDeviceTag mark the volumes created for an additional volume of a launched
+	// instance, so that a volume created by a reconcile whose status update failed is found and reused.
+	volumeInstanceTag = "compute.cloud.com/instance-id"
+	volumeDeviceTag   = "compute.cloud.com/device"
+)
+
+// syncAttachments creates and attaches the additional volumes of the spec that are not attached to the instance,
+// and detaches the volumes of earlier statuses whose device was removed from the spec, deleting or retaining them
+// according to their deletion policy. It returns the status of every volume that is not attached yet or still being
+// detached; inProgress is true while there are any.
+// Attached volumes also get their DeleteOnTermination attribute aligned with their deletion policy.
+func syncAttachments(ctx context.Context, api volumeAPI, instance ec2types.Instance, storage computev1.StorageConfig,
+	previous []computev1.VolumeStatus, tags map[string]string) (pending []computev1.VolumeStatus, inProgress bool, err error) {
+	instanceID := aws.ToString(instance.InstanceId)
+	rootDevice := aws.ToString(instance.RootDeviceName)
+	if storage.RootVolume.DeviceName != "" {
+		rootDevice = storage.RootVolume.DeviceName
+	}
+
+	attached := map[string]ec2types.EbsInstanceBlockDevice{}
+	for _, mapping := range instance.BlockDeviceMappings {
+		if mapping.Ebs != nil {
+			attached[aws.ToString(mapping.DeviceName)] = *mapping.Ebs
+		}
+	}
+	known := map[string]computev1.VolumeStatus{}
+	for _, status := range previous {
+		known[status.DeviceName] = status
+	}
+
+	desired := map[string]bool{}
+	for _, volume := range storage.AdditionalVolumes {
+		device := volume.DeviceName
+		if device == "" || device == rootDevice {
+			continue
+		}
+		desired[device] = true
+
+		if mapping, ok := attached[device]; ok {
+			if err := alignDeleteOnTermination(ctx, api, instanceID, device, mapping, volume); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		status, err := attachVolume(ctx, api, instance, volume, known[device], tags)
+		if err != nil {
+			return nil, false, err
+		}
+		pending = append(pending, status)
+		inProgress = true
+	}
+
+	for _, status := range previous {
+		if desired[status.DeviceName] || status.DeviceName == rootDevice || status.VolumeID == "" {
+			continue
+		}
+		status, released, err := releaseVolume(ctx, api, instanceID, status, attached[status.DeviceName])
+		if err != nil {
+			return nil, false, err
+		}
+		if !released {
+			pending = append(pending, status)
+			inProgress = true
+		}
+	}
+	return pending, inProgress, nil
+}
+
+// attachVolume moves an additional volume that is not attached to the instance one step further: it finds or
+// creates the volume in the instance's availability zone, and attaches it once it is available.
+func attachVolume(ctx context.Context, api volumeAPI, instance ec2types.Instance, volume computev1.VolumeConfig,
+	known computev1.VolumeStatus, tags map[string]string) (computev1.VolumeStatus, error) {
+	l := log.FromContext(ctx)
+
+	instanceID := aws.ToString(instance.InstanceId)
+	status := computev1.VolumeStatus{
+		DeviceName:     volume.DeviceName,
+		VolumeID:       known.VolumeID,
+		Size:           volume.Size,
+		Type:           volume.Type,
+		IOPS:           volume.IOPS,
+		Throughput:     volume.Throughput,
+		DeletionPolicy: volumeDeletionPolicy(volume),
+	}
+
+	filters := []ec2types.Filter{{Name: aws.String("volume-id"), Values: []string{known.VolumeID}}}
+	if known.VolumeID == "" {
+		filters = []ec2types.Filter{
+			{Name: aws.String("tag:" + volumeInstanceTag), Values: []string{instanceID}},
+			{Name: aws.String("tag:" + volumeDeviceTag), Values: []string{volume.DeviceName}},
+			{Name: aws.String("status"), Values: []string{string(ec2types.VolumeStateCreating), string(ec2types.VolumeStateAvailable)}},
+		}
+	}
+	described, err := api.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{Filters: filters})
+	if err != nil {
+		return status, fmt.Errorf("failed to describe volume for device %s of instance %s: %w", volume.DeviceName, instanceID, err)
+	}
+
+	if len(described.Volumes) == 0 {
+		input := &ec2.CreateVolumeInput{
+			AvailabilityZone:  instance.Placement.AvailabilityZone,
+			Encrypted:         aws.Bool(volume.Encrypted),
+			KmsKeyId:          optionalString(volume.KMSKeyID),
+			TagSpecifications: volumeTagSpecifications(tags, instanceID, volume.DeviceName),
+		}
+		if volume.Size > 0 {
+			input.Size = aws.Int32(volume.Size)
+		}
+		if volume.Type != "" {
+			input.VolumeType = ec2types.VolumeType(volume.Type)
+		}
+		if volume.IOPS > 0 {
+			input.Iops = aws.Int32(volume.IOPS)
+		}
+		if volume.Throughput > 0 {
+			input.Throughput = aws.Int32(volume.Throughput)
+		}
+		l.Info("Creating volume", "device", volume.DeviceName, "availabilityZone", aws.ToString(input.AvailabilityZone))
+		output, err := api.CreateVolume(ctx, input)
+		if err != nil {
+			return status, fmt.Errorf("failed to create volume for device %s of instance %s: %w", volume.DeviceName, instanceID, err)
+		}
+		status.VolumeID = aws.ToString(output.VolumeId)
+		status.State = string(output.State)
+		return status, nil
+	}
+
+	created := described.Volumes[0]
+	status.VolumeID = aws.ToString(created.VolumeId)
+	status.State = string(created.State)
+	switch created.State {
+	case ec2types.VolumeStateCreating:
+		return status, nil
+	case ec2types.VolumeStateAvailable:
+		l.Info("Attaching volume", "volumeID", status.VolumeID, "device", volume.DeviceName)
+		output, err := api.AttachVolume(ctx, &ec2.AttachVolumeInput{
+			Device:     aws.String(volume.DeviceName),
+			InstanceId: aws.String(instanceID),
+			VolumeId:   created.VolumeId,
+		})
+		if err != nil {
+			// E.g. the device name is taken by a volume attached outside of the operator. Report it and try again later.
+			status.Message = err.Error()
+			return status, nil
+		}
+		status.AttachmentState = string(output.State)
+	default:
+		status.Message = fmt.Sprintf("volume %s is %s and cannot be attached", status.VolumeID, created.State)
+	}
+	return status, nil
+}
+
+// releaseVolume moves a volume removed from the spec one step further: it detaches it from the instance,
+// and once it is detached deletes or retains it. released is true once the volume needs no more attention.
+func releaseVolume(ctx context.Context, api volumeAPI, instanceID string, status computev1.VolumeStatus,
+	mapping ec2types.EbsInstanceBlockDevice) (computev1.VolumeStatus, bool, error) {
+	l := log.FromContext(ctx)
+
+	if aws.ToString(mapping.VolumeId) == status.VolumeID {
+		status.AttachmentState = string(mapping.Status)
+		if mapping.Status != ec2types.AttachmentStatusAttached {
+			return status, false, nil
+		}
+		l.Info("Detaching volume", "volumeID", status.VolumeID, "device", status.DeviceName)
+		output, err := api.DetachVolume(ctx, &ec2.DetachVolumeInput{
+			VolumeId:   aws.String(status.VolumeID),
+			InstanceId: aws.String(instanceID),
+			Device:     aws.String(status.DeviceName),
+		})
+		if err != nil {
+			return status, false, fmt.Errorf("failed to detach volume %s from instance %s: %w", status.VolumeID, instanceID, err)
+		}
+		status.AttachmentState = string(output.State)
+		return status, false, nil
+	}
+
+	described, err := api.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{
+		Filters: []ec2types.Filter{{Name: aws.String("volume-id"), Values: []string{status.VolumeID}}},
+	})
+	if err != nil {
+		return status, false, fmt.Errorf("failed to describe volume %s: %w", status.VolumeID, err)
+	}
+	if len(described.Volumes) == 0 {
+		return status, true, nil
+	}
+	volume := described.Volumes[0]
+	status.State = string(volume.State)
+	if attachment := volumeAttachment(volume, instanceID); attachment != nil {
+		status.AttachmentState = string(attachment.State)
+		return status, false, nil
+	}
+	if volume.State != ec2types.VolumeStateAvailable {
+		// Deleted already, or attached to another instance in the meantime; either way no longer ours.
+		return status, true, nil
+	}
+	if status.DeletionPolicy == computev1.VolumeDeletionPolicyRetain {
+		l.Info("Retaining detached volume", "volumeID", status.VolumeID, "device", status.DeviceName)
+		return status, true, nil
+	}
+	l.Info("Deleting detached volume", "volumeID", status.VolumeID, "device", status.DeviceName)
+	if _, err := api.DeleteVolume(ctx, &ec2.DeleteVolumeInput{VolumeId: volume.VolumeId}); err != nil {
+		return status, false, fmt.Errorf("failed to delete volume %s: %w", status.VolumeID, err)
+	}
+	return status, true, nil
+}
+
+// alignDeleteOnTermination makes an attached volume outlive the instance exactly when its deletion policy is Retain.
+// Volumes attached after launch are kept on termination by default, and the policy of a volume can change.
+func alignDeleteOnTermination(ctx context.Context, api volumeAPI, instanceID, device string, mapping ec2types.EbsInstanceBlockDevice, volume computev1.VolumeConfig) error {
+	deleteOnTermination := volumeDeletionPolicy(volume) == computev1.VolumeDeletionPolicyDelete
+	if aws.ToBool(mapping.DeleteOnTermination) == deleteOnTermination {
+		return nil
+	}
+	log.FromContext(ctx).Info("Updating DeleteOnTermination", "device", device, "deleteOnTermination", deleteOnTermination)
+	_, err := api.ModifyInstanceAttribute(ctx, &ec2.ModifyInstanceAttributeInput{
+		InstanceId: aws.String(instanceID),
+		BlockDeviceMappings: []ec2types.InstanceBlockDeviceMappingSpecification{{
+			DeviceName: aws.String(device),
+			Ebs: &ec2types.EbsInstanceBlockDeviceSpecification{
+				VolumeId:            mapping.VolumeId,
+				DeleteOnTermination: aws.Bool(deleteOnTermination),
+			},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update DeleteOnTermination of device %s of instance %s: %w", device, instanceID, err)
+	}
+	return nil
+}
+
+// volumeTagSpecifications tags a volume created for a launched instance with the spec tags and its owner.
+func volumeTagSpecifications(tags map[string]string, instanceID, device string) []ec2types.TagSpecification {
+	ec2Tags := []ec2types.Tag{
+		{Key: aws.String(volumeInstanceTag), Value: aws.String(instanceID)},
+		{Key: aws.String(volumeDeviceTag), Value: aws.String(device)},
+	}
+	for key, value := range tags {
+		ec2Tags = append(ec2Tags, ec2types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return []ec2types.TagSpecification{{ResourceType: ec2types.ResourceTypeVolume, Tags: ec2Tags}}
+}
+
+// volumeAttachment returns the attachment of the volume to the instance, if any.
+func volumeAttachment(volume ec2types.Volume, instanceID string) *ec2types.VolumeAttachment {
+	for i := range volume.Attachments {
+		if aws.ToString(volume.Attachments[i].InstanceId) == instanceID {
+			return &volume.Attachments[i]
+		}
+	}
+	return nil
+}
+
+func volumeDeletionPolicy(volume computev1.VolumeConfig) computev1.VolumeDeletionPolicy {
+	if volume.DeletionPolicy == "" {
+		return computev1.VolumeDeletionPolicyDelete
+	}
+	return volume.DeletionPolicy
+}
@@ -5,12 +5,36 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	elbv2 "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
 )
 
 func awsClient(region string) *ec2.Client {
+	return ec2.NewFromConfig(awsConfig(region))
+}
+
+// ssmClient returns an SSM client for the region, used to read AMI IDs from SSM parameters.
+func ssmClient(region string) *ssm.Client {
+	return ssm.NewFromConfig(awsConfig(region))
+}
+
+// route53Client returns a Route 53 client. Route 53 is a global service; the region only selects the partition.
+func route53Client(region string) *route53.Client {
+	return route53.NewFromConfig(awsConfig(region))
+}
+
+// elbv2Client returns an ELBv2 client for the region, used to register instances in target groups.
+func elbv2Client(region string) *elbv2.Client {
+	return elbv2.NewFromConfig(awsConfig(region))
+}
+
+func awsConfig(region string) aws.Config {
 	// read env variable for namespace
 	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
 	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
@@ -20,5 +44,14 @@ func awsClient(region string) *ec2.Client {
 		fmt.Println("Error loading AWS config:", err)
 		os.Exit(1)
 	}
-	return ec2.NewFromConfig(cfg)
+	return cfg
+}
+
+// instanceRegion returns the region a launched instance lives in. The region recorded in the status
+// wins over the spec, because the spec alone does not tell when the region came from a class.
+func instanceRegion(ec2Instance *computev1.Ec2Instance) string {
+	if ec2Instance.Status.Region != "" {
+		return ec2Instance.Status.Region
+	}
+	return ec2Instance.Spec.Region
 }
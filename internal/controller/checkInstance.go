@@ -14,7 +14,7 @@ import (
 func checkEC2InstanceExists(ctx context.Context, instanceID string, ec2Instance *computev1.Ec2Instance) (bool, *ec2types.Instance, error) {
 	// create the client for ec2 instance
 	fmt.Println("Checking instance ", instanceID)
-	ec2Client := awsClient(ec2Instance.Spec.Region)
+	ec2Client := awsClient(instanceRegion(ec2Instance))
 
 	input := &ec2.DescribeInstancesInput{
 		InstanceIds: []string{instanceID},
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// Keys of the connection Secret of an instance.
+const (
+	connectionSecretPublicIP      = "publicIP"
+	connectionSecretPrivateIP     = "privateIP"
+	connectionSecretPublicDNS     = "publicDNS"
+	connectionSecretPrivateDNS    = "privateDNS"
+	connectionSecretSSHUser       = "sshUser"
+	connectionSecretSSHPort       = "sshPort"
+	connectionSecretSSHPrivateKey = "sshPrivateKey"
+
+	defaultSSHUser = "ec2-user"
+	defaultSSHPort = 22
+)
+
+// connectionDetails are the contents of the connection Secret, taken from the status of the instance.
+func connectionDetails(ec2Instance *computev1.Ec2Instance) map[string][]byte {
+	ref := ec2Instance.Spec.WriteConnectionSecretToRef
+	user := ref.SSHUser
+	if user == "" {
+		user = defaultSSHUser
+	}
+	port := ref.SSHPort
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	return map[string][]byte{
+		connectionSecretPublicIP:   []byte(ec2Instance.Status.PublicIP),
+		connectionSecretPrivateIP:  []byte(ec2Instance.Status.PrivateIP),
+		connectionSecretPublicDNS:  []byte(ec2Instance.Status.PublicDNS),
+		connectionSecretPrivateDNS: []byte(ec2Instance.Status.PrivateDNS),
+		connectionSecretSSHUser:    []byte(user),
+		connectionSecretSSHPort:    []byte(strconv.Itoa(int(port))),
+	}
+}
+
+// writeConnectionSecret creates or updates the connection Secret of spec.writeConnectionSecretToRef, and
+// deletes the one left behind by an earlier name of the Secret. It is called on every reconcile of a launched
+// instance, which includes the ones triggered by its own status updates, so the Secret follows the addresses
+// of the instance.
+func (r *Ec2InstanceReconciler) writeConnectionSecret(ctx context.Context, ec2Instance *computev1.Ec2Instance) error {
+	ref := ec2Instance.Spec.WriteConnectionSecretToRef
+	name := ""
+	if ref != nil {
+		name = ref.Name
+	}
+	if err := r.deleteStaleConnectionSecrets(ctx, ec2Instance, name); err != nil {
+		return err
+	}
+	if ref == nil {
+		return nil
+	}
+
+	data := connectionDetails(ec2Instance)
+	if ref.IncludePrivateKey {
+		privateKey, err := r.keyPairPrivateKey(ctx, ec2Instance)
+		if err != nil {
+			return err
+		}
+		if privateKey != nil {
+			data[connectionSecretSSHPrivateKey] = privateKey
+		}
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: ec2Instance.Namespace}}
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		if secret.ResourceVersion != "" && !metav1.IsControlledBy(secret, ec2Instance) {
+			return fmt.Errorf("secret %s already exists and is not owned by the Ec2Instance", ref.Name)
+		}
+		secret.Data = data
+		return controllerutil.SetControllerReference(ec2Instance, secret, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write connection secret %s: %w", ref.Name, err)
+	}
+	if result != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("Wrote connection secret", "secret", ref.Name, "operation", result)
+	}
+	return nil
+}
+
+// deleteStaleConnectionSecrets deletes the Secrets owned by the instance not named name. The connection Secret
+// is the only Secret an instance owns, and one of an earlier name may still hold the private key.
+func (r *Ec2InstanceReconciler) deleteStaleConnectionSecrets(ctx context.Context, ec2Instance *computev1.Ec2Instance, name string) error {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.InNamespace(ec2Instance.Namespace)); err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Name == name || !metav1.IsControlledBy(secret, ec2Instance) {
+			continue
+		}
+		log.FromContext(ctx).Info("Deleting stale connection secret", "secret", secret.Name)
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete connection secret %s: %w", secret.Name, err)
+		}
+	}
+	return nil
+}
+
+// keyPairPrivateKey returns the private key of the KeyPair the instance references, or nil when the
+// KeyPair has no private key, as for imported keys, or the instance does not reference one.
+func (r *Ec2InstanceReconciler) keyPairPrivateKey(ctx context.Context, ec2Instance *computev1.Ec2Instance) ([]byte, error) {
+	l := log.FromContext(ctx)
+	if ec2Instance.Spec.KeyPairRef == "" {
+		return nil, nil
+	}
+
+	keyPair := &computev1.KeyPair{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: ec2Instance.Namespace, Name: ec2Instance.Spec.KeyPairRef}, keyPair); err != nil {
+		if errors.IsNotFound(err) {
+			l.Info("Not writing private key, the KeyPair was deleted", "keyPair", ec2Instance.Spec.KeyPairRef)
+			return nil, nil
+		}
+		return nil, err
+	}
+	if keyPair.Status.SecretName == "" {
+		l.Info("Not writing private key, the KeyPair was imported", "keyPair", keyPair.Name)
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: keyPair.Namespace, Name: keyPair.Status.SecretName}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			l.Info("Not writing private key, its Secret was deleted", "keyPair", keyPair.Name, "secret", keyPair.Status.SecretName)
+			return nil, nil
+		}
+		return nil, err
+	}
+	return secret.Data[corev1.SSHAuthPrivateKey], nil
+}
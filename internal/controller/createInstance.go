@@ -2,13 +2,16 @@ package controller
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	computev1 "github.com/shkatara/ec2Operator/api/v1"
+	"github.com/shkatara/ec2Operator/internal/cloudinit"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -23,15 +26,28 @@ func createEc2Instance(ec2Instance *computev1.Ec2Instance) (createdInstanceInfo
 	// create the client for ec2 instance
 	ec2Client := awsClient(ec2Instance.Spec.Region)
 
+	// gzip compressed if it does not fit into 16 KB otherwise
+	userData, err := cloudinit.Encode(ec2Instance.Spec.UserData)
+	if err != nil {
+		return nil, err
+	}
+
 	// create the input for the run instances
 	runInput := &ec2.RunInstancesInput{
-		ImageId:      aws.String(ec2Instance.Spec.AMIId),
-		InstanceType: ec2types.InstanceType(ec2Instance.Spec.InstanceType),
-		KeyName:      aws.String(ec2Instance.Spec.KeyPair),
-		SubnetId:     aws.String(ec2Instance.Spec.Subnet),
-		MinCount:     aws.Int32(1),
-		MaxCount:     aws.Int32(1),
-		//SecurityGroupIds: []string{ec2Instance.Spec.SecurityGroups[0]},
+		ImageId:             aws.String(ec2Instance.Spec.AMIId),
+		InstanceType:        ec2types.InstanceType(ec2Instance.Spec.InstanceType),
+		KeyName:             optionalString(ec2Instance.Spec.KeyPair),
+		SubnetId:            optionalString(ec2Instance.Spec.Subnet),
+		MinCount:            aws.Int32(1),
+		MaxCount:            aws.Int32(1),
+		SecurityGroupIds:    ec2Instance.Spec.SecurityGroups,
+		BlockDeviceMappings: blockDeviceMappings(ec2Instance.Spec.Storage),
+		TagSpecifications:   tagSpecifications(ec2Instance.Spec.Tags),
+		IamInstanceProfile:  iamInstanceProfile(ec2Instance.Spec.IAMInstanceProfile),
+		UserData:            userDataInput(userData),
+	}
+	if ec2Instance.Spec.AvailabilityZone != "" {
+		runInput.Placement = &ec2types.Placement{AvailabilityZone: aws.String(ec2Instance.Spec.AvailabilityZone)}
 	}
 
 	l.Info("=== CALLING AWS RunInstances API ===")
@@ -125,6 +141,84 @@ func createEc2Instance(ec2Instance *computev1.Ec2Instance) (createdInstanceInfo
 	return createdInstanceInfo, nil
 }
 
+// blockDeviceMappings translates the storage config into RunInstances block device mappings.
+// The root volume has no device name in the spec, so it is only mapped when it has one;
+// otherwise the AMI's root device is used with its default size and type.
+func blockDeviceMappings(storage computev1.StorageConfig) []ec2types.BlockDeviceMapping {
+	var mappings []ec2types.BlockDeviceMapping
+	volumes := append([]computev1.VolumeConfig{storage.RootVolume}, storage.AdditionalVolumes...)
+	for i, volume := range volumes {
+		if volume.DeviceName == "" {
+			continue
+		}
+		// Additional volumes with the Retain policy outlive the instance, the root volume never does.
+		ebs := &ec2types.EbsBlockDevice{
+			DeleteOnTermination: aws.Bool(i == 0 || volumeDeletionPolicy(volume) == computev1.VolumeDeletionPolicyDelete),
+			Encrypted:           aws.Bool(volume.Encrypted),
+		}
+		if volume.Size > 0 {
+			ebs.VolumeSize = aws.Int32(volume.Size)
+		}
+		if volume.Type != "" {
+			ebs.VolumeType = ec2types.VolumeType(volume.Type)
+		}
+		if volume.IOPS > 0 {
+			ebs.Iops = aws.Int32(volume.IOPS)
+		}
+		if volume.Throughput > 0 {
+			ebs.Throughput = aws.Int32(volume.Throughput)
+		}
+		ebs.KmsKeyId = optionalString(volume.KMSKeyID)
+		mappings = append(mappings, ec2types.BlockDeviceMapping{
+			DeviceName: aws.String(volume.DeviceName),
+			Ebs:        ebs,
+		})
+	}
+	return mappings
+}
+
+// tagSpecifications applies the spec tags to both the instance and the volumes launched with it.
+func tagSpecifications(tags map[string]string) []ec2types.TagSpecification {
+	if len(tags) == 0 {
+		return nil
+	}
+	ec2Tags := make([]ec2types.Tag, 0, len(tags))
+	for key, value := range tags {
+		ec2Tags = append(ec2Tags, ec2types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return []ec2types.TagSpecification{
+		{ResourceType: ec2types.ResourceTypeInstance, Tags: ec2Tags},
+		{ResourceType: ec2types.ResourceTypeVolume, Tags: ec2Tags},
+	}
+}
+
+// iamInstanceProfile accepts either the name or the ARN of an instance profile.
+func iamInstanceProfile(profile string) *ec2types.IamInstanceProfileSpecification {
+	if profile == "" {
+		return nil
+	}
+	if strings.HasPrefix(profile, "arn:") {
+		return &ec2types.IamInstanceProfileSpecification{Arn: aws.String(profile)}
+	}
+	return &ec2types.IamInstanceProfileSpecification{Name: aws.String(profile)}
+}
+
+// userDataInput is the user data as RunInstances expects it, base64 encoded, or nil without user data.
+func userDataInput(userData []byte) *string {
+	if len(userData) == 0 {
+		return nil
+	}
+	return aws.String(base64.StdEncoding.EncodeToString(userData))
+}
+
+// optionalString returns nil for an empty string so that optional fields are left out of AWS requests.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
 // derefString is a helper function to safely dereference *string
 func derefString(s *string) string {
 	if s != nil {
@@ -15,7 +15,7 @@ func deleteEc2Instance(ctx context.Context, ec2Instance *computev1.Ec2Instance)
 	l.Info("Deleting EC2 instance", "instanceID", ec2Instance.Status.InstanceID)
 
 	// create the client for ec2 instance
-	ec2Client := awsClient(ec2Instance.Spec.Region)
+	ec2Client := awsClient(instanceRegion(ec2Instance))
 
 	// Terminate the instance
 	terminateResult, err := ec2Client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
@@ -57,3 +57,27 @@ func deleteEc2Instance(ctx context.Context, ec2Instance *computev1.Ec2Instance)
 	l.Info("EC2 instance successfully terminated", "instanceID", ec2Instance.Status.InstanceID)
 	return true, nil
 }
+
+// replaceInstance terminates a launched instance once its connections have drained from its target groups,
+// and clears its status, so that the next reconcile launches it again. replaced is false while connections
+// are still draining; the caller writes the status either way.
+func replaceInstance(ctx context.Context, ec2Instance *computev1.Ec2Instance) (replaced bool, err error) {
+	drained, err := drainTargets(ctx, elbv2Client(instanceRegion(ec2Instance)), ec2Instance)
+	if err != nil || !drained {
+		return false, err
+	}
+	if _, err := deleteEc2Instance(ctx, ec2Instance); err != nil {
+		return false, err
+	}
+	ec2Instance.Status.InstanceID = ""
+	ec2Instance.Status.State = ""
+	ec2Instance.Status.PublicIP = ""
+	ec2Instance.Status.PrivateIP = ""
+	ec2Instance.Status.PublicDNS = ""
+	ec2Instance.Status.PrivateDNS = ""
+	ec2Instance.Status.IPv6Address = ""
+	ec2Instance.Status.LaunchTime = nil
+	ec2Instance.Status.Volumes = nil
+	ec2Instance.Status.TargetGroups = nil
+	return true, nil
+}
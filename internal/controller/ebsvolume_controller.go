@@ -0,0 +1,552 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	ebsVolumeFinalizer = "ebsvolume.compute.cloud.com"
+	// attachedToField is the field index used to find the EbsVolumes held by an Ec2Instance.
+	attachedToField = ".status.attachedTo"
+	// ebsVolumeUIDTag marks the AWS volume created for an EbsVolume, so that a volume created by a reconcile
+	// whose status update failed is found and reused.
+	ebsVolumeUIDTag = "compute.cloud.com/ebsvolume-uid"
+)
+
+// EbsVolumeReconciler reconciles a EbsVolume object.
+// It creates the AWS volume and attaches it to the Ec2Instance referencing it in spec.volumes. When the instance
+// is replaced, the volume is detached from the old instance before it is attached to the new one, and while any
+// instance references the volume, deleting the EbsVolume is held back by its finalizer.
+// It relies on the spec.volumes index registered by the Ec2InstanceReconciler.
+type EbsVolumeReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ebsvolumes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ebsvolumes/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ebsvolumes/finalizers,verbs=update
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instances,verbs=get;list;watch
+
+// Reconcile creates the volume, applies size and performance changes, and attaches it to the Ec2Instance holding it.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.2/pkg/reconcile
+func (r *EbsVolumeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	ebsVolume := &computev1.EbsVolume{}
+	if err := r.Get(ctx, req.NamespacedName, ebsVolume); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	holder, err := r.volumeHolder(ctx, ebsVolume)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	api := awsClient(ebsVolume.Spec.Region)
+
+	if !ebsVolume.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, api, ebsVolume, holder)
+	}
+
+	if controllerutil.AddFinalizer(ebsVolume, ebsVolumeFinalizer) {
+		if err := r.Update(ctx, ebsVolume); err != nil {
+			l.Error(err, "Failed to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	original := ebsVolume.Status.DeepCopy()
+	inProgress, err := syncEbsVolume(ctx, api, ebsVolume, holder)
+	if err != nil {
+		l.Error(err, "Failed to reconcile EBS volume")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+	ebsVolume.Status.ObservedGeneration = ebsVolume.Generation
+
+	result := ctrl.Result{}
+	if inProgress {
+		result.RequeueAfter = volumeModificationPollInterval
+	}
+	if equality.Semantic.DeepEqual(original, &ebsVolume.Status) {
+		return result, nil
+	}
+	if err := r.Status().Update(ctx, ebsVolume); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// finalize detaches the volume and deletes or retains it according to its deletion policy,
+// but not before the last Ec2Instance referencing the volume stopped doing so.
+func (r *EbsVolumeReconciler) finalize(ctx context.Context, api volumeAPI, ebsVolume *computev1.EbsVolume, holder *computev1.Ec2Instance) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(ebsVolume, ebsVolumeFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if holder != nil {
+		message := fmt.Sprintf("EbsVolume is referenced by Ec2Instance %s and is deleted once no instance references it", holder.Name)
+		l.Info("Not deleting EBS volume", "reason", message)
+		changed := meta.SetStatusCondition(&ebsVolume.Status.Conditions, metav1.Condition{
+			Type:               computev1.ConditionVolumeReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             computev1.ReasonVolumeInUse,
+			Message:            message,
+			ObservedGeneration: ebsVolume.Generation,
+		})
+		if changed {
+			if err := r.Status().Update(ctx, ebsVolume); err != nil {
+				l.Error(err, "Failed to update status")
+				return ctrl.Result{}, err
+			}
+		}
+		// Kubernetes will not retry - the watch on Ec2Instances brings the volume back once the reference is gone
+		return ctrl.Result{}, nil
+	}
+
+	if ebsVolume.Status.VolumeID != "" {
+		released, err := releaseEbsVolume(ctx, api, ebsVolume)
+		if err != nil {
+			l.Error(err, "Failed to release EBS volume")
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+		if !released {
+			if err := r.Status().Update(ctx, ebsVolume); err != nil {
+				l.Error(err, "Failed to update status")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: volumeModificationPollInterval}, nil
+		}
+	}
+
+	controllerutil.RemoveFinalizer(ebsVolume, ebsVolumeFinalizer)
+	if err := r.Update(ctx, ebsVolume); err != nil {
+		l.Error(err, "Failed to remove finalizer")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// volumeHolder returns the Ec2Instance the volume should be attached to, or nil when no instance references it.
+func (r *EbsVolumeReconciler) volumeHolder(ctx context.Context, ebsVolume *computev1.EbsVolume) (*computev1.Ec2Instance, error) {
+	instances := &computev1.Ec2InstanceList{}
+	if err := r.List(ctx, instances, client.InNamespace(ebsVolume.Namespace),
+		client.MatchingFields{volumeNamesField: ebsVolume.Name}); err != nil {
+		return nil, err
+	}
+	return pickVolumeHolder(instances.Items, ebsVolume.Status.AttachedTo), nil
+}
+
+// pickVolumeHolder keeps the volume with the instance holding it as long as that instance references it and is
+// not being deleted; otherwise the oldest referencing instance gets it. Instances being deleted never hold a volume,
+// so that it is detached and free for their replacement.
+func pickVolumeHolder(instances []computev1.Ec2Instance, attachedTo string) *computev1.Ec2Instance {
+	var holder *computev1.Ec2Instance
+	for i := range instances {
+		instance := &instances[i]
+		if !instance.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if instance.Name == attachedTo {
+			return instance
+		}
+		if holder == nil || instance.CreationTimestamp.Before(&holder.CreationTimestamp) ||
+			(instance.CreationTimestamp.Equal(&holder.CreationTimestamp) && instance.Name < holder.Name) {
+			holder = instance
+		}
+	}
+	return holder
+}
+
+// syncEbsVolume creates the volume if needed, applies size and performance changes, and moves its attachment one
+// step towards the holder: a volume attached elsewhere is detached first, and only attached to the holder's instance
+// once it is available. The status of the EbsVolume is updated in place; inProgress is true while anything is
+// still changing that is not followed through a watch.
+func syncEbsVolume(ctx context.Context, api volumeAPI, ebsVolume *computev1.EbsVolume, holder *computev1.Ec2Instance) (inProgress bool, err error) {
+	l := log.FromContext(ctx)
+	status := &ebsVolume.Status
+
+	volume, found, err := describeEbsVolume(ctx, api, ebsVolume)
+	if err != nil {
+		return false, err
+	}
+	if !found && status.VolumeID != "" {
+		status.State, status.InstanceID, status.DeviceName, status.AttachmentState = "", "", "", ""
+		setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeReady, metav1.ConditionFalse, computev1.ReasonVolumeLost,
+			fmt.Sprintf("Volume %s no longer exists", status.VolumeID))
+		return false, nil
+	}
+	if !found {
+		l.Info("Creating EBS volume", "availabilityZone", ebsVolume.Spec.AvailabilityZone)
+		output, err := api.CreateVolume(ctx, createEbsVolumeInput(ebsVolume))
+		if err != nil {
+			return false, fmt.Errorf("failed to create volume: %w", err)
+		}
+		status.VolumeID = aws.ToString(output.VolumeId)
+		status.State = string(output.State)
+		setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeReady, metav1.ConditionFalse, computev1.ReasonVolumeCreating,
+			fmt.Sprintf("Creating volume %s", status.VolumeID))
+		return true, nil
+	}
+
+	status.VolumeID = aws.ToString(volume.VolumeId)
+	status.State = string(volume.State)
+	status.Size = aws.ToInt32(volume.Size)
+	status.Type = string(volume.VolumeType)
+	status.IOPS = aws.ToInt32(volume.Iops)
+	status.Throughput = aws.ToInt32(volume.Throughput)
+	if volume.State == ec2types.VolumeStateCreating {
+		return true, nil
+	}
+	setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeReady, metav1.ConditionTrue, computev1.ReasonVolumeReady,
+		fmt.Sprintf("Volume %s is %s", status.VolumeID, volume.State))
+
+	modifying, err := modifyEbsVolume(ctx, api, ebsVolume)
+	if err != nil {
+		return false, err
+	}
+	attaching, err := syncEbsVolumeAttachment(ctx, api, ebsVolume, volume, holder)
+	return modifying || attaching, err
+}
+
+// modifyEbsVolume starts a ModifyVolume when the spec asks for a larger size or other performance settings than the
+// volume has. inProgress is true while a modification is running.
+func modifyEbsVolume(ctx context.Context, api volumeAPI, ebsVolume *computev1.EbsVolume) (inProgress bool, err error) {
+	status := &ebsVolume.Status
+	desired := computev1.VolumeConfig{
+		Size:       ebsVolume.Spec.Size,
+		Type:       ebsVolume.Spec.Type,
+		IOPS:       ebsVolume.Spec.IOPS,
+		Throughput: ebsVolume.Spec.Throughput,
+	}
+	input := volumeModification(desired, computev1.VolumeStatus{Size: status.Size, Type: status.Type, IOPS: status.IOPS, Throughput: status.Throughput})
+	if input == nil {
+		return false, nil
+	}
+
+	// Filtering instead of passing the volume ID, because AWS returns an error for volumes never modified.
+	modifications, err := api.DescribeVolumesModifications(ctx, &ec2.DescribeVolumesModificationsInput{
+		Filters: []ec2types.Filter{{Name: aws.String("volume-id"), Values: []string{status.VolumeID}}},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to describe modifications of volume %s: %w", status.VolumeID, err)
+	}
+	var latest *ec2types.VolumeModification
+	for i, modification := range modifications.VolumesModifications {
+		if latest == nil || aws.ToTime(modification.StartTime).After(aws.ToTime(latest.StartTime)) {
+			latest = &modifications.VolumesModifications[i]
+		}
+	}
+	if latest != nil {
+		switch latest.ModificationState {
+		case ec2types.VolumeModificationStateModifying, ec2types.VolumeModificationStateOptimizing:
+			return true, nil
+		case ec2types.VolumeModificationStateFailed:
+			if sameModification(input, *latest) {
+				// Retrying the same modification would fail the same way; the spec has to change first.
+				return false, nil
+			}
+		}
+	}
+
+	input.VolumeId = aws.String(status.VolumeID)
+	log.FromContext(ctx).Info("Modifying EBS volume", "volumeID", status.VolumeID)
+	if _, err := api.ModifyVolume(ctx, input); err != nil {
+		return false, fmt.Errorf("failed to modify volume %s: %w", status.VolumeID, err)
+	}
+	return true, nil
+}
+
+// syncEbsVolumeAttachment moves the attachment of the volume one step towards the holder's instance.
+func syncEbsVolumeAttachment(ctx context.Context, api volumeAPI, ebsVolume *computev1.EbsVolume, volume ec2types.Volume,
+	holder *computev1.Ec2Instance) (inProgress bool, err error) {
+	l := log.FromContext(ctx)
+	status := &ebsVolume.Status
+
+	wantInstanceID, wantDevice := "", ""
+	status.AttachedTo = ""
+	if holder != nil {
+		status.AttachedTo = holder.Name
+		wantInstanceID = holder.Status.InstanceID
+		for _, attachment := range holder.Spec.Volumes {
+			if attachment.Name == ebsVolume.Name {
+				wantDevice = attachment.DeviceName
+			}
+		}
+	}
+
+	var current *ec2types.VolumeAttachment
+	if len(volume.Attachments) > 0 {
+		current = &volume.Attachments[0]
+	}
+
+	switch {
+	case current != nil && aws.ToString(current.InstanceId) != wantInstanceID:
+		// A replacement instance only gets the volume once it has been detached from the previous one.
+		status.InstanceID = aws.ToString(current.InstanceId)
+		status.DeviceName = aws.ToString(current.Device)
+		status.AttachmentState = string(current.State)
+		message := fmt.Sprintf("Detaching from instance %s", status.InstanceID)
+		if current.State == ec2types.VolumeAttachmentStateAttached {
+			l.Info("Detaching EBS volume", "volumeID", status.VolumeID, "instanceID", status.InstanceID)
+			output, err := api.DetachVolume(ctx, &ec2.DetachVolumeInput{
+				VolumeId:   volume.VolumeId,
+				InstanceId: current.InstanceId,
+			})
+			if err != nil {
+				// E.g. the instance is shutting down, which detaches the volume anyway.
+				message = fmt.Sprintf("Failed to detach from instance %s: %v", status.InstanceID, err)
+			} else {
+				status.AttachmentState = string(output.State)
+			}
+		}
+		setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeAttached, metav1.ConditionFalse, computev1.ReasonVolumeDetaching, message)
+		return true, nil
+
+	case current != nil:
+		status.InstanceID = wantInstanceID
+		status.DeviceName = aws.ToString(current.Device)
+		status.AttachmentState = string(current.State)
+		if current.State != ec2types.VolumeAttachmentStateAttached {
+			setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeAttached, metav1.ConditionFalse, computev1.ReasonVolumeAttaching,
+				fmt.Sprintf("Attaching to instance %s of Ec2Instance %s", wantInstanceID, holder.Name))
+			return true, nil
+		}
+		setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeAttached, metav1.ConditionTrue, computev1.ReasonVolumeAttached,
+			fmt.Sprintf("Attached to instance %s of Ec2Instance %s as %s", wantInstanceID, holder.Name, status.DeviceName))
+		return false, nil
+	}
+
+	status.InstanceID, status.DeviceName, status.AttachmentState = "", "", ""
+	switch {
+	case holder == nil:
+		setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeAttached, metav1.ConditionFalse, computev1.ReasonVolumeNotReferenced,
+			"No Ec2Instance references the volume")
+		return false, nil
+	case wantInstanceID == "":
+		// The watch on Ec2Instances brings the volume back once the instance has been launched.
+		setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeAttached, metav1.ConditionFalse, computev1.ReasonWaitingForInstance,
+			fmt.Sprintf("Waiting for Ec2Instance %s to be launched", holder.Name))
+		return false, nil
+	case volume.State != ec2types.VolumeStateAvailable:
+		return true, nil
+	}
+
+	instance, err := describeInstance(ctx, api, wantInstanceID)
+	if err != nil {
+		return false, err
+	}
+	if zone := aws.ToString(instance.Placement.AvailabilityZone); zone != ebsVolume.Spec.AvailabilityZone {
+		setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeAttached, metav1.ConditionFalse, computev1.ReasonAvailabilityZoneDiffer,
+			fmt.Sprintf("Instance %s of Ec2Instance %s runs in %s, the volume is in %s", wantInstanceID, holder.Name, zone, ebsVolume.Spec.AvailabilityZone))
+		return false, nil
+	}
+	if instance.State != nil && instance.State.Name != ec2types.InstanceStateNameRunning && instance.State.Name != ec2types.InstanceStateNameStopped {
+		setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeAttached, metav1.ConditionFalse, computev1.ReasonWaitingForInstance,
+			fmt.Sprintf("Waiting for instance %s of Ec2Instance %s, which is %s", wantInstanceID, holder.Name, instance.State.Name))
+		return true, nil
+	}
+
+	l.Info("Attaching EBS volume", "volumeID", status.VolumeID, "instanceID", wantInstanceID, "device", wantDevice)
+	output, err := api.AttachVolume(ctx, &ec2.AttachVolumeInput{
+		Device:     aws.String(wantDevice),
+		InstanceId: aws.String(wantInstanceID),
+		VolumeId:   volume.VolumeId,
+	})
+	if err != nil {
+		// E.g. the device name is taken on the instance. Report it and try again later.
+		setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeAttached, metav1.ConditionFalse, computev1.ReasonAttachFailed,
+			fmt.Sprintf("Failed to attach to instance %s of Ec2Instance %s: %v", wantInstanceID, holder.Name, err))
+		return true, nil
+	}
+	status.InstanceID = wantInstanceID
+	status.DeviceName = wantDevice
+	status.AttachmentState = string(output.State)
+	setEbsVolumeCondition(ebsVolume, computev1.ConditionVolumeAttached, metav1.ConditionFalse, computev1.ReasonVolumeAttaching,
+		fmt.Sprintf("Attaching to instance %s of Ec2Instance %s", wantInstanceID, holder.Name))
+	return true, nil
+}
+
+// releaseEbsVolume detaches a volume whose EbsVolume is being deleted, and once it is detached deletes or retains it.
+// released is true once the volume needs no more attention.
+func releaseEbsVolume(ctx context.Context, api volumeAPI, ebsVolume *computev1.EbsVolume) (released bool, err error) {
+	l := log.FromContext(ctx)
+	status := &ebsVolume.Status
+
+	volume, found, err := describeEbsVolume(ctx, api, ebsVolume)
+	if err != nil || !found {
+		return err == nil, err
+	}
+	status.State = string(volume.State)
+	if len(volume.Attachments) > 0 {
+		attachment := volume.Attachments[0]
+		status.AttachmentState = string(attachment.State)
+		if attachment.State == ec2types.VolumeAttachmentStateAttached {
+			l.Info("Detaching EBS volume", "volumeID", status.VolumeID, "instanceID", aws.ToString(attachment.InstanceId))
+			if _, err := api.DetachVolume(ctx, &ec2.DetachVolumeInput{VolumeId: volume.VolumeId, InstanceId: attachment.InstanceId}); err != nil {
+				return false, fmt.Errorf("failed to detach volume %s: %w", status.VolumeID, err)
+			}
+		}
+		return false, nil
+	}
+	switch volume.State {
+	case ec2types.VolumeStateDeleting, ec2types.VolumeStateDeleted:
+		return true, nil
+	case ec2types.VolumeStateAvailable, ec2types.VolumeStateError:
+	default:
+		return false, nil
+	}
+
+	if ebsVolume.Spec.DeletionPolicy == computev1.VolumeDeletionPolicyRetain {
+		l.Info("Retaining EBS volume", "volumeID", status.VolumeID)
+		return true, nil
+	}
+	l.Info("Deleting EBS volume", "volumeID", status.VolumeID)
+	if _, err := api.DeleteVolume(ctx, &ec2.DeleteVolumeInput{VolumeId: volume.VolumeId}); err != nil {
+		return false, fmt.Errorf("failed to delete volume %s: %w", status.VolumeID, err)
+	}
+	return true, nil
+}
+
+// describeEbsVolume looks up the AWS volume of an EbsVolume by its recorded ID, or by its UID tag before one was recorded.
+func describeEbsVolume(ctx context.Context, api volumeAPI, ebsVolume *computev1.EbsVolume) (ec2types.Volume, bool, error) {
+	filter := ec2types.Filter{Name: aws.String("volume-id"), Values: []string{ebsVolume.Status.VolumeID}}
+	if ebsVolume.Status.VolumeID == "" {
+		filter = ec2types.Filter{Name: aws.String("tag:" + ebsVolumeUIDTag), Values: []string{string(ebsVolume.UID)}}
+	}
+	described, err := api.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{Filters: []ec2types.Filter{filter}})
+	if err != nil {
+		return ec2types.Volume{}, false, fmt.Errorf("failed to describe volume of EbsVolume %s: %w", ebsVolume.Name, err)
+	}
+	for _, volume := range described.Volumes {
+		if volume.State != ec2types.VolumeStateDeleted {
+			return volume, true, nil
+		}
+	}
+	return ec2types.Volume{}, false, nil
+}
+
+func createEbsVolumeInput(ebsVolume *computev1.EbsVolume) *ec2.CreateVolumeInput {
+	spec := ebsVolume.Spec
+	tags := []ec2types.Tag{
+		{Key: aws.String(ebsVolumeUIDTag), Value: aws.String(string(ebsVolume.UID))},
+		{Key: aws.String("Name"), Value: aws.String(ebsVolume.Namespace + "/" + ebsVolume.Name)},
+	}
+	for key, value := range spec.Tags {
+		tags = append(tags, ec2types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	input := &ec2.CreateVolumeInput{
+		AvailabilityZone:  aws.String(spec.AvailabilityZone),
+		Encrypted:         aws.Bool(spec.Encrypted),
+		KmsKeyId:          optionalString(spec.KMSKeyID),
+		SnapshotId:        optionalString(spec.SnapshotID),
+		TagSpecifications: []ec2types.TagSpecification{{ResourceType: ec2types.ResourceTypeVolume, Tags: tags}},
+	}
+	if spec.Size > 0 {
+		input.Size = aws.Int32(spec.Size)
+	}
+	if spec.Type != "" {
+		input.VolumeType = ec2types.VolumeType(spec.Type)
+	}
+	if spec.IOPS > 0 {
+		input.Iops = aws.Int32(spec.IOPS)
+	}
+	if spec.Throughput > 0 {
+		input.Throughput = aws.Int32(spec.Throughput)
+	}
+	return input
+}
+
+func setEbsVolumeCondition(ebsVolume *computev1.EbsVolume, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&ebsVolume.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: ebsVolume.Generation,
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Besides EbsVolumes it watches Ec2Instances, so that a volume follows the instances referencing
+// or holding it: launches, replacements, and references being added or removed.
+func (r *EbsVolumeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Index EbsVolumes by their holder, so that an instance dropping its reference still reaches the volume.
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &computev1.EbsVolume{}, attachedToField,
+		func(obj client.Object) []string {
+			attachedTo := obj.(*computev1.EbsVolume).Status.AttachedTo
+			if attachedTo == "" {
+				return nil
+			}
+			return []string{attachedTo}
+		}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&computev1.EbsVolume{}).
+		Watches(&computev1.Ec2Instance{}, handler.EnqueueRequestsFromMapFunc(r.volumesForInstance)).
+		Named("ebsvolume").
+		Complete(r)
+}
+
+// volumesForInstance maps an Ec2Instance to reconcile requests for the EbsVolumes it references or holds.
+func (r *EbsVolumeReconciler) volumesForInstance(ctx context.Context, obj client.Object) []reconcile.Request {
+	instance := obj.(*computev1.Ec2Instance)
+	names := map[string]bool{}
+	for _, attachment := range instance.Spec.Volumes {
+		names[attachment.Name] = true
+	}
+	held := &computev1.EbsVolumeList{}
+	if err := r.List(ctx, held, client.InNamespace(instance.Namespace), client.MatchingFields{attachedToField: instance.Name}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list EbsVolumes for Ec2Instance", "instance", instance.Name)
+	}
+	for _, volume := range held.Items {
+		names[volume.Name] = true
+	}
+
+	requests := make([]reconcile.Request, 0, len(names))
+	for name := range names {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Namespace: instance.Namespace, Name: name}})
+	}
+	return requests
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+var _ = Describe("EbsVolume Controller", func() {
+	ctx := context.Background()
+
+	var (
+		api       *fakeVolumes
+		ebsVolume *computev1.EbsVolume
+		holder    *computev1.Ec2Instance
+	)
+
+	BeforeEach(func() {
+		api = newFakeVolumes()
+		ebsVolume = &computev1.EbsVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default", UID: "1234"},
+			Spec: computev1.EbsVolumeSpec{
+				Region:           "us-east-1",
+				AvailabilityZone: "us-east-1a",
+				Size:             200,
+				Type:             "gp3",
+				SnapshotID:       "snap-0123",
+			},
+		}
+		holder = &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Spec:       computev1.Ec2InstanceSpec{Volumes: []computev1.EbsVolumeAttachment{{Name: "data", DeviceName: "/dev/sdh"}}},
+			Status:     computev1.Ec2InstanceStatus{InstanceID: "i-0123"},
+		}
+	})
+
+	condition := func(conditionType string) *metav1.Condition {
+		return meta.FindStatusCondition(ebsVolume.Status.Conditions, conditionType)
+	}
+
+	It("should create the volume and attach it to the holder's instance once available", func() {
+		inProgress, err := syncEbsVolume(ctx, api, ebsVolume, holder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(api.created).To(HaveLen(1))
+		Expect(aws.ToString(api.created[0].AvailabilityZone)).To(Equal("us-east-1a"))
+		Expect(aws.ToString(api.created[0].SnapshotId)).To(Equal("snap-0123"))
+		Expect(ebsVolume.Status.VolumeID).To(Equal("vol-new"))
+		Expect(condition(computev1.ConditionVolumeReady).Reason).To(Equal(computev1.ReasonVolumeCreating))
+
+		inProgress, err = syncEbsVolume(ctx, api, ebsVolume, holder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(api.devices).To(HaveKeyWithValue("/dev/sdh", "vol-new"))
+		Expect(ebsVolume.Status.AttachedTo).To(Equal("db"))
+		Expect(ebsVolume.Status.AttachmentState).To(Equal("attaching"))
+
+		inProgress, err = syncEbsVolume(ctx, api, ebsVolume, holder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(api.created).To(HaveLen(1))
+		Expect(ebsVolume.Status.InstanceID).To(Equal("i-0123"))
+		Expect(condition(computev1.ConditionVolumeAttached).Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	It("should wait for the holder to be launched", func() {
+		holder.Status.InstanceID = ""
+		_, _ = syncEbsVolume(ctx, api, ebsVolume, holder)
+
+		inProgress, err := syncEbsVolume(ctx, api, ebsVolume, holder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inProgress).To(BeFalse())
+		Expect(api.devices).NotTo(HaveKey("/dev/sdh"))
+		Expect(condition(computev1.ConditionVolumeAttached).Reason).To(Equal(computev1.ReasonWaitingForInstance))
+	})
+
+	It("should not attach the volume to an instance in another availability zone", func() {
+		ebsVolume.Spec.AvailabilityZone = "us-east-1b"
+		_, _ = syncEbsVolume(ctx, api, ebsVolume, holder)
+
+		_, err := syncEbsVolume(ctx, api, ebsVolume, holder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api.devices).NotTo(HaveKey("/dev/sdh"))
+		Expect(condition(computev1.ConditionVolumeAttached).Reason).To(Equal(computev1.ReasonAvailabilityZoneDiffer))
+	})
+
+	It("should detach the volume from a replaced instance before attaching it to the new one", func() {
+		ebsVolume.Status.VolumeID = "vol-data"
+		holder.Status.InstanceID = "i-0456"
+
+		inProgress, err := syncEbsVolume(ctx, api, ebsVolume, holder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(ebsVolume.Status.InstanceID).To(Equal("i-0123"))
+		Expect(condition(computev1.ConditionVolumeAttached).Reason).To(Equal(computev1.ReasonVolumeDetaching))
+		Expect(api.volumes["vol-data"].Attachments).To(BeEmpty())
+
+		inProgress, err = syncEbsVolume(ctx, api, ebsVolume, holder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(ebsVolume.Status.InstanceID).To(Equal("i-0456"))
+		Expect(aws.ToString(api.volumes["vol-data"].Attachments[0].InstanceId)).To(Equal("i-0456"))
+	})
+
+	It("should grow the volume", func() {
+		ebsVolume.Status.VolumeID = "vol-data"
+		holder.Status.InstanceID = "i-0123"
+		holder.Spec.Volumes[0].DeviceName = "/dev/sdf"
+
+		inProgress, err := syncEbsVolume(ctx, api, ebsVolume, holder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inProgress).To(BeTrue())
+		Expect(api.modified).To(HaveLen(1))
+		Expect(aws.ToInt32(api.modified[0].Size)).To(BeEquivalentTo(200))
+
+		By("waiting for the running modification instead of starting a new one")
+		_, err = syncEbsVolume(ctx, api, ebsVolume, holder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api.modified).To(HaveLen(1))
+	})
+
+	It("should report a modification AWS rejects", func() {
+		ebsVolume.Status.VolumeID = "vol-data"
+		api.modifyErr = errors.New("VolumeModificationRateExceeded")
+
+		_, err := syncEbsVolume(ctx, api, ebsVolume, holder)
+		Expect(err).To(MatchError(ContainSubstring("VolumeModificationRateExceeded")))
+	})
+
+	Context("When the EbsVolume is deleted", func() {
+		BeforeEach(func() {
+			ebsVolume.Status.VolumeID = "vol-data"
+		})
+
+		It("should detach and then delete the volume", func() {
+			released, err := releaseEbsVolume(ctx, api, ebsVolume)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(released).To(BeFalse())
+			Expect(api.deleted).To(BeEmpty())
+
+			released, err = releaseEbsVolume(ctx, api, ebsVolume)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(released).To(BeTrue())
+			Expect(api.deleted).To(ConsistOf("vol-data"))
+		})
+
+		It("should keep the volume with the Retain policy", func() {
+			ebsVolume.Spec.DeletionPolicy = computev1.VolumeDeletionPolicyRetain
+			_, _ = releaseEbsVolume(ctx, api, ebsVolume)
+
+			released, err := releaseEbsVolume(ctx, api, ebsVolume)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(released).To(BeTrue())
+			Expect(api.deleted).To(BeEmpty())
+		})
+	})
+
+	It("should keep the volume with its holder and otherwise give it to the oldest instance", func() {
+		now := time.Now()
+		instance := func(name string, age time.Duration) computev1.Ec2Instance {
+			return computev1.Ec2Instance{ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(now.Add(-age))}}
+		}
+		deleting := instance("old", 3*time.Hour)
+		deleting.DeletionTimestamp = &metav1.Time{Time: now}
+		instances := []computev1.Ec2Instance{instance("new", time.Minute), deleting, instance("older", time.Hour)}
+
+		Expect(pickVolumeHolder(instances, "new").Name).To(Equal("new"))
+		Expect(pickVolumeHolder(instances, "").Name).To(Equal("older"))
+		Expect(pickVolumeHolder(instances, "old").Name).To(Equal("older"))
+		Expect(pickVolumeHolder(instances[1:2], "old")).To(BeNil())
+	})
+})
+
+var _ = Describe("EbsVolume resolution", func() {
+	ctx := context.Background()
+
+	var instance *computev1.Ec2Instance
+
+	newVolume := func(name, zone string) *computev1.EbsVolume {
+		return &computev1.EbsVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       computev1.EbsVolumeSpec{Region: "eu-central-1", AvailabilityZone: zone, Size: 10},
+		}
+	}
+
+	BeforeEach(func() {
+		for _, volume := range []*computev1.EbsVolume{newVolume("data-a", "eu-central-1a"), newVolume("logs-a", "eu-central-1a"), newVolume("data-b", "eu-central-1b")} {
+			Expect(k8sClient.Create(ctx, volume)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, volume)).To(Succeed())
+			})
+		}
+		instance = &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Spec:       computev1.Ec2InstanceSpec{Region: "eu-central-1"},
+		}
+	})
+
+	It("should launch the instance in the zone of its volumes", func() {
+		instance.Spec.Volumes = []computev1.EbsVolumeAttachment{{Name: "data-a", DeviceName: "/dev/sdh"}, {Name: "logs-a", DeviceName: "/dev/sdi"}}
+		zone, err := resolveVolumeZone(ctx, k8sClient, instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zone).To(Equal("eu-central-1a"))
+	})
+
+	It("should reject volumes in different zones or outside the zone of the spec", func() {
+		var unresolved *resolutionError
+
+		instance.Spec.Volumes = []computev1.EbsVolumeAttachment{{Name: "data-a", DeviceName: "/dev/sdh"}, {Name: "data-b", DeviceName: "/dev/sdi"}}
+		_, err := resolveVolumeZone(ctx, k8sClient, instance)
+		Expect(errors.As(err, &unresolved)).To(BeTrue())
+		Expect(unresolved.reason).To(Equal(computev1.ReasonVolumeZoneConflict))
+
+		instance.Spec.AvailabilityZone = "eu-central-1a"
+		instance.Spec.Volumes = instance.Spec.Volumes[1:]
+		_, err = resolveVolumeZone(ctx, k8sClient, instance)
+		Expect(err).To(MatchError(ContainSubstring("spec.availabilityZone is eu-central-1a")))
+	})
+
+	It("should report missing volumes", func() {
+		var unresolved *resolutionError
+
+		instance.Spec.Volumes = []computev1.EbsVolumeAttachment{{Name: "missing", DeviceName: "/dev/sdh"}}
+		_, err := resolveVolumeZone(ctx, k8sClient, instance)
+		Expect(errors.As(err, &unresolved)).To(BeTrue())
+		Expect(unresolved.reason).To(Equal(computev1.ReasonVolumeNotFound))
+	})
+})
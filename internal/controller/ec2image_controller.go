@@ -0,0 +1,269 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	ec2ImageFinalizer = "ec2image.compute.cloud.com"
+	// imageUIDTag marks the AMI created for an Ec2Image, so that an AMI created by a reconcile
+	// whose status update failed is found and reused instead of being created twice.
+	imageUIDTag = "compute.cloud.com/image-uid"
+	// imagePollInterval is how often pending AMIs, and instances that are not launched yet, are checked.
+	imagePollInterval = time.Minute
+)
+
+// imageAPI is the part of the EC2 client used to create and deregister AMIs.
+type imageAPI interface {
+	DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error)
+	CreateImage(ctx context.Context, params *ec2.CreateImageInput, optFns ...func(*ec2.Options)) (*ec2.CreateImageOutput, error)
+	DeregisterImage(ctx context.Context, params *ec2.DeregisterImageInput, optFns ...func(*ec2.Options)) (*ec2.DeregisterImageOutput, error)
+}
+
+// Ec2ImageReconciler reconciles a Ec2Image object.
+// It creates the AMI from the referenced instance once, follows it until it is available,
+// and deregisters it together with its snapshots on deletion unless its deletion policy is Retain.
+type Ec2ImageReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2images,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2images/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2images/finalizers,verbs=update
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instances,verbs=get;list;watch
+
+// Reconcile creates the AMI of a new Ec2Image and reports its state until it is available.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.2/pkg/reconcile
+func (r *Ec2ImageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	image := &computev1.Ec2Image{}
+	if err := r.Get(ctx, req.NamespacedName, image); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !image.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(image, ec2ImageFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		if image.Spec.DeletionPolicy != computev1.VolumeDeletionPolicyRetain && image.Status.ImageID != "" {
+			if err := deregisterImage(ctx, awsClient(image.Status.Region), image.Status.ImageID); err != nil {
+				l.Error(err, "Failed to deregister AMI")
+				// Kubernetes will retry with backoff
+				return ctrl.Result{}, err
+			}
+		}
+		controllerutil.RemoveFinalizer(image, ec2ImageFinalizer)
+		if err := r.Update(ctx, image); err != nil {
+			l.Error(err, "Failed to remove finalizer")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if controllerutil.AddFinalizer(image, ec2ImageFinalizer) {
+		if err := r.Update(ctx, image); err != nil {
+			l.Error(err, "Failed to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if image.Status.ImageID == "" {
+		target, err := resolveSnapshotSource(ctx, r.Client, image.Namespace, computev1.SnapshotSource{InstanceName: image.Spec.InstanceName})
+		var sourceErr *snapshotSourceError
+		switch {
+		case stderrors.As(err, &sourceErr):
+			l.Info("Not creating image yet", "reason", sourceErr.reason, "message", sourceErr.message)
+			setImageReady(image, metav1.ConditionFalse, sourceErr.reason, sourceErr.message)
+			if err := r.Status().Update(ctx, image); err != nil {
+				l.Error(err, "Failed to update status")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: imagePollInterval}, nil
+		case err != nil:
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+
+		imageID, err := createImage(ctx, awsClient(target.region), image, target.instanceID)
+		if err != nil {
+			l.Error(err, "Failed to create AMI")
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+		image.Status.ImageID = imageID
+		image.Status.ImageName = imageName(image)
+		image.Status.Region = target.region
+		image.Status.CreationTime = &metav1.Time{Time: time.Now()}
+	}
+
+	if err := refreshImage(ctx, awsClient(image.Status.Region), &image.Status); err != nil {
+		l.Error(err, "Failed to describe AMI")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	result := ctrl.Result{}
+	switch ec2types.ImageState(image.Status.State) {
+	case ec2types.ImageStateAvailable:
+		setImageReady(image, metav1.ConditionTrue, computev1.ReasonImageAvailable, fmt.Sprintf("AMI %s is available", image.Status.ImageID))
+	case ec2types.ImageStatePending:
+		setImageReady(image, metav1.ConditionFalse, computev1.ReasonImagePending, fmt.Sprintf("AMI %s is being created", image.Status.ImageID))
+		result.RequeueAfter = imagePollInterval
+	default:
+		// A failed AMI is not created again: delete the Ec2Image and create a new one to retry.
+		setImageReady(image, metav1.ConditionFalse, computev1.ReasonImageFailed,
+			fmt.Sprintf("AMI %s is %s", image.Status.ImageID, image.Status.State))
+	}
+
+	if err := r.Status().Update(ctx, image); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// imageName is the name of the AMI, defaulting to one derived from the Ec2Image.
+func imageName(image *computev1.Ec2Image) string {
+	if image.Spec.ImageName != "" {
+		return image.Spec.ImageName
+	}
+	uid := string(image.UID)
+	return fmt.Sprintf("%s-%s-%s", image.Namespace, image.Name, uid[:min(8, len(uid))])
+}
+
+// createImage creates the AMI of an instance, tagging the AMI and its snapshots.
+// An AMI already created for the Ec2Image is returned instead.
+func createImage(ctx context.Context, api imageAPI, image *computev1.Ec2Image, instanceID string) (string, error) {
+	existing, err := api.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Owners:  []string{"self"},
+		Filters: []ec2types.Filter{{Name: aws.String("tag:" + imageUIDTag), Values: []string{string(image.UID)}}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe images: %w", err)
+	}
+	if len(existing.Images) > 0 {
+		return aws.ToString(existing.Images[0].ImageId), nil
+	}
+
+	tags := []ec2types.Tag{{Key: aws.String(imageUIDTag), Value: aws.String(string(image.UID))}}
+	for key, value := range image.Spec.Tags {
+		tags = append(tags, ec2types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	input := &ec2.CreateImageInput{
+		InstanceId: aws.String(instanceID),
+		Name:       aws.String(imageName(image)),
+		NoReboot:   aws.Bool(image.Spec.NoReboot),
+		TagSpecifications: []ec2types.TagSpecification{
+			{ResourceType: ec2types.ResourceTypeImage, Tags: tags},
+			{ResourceType: ec2types.ResourceTypeSnapshot, Tags: tags},
+		},
+	}
+	if image.Spec.Description != "" {
+		input.Description = aws.String(image.Spec.Description)
+	}
+	log.FromContext(ctx).Info("Creating AMI", "instanceID", instanceID, "name", aws.ToString(input.Name), "noReboot", image.Spec.NoReboot)
+	output, err := api.CreateImage(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create image of instance %s: %w", instanceID, err)
+	}
+	return aws.ToString(output.ImageId), nil
+}
+
+// refreshImage updates the state and snapshots of the AMI in the status.
+func refreshImage(ctx context.Context, api imageAPI, status *computev1.Ec2ImageStatus) error {
+	// Filtering instead of passing the image ID, because AWS returns an error for deregistered images.
+	described, err := api.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Filters: []ec2types.Filter{{Name: aws.String("image-id"), Values: []string{status.ImageID}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe image %s: %w", status.ImageID, err)
+	}
+	if len(described.Images) == 0 {
+		status.State = string(ec2types.ImageStateDeregistered)
+		return nil
+	}
+	ami := described.Images[0]
+	status.State = string(ami.State)
+	status.SnapshotIDs = nil
+	for _, mapping := range ami.BlockDeviceMappings {
+		if mapping.Ebs != nil && mapping.Ebs.SnapshotId != nil {
+			status.SnapshotIDs = append(status.SnapshotIDs, aws.ToString(mapping.Ebs.SnapshotId))
+		}
+	}
+	return nil
+}
+
+// deregisterImage deregisters the AMI if it still exists, deleting the snapshots backing it.
+func deregisterImage(ctx context.Context, api imageAPI, imageID string) error {
+	described, err := api.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Filters: []ec2types.Filter{{Name: aws.String("image-id"), Values: []string{imageID}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe image %s: %w", imageID, err)
+	}
+	if len(described.Images) == 0 {
+		return nil
+	}
+	log.FromContext(ctx).Info("Deregistering AMI", "imageID", imageID)
+	if _, err := api.DeregisterImage(ctx, &ec2.DeregisterImageInput{
+		ImageId:                   aws.String(imageID),
+		DeleteAssociatedSnapshots: aws.Bool(true),
+	}); err != nil {
+		return fmt.Errorf("failed to deregister image %s: %w", imageID, err)
+	}
+	return nil
+}
+
+func setImageReady(image *computev1.Ec2Image, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&image.Status.Conditions, metav1.Condition{
+		Type:               computev1.ConditionImageReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: image.Generation,
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *Ec2ImageReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&computev1.Ec2Image{}).
+		Named("ec2image").
+		Complete(r)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// fakeAMIs creates AMIs that are pending until available is called.
+type fakeAMIs struct {
+	images       map[string]ec2types.Image
+	created      []*ec2.CreateImageInput
+	deregistered []*ec2.DeregisterImageInput
+}
+
+func (f *fakeAMIs) DescribeImages(_ context.Context, params *ec2.DescribeImagesInput, _ ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	output := &ec2.DescribeImagesOutput{}
+	for _, image := range f.images {
+		for _, filter := range params.Filters {
+			for _, value := range filter.Values {
+				if aws.ToString(image.ImageId) == value || imageTagged(image, aws.ToString(filter.Name), value) {
+					output.Images = append(output.Images, image)
+				}
+			}
+		}
+	}
+	return output, nil
+}
+
+func imageTagged(image ec2types.Image, filter, value string) bool {
+	for _, tag := range image.Tags {
+		if "tag:"+aws.ToString(tag.Key) == filter && aws.ToString(tag.Value) == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeAMIs) CreateImage(_ context.Context, params *ec2.CreateImageInput, _ ...func(*ec2.Options)) (*ec2.CreateImageOutput, error) {
+	f.created = append(f.created, params)
+	image := ec2types.Image{
+		ImageId: aws.String("ami-0baked"),
+		Name:    params.Name,
+		State:   ec2types.ImageStatePending,
+		Tags:    params.TagSpecifications[0].Tags,
+	}
+	f.images[aws.ToString(image.ImageId)] = image
+	return &ec2.CreateImageOutput{ImageId: image.ImageId}, nil
+}
+
+func (f *fakeAMIs) DeregisterImage(_ context.Context, params *ec2.DeregisterImageInput, _ ...func(*ec2.Options)) (*ec2.DeregisterImageOutput, error) {
+	f.deregistered = append(f.deregistered, params)
+	delete(f.images, aws.ToString(params.ImageId))
+	return &ec2.DeregisterImageOutput{}, nil
+}
+
+// available completes the AMI, backed by a snapshot of the root volume.
+func (f *fakeAMIs) available(imageID string) {
+	image := f.images[imageID]
+	image.State = ec2types.ImageStateAvailable
+	image.BlockDeviceMappings = []ec2types.BlockDeviceMapping{
+		{DeviceName: aws.String("/dev/xvda"), Ebs: &ec2types.EbsBlockDevice{SnapshotId: aws.String("snap-root")}},
+		{DeviceName: aws.String("/dev/sdb"), VirtualName: aws.String("ephemeral0")},
+	}
+	f.images[imageID] = image
+}
+
+var _ = Describe("Ec2Image Controller", func() {
+	ctx := context.Background()
+
+	var (
+		api   *fakeAMIs
+		image *computev1.Ec2Image
+	)
+
+	BeforeEach(func() {
+		api = &fakeAMIs{images: map[string]ec2types.Image{}}
+		image = &computev1.Ec2Image{
+			ObjectMeta: metav1.ObjectMeta{Name: "golden-web", Namespace: "default", UID: "0f3a9c12-5b7e-4d4e-9a57-1f2d3c4b5a69"},
+			Spec: computev1.Ec2ImageSpec{
+				InstanceName: "web",
+				NoReboot:     true,
+				Tags:         map[string]string{"role": "web"},
+			},
+		}
+	})
+
+	It("should create the AMI once, tagging the image and its snapshots", func() {
+		imageID, err := createImage(ctx, api, image, "i-0123")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imageID).To(Equal("ami-0baked"))
+		Expect(api.created).To(HaveLen(1))
+		Expect(aws.ToString(api.created[0].Name)).To(Equal("default-golden-web-0f3a9c12"))
+		Expect(aws.ToBool(api.created[0].NoReboot)).To(BeTrue())
+		Expect(api.created[0].TagSpecifications).To(HaveLen(2))
+		Expect(api.created[0].TagSpecifications[1].ResourceType).To(Equal(ec2types.ResourceTypeSnapshot))
+
+		imageID, err = createImage(ctx, api, image, "i-0123")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imageID).To(Equal("ami-0baked"))
+		Expect(api.created).To(HaveLen(1))
+	})
+
+	It("should follow the AMI until it is available and record its snapshots", func() {
+		_, err := createImage(ctx, api, image, "i-0123")
+		Expect(err).NotTo(HaveOccurred())
+		status := &computev1.Ec2ImageStatus{ImageID: "ami-0baked"}
+
+		Expect(refreshImage(ctx, api, status)).To(Succeed())
+		Expect(status.State).To(Equal("pending"))
+		Expect(status.SnapshotIDs).To(BeEmpty())
+
+		api.available("ami-0baked")
+		Expect(refreshImage(ctx, api, status)).To(Succeed())
+		Expect(status.State).To(Equal("available"))
+		Expect(status.SnapshotIDs).To(Equal([]string{"snap-root"}))
+	})
+
+	It("should report an AMI deregistered outside of the operator", func() {
+		status := &computev1.Ec2ImageStatus{ImageID: "ami-0gone"}
+		Expect(refreshImage(ctx, api, status)).To(Succeed())
+		Expect(status.State).To(Equal("deregistered"))
+	})
+
+	It("should deregister the AMI together with its snapshots, once", func() {
+		_, err := createImage(ctx, api, image, "i-0123")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(deregisterImage(ctx, api, "ami-0baked")).To(Succeed())
+		Expect(deregisterImage(ctx, api, "ami-0baked")).To(Succeed())
+		Expect(api.deregistered).To(HaveLen(1))
+		Expect(aws.ToBool(api.deregistered[0].DeleteAssociatedSnapshots)).To(BeTrue())
+	})
+})
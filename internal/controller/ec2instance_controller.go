@@ -18,16 +18,28 @@ package controller
 
 import (
 	"context"
+	stderrors "errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	computev1 "github.com/shkatara/ec2Operator/api/v1"
+	"github.com/shkatara/ec2Operator/internal/cloudinit"
 )
 
 // Ec2InstanceReconciler is a struct that implements the logic for reconciling Ec2Instance custom resources.
@@ -36,8 +48,9 @@ import (
 // This struct is used to reconcile the Ec2Instance custom resource.
 
 type Ec2InstanceReconciler struct {
-	client.Client                 // Used to perform CRUD operations on Kubernetes resources.
-	Scheme        *runtime.Scheme // Used to map Go types to Kubernetes GroupVersionKinds and vice versa.
+	client.Client                      // Used to perform CRUD operations on Kubernetes resources.
+	Scheme        *runtime.Scheme      // Used to map Go types to Kubernetes GroupVersionKinds and vice versa.
+	Recorder      record.EventRecorder // Used to record the remediations of unhealthy instances as events.
 }
 
 /* Following are "Markers": These comments are special markers that the controller-gen tool (part of the Kubebuilder framework) understands.
@@ -47,6 +60,18 @@ This file defines all the permissions your controller needs to interact with Kub
 // +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instances,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instances/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instances/finalizers,verbs=update
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instanceclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ebsvolumes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2snapshots,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2images,verbs=get;list;watch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=securitygroups,verbs=get;list;watch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=keypairs,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -84,11 +109,69 @@ func (r *Ec2InstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	//check if deletionTimestamp is not zero
 	if !ec2Instance.DeletionTimestamp.IsZero() {
 		l.Info("Has deletionTimestamp, Instance is being deleted")
-		_, err := deleteEc2Instance(ctx, ec2Instance)
-		if err != nil {
-			l.Error(err, "Failed to delete EC2 instance")
-			// Kubernetes will retry with backoff
-			return ctrl.Result{Requeue: true}, err
+		// Instances depending on this one go first, unless the deletion is forced.
+		if ec2Instance.Annotations[computev1.ForceDeleteAnnotation] != "true" {
+			dependents, err := dependentInstances(ctx, r.Client, ec2Instance)
+			if err != nil {
+				l.Error(err, "Failed to list dependent instances")
+				// Kubernetes will retry with backoff
+				return ctrl.Result{}, err
+			}
+			if len(dependents) > 0 {
+				return r.blockDeletion(ctx, ec2Instance, dependents)
+			}
+		}
+		// Nothing to terminate if the instance was never launched, e.g. because its class could not be resolved.
+		if ec2Instance.Status.InstanceID != "" {
+			// Take the instance out of its target groups and let its connections drain before it goes.
+			drained, err := drainTargets(ctx, elbv2Client(instanceRegion(ec2Instance)), ec2Instance)
+			if err != nil {
+				l.Error(err, "Failed to deregister instance from target groups")
+				// Kubernetes will retry with backoff
+				return ctrl.Result{}, err
+			}
+			if !drained {
+				l.Info("Waiting for connection draining before terminating")
+				if err := r.Status().Update(ctx, ec2Instance); err != nil {
+					l.Error(err, "Failed to update status")
+					return ctrl.Result{}, err
+				}
+				return ctrl.Result{RequeueAfter: targetHealthPollInterval}, nil
+			}
+			if ec2Instance.Spec.FinalSnapshot != nil {
+				snapshot, err := r.finalSnapshot(ctx, ec2Instance)
+				if err != nil {
+					l.Error(err, "Failed to take final snapshot")
+					// Kubernetes will retry with backoff
+					return ctrl.Result{}, err
+				}
+				if !snapshot.Status.ReadyToUse {
+					// A failed snapshot keeps the instance around; removing spec.finalSnapshot lets the deletion proceed.
+					l.Info("Waiting for final snapshot before terminating", "snapshot", snapshot.Name)
+					setFinalSnapshotCondition(ec2Instance, snapshot)
+					if err := r.Status().Update(ctx, ec2Instance); err != nil {
+						l.Error(err, "Failed to update status")
+						return ctrl.Result{}, err
+					}
+					// Kubernetes will not retry - the Ec2Snapshot watch brings the instance back once it progresses
+					return ctrl.Result{}, nil
+				}
+				l.Info("Final snapshot taken", "snapshot", snapshot.Name)
+			}
+			// Remove the record first, so that the name no longer resolves to an instance going away.
+			if ec2Instance.Status.DNS != nil {
+				if err := deleteDNSRecord(ctx, route53Client(instanceRegion(ec2Instance)), ec2Instance.Status.DNS); err != nil {
+					l.Error(err, "Failed to delete DNS record")
+					// Kubernetes will retry with backoff
+					return ctrl.Result{}, err
+				}
+			}
+			_, err = deleteEc2Instance(ctx, ec2Instance)
+			if err != nil {
+				l.Error(err, "Failed to delete EC2 instance")
+				// Kubernetes will retry with backoff
+				return ctrl.Result{Requeue: true}, err
+			}
 		}
 
 		// Remove the finalizer
@@ -142,12 +225,81 @@ func (r *Ec2InstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		// 	r.Status().Update(ctx, ec2Instance)
 		// 	return ctrl.Result{}, nil
 		// }
-		return ctrl.Result{}, nil
+
+		return r.reconcileLaunchedInstance(ctx, ec2Instance)
 	}
 	l.Info("Creating new instance")
 
+	// Wait for the instances of spec.dependsOn; their events bring the instance back.
+	if len(ec2Instance.Spec.DependsOn) > 0 {
+		if err := resolveDependencies(ctx, r.Client, ec2Instance); err != nil {
+			return r.handleResolutionError(ctx, ec2Instance, computev1.ConditionDependenciesReady, err)
+		}
+	}
+
+	// Merge the referenced Ec2InstanceClass (if any) into the spec the instance is launched with.
+	// The object itself keeps the spec as written by the user; only its status records the class generation.
+	resolved, class, err := resolveEc2InstanceSpec(ctx, r.Client, ec2Instance)
+	if err != nil {
+		return r.handleClassResolutionError(ctx, ec2Instance, err)
+	}
+	if class != nil {
+		l.Info("Resolved Ec2InstanceClass", "class", class.Name, "generation", class.Generation)
+	}
+
+	// Launch the instance in the availability zone of the EbsVolumes it attaches.
+	if len(resolved.Spec.Volumes) > 0 {
+		zone, err := resolveVolumeZone(ctx, r.Client, resolved)
+		if err != nil {
+			return r.handleResolutionError(ctx, ec2Instance, computev1.ConditionVolumesResolved, err)
+		}
+		resolved.Spec.AvailabilityZone = zone
+	}
+
+	// Launch the instance in the SecurityGroups it references, next to the security group IDs of the spec.
+	if len(resolved.Spec.SecurityGroupRefs) > 0 {
+		groupIDs, err := resolveSecurityGroupIDs(ctx, r.Client, resolved)
+		if err != nil {
+			return r.handleResolutionError(ctx, ec2Instance, computev1.ConditionSecurityGroupsResolved, err)
+		}
+		resolved.Spec.SecurityGroups = append(slices.Clone(resolved.Spec.SecurityGroups), groupIDs...)
+	}
+
+	// Install the key of the KeyPair the instance references, instead of a key pair named in the spec or class.
+	if resolved.Spec.KeyPairRef != "" {
+		keyName, err := resolveKeyPairName(ctx, r.Client, resolved)
+		if err != nil {
+			return r.handleResolutionError(ctx, ec2Instance, computev1.ConditionKeyPairResolved, err)
+		}
+		resolved.Spec.KeyPair = keyName
+	}
+
+	// Render spec.cloudInit and the userData template, and assemble the user data from the ConfigMaps and
+	// Secrets of spec.userDataFrom. The objects the template looked up are watched from now on.
+	userData, references, err := assembleUserData(ctx, r.Client, resolved)
+	ec2Instance.Status.UserDataReferences = references
+	if err != nil {
+		return r.handleResolutionError(ctx, ec2Instance, computev1.ConditionUserDataUpToDate, err)
+	}
+	resolved.Spec.UserData = userData
+
+	// Resolve spec.image to an AMI ID. Once resolved, the AMI ID is pinned in the status and reused for every
+	// later launch attempt, so that a newer image release never silently changes what the instance runs.
+	resolvedAMIId := ec2Instance.Status.ResolvedAMIId
+	if resolved.Spec.AMIId == "" && resolved.Spec.Image != nil {
+		if resolvedAMIId == "" {
+			resolvedAMIId, err = r.resolveInstanceImage(ctx, ec2Instance.Namespace, resolved.Spec.Region, resolved.Spec.Image)
+			if err != nil {
+				return r.handleImageResolutionError(ctx, ec2Instance, err)
+			}
+			l.Info("Resolved image", "ami", resolvedAMIId)
+		}
+		resolved.Spec.AMIId = resolvedAMIId
+	}
+
 	l.Info("=== ABOUT TO ADD FINALIZER ===")
-	ec2Instance.Finalizers = append(ec2Instance.Finalizers, "ec2instance.compute.cloud.com")
+	// The finalizer is already present when the instance is launched again after an image refresh.
+	controllerutil.AddFinalizer(ec2Instance, "ec2instance.compute.cloud.com")
 	if err := r.Update(ctx, ec2Instance); err != nil { // r.Update() WILL trigger the Reconcile function again via Kubernetes watch mechanism
 		l.Error(err, "Failed to add finalizer")
 		// Kubernetes will retry with backoff
@@ -160,7 +312,7 @@ func (r *Ec2InstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// Create a new instance
 	l.Info("=== CONTINUING WITH EC2 INSTANCE CREATION IN CURRENT RECONCILE ===")
 
-	createdInstanceInfo, err := createEc2Instance(ec2Instance)
+	createdInstanceInfo, err := createEc2Instance(resolved)
 	if err != nil {
 		l.Error(err, "Failed to create EC2 instance")
 		// Kubernetes will retry with backoff
@@ -177,6 +329,84 @@ func (r *Ec2InstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	ec2Instance.Status.PrivateIP = createdInstanceInfo.PrivateIP
 	ec2Instance.Status.PublicDNS = createdInstanceInfo.PublicDNS
 	ec2Instance.Status.PrivateDNS = createdInstanceInfo.PrivateDNS
+	ec2Instance.Status.Region = resolved.Spec.Region
+	// The status is only written here: the finalizer update above replaced the object with the stored one.
+	if class != nil {
+		ec2Instance.Status.ClassGeneration = class.Generation
+		meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+			Type:               computev1.ConditionClassResolved,
+			Status:             metav1.ConditionTrue,
+			Reason:             computev1.ReasonClassResolved,
+			Message:            fmt.Sprintf("Resolved from Ec2InstanceClass %s at generation %d", class.Name, class.Generation),
+			ObservedGeneration: ec2Instance.Generation,
+		})
+	}
+	if len(resolved.Spec.Volumes) > 0 {
+		meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+			Type:               computev1.ConditionVolumesResolved,
+			Status:             metav1.ConditionTrue,
+			Reason:             computev1.ReasonVolumesResolved,
+			Message:            fmt.Sprintf("Launched in availability zone %s of the referenced EbsVolumes", resolved.Spec.AvailabilityZone),
+			ObservedGeneration: ec2Instance.Generation,
+		})
+	}
+	if len(resolved.Spec.SecurityGroupRefs) > 0 {
+		meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+			Type:               computev1.ConditionSecurityGroupsResolved,
+			Status:             metav1.ConditionTrue,
+			Reason:             computev1.ReasonSecurityGroupsResolved,
+			Message:            fmt.Sprintf("Launched in security groups %v", resolved.Spec.SecurityGroups),
+			ObservedGeneration: ec2Instance.Generation,
+		})
+	}
+	if resolved.Spec.KeyPairRef != "" {
+		meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+			Type:               computev1.ConditionKeyPairResolved,
+			Status:             metav1.ConditionTrue,
+			Reason:             computev1.ReasonKeyPairResolved,
+			Message:            fmt.Sprintf("Launched with key pair %s", resolved.Spec.KeyPair),
+			ObservedGeneration: ec2Instance.Generation,
+		})
+	}
+	if len(ec2Instance.Spec.DependsOn) > 0 {
+		meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+			Type:               computev1.ConditionDependenciesReady,
+			Status:             metav1.ConditionTrue,
+			Reason:             computev1.ReasonDependenciesReady,
+			Message:            fmt.Sprintf("Launched after %d dependencies were ready", len(ec2Instance.Spec.DependsOn)),
+			ObservedGeneration: ec2Instance.Generation,
+		})
+	}
+	if trackedUserData(&resolved.Spec) {
+		ec2Instance.Status.UserDataHash = userDataHash(userData)
+		meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+			Type:               computev1.ConditionUserDataUpToDate,
+			Status:             metav1.ConditionTrue,
+			Reason:             computev1.ReasonUserDataCurrent,
+			Message:            fmt.Sprintf("Launched with %d bytes of user data", len(userData)),
+			ObservedGeneration: ec2Instance.Generation,
+		})
+	}
+	if resolved.Spec.CloudInit != nil {
+		// Rendered once more for its hash; it rendered the same moments ago.
+		if document, err := cloudinit.Render(resolved.Spec.CloudInit); err == nil {
+			ec2Instance.Status.CloudInitHash = userDataHash(document)
+		}
+	}
+	if resolved.Spec.Image != nil && ec2Instance.Spec.AMIId == "" {
+		ec2Instance.Status.ResolvedAMIId = resolvedAMIId
+		if ec2Instance.Status.AvailableAMIId == "" {
+			ec2Instance.Status.AvailableAMIId = resolvedAMIId
+			ec2Instance.Status.ImageCheckedAt = &metav1.Time{Time: time.Now()}
+		}
+		meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+			Type:               computev1.ConditionImageResolved,
+			Status:             metav1.ConditionTrue,
+			Reason:             computev1.ReasonImageResolved,
+			Message:            fmt.Sprintf("Resolved to %s", resolvedAMIId),
+			ObservedGeneration: ec2Instance.Generation,
+		})
+	}
 
 	// The Reconcile function must return a ctrl.Result and an error.
 	// Returning ctrl.Result{} with nil error means the reconciliation was successful
@@ -198,14 +428,462 @@ func (r *Ec2InstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{RequeueAfter: 1 * time.Second}, nil
 }
 
+// reconcileLaunchedInstance reads the state and addresses of a launched instance, which its connection
+// Secret, Service, DNS record and target group registrations follow, applies the changes it supports without being replaced,
+// and replaces it when its user data changed or it is refreshed onto a newer AMI, if their policies ask for it.
+// While its Ec2InstanceClass cannot be resolved, only the steps applying the resolved spec are skipped.
+func (r *Ec2InstanceReconciler) reconcileLaunchedInstance(ctx context.Context, ec2Instance *computev1.Ec2Instance) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	resolved, err := r.resolveLaunchedInstanceSpec(ctx, ec2Instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	statusResult, err := r.reconcileInstanceStatus(ctx, ec2Instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Replace the instance when its user data changed and its policy says so.
+	var userDataResult ctrl.Result
+	if resolved != nil {
+		userDataResult, err = r.reconcileUserData(ctx, ec2Instance, resolved)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if ec2Instance.Status.InstanceID == "" {
+			// Replaced; the next reconcile launches the instance again.
+			return userDataResult, nil
+		}
+	}
+
+	// Remediate the instance when it keeps failing its health checks and its policy says so.
+	remediationResult, err := r.reconcileRemediation(ctx, awsClient(instanceRegion(ec2Instance)), ec2Instance, time.Now())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if ec2Instance.Status.InstanceID == "" {
+		// Replaced; the next reconcile launches the instance again.
+		return remediationResult, nil
+	}
+
+	var volumeResult ctrl.Result
+	if resolved != nil {
+		volumeResult, err = r.reconcileVolumes(ctx, ec2Instance, resolved)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.writeConnectionSecret(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to write connection secret")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileService(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to reconcile service")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	dnsResult, err := r.reconcileDNS(ctx, route53Client(instanceRegion(ec2Instance)), ec2Instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	targetResult, err := r.reconcileTargetGroups(ctx, elbv2Client(instanceRegion(ec2Instance)), ec2Instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Look for a newer AMI when the instance was launched from spec.image, and refresh it if its policy says so.
+	var refreshResult ctrl.Result
+	if resolved != nil {
+		refreshResult, err = r.reconcileImageRefresh(ctx, ec2Instance, resolved)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return earliestResult(statusResult, userDataResult, remediationResult, volumeResult, dnsResult, targetResult, refreshResult), nil
+}
+
+// earliestResult combines reconcile results, requeueing at the earliest time any of them asks for.
+func earliestResult(results ...ctrl.Result) ctrl.Result {
+	combined := ctrl.Result{}
+	for _, result := range results {
+		if result.RequeueAfter > 0 && (combined.RequeueAfter == 0 || result.RequeueAfter < combined.RequeueAfter) {
+			combined.RequeueAfter = result.RequeueAfter
+		}
+	}
+	return combined
+}
+
+// resolveLaunchedInstanceSpec merges the Ec2InstanceClass into the spec of a launched instance and reports
+// the outcome in the ClassResolved condition. The class may have been deleted or changed since launch: then
+// the resolved spec is nil, and the instance goes on running as launched until the class resolves again.
+func (r *Ec2InstanceReconciler) resolveLaunchedInstanceSpec(ctx context.Context, ec2Instance *computev1.Ec2Instance) (*computev1.Ec2Instance, error) {
+	l := log.FromContext(ctx)
+
+	resolved, class, err := resolveEc2InstanceSpec(ctx, r.Client, ec2Instance)
+	var condition metav1.Condition
+	switch {
+	case err != nil:
+		var ok bool
+		if condition, ok = classResolutionFailure(ec2Instance, err); !ok {
+			l.Error(err, "Failed to resolve Ec2InstanceClass", "class", ec2Instance.Spec.ClassName)
+			// Kubernetes will retry with backoff
+			return nil, err
+		}
+		l.Info("Not applying the Ec2InstanceClass to the launched instance", "reason", condition.Reason, "message", condition.Message)
+		resolved = nil
+	case class != nil:
+		condition = metav1.Condition{
+			Type:               computev1.ConditionClassResolved,
+			Status:             metav1.ConditionTrue,
+			Reason:             computev1.ReasonClassResolved,
+			Message:            fmt.Sprintf("Resolved from Ec2InstanceClass %s at generation %d", class.Name, class.Generation),
+			ObservedGeneration: ec2Instance.Generation,
+		}
+	default:
+		return resolved, nil
+	}
+
+	if meta.SetStatusCondition(&ec2Instance.Status.Conditions, condition) {
+		if err := r.Status().Update(ctx, ec2Instance); err != nil {
+			l.Error(err, "Failed to update status")
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// classResolutionFailure returns the ClassResolved condition reporting a missing or forbidding class.
+// It returns false for other errors, from the API server, which are retried with backoff.
+func classResolutionFailure(ec2Instance *computev1.Ec2Instance, err error) (metav1.Condition, bool) {
+	var forbidden *classForbiddenError
+	condition := metav1.Condition{
+		Type:               computev1.ConditionClassResolved,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec2Instance.Generation,
+	}
+	switch {
+	case errors.IsNotFound(err):
+		condition.Reason = computev1.ReasonClassNotFound
+		condition.Message = fmt.Sprintf("Ec2InstanceClass %s not found", ec2Instance.Spec.ClassName)
+	case stderrors.As(err, &forbidden):
+		condition.Reason = computev1.ReasonClassForbidden
+		condition.Message = forbidden.Error()
+	default:
+		return condition, false
+	}
+	return condition, true
+}
+
+// handleClassResolutionError records why the Ec2InstanceClass could not be merged into the spec.
+// A missing or forbidding class is reported in the ClassResolved condition without requeueing:
+// the watch on Ec2InstanceClass brings the instance back once the class is created or changed.
+func (r *Ec2InstanceReconciler) handleClassResolutionError(ctx context.Context, ec2Instance *computev1.Ec2Instance, err error) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	condition, ok := classResolutionFailure(ec2Instance, err)
+	if !ok {
+		l.Error(err, "Failed to resolve Ec2InstanceClass", "class", ec2Instance.Spec.ClassName)
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	l.Info("Not launching instance", "reason", condition.Reason, "message", condition.Message)
+	meta.SetStatusCondition(&ec2Instance.Status.Conditions, condition)
+	if err := r.Status().Update(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	// Kubernetes will not retry - done, wait for next event
+	return ctrl.Result{}, nil
+}
+
+// blockDeletion records that the deletion of the instance waits for the instances depending on it.
+// The instance is reconciled again through the Ec2Instance watch once they are deleted.
+func (r *Ec2InstanceReconciler) blockDeletion(ctx context.Context, ec2Instance *computev1.Ec2Instance, dependents []string) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	l.Info("Not deleting instance while other instances depend on it", "dependents", dependents)
+	changed := meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+		Type:   computev1.ConditionDeletionBlocked,
+		Status: metav1.ConditionTrue,
+		Reason: computev1.ReasonDependentsExist,
+		Message: fmt.Sprintf("Ec2Instances %s depend on the instance; delete them first or annotate the instance with %s: \"true\"",
+			strings.Join(dependents, ", "), computev1.ForceDeleteAnnotation),
+		ObservedGeneration: ec2Instance.Generation,
+	})
+	if changed {
+		if err := r.Status().Update(ctx, ec2Instance); err != nil {
+			l.Error(err, "Failed to update status")
+			return ctrl.Result{}, err
+		}
+	}
+	// Kubernetes will not retry - done, wait for next event
+	return ctrl.Result{}, nil
+}
+
+// resolutionError is returned when something the instance is launched with cannot be resolved yet: a referenced
+// object does not exist or is not ready, conflicts with the spec, or the user data cannot be assembled.
+type resolutionError struct {
+	reason  string
+	message string
+}
+
+func (e *resolutionError) Error() string {
+	return e.message
+}
+
+// handleResolutionError reports a resolutionError in the condition of the given type without requeueing:
+// the watches of the referenced objects bring the instance back once they change. Other errors, from AWS
+// or the API server, are retried with backoff.
+func (r *Ec2InstanceReconciler) handleResolutionError(ctx context.Context, ec2Instance *computev1.Ec2Instance, conditionType string, err error) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	var unresolved *resolutionError
+	if !stderrors.As(err, &unresolved) {
+		l.Error(err, "Failed to resolve instance", "condition", conditionType)
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	l.Info("Not launching instance", "reason", unresolved.reason, "message", unresolved.message)
+	meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             unresolved.reason,
+		Message:            unresolved.message,
+		ObservedGeneration: ec2Instance.Generation,
+	})
+	if err := r.Status().Update(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	// Kubernetes will not retry - done, wait for next event
+	return ctrl.Result{}, nil
+}
+
+// handleImageResolutionError records why spec.image could not be resolved. When no image matches,
+// the instance is checked again later, as the image may still be published; AWS errors are retried with backoff.
+func (r *Ec2InstanceReconciler) handleImageResolutionError(ctx context.Context, ec2Instance *computev1.Ec2Instance, err error) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	var notFound *imageNotFoundError
+	if !stderrors.As(err, &notFound) {
+		l.Error(err, "Failed to resolve image")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	l.Info("Not launching instance", "reason", computev1.ReasonImageNotFound, "message", notFound.Error())
+	meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+		Type:               computev1.ConditionImageResolved,
+		Status:             metav1.ConditionFalse,
+		Reason:             computev1.ReasonImageNotFound,
+		Message:            notFound.Error(),
+		ObservedGeneration: ec2Instance.Generation,
+	})
+	if err := r.Status().Update(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: imageRetryInterval}, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 // SetupWithManager registers the Ec2InstanceReconciler with the controller manager.
-// It configures the controller to watch for changes to Ec2Instance resources.
+// It configures the controller to watch for changes to Ec2Instance resources, and to Ec2InstanceClass
+// resources so that instances waiting for their class are reconciled as soon as it shows up or changes.
+// EbsVolumes are watched for the same reason, for instances waiting for the volumes they attach,
+// and final Ec2Snapshots for deleted instances waiting for their snapshots before termination.
+// Ec2Images are watched for instances waiting for their AMI to become available,
+// SecurityGroups for instances waiting for their groups to be created, and KeyPairs for their key pair.
+// Connection Secrets, Services and EndpointSlices are owned, so that they are written again when changed or deleted.
 // The controller will be named "ec2instance" for logging and metrics purposes.
 // The Complete(r) call finalizes the setup, associating the reconciler logic with this controller.
 func (r *Ec2InstanceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Index Ec2Instances by the class they reference so that a class event can be mapped to its instances.
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &computev1.Ec2Instance{}, classNameField,
+		func(obj client.Object) []string {
+			className := obj.(*computev1.Ec2Instance).Spec.ClassName
+			if className == "" {
+				return nil
+			}
+			return []string{className}
+		}); err != nil {
+		return err
+	}
+	// Index Ec2Instances by the EbsVolumes they attach; the EbsVolumeReconciler uses it as well.
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &computev1.Ec2Instance{}, volumeNamesField,
+		func(obj client.Object) []string {
+			var names []string
+			for _, attachment := range obj.(*computev1.Ec2Instance).Spec.Volumes {
+				names = append(names, attachment.Name)
+			}
+			return names
+		}); err != nil {
+		return err
+	}
+
+	// Index Ec2Instances by the Ec2Image they launch from. Images set through a class are not indexed;
+	// those instances wait for the image by polling.
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &computev1.Ec2Instance{}, ec2ImageField,
+		func(obj client.Object) []string {
+			image := obj.(*computev1.Ec2Instance).Spec.Image
+			if image == nil || image.Ec2Image == "" {
+				return nil
+			}
+			return []string{image.Ec2Image}
+		}); err != nil {
+		return err
+	}
+
+	// Index Ec2Instances by the SecurityGroups they reference.
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &computev1.Ec2Instance{}, securityGroupRefsIndexField,
+		func(obj client.Object) []string {
+			return obj.(*computev1.Ec2Instance).Spec.SecurityGroupRefs
+		}); err != nil {
+		return err
+	}
+
+	// Index Ec2Instances by the KeyPair they reference.
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &computev1.Ec2Instance{}, keyPairRefIndexField,
+		func(obj client.Object) []string {
+			if ref := obj.(*computev1.Ec2Instance).Spec.KeyPairRef; ref != "" {
+				return []string{ref}
+			}
+			return nil
+		}); err != nil {
+		return err
+	}
+
+	// Index Ec2Instances by the ConfigMaps and Secrets they assemble their user data from,
+	// and by the objects their userData template looks up.
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &computev1.Ec2Instance{}, userDataReferencesIndexField,
+		func(obj client.Object) []string {
+			return userDataReferenceKeys(obj.(*computev1.Ec2Instance))
+		}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&computev1.Ec2Instance{}).
+		Owns(&corev1.Secret{}).
+		Owns(&corev1.Service{}).
+		Owns(&discoveryv1.EndpointSlice{}).
+		Watches(&computev1.Ec2InstanceClass{}, handler.EnqueueRequestsFromMapFunc(r.instancesForClass)).
+		Watches(&computev1.EbsVolume{}, handler.EnqueueRequestsFromMapFunc(r.instancesForVolume)).
+		Watches(&computev1.Ec2Snapshot{}, handler.EnqueueRequestsFromMapFunc(r.instanceForFinalSnapshot)).
+		Watches(&computev1.Ec2Image{}, handler.EnqueueRequestsFromMapFunc(r.instancesForImage)).
+		Watches(&computev1.SecurityGroup{}, handler.EnqueueRequestsFromMapFunc(r.instancesForSecurityGroup)).
+		Watches(&computev1.KeyPair{}, handler.EnqueueRequestsFromMapFunc(r.instancesForKeyPair)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.instancesForUserDataReference("ConfigMap"))).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.instancesForUserDataReference("Secret"))).
+		Watches(&computev1.Ec2Instance{}, handler.EnqueueRequestsFromMapFunc(r.instancesForUserDataReference("Ec2Instance"))).
+		Watches(&computev1.Ec2Instance{}, handler.EnqueueRequestsFromMapFunc(r.instancesForDependencies)).
 		Named("ec2instance").
 		Complete(r)
 }
+
+// instancesForClass maps an Ec2InstanceClass to reconcile requests for every Ec2Instance referencing it.
+func (r *Ec2InstanceReconciler) instancesForClass(ctx context.Context, class client.Object) []reconcile.Request {
+	instances := &computev1.Ec2InstanceList{}
+	if err := r.List(ctx, instances, client.MatchingFields{classNameField: class.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Ec2Instances for class", "class", class.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(instances.Items))
+	for _, instance := range instances.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&instance)})
+	}
+	return requests
+}
+
+// isEc2InstanceReady tells whether the EC2 instance behind the object is Ready: running, and passing
+// its health checks when it has any.
+func isEc2InstanceReady(ec2Instance *computev1.Ec2Instance) bool {
+	return meta.IsStatusConditionTrue(ec2Instance.Status.Conditions, computev1.ConditionReady)
+}
+
+// instancesForVolume maps an EbsVolume to reconcile requests for every Ec2Instance attaching it.
+func (r *Ec2InstanceReconciler) instancesForVolume(ctx context.Context, volume client.Object) []reconcile.Request {
+	instances := &computev1.Ec2InstanceList{}
+	if err := r.List(ctx, instances, client.InNamespace(volume.GetNamespace()),
+		client.MatchingFields{volumeNamesField: volume.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Ec2Instances for EbsVolume", "volume", volume.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(instances.Items))
+	for _, instance := range instances.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&instance)})
+	}
+	return requests
+}
+
+// instancesForImage maps an Ec2Image to reconcile requests for every Ec2Instance launching from it.
+func (r *Ec2InstanceReconciler) instancesForImage(ctx context.Context, image client.Object) []reconcile.Request {
+	instances := &computev1.Ec2InstanceList{}
+	if err := r.List(ctx, instances, client.InNamespace(image.GetNamespace()),
+		client.MatchingFields{ec2ImageField: image.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Ec2Instances for Ec2Image", "image", image.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(instances.Items))
+	for _, instance := range instances.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&instance)})
+	}
+	return requests
+}
+
+// instancesForSecurityGroup maps a SecurityGroup to reconcile requests for every Ec2Instance referencing it.
+func (r *Ec2InstanceReconciler) instancesForSecurityGroup(ctx context.Context, group client.Object) []reconcile.Request {
+	instances := &computev1.Ec2InstanceList{}
+	if err := r.List(ctx, instances, client.InNamespace(group.GetNamespace()),
+		client.MatchingFields{securityGroupRefsIndexField: group.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Ec2Instances for SecurityGroup", "securityGroup", group.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(instances.Items))
+	for _, instance := range instances.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&instance)})
+	}
+	return requests
+}
+
+// instancesForKeyPair maps a KeyPair to reconcile requests for every Ec2Instance referencing it.
+func (r *Ec2InstanceReconciler) instancesForKeyPair(ctx context.Context, keyPair client.Object) []reconcile.Request {
+	instances := &computev1.Ec2InstanceList{}
+	if err := r.List(ctx, instances, client.InNamespace(keyPair.GetNamespace()),
+		client.MatchingFields{keyPairRefIndexField: keyPair.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Ec2Instances for KeyPair", "keyPair", keyPair.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(instances.Items))
+	for _, instance := range instances.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&instance)})
+	}
+	return requests
+}
+
+// instancesForUserDataReference returns a function mapping an object of the given kind to reconcile requests for
+// every Ec2Instance assembling its user data from it, or whose userData template looks up a value of it.
+func (r *Ec2InstanceReconciler) instancesForUserDataReference(kind string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		instances := &computev1.Ec2InstanceList{}
+		if err := r.List(ctx, instances, client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{userDataReferencesIndexField: kind + "/" + obj.GetName()}); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list Ec2Instances for user data", "name", obj.GetName())
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(instances.Items))
+		for _, instance := range instances.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&instance)})
+		}
+		return requests
+	}
+}
@@ -0,0 +1,524 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/rand"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const defaultRevisionHistoryLimit = 10
+
+// Ec2InstanceDeploymentReconciler reconciles a Ec2InstanceDeployment object.
+// Every distinct template of a deployment gets its own Ec2InstanceSet; a rollout moves replicas from the
+// old sets to the set of the current template, and old sets scaled to zero are kept as revision history.
+type Ec2InstanceDeploymentReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instancedeployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instancedeployments/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instancedeployments/finalizers,verbs=update
+
+// Reconcile applies a requested rollback, makes sure an Ec2InstanceSet exists for the current template,
+// scales the sets according to the deployment strategy, prunes the revision history and reports the
+// progress of the rollout in the status.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.2/pkg/reconcile
+func (r *Ec2InstanceDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	deployment := &computev1.Ec2InstanceDeployment{}
+	if err := r.Get(ctx, req.NamespacedName, deployment); err != nil {
+		// Owned Ec2InstanceSets are garbage collected through their owner reference.
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !deployment.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	sets, err := r.ownedSets(ctx, deployment)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// A rollback only rewrites the template; the update triggers a new reconcile which rolls it out.
+	if deployment.Spec.RollbackTo != nil {
+		return ctrl.Result{}, r.rollback(ctx, deployment, sets)
+	}
+
+	hash := templateHash(deployment)
+	newSet, oldSets := splitSets(sets, hash)
+
+	if deployment.Spec.Paused {
+		l.Info("Rollout is paused")
+		return ctrl.Result{}, r.updateStatus(ctx, deployment, newSet, oldSets)
+	}
+
+	if newSet, err = r.syncNewSet(ctx, deployment, newSet, oldSets, hash); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if deploymentStrategy(deployment) == computev1.RecreateStrategyType {
+		err = r.recreate(ctx, deployment, newSet, oldSets)
+	} else {
+		err = r.rollingUpdate(ctx, deployment, newSet, oldSets)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.pruneHistory(ctx, deployment, oldSets); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, r.updateStatus(ctx, deployment, newSet, oldSets)
+}
+
+// ownedSets lists the Ec2InstanceSets controlled by the deployment.
+func (r *Ec2InstanceDeploymentReconciler) ownedSets(ctx context.Context, deployment *computev1.Ec2InstanceDeployment) ([]*computev1.Ec2InstanceSet, error) {
+	list := &computev1.Ec2InstanceSetList{}
+	if err := r.List(ctx, list, client.InNamespace(deployment.Namespace), client.MatchingLabels{computev1.InstanceDeploymentLabel: deployment.Name}); err != nil {
+		return nil, err
+	}
+	var owned []*computev1.Ec2InstanceSet
+	for i := range list.Items {
+		if metav1.IsControlledBy(&list.Items[i], deployment) {
+			owned = append(owned, &list.Items[i])
+		}
+	}
+	return owned, nil
+}
+
+// rollback copies the template and placements of the requested revision into the deployment and clears
+// spec.rollbackTo. An unknown revision is reported in the Progressing condition and left in the spec
+// until the user removes or corrects it.
+func (r *Ec2InstanceDeploymentReconciler) rollback(ctx context.Context, deployment *computev1.Ec2InstanceDeployment, sets []*computev1.Ec2InstanceSet) error {
+	l := log.FromContext(ctx)
+
+	target := findRevision(sets, deployment.Spec.RollbackTo.Revision, templateHash(deployment))
+	if target == nil {
+		message := fmt.Sprintf("revision %d not found in the revision history", deployment.Spec.RollbackTo.Revision)
+		if deployment.Spec.RollbackTo.Revision == 0 {
+			message = "no previous revision found in the revision history"
+		}
+		l.Info("Rollback failed", "reason", message)
+		meta.SetStatusCondition(&deployment.Status.Conditions, metav1.Condition{
+			Type:               computev1.ConditionProgressing,
+			Status:             metav1.ConditionFalse,
+			Reason:             computev1.ReasonRollbackFailed,
+			Message:            message,
+			ObservedGeneration: deployment.Generation,
+		})
+		return r.Status().Update(ctx, deployment)
+	}
+
+	l.Info("Rolling back", "revision", revisionOf(target))
+	target.Spec.Template.DeepCopyInto(&deployment.Spec.Template)
+	// Drop the labels the controller added to the set's template, they are added again on rollout.
+	delete(deployment.Spec.Template.Metadata.Labels, computev1.InstanceDeploymentLabel)
+	delete(deployment.Spec.Template.Metadata.Labels, computev1.TemplateHashLabel)
+	if len(deployment.Spec.Template.Metadata.Labels) == 0 {
+		deployment.Spec.Template.Metadata.Labels = nil
+	}
+	deployment.Spec.Placements = append([]computev1.Ec2InstancePlacement(nil), target.Spec.Placements...)
+	deployment.Spec.RollbackTo = nil
+	return r.Update(ctx, deployment)
+}
+
+// syncNewSet creates the Ec2InstanceSet of the current template if it does not exist yet, with zero replicas,
+// and makes sure it carries the highest revision, e.g. after a rollback made an old set current again.
+func (r *Ec2InstanceDeploymentReconciler) syncNewSet(ctx context.Context, deployment *computev1.Ec2InstanceDeployment, newSet *computev1.Ec2InstanceSet, oldSets []*computev1.Ec2InstanceSet, hash string) (*computev1.Ec2InstanceSet, error) {
+	l := log.FromContext(ctx)
+
+	maxRevision := int64(0)
+	for _, set := range oldSets {
+		maxRevision = max(maxRevision, revisionOf(set))
+	}
+
+	if newSet != nil {
+		if revisionOf(newSet) > maxRevision {
+			return newSet, nil
+		}
+		newSet.Annotations[computev1.RevisionAnnotation] = strconv.FormatInt(maxRevision+1, 10)
+		if err := r.Update(ctx, newSet); err != nil {
+			return nil, err
+		}
+		l.Info("Updated revision of Ec2InstanceSet", "name", newSet.Name, "revision", maxRevision+1)
+		return newSet, nil
+	}
+
+	newSet = &computev1.Ec2InstanceSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deployment.Name + "-" + hash,
+			Namespace: deployment.Namespace,
+			Labels: map[string]string{
+				computev1.InstanceDeploymentLabel: deployment.Name,
+				computev1.TemplateHashLabel:       hash,
+			},
+			Annotations: map[string]string{
+				computev1.RevisionAnnotation: strconv.FormatInt(maxRevision+1, 10),
+			},
+		},
+		Spec: computev1.Ec2InstanceSetSpec{
+			Replicas:   new(int32),
+			Placements: append([]computev1.Ec2InstancePlacement(nil), deployment.Spec.Placements...),
+		},
+	}
+	deployment.Spec.Template.DeepCopyInto(&newSet.Spec.Template)
+	if newSet.Spec.Template.Metadata.Labels == nil {
+		newSet.Spec.Template.Metadata.Labels = map[string]string{}
+	}
+	newSet.Spec.Template.Metadata.Labels[computev1.InstanceDeploymentLabel] = deployment.Name
+	newSet.Spec.Template.Metadata.Labels[computev1.TemplateHashLabel] = hash
+
+	if err := controllerutil.SetControllerReference(deployment, newSet, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, newSet); err != nil {
+		l.Error(err, "Failed to create Ec2InstanceSet")
+		return nil, err
+	}
+	l.Info("Created Ec2InstanceSet", "name", newSet.Name, "revision", maxRevision+1)
+	return newSet, nil
+}
+
+// recreate scales all old sets to zero and only scales up the new set once none of their instances are left.
+func (r *Ec2InstanceDeploymentReconciler) recreate(ctx context.Context, deployment *computev1.Ec2InstanceDeployment, newSet *computev1.Ec2InstanceSet, oldSets []*computev1.Ec2InstanceSet) error {
+	running := int32(0)
+	for _, set := range oldSets {
+		if err := r.scaleSet(ctx, set, 0); err != nil {
+			return err
+		}
+		running += set.Status.Replicas
+	}
+	if running > 0 {
+		// The set controller updates the status of the old sets as their instances go away,
+		// which triggers another reconcile of the deployment.
+		return nil
+	}
+	return r.scaleSet(ctx, newSet, deploymentReplicas(deployment))
+}
+
+// rollingUpdate scales the new set up as far as maxSurge allows, then scales the old sets down as far as
+// maxUnavailable allows. Only ready instances count as available, so every step waits for the instances
+// launched by the previous one.
+func (r *Ec2InstanceDeploymentReconciler) rollingUpdate(ctx context.Context, deployment *computev1.Ec2InstanceDeployment, newSet *computev1.Ec2InstanceSet, oldSets []*computev1.Ec2InstanceSet) error {
+	desired := deploymentReplicas(deployment)
+	maxSurge, maxUnavailable, err := rollingUpdateBounds(deployment)
+	if err != nil {
+		return err
+	}
+
+	// Scale up the new set, without going over replicas + maxSurge instances in total.
+	newReplicas := replicasOf(newSet)
+	if newReplicas > desired {
+		newReplicas = desired
+	} else {
+		room := desired + maxSurge - totalReplicas(newSet, oldSets)
+		newReplicas += max(0, min(room, desired-newReplicas))
+	}
+	if err := r.scaleSet(ctx, newSet, newReplicas); err != nil {
+		return err
+	}
+
+	// Scale down the old sets, keeping at least replicas - maxUnavailable ready instances.
+	// Instances of old sets that are not ready do not count towards availability and go first.
+	sortByRevision(oldSets)
+	minAvailable := desired - maxUnavailable
+	newUnavailable := max(0, replicasOf(newSet)-newSet.Status.ReadyReplicas)
+	budget := totalReplicas(newSet, oldSets) - minAvailable - newUnavailable
+	for _, set := range oldSets {
+		if budget <= 0 {
+			break
+		}
+		unhealthy := min(budget, max(0, replicasOf(set)-set.Status.ReadyReplicas))
+		if unhealthy == 0 {
+			continue
+		}
+		if err := r.scaleSet(ctx, set, replicasOf(set)-unhealthy); err != nil {
+			return err
+		}
+		budget -= unhealthy
+	}
+
+	canScaleDown := totalReady(newSet, oldSets) - minAvailable
+	for _, set := range oldSets {
+		if canScaleDown <= 0 {
+			break
+		}
+		scaleDown := min(canScaleDown, replicasOf(set))
+		if scaleDown == 0 {
+			continue
+		}
+		if err := r.scaleSet(ctx, set, replicasOf(set)-scaleDown); err != nil {
+			return err
+		}
+		canScaleDown -= scaleDown
+	}
+	return nil
+}
+
+// scaleSet sets the replicas of an Ec2InstanceSet, if they differ.
+func (r *Ec2InstanceDeploymentReconciler) scaleSet(ctx context.Context, set *computev1.Ec2InstanceSet, replicas int32) error {
+	if set.Spec.Replicas != nil && *set.Spec.Replicas == replicas {
+		return nil
+	}
+	log.FromContext(ctx).Info("Scaling Ec2InstanceSet", "name", set.Name, "from", replicasOf(set), "to", replicas)
+	set.Spec.Replicas = &replicas
+	return r.Update(ctx, set)
+}
+
+// pruneHistory deletes the oldest sets that have no instances left, beyond spec.revisionHistoryLimit.
+func (r *Ec2InstanceDeploymentReconciler) pruneHistory(ctx context.Context, deployment *computev1.Ec2InstanceDeployment, oldSets []*computev1.Ec2InstanceSet) error {
+	limit := defaultRevisionHistoryLimit
+	if deployment.Spec.RevisionHistoryLimit != nil {
+		limit = int(*deployment.Spec.RevisionHistoryLimit)
+	}
+
+	var idle []*computev1.Ec2InstanceSet
+	for _, set := range oldSets {
+		if replicasOf(set) == 0 && set.Status.Replicas == 0 && set.DeletionTimestamp.IsZero() {
+			idle = append(idle, set)
+		}
+	}
+	sortByRevision(idle)
+	for i := 0; i < len(idle)-limit; i++ {
+		if err := r.Delete(ctx, idle[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("Deleted old Ec2InstanceSet", "name", idle[i].Name, "revision", revisionOf(idle[i]))
+	}
+	return nil
+}
+
+// updateStatus sums up the replicas of all sets and reports the Available and Progressing conditions.
+func (r *Ec2InstanceDeploymentReconciler) updateStatus(ctx context.Context, deployment *computev1.Ec2InstanceDeployment, newSet *computev1.Ec2InstanceSet, oldSets []*computev1.Ec2InstanceSet) error {
+	desired := deploymentReplicas(deployment)
+	status := deployment.Status.DeepCopy()
+	status.Selector = labels.SelectorFromSet(labels.Set{computev1.InstanceDeploymentLabel: deployment.Name}).String()
+	status.ObservedGeneration = deployment.Generation
+	status.Replicas, status.ReadyReplicas, status.UpdatedReplicas, status.Revision = 0, 0, 0, 0
+	for _, set := range append([]*computev1.Ec2InstanceSet{newSet}, oldSets...) {
+		if set == nil {
+			continue
+		}
+		status.Replicas += set.Status.Replicas
+		status.ReadyReplicas += set.Status.ReadyReplicas
+	}
+	if newSet != nil {
+		status.UpdatedReplicas = newSet.Status.Replicas
+		status.Revision = revisionOf(newSet)
+	}
+	status.UnavailableReplicas = max(0, desired-status.ReadyReplicas)
+
+	_, maxUnavailable, err := rollingUpdateBounds(deployment)
+	if err != nil {
+		return err
+	}
+	if deploymentStrategy(deployment) == computev1.RecreateStrategyType {
+		maxUnavailable = desired
+	}
+	available := metav1.Condition{
+		Type:               computev1.ConditionAvailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             computev1.ReasonMinimumAvailable,
+		Message:            fmt.Sprintf("%d of %d instances are ready", status.ReadyReplicas, desired),
+		ObservedGeneration: deployment.Generation,
+	}
+	if status.ReadyReplicas < desired-maxUnavailable {
+		available.Status = metav1.ConditionFalse
+		available.Reason = computev1.ReasonMinimumUnavailable
+	}
+	meta.SetStatusCondition(&status.Conditions, available)
+
+	progressing := metav1.Condition{
+		Type:               computev1.ConditionProgressing,
+		Status:             metav1.ConditionTrue,
+		Reason:             computev1.ReasonRolloutInProgress,
+		Message:            fmt.Sprintf("%d of %d instances updated", status.UpdatedReplicas, desired),
+		ObservedGeneration: deployment.Generation,
+	}
+	switch {
+	case deployment.Spec.Paused:
+		progressing.Status = metav1.ConditionUnknown
+		progressing.Reason = computev1.ReasonRolloutPaused
+		progressing.Message = "Rollout is paused"
+	case newSet != nil && status.UpdatedReplicas == desired && status.Replicas == desired && status.ReadyReplicas == desired:
+		progressing.Reason = computev1.ReasonRolloutComplete
+		progressing.Message = fmt.Sprintf("Revision %d is rolled out", status.Revision)
+	}
+	meta.SetStatusCondition(&status.Conditions, progressing)
+
+	// SetStatusCondition keeps the transition time of unchanged conditions, so an unchanged status compares equal.
+	if equality.Semantic.DeepEqual(&deployment.Status, status) {
+		return nil
+	}
+	deployment.Status = *status
+	if err := r.Status().Update(ctx, deployment); err != nil {
+		if errors.IsConflict(err) {
+			// A newer version of the deployment is on its way and will be reconciled again.
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// templateHash identifies the template and placements of the deployment. Both end up in the
+// Ec2InstanceSet, so changing either of them rolls out a new set.
+func templateHash(deployment *computev1.Ec2InstanceDeployment) string {
+	hasher := fnv.New32a()
+	// Marshalling a struct never fails and map keys are sorted, so the hash is stable.
+	data, _ := json.Marshal(struct {
+		Template   computev1.Ec2InstanceTemplateSpec `json:"template"`
+		Placements []computev1.Ec2InstancePlacement  `json:"placements,omitempty"`
+	}{deployment.Spec.Template, deployment.Spec.Placements})
+	_, _ = hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// splitSets returns the set of the current template and all other sets.
+func splitSets(sets []*computev1.Ec2InstanceSet, hash string) (*computev1.Ec2InstanceSet, []*computev1.Ec2InstanceSet) {
+	var newSet *computev1.Ec2InstanceSet
+	var oldSets []*computev1.Ec2InstanceSet
+	for _, set := range sets {
+		if set.Labels[computev1.TemplateHashLabel] == hash && newSet == nil {
+			newSet = set
+			continue
+		}
+		oldSets = append(oldSets, set)
+	}
+	return newSet, oldSets
+}
+
+// findRevision returns the set of the given revision, or for revision 0 the newest set that is not
+// the one of the current template.
+func findRevision(sets []*computev1.Ec2InstanceSet, revision int64, currentHash string) *computev1.Ec2InstanceSet {
+	var found *computev1.Ec2InstanceSet
+	for _, set := range sets {
+		switch {
+		case revision != 0 && revisionOf(set) == revision:
+			return set
+		case revision == 0 && set.Labels[computev1.TemplateHashLabel] != currentHash:
+			if found == nil || revisionOf(set) > revisionOf(found) {
+				found = set
+			}
+		}
+	}
+	return found
+}
+
+// rollingUpdateBounds resolves maxSurge and maxUnavailable against the desired replicas.
+// Like for Deployments, both default to 25% and maxUnavailable is at least 1 when maxSurge is 0.
+func rollingUpdateBounds(deployment *computev1.Ec2InstanceDeployment) (int32, int32, error) {
+	defaultBound := intstr.FromString("25%")
+	surge, unavailable := &defaultBound, &defaultBound
+	if params := deployment.Spec.Strategy.RollingUpdate; params != nil {
+		if params.MaxSurge != nil {
+			surge = params.MaxSurge
+		}
+		if params.MaxUnavailable != nil {
+			unavailable = params.MaxUnavailable
+		}
+	}
+
+	desired := int(deploymentReplicas(deployment))
+	maxSurge, err := intstr.GetScaledValueFromIntOrPercent(surge, desired, true)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid maxSurge: %w", err)
+	}
+	maxUnavailable, err := intstr.GetScaledValueFromIntOrPercent(unavailable, desired, false)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid maxUnavailable: %w", err)
+	}
+	if maxSurge == 0 && maxUnavailable == 0 {
+		maxUnavailable = 1
+	}
+	return int32(maxSurge), int32(maxUnavailable), nil
+}
+
+func deploymentStrategy(deployment *computev1.Ec2InstanceDeployment) computev1.Ec2InstanceDeploymentStrategyType {
+	if deployment.Spec.Strategy.Type == "" {
+		return computev1.RollingUpdateStrategyType
+	}
+	return deployment.Spec.Strategy.Type
+}
+
+func deploymentReplicas(deployment *computev1.Ec2InstanceDeployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+	return *deployment.Spec.Replicas
+}
+
+func revisionOf(set *computev1.Ec2InstanceSet) int64 {
+	revision, _ := strconv.ParseInt(set.Annotations[computev1.RevisionAnnotation], 10, 64)
+	return revision
+}
+
+// sortByRevision orders sets from the oldest to the newest revision.
+func sortByRevision(sets []*computev1.Ec2InstanceSet) {
+	sort.SliceStable(sets, func(i, j int) bool { return revisionOf(sets[i]) < revisionOf(sets[j]) })
+}
+
+func totalReplicas(newSet *computev1.Ec2InstanceSet, oldSets []*computev1.Ec2InstanceSet) int32 {
+	total := replicasOf(newSet)
+	for _, set := range oldSets {
+		total += replicasOf(set)
+	}
+	return total
+}
+
+func totalReady(newSet *computev1.Ec2InstanceSet, oldSets []*computev1.Ec2InstanceSet) int32 {
+	total := newSet.Status.ReadyReplicas
+	for _, set := range oldSets {
+		total += set.Status.ReadyReplicas
+	}
+	return total
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Owned Ec2InstanceSets are watched so that the rollout continues as their instances become ready.
+func (r *Ec2InstanceDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&computev1.Ec2InstanceDeployment{}).
+		Owns(&computev1.Ec2InstanceSet{}).
+		Named("ec2instancedeployment").
+		Complete(r)
+}
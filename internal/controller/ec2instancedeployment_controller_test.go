@@ -0,0 +1,275 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+var _ = Describe("Ec2InstanceDeployment Controller", func() {
+	Context("When reconciling a resource", func() {
+		const resourceName = "test-deployment"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var controllerReconciler *Ec2InstanceDeploymentReconciler
+
+		reconcileDeployment := func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		getDeployment := func() *computev1.Ec2InstanceDeployment {
+			deployment := &computev1.Ec2InstanceDeployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			return deployment
+		}
+
+		// setsByRevision returns the replicas of every owned set, keyed by revision.
+		setsByRevision := func() map[int64]int32 {
+			list := &computev1.Ec2InstanceSetList{}
+			Expect(k8sClient.List(ctx, list, client.InNamespace("default"),
+				client.MatchingLabels{computev1.InstanceDeploymentLabel: resourceName})).To(Succeed())
+			replicas := map[int64]int32{}
+			for i := range list.Items {
+				replicas[revisionOf(&list.Items[i])] = replicasOf(&list.Items[i])
+			}
+			return replicas
+		}
+
+		// markReady simulates the Ec2InstanceSet controller: every set reports all its replicas as ready.
+		markReady := func() {
+			list := &computev1.Ec2InstanceSetList{}
+			Expect(k8sClient.List(ctx, list, client.InNamespace("default"),
+				client.MatchingLabels{computev1.InstanceDeploymentLabel: resourceName})).To(Succeed())
+			for i := range list.Items {
+				set := &list.Items[i]
+				set.Status.Replicas = replicasOf(set)
+				set.Status.ReadyReplicas = replicasOf(set)
+				Expect(k8sClient.Status().Update(ctx, set)).To(Succeed())
+			}
+		}
+
+		// runInstances simulates the Ec2InstanceSet and Ec2Instance controllers: every set creates its instances,
+		// which are launched and running. Instances that are not Ready yet become Ready only when ready is true.
+		runInstances := func(ready bool) {
+			sets := &computev1.Ec2InstanceSetList{}
+			Expect(k8sClient.List(ctx, sets, client.InNamespace("default"),
+				client.MatchingLabels{computev1.InstanceDeploymentLabel: resourceName})).To(Succeed())
+			setReconciler := &Ec2InstanceSetReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+			for i := range sets.Items {
+				_, err := setReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&sets.Items[i])})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			instances := &computev1.Ec2InstanceList{}
+			Expect(k8sClient.List(ctx, instances, client.InNamespace("default"),
+				client.MatchingLabels{computev1.InstanceDeploymentLabel: resourceName})).To(Succeed())
+			for i := range instances.Items {
+				instance := &instances.Items[i]
+				if isEc2InstanceReady(instance) {
+					continue
+				}
+				instance.Status.InstanceID = "i-" + instance.Name
+				instance.Status.State = "running"
+				status, reason := metav1.ConditionFalse, computev1.ReasonInstanceUnhealthy
+				if ready {
+					status, reason = metav1.ConditionTrue, computev1.ReasonInstanceHealthy
+				}
+				meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{Type: computev1.ConditionReady, Status: status, Reason: reason})
+				Expect(k8sClient.Status().Update(ctx, instance)).To(Succeed())
+			}
+			for i := range sets.Items {
+				_, err := setReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&sets.Items[i])})
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+
+		changeAMI := func(ami string) {
+			deployment := getDeployment()
+			deployment.Spec.Template.Spec.AMIId = ami
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			By("creating the custom resource for the Kind Ec2InstanceDeployment")
+			resource := &computev1.Ec2InstanceDeployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: computev1.Ec2InstanceDeploymentSpec{
+					Replicas: ptr.To[int32](4),
+					Template: computev1.Ec2InstanceTemplateSpec{
+						Metadata: computev1.Ec2InstanceTemplateMetadata{Labels: map[string]string{"app": "web"}},
+						Spec: computev1.Ec2InstanceSpec{
+							InstanceType: "t3.micro",
+							AMIId:        "ami-0000000000000000a",
+							Region:       "eu-central-1",
+						},
+					},
+					Strategy: computev1.Ec2InstanceDeploymentStrategy{
+						Type: computev1.RollingUpdateStrategyType,
+						RollingUpdate: &computev1.RollingUpdateEc2InstanceDeployment{
+							MaxSurge:       ptr.To(intstr.FromInt32(1)),
+							MaxUnavailable: ptr.To(intstr.FromInt32(0)),
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			controllerReconciler = &Ec2InstanceDeploymentReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+		})
+
+		AfterEach(func() {
+			By("Cleanup the specific resource instance Ec2InstanceDeployment and its sets")
+			Expect(k8sClient.Delete(ctx, getDeployment())).To(Succeed())
+			Expect(k8sClient.DeleteAllOf(ctx, &computev1.Ec2InstanceSet{}, client.InNamespace("default"),
+				client.MatchingLabels{computev1.InstanceDeploymentLabel: resourceName})).To(Succeed())
+			Expect(k8sClient.DeleteAllOf(ctx, &computev1.Ec2Instance{}, client.InNamespace("default"),
+				client.MatchingLabels{computev1.InstanceDeploymentLabel: resourceName})).To(Succeed())
+		})
+
+		It("should create a set for the first revision with all replicas", func() {
+			reconcileDeployment()
+
+			Expect(setsByRevision()).To(Equal(map[int64]int32{1: 4}))
+			deployment := getDeployment()
+			Expect(deployment.Status.Revision).To(BeEquivalentTo(1))
+			Expect(deployment.Status.Selector).To(Equal(computev1.InstanceDeploymentLabel + "=" + resourceName))
+			Expect(meta.IsStatusConditionTrue(deployment.Status.Conditions, computev1.ConditionAvailable)).To(BeFalse())
+		})
+
+		It("should roll out a template change within maxSurge and maxUnavailable", func() {
+			reconcileDeployment()
+			markReady()
+			reconcileDeployment()
+			Expect(meta.FindStatusCondition(getDeployment().Status.Conditions, computev1.ConditionProgressing).Reason).
+				To(Equal(computev1.ReasonRolloutComplete))
+
+			changeAMI("ami-0000000000000000b")
+			reconcileDeployment()
+			By("surging one new instance while keeping all old ones")
+			Expect(setsByRevision()).To(Equal(map[int64]int32{1: 4, 2: 1}))
+
+			By("waiting for the new instance to be ready before removing an old one")
+			reconcileDeployment()
+			Expect(setsByRevision()).To(Equal(map[int64]int32{1: 4, 2: 1}))
+			markReady()
+			reconcileDeployment()
+			Expect(setsByRevision()).To(Equal(map[int64]int32{1: 3, 2: 1}))
+
+			for i := 0; i < 8; i++ {
+				markReady()
+				reconcileDeployment()
+			}
+			Expect(setsByRevision()).To(Equal(map[int64]int32{1: 0, 2: 4}))
+			markReady()
+			reconcileDeployment()
+			deployment := getDeployment()
+			Expect(deployment.Status.UpdatedReplicas).To(BeEquivalentTo(4))
+			Expect(meta.FindStatusCondition(deployment.Status.Conditions, computev1.ConditionProgressing).Reason).
+				To(Equal(computev1.ReasonRolloutComplete))
+		})
+
+		It("should not remove old instances while the new ones run but are not Ready", func() {
+			reconcileDeployment()
+			runInstances(true)
+			reconcileDeployment()
+
+			changeAMI("ami-0000000000000000b")
+			reconcileDeployment()
+			Expect(setsByRevision()).To(Equal(map[int64]int32{1: 4, 2: 1}))
+
+			By("keeping all old instances while the new one fails its health checks")
+			runInstances(false)
+			reconcileDeployment()
+			Expect(setsByRevision()).To(Equal(map[int64]int32{1: 4, 2: 1}))
+
+			runInstances(true)
+			reconcileDeployment()
+			Expect(setsByRevision()).To(Equal(map[int64]int32{1: 3, 2: 1}))
+		})
+
+		It("should not roll out while paused", func() {
+			reconcileDeployment()
+			deployment := getDeployment()
+			deployment.Spec.Paused = true
+			deployment.Spec.Template.Spec.AMIId = "ami-0000000000000000b"
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+
+			reconcileDeployment()
+			Expect(setsByRevision()).To(Equal(map[int64]int32{1: 4}))
+			Expect(meta.FindStatusCondition(getDeployment().Status.Conditions, computev1.ConditionProgressing).Reason).
+				To(Equal(computev1.ReasonRolloutPaused))
+		})
+
+		It("should roll back to the previous revision", func() {
+			reconcileDeployment()
+			markReady()
+			changeAMI("ami-0000000000000000b")
+			reconcileDeployment()
+
+			deployment := getDeployment()
+			deployment.Spec.RollbackTo = &computev1.Ec2InstanceRollback{}
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+			reconcileDeployment()
+
+			deployment = getDeployment()
+			Expect(deployment.Spec.RollbackTo).To(BeNil())
+			Expect(deployment.Spec.Template.Spec.AMIId).To(Equal("ami-0000000000000000a"))
+			Expect(deployment.Spec.Template.Metadata.Labels).To(Equal(map[string]string{"app": "web"}))
+
+			By("making the set of the restored template the newest revision")
+			reconcileDeployment()
+			Expect(setsByRevision()).To(HaveKeyWithValue(BeEquivalentTo(3), BeEquivalentTo(4)))
+		})
+
+		It("should report a rollback to an unknown revision", func() {
+			reconcileDeployment()
+			deployment := getDeployment()
+			deployment.Spec.RollbackTo = &computev1.Ec2InstanceRollback{Revision: 7}
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+			reconcileDeployment()
+
+			condition := meta.FindStatusCondition(getDeployment().Status.Conditions, computev1.ConditionProgressing)
+			Expect(condition.Reason).To(Equal(computev1.ReasonRollbackFailed))
+			Expect(condition.Message).To(ContainSubstring("revision 7 not found"))
+		})
+	})
+})
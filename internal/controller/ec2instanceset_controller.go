@@ -0,0 +1,304 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// instanceSetCacheSyncDelay is how long a set waits for the cache to show an instance it created before.
+const instanceSetCacheSyncDelay = 5 * time.Second
+
+// Ec2InstanceSetReconciler reconciles a Ec2InstanceSet object.
+// It creates and deletes owned Ec2Instance objects until the number of instances matches spec.replicas;
+// the Ec2InstanceReconciler takes care of launching and terminating the actual EC2 instances.
+type Ec2InstanceSetReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instancesets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instancesets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instancesets/finalizers,verbs=update
+
+// Reconcile compares the owned Ec2Instances with spec.replicas, creates or deletes the difference,
+// and reports the current and ready replicas in the status.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.2/pkg/reconcile
+func (r *Ec2InstanceSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	set := &computev1.Ec2InstanceSet{}
+	if err := r.Get(ctx, req.NamespacedName, set); err != nil {
+		// Owned Ec2Instances are garbage collected through their owner reference.
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !set.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	instances, err := r.ownedInstances(ctx, set)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	desired := int(replicasOf(set))
+	switch diff := desired - len(instances); {
+	case diff > 0:
+		l.Info("Scaling up", "current", len(instances), "desired", desired)
+		// Instances still being deleted keep their names until their EC2 instance is terminated.
+		taken, err := r.instanceNames(ctx, set)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		for i := 0; i < diff; i++ {
+			instance, err := r.newInstance(set, instances, taken)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if err := r.Create(ctx, instance); err != nil {
+				if errors.IsAlreadyExists(err) {
+					// Created by an earlier reconcile the cache does not show yet; creating another instance
+					// under a new name would launch a duplicate EC2 instance.
+					l.Info("Ec2Instance already exists, waiting for the cache to catch up", "name", instance.Name)
+					return ctrl.Result{RequeueAfter: instanceSetCacheSyncDelay}, nil
+				}
+				l.Error(err, "Failed to create Ec2Instance")
+				return ctrl.Result{}, err
+			}
+			l.Info("Created Ec2Instance", "name", instance.Name, "availabilityZone", instance.Spec.AvailabilityZone, "subnet", instance.Spec.Subnet)
+			instances = append(instances, *instance)
+			taken[instance.Name] = true
+		}
+	case diff < 0:
+		l.Info("Scaling down", "current", len(instances), "desired", desired)
+		for _, instance := range instancesToDelete(set, instances, -diff) {
+			if err := r.Delete(ctx, &instance); client.IgnoreNotFound(err) != nil {
+				l.Error(err, "Failed to delete Ec2Instance", "name", instance.Name)
+				return ctrl.Result{}, err
+			}
+			l.Info("Deleted Ec2Instance", "name", instance.Name)
+		}
+		instances, err = r.ownedInstances(ctx, set)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, r.updateStatus(ctx, set, instances)
+}
+
+// ownedInstances lists the Ec2Instances controlled by the set that are not being deleted.
+func (r *Ec2InstanceSetReconciler) ownedInstances(ctx context.Context, set *computev1.Ec2InstanceSet) ([]computev1.Ec2Instance, error) {
+	list := &computev1.Ec2InstanceList{}
+	if err := r.List(ctx, list, client.InNamespace(set.Namespace), client.MatchingLabels{computev1.InstanceSetLabel: set.Name}); err != nil {
+		return nil, err
+	}
+	var owned []computev1.Ec2Instance
+	for _, instance := range list.Items {
+		if !instance.DeletionTimestamp.IsZero() || !metav1.IsControlledBy(&instance, set) {
+			continue
+		}
+		owned = append(owned, instance)
+	}
+	return owned, nil
+}
+
+// instanceNames returns the names of every Ec2Instance labeled with the set, including those being deleted.
+func (r *Ec2InstanceSetReconciler) instanceNames(ctx context.Context, set *computev1.Ec2InstanceSet) (map[string]bool, error) {
+	list := &computev1.Ec2InstanceList{}
+	if err := r.List(ctx, list, client.InNamespace(set.Namespace), client.MatchingLabels{computev1.InstanceSetLabel: set.Name}); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(list.Items))
+	for _, instance := range list.Items {
+		names[instance.Name] = true
+	}
+	return names, nil
+}
+
+// newInstance builds a new Ec2Instance from the set's template, placed in the least used placement,
+// and named after the lowest ordinal not taken.
+func (r *Ec2InstanceSetReconciler) newInstance(set *computev1.Ec2InstanceSet, existing []computev1.Ec2Instance, taken map[string]bool) (*computev1.Ec2Instance, error) {
+	instance := &computev1.Ec2Instance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        instanceName(set, taken),
+			Namespace:   set.Namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+	}
+	for key, value := range set.Spec.Template.Metadata.Labels {
+		instance.Labels[key] = value
+	}
+	for key, value := range set.Spec.Template.Metadata.Annotations {
+		instance.Annotations[key] = value
+	}
+	instance.Labels[computev1.InstanceSetLabel] = set.Name
+	set.Spec.Template.Spec.DeepCopyInto(&instance.Spec)
+
+	if len(set.Spec.Placements) > 0 {
+		counts := placementCounts(set, existing)
+		least := 0
+		for i := range counts {
+			if counts[i] < counts[least] {
+				least = i
+			}
+		}
+		applyPlacement(&instance.Spec, set.Spec.Placements[least])
+	}
+
+	if err := controllerutil.SetControllerReference(set, instance, r.Scheme); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+// instanceName returns <set>-<ordinal> for the lowest ordinal not taken. Unlike generated names,
+// creating the same replica twice from a stale cache fails with AlreadyExists.
+func instanceName(set *computev1.Ec2InstanceSet, taken map[string]bool) string {
+	for ordinal := 0; ; ordinal++ {
+		if name := fmt.Sprintf("%s-%d", set.Name, ordinal); !taken[name] {
+			return name
+		}
+	}
+}
+
+// updateStatus reports the owned and ready replicas and the selector used by the scale subresource.
+func (r *Ec2InstanceSetReconciler) updateStatus(ctx context.Context, set *computev1.Ec2InstanceSet, instances []computev1.Ec2Instance) error {
+	status := computev1.Ec2InstanceSetStatus{
+		Replicas:           int32(len(instances)),
+		Selector:           labels.SelectorFromSet(labels.Set{computev1.InstanceSetLabel: set.Name}).String(),
+		ObservedGeneration: set.Generation,
+	}
+	for i := range instances {
+		if isEc2InstanceReady(&instances[i]) {
+			status.ReadyReplicas++
+		}
+	}
+	if status == set.Status {
+		return nil
+	}
+	set.Status = status
+	if err := r.Status().Update(ctx, set); err != nil {
+		if errors.IsConflict(err) {
+			// A newer version of the set is on its way and will be reconciled again.
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// instancesToDelete picks count instances to remove on scale-down: instances that are not ready go first,
+// then instances from the most crowded placement, and the newest instances before older ones.
+func instancesToDelete(set *computev1.Ec2InstanceSet, instances []computev1.Ec2Instance, count int) []computev1.Ec2Instance {
+	remaining := append([]computev1.Ec2Instance(nil), instances...)
+	counts := placementCounts(set, remaining)
+
+	var victims []computev1.Ec2Instance
+	for ; count > 0 && len(remaining) > 0; count-- {
+		sort.SliceStable(remaining, func(i, j int) bool {
+			a, b := &remaining[i], &remaining[j]
+			if readyA, readyB := isEc2InstanceReady(a), isEc2InstanceReady(b); readyA != readyB {
+				return !readyA
+			}
+			if crowdA, crowdB := countFor(counts, placementIndex(set, a)), countFor(counts, placementIndex(set, b)); crowdA != crowdB {
+				return crowdA > crowdB
+			}
+			return b.CreationTimestamp.Before(&a.CreationTimestamp)
+		})
+		victim := remaining[0]
+		remaining = remaining[1:]
+		if idx := placementIndex(set, &victim); idx >= 0 {
+			counts[idx]--
+		}
+		victims = append(victims, victim)
+	}
+	return victims
+}
+
+// placementCounts returns the number of instances per placement of the set.
+func placementCounts(set *computev1.Ec2InstanceSet, instances []computev1.Ec2Instance) []int {
+	counts := make([]int, len(set.Spec.Placements))
+	for i := range instances {
+		if idx := placementIndex(set, &instances[i]); idx >= 0 {
+			counts[idx]++
+		}
+	}
+	return counts
+}
+
+// placementIndex returns the index of the placement the instance was created in, or -1.
+func placementIndex(set *computev1.Ec2InstanceSet, instance *computev1.Ec2Instance) int {
+	for i, placement := range set.Spec.Placements {
+		spec := instance.Spec.DeepCopy()
+		applyPlacement(spec, placement)
+		if spec.AvailabilityZone == instance.Spec.AvailabilityZone && spec.Subnet == instance.Spec.Subnet {
+			return i
+		}
+	}
+	return -1
+}
+
+func countFor(counts []int, idx int) int {
+	if idx < 0 {
+		return 0
+	}
+	return counts[idx]
+}
+
+func applyPlacement(spec *computev1.Ec2InstanceSpec, placement computev1.Ec2InstancePlacement) {
+	if placement.AvailabilityZone != "" {
+		spec.AvailabilityZone = placement.AvailabilityZone
+	}
+	if placement.Subnet != "" {
+		spec.Subnet = placement.Subnet
+	}
+}
+
+func replicasOf(set *computev1.Ec2InstanceSet) int32 {
+	if set.Spec.Replicas == nil {
+		return 1
+	}
+	return *set.Spec.Replicas
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Owned Ec2Instances are watched so that the ready replicas follow the instances' state.
+func (r *Ec2InstanceSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&computev1.Ec2InstanceSet{}).
+		Owns(&computev1.Ec2Instance{}).
+		Named("ec2instanceset").
+		Complete(r)
+}
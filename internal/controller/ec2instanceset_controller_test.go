@@ -0,0 +1,155 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+var _ = Describe("Ec2InstanceSet Controller", func() {
+	Context("When reconciling a resource", func() {
+		const resourceName = "test-set"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var controllerReconciler *Ec2InstanceSetReconciler
+
+		ownedInstances := func() []computev1.Ec2Instance {
+			list := &computev1.Ec2InstanceList{}
+			Expect(k8sClient.List(ctx, list, client.InNamespace("default"),
+				client.MatchingLabels{computev1.InstanceSetLabel: resourceName})).To(Succeed())
+			return list.Items
+		}
+
+		reconcileSet := func() {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			By("creating the custom resource for the Kind Ec2InstanceSet")
+			resource := &computev1.Ec2InstanceSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: computev1.Ec2InstanceSetSpec{
+					Replicas: ptr.To[int32](3),
+					Template: computev1.Ec2InstanceTemplateSpec{
+						Metadata: computev1.Ec2InstanceTemplateMetadata{Labels: map[string]string{"app": "web"}},
+						Spec: computev1.Ec2InstanceSpec{
+							InstanceType: "t3.micro",
+							AMIId:        "ami-09042b2f6d07d164a",
+							Region:       "eu-central-1",
+						},
+					},
+					Placements: []computev1.Ec2InstancePlacement{
+						{AvailabilityZone: "eu-central-1a", Subnet: "subnet-0aaa"},
+						{AvailabilityZone: "eu-central-1b", Subnet: "subnet-0bbb"},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			controllerReconciler = &Ec2InstanceSetReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+		})
+
+		AfterEach(func() {
+			resource := &computev1.Ec2InstanceSet{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+
+			By("Cleanup the specific resource instance Ec2InstanceSet and its instances")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			for _, instance := range ownedInstances() {
+				Expect(k8sClient.Delete(ctx, &instance)).To(Succeed())
+			}
+		})
+
+		It("should create the replicas spread over the placements", func() {
+			reconcileSet()
+
+			instances := ownedInstances()
+			Expect(instances).To(HaveLen(3))
+			zones := map[string]int{}
+			Expect([]string{instances[0].Name, instances[1].Name, instances[2].Name}).
+				To(ConsistOf(resourceName+"-0", resourceName+"-1", resourceName+"-2"))
+			for _, instance := range instances {
+				Expect(instance.Labels).To(HaveKeyWithValue("app", "web"))
+				Expect(metav1.GetControllerOf(&instance).Kind).To(Equal("Ec2InstanceSet"))
+				zones[instance.Spec.AvailabilityZone]++
+			}
+			Expect(zones).To(Equal(map[string]int{"eu-central-1a": 2, "eu-central-1b": 1}))
+
+			set := &computev1.Ec2InstanceSet{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, set)).To(Succeed())
+			Expect(set.Status.Replicas).To(BeEquivalentTo(3))
+			Expect(set.Status.ReadyReplicas).To(BeEquivalentTo(0))
+			Expect(set.Status.Selector).To(Equal(computev1.InstanceSetLabel + "=" + resourceName))
+		})
+
+		It("should not create a replica twice when the cache misses an instance it created", func() {
+			By("creating the first replica without the label the set lists its instances by, as if the cache missed it")
+			existing := &computev1.Ec2Instance{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-0", Namespace: "default"},
+				Spec:       computev1.Ec2InstanceSpec{InstanceType: "t3.micro", AMIId: "ami-09042b2f6d07d164a", Region: "eu-central-1"},
+			}
+			Expect(k8sClient.Create(ctx, existing)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, existing)).To(Succeed())
+			})
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(instanceSetCacheSyncDelay))
+			Expect(ownedInstances()).To(BeEmpty())
+		})
+
+		It("should scale down from the most crowded placement", func() {
+			reconcileSet()
+
+			set := &computev1.Ec2InstanceSet{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, set)).To(Succeed())
+			set.Spec.Replicas = ptr.To[int32](2)
+			Expect(k8sClient.Update(ctx, set)).To(Succeed())
+			reconcileSet()
+
+			instances := ownedInstances()
+			Expect(instances).To(HaveLen(2))
+			Expect([]string{instances[0].Spec.AvailabilityZone, instances[1].Spec.AvailabilityZone}).
+				To(ConsistOf("eu-central-1a", "eu-central-1b"))
+		})
+	})
+})
@@ -0,0 +1,372 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	ec2SnapshotFinalizer = "ec2snapshot.compute.cloud.com"
+	// snapshotUIDTag marks the EBS snapshots taken for an Ec2Snapshot, so that snapshots taken by a reconcile
+	// whose status update failed are found and reused instead of being taken twice.
+	snapshotUIDTag = "compute.cloud.com/snapshot-uid"
+	// snapshotPollInterval is how often pending snapshots, and sources that are not ready yet, are checked.
+	snapshotPollInterval = time.Minute
+)
+
+// snapshotAPI is the part of the EC2 client used to take and delete EBS snapshots.
+type snapshotAPI interface {
+	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	DescribeSnapshots(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error)
+	CreateSnapshot(ctx context.Context, params *ec2.CreateSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.CreateSnapshotOutput, error)
+	CreateSnapshots(ctx context.Context, params *ec2.CreateSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.CreateSnapshotsOutput, error)
+	DeleteSnapshot(ctx context.Context, params *ec2.DeleteSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.DeleteSnapshotOutput, error)
+}
+
+// snapshotTarget is what a SnapshotSource resolved to: either a launched instance or a created volume.
+type snapshotTarget struct {
+	region     string
+	instanceID string
+	volumeID   string
+}
+
+// snapshotSourceError is returned when the source cannot be snapshotted (yet).
+type snapshotSourceError struct {
+	reason  string
+	message string
+}
+
+func (e *snapshotSourceError) Error() string {
+	return e.message
+}
+
+// Ec2SnapshotReconciler reconciles a Ec2Snapshot object.
+// It snapshots the volumes of the source once, follows the snapshots until they complete,
+// and deletes them with the Ec2Snapshot unless its deletion policy is Retain.
+type Ec2SnapshotReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2snapshots,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2snapshots/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2snapshots/finalizers,verbs=update
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2instances;ebsvolumes,verbs=get;list;watch
+
+// Reconcile takes the snapshots of a new Ec2Snapshot and reports their progress until they are ready to use.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.2/pkg/reconcile
+func (r *Ec2SnapshotReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	snapshot := &computev1.Ec2Snapshot{}
+	if err := r.Get(ctx, req.NamespacedName, snapshot); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !snapshot.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(snapshot, ec2SnapshotFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		if snapshot.Spec.DeletionPolicy != computev1.VolumeDeletionPolicyRetain && len(snapshot.Status.Snapshots) > 0 {
+			if err := deleteSnapshots(ctx, awsClient(snapshot.Status.Region), snapshot.Status.Snapshots); err != nil {
+				l.Error(err, "Failed to delete EBS snapshots")
+				// Kubernetes will retry with backoff
+				return ctrl.Result{}, err
+			}
+		}
+		controllerutil.RemoveFinalizer(snapshot, ec2SnapshotFinalizer)
+		if err := r.Update(ctx, snapshot); err != nil {
+			l.Error(err, "Failed to remove finalizer")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if controllerutil.AddFinalizer(snapshot, ec2SnapshotFinalizer) {
+		if err := r.Update(ctx, snapshot); err != nil {
+			l.Error(err, "Failed to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if len(snapshot.Status.Snapshots) == 0 {
+		target, err := resolveSnapshotSource(ctx, r.Client, snapshot.Namespace, snapshot.Spec.Source)
+		var sourceErr *snapshotSourceError
+		switch {
+		case stderrors.As(err, &sourceErr):
+			l.Info("Not taking snapshot yet", "reason", sourceErr.reason, "message", sourceErr.message)
+			setSnapshotReady(snapshot, metav1.ConditionFalse, sourceErr.reason, sourceErr.message)
+			if err := r.Status().Update(ctx, snapshot); err != nil {
+				l.Error(err, "Failed to update status")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: snapshotPollInterval}, nil
+		case err != nil:
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+
+		statuses, err := takeSnapshots(ctx, awsClient(target.region), snapshot, target)
+		if err != nil {
+			l.Error(err, "Failed to take EBS snapshots")
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+		snapshot.Status.Region = target.region
+		snapshot.Status.Snapshots = statuses
+		snapshot.Status.CreationTime = &metav1.Time{Time: time.Now()}
+	} else if err := refreshSnapshots(ctx, awsClient(snapshot.Status.Region), snapshot.Status.Snapshots); err != nil {
+		l.Error(err, "Failed to describe EBS snapshots")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	result := ctrl.Result{}
+	pending, failed := 0, 0
+	for _, status := range snapshot.Status.Snapshots {
+		switch ec2types.SnapshotState(status.State) {
+		case ec2types.SnapshotStateCompleted:
+		case ec2types.SnapshotStateError:
+			failed++
+		default:
+			pending++
+		}
+	}
+	snapshot.Status.ReadyToUse = pending == 0 && failed == 0
+	switch {
+	case failed > 0:
+		setSnapshotReady(snapshot, metav1.ConditionFalse, computev1.ReasonSnapshotFailed,
+			fmt.Sprintf("%d of %d snapshots failed", failed, len(snapshot.Status.Snapshots)))
+	case pending > 0:
+		setSnapshotReady(snapshot, metav1.ConditionFalse, computev1.ReasonSnapshotPending,
+			fmt.Sprintf("%d of %d snapshots pending", pending, len(snapshot.Status.Snapshots)))
+		result.RequeueAfter = snapshotPollInterval
+	default:
+		setSnapshotReady(snapshot, metav1.ConditionTrue, computev1.ReasonSnapshotCompleted,
+			fmt.Sprintf("%d snapshots completed", len(snapshot.Status.Snapshots)))
+	}
+
+	if err := r.Status().Update(ctx, snapshot); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// resolveSnapshotSource finds the launched instance or created volume a source refers to.
+func resolveSnapshotSource(ctx context.Context, c client.Client, namespace string, source computev1.SnapshotSource) (snapshotTarget, error) {
+	if source.InstanceName != "" {
+		instance := &computev1.Ec2Instance{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: source.InstanceName}, instance); err != nil {
+			if errors.IsNotFound(err) {
+				return snapshotTarget{}, &snapshotSourceError{computev1.ReasonSnapshotSourceNotFound, fmt.Sprintf("Ec2Instance %s not found", source.InstanceName)}
+			}
+			return snapshotTarget{}, err
+		}
+		if instance.Status.InstanceID == "" {
+			return snapshotTarget{}, &snapshotSourceError{computev1.ReasonSnapshotSourceNotReady, fmt.Sprintf("Ec2Instance %s has not been launched", source.InstanceName)}
+		}
+		return snapshotTarget{region: instanceRegion(instance), instanceID: instance.Status.InstanceID}, nil
+	}
+
+	volume := &computev1.EbsVolume{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: source.VolumeName}, volume); err != nil {
+		if errors.IsNotFound(err) {
+			return snapshotTarget{}, &snapshotSourceError{computev1.ReasonSnapshotSourceNotFound, fmt.Sprintf("EbsVolume %s not found", source.VolumeName)}
+		}
+		return snapshotTarget{}, err
+	}
+	if volume.Status.VolumeID == "" {
+		return snapshotTarget{}, &snapshotSourceError{computev1.ReasonSnapshotSourceNotReady, fmt.Sprintf("EbsVolume %s has not been created", source.VolumeName)}
+	}
+	return snapshotTarget{region: volume.Spec.Region, volumeID: volume.Status.VolumeID}, nil
+}
+
+// takeSnapshots snapshots the target's volumes: all volumes of an instance at once, so that they are consistent
+// with each other, or the single volume. Snapshots already taken for the Ec2Snapshot are returned instead.
+func takeSnapshots(ctx context.Context, api snapshotAPI, snapshot *computev1.Ec2Snapshot, target snapshotTarget) ([]computev1.VolumeSnapshotStatus, error) {
+	l := log.FromContext(ctx)
+
+	devices := map[string]string{}
+	if target.instanceID != "" {
+		instances, err := api.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{target.instanceID}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instance %s: %w", target.instanceID, err)
+		}
+		for _, reservation := range instances.Reservations {
+			for _, instance := range reservation.Instances {
+				for _, mapping := range instance.BlockDeviceMappings {
+					if mapping.Ebs != nil {
+						devices[aws.ToString(mapping.Ebs.VolumeId)] = aws.ToString(mapping.DeviceName)
+					}
+				}
+			}
+		}
+	}
+	status := func(snapshotID, volumeID *string, state ec2types.SnapshotState, progress *string) computev1.VolumeSnapshotStatus {
+		return computev1.VolumeSnapshotStatus{
+			DeviceName: devices[aws.ToString(volumeID)],
+			VolumeID:   aws.ToString(volumeID),
+			SnapshotID: aws.ToString(snapshotID),
+			State:      string(state),
+			Progress:   aws.ToString(progress),
+		}
+	}
+
+	existing, err := api.DescribeSnapshots(ctx, &ec2.DescribeSnapshotsInput{
+		OwnerIds: []string{"self"},
+		Filters:  []ec2types.Filter{{Name: aws.String("tag:" + snapshotUIDTag), Values: []string{string(snapshot.UID)}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe snapshots: %w", err)
+	}
+	var statuses []computev1.VolumeSnapshotStatus
+	for _, s := range existing.Snapshots {
+		statuses = append(statuses, status(s.SnapshotId, s.VolumeId, s.State, s.Progress))
+	}
+	if len(statuses) > 0 {
+		return statuses, nil
+	}
+
+	tags := []ec2types.Tag{{Key: aws.String(snapshotUIDTag), Value: aws.String(string(snapshot.UID))}}
+	for key, value := range snapshot.Spec.Tags {
+		tags = append(tags, ec2types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	tagSpecifications := []ec2types.TagSpecification{{ResourceType: ec2types.ResourceTypeSnapshot, Tags: tags}}
+	description := snapshot.Spec.Description
+	if description == "" {
+		description = fmt.Sprintf("Ec2Snapshot %s/%s", snapshot.Namespace, snapshot.Name)
+	}
+
+	if target.instanceID != "" {
+		l.Info("Snapshotting instance volumes", "instanceID", target.instanceID)
+		output, err := api.CreateSnapshots(ctx, &ec2.CreateSnapshotsInput{
+			InstanceSpecification: &ec2types.InstanceSpecification{InstanceId: aws.String(target.instanceID)},
+			Description:           aws.String(description),
+			TagSpecifications:     tagSpecifications,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot instance %s: %w", target.instanceID, err)
+		}
+		for _, s := range output.Snapshots {
+			statuses = append(statuses, status(s.SnapshotId, s.VolumeId, s.State, s.Progress))
+		}
+		return statuses, nil
+	}
+
+	l.Info("Snapshotting volume", "volumeID", target.volumeID)
+	output, err := api.CreateSnapshot(ctx, &ec2.CreateSnapshotInput{
+		VolumeId:          aws.String(target.volumeID),
+		Description:       aws.String(description),
+		TagSpecifications: tagSpecifications,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot volume %s: %w", target.volumeID, err)
+	}
+	return []computev1.VolumeSnapshotStatus{status(output.SnapshotId, output.VolumeId, output.State, output.Progress)}, nil
+}
+
+// refreshSnapshots updates the state and progress of the snapshots in place.
+func refreshSnapshots(ctx context.Context, api snapshotAPI, statuses []computev1.VolumeSnapshotStatus) error {
+	ids := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		ids = append(ids, status.SnapshotID)
+	}
+	// Filtering instead of passing snapshot IDs, because AWS returns an error for deleted snapshots.
+	described, err := api.DescribeSnapshots(ctx, &ec2.DescribeSnapshotsInput{
+		Filters: []ec2types.Filter{{Name: aws.String("snapshot-id"), Values: ids}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe snapshots: %w", err)
+	}
+	byID := map[string]ec2types.Snapshot{}
+	for _, s := range described.Snapshots {
+		byID[aws.ToString(s.SnapshotId)] = s
+	}
+	for i := range statuses {
+		s, ok := byID[statuses[i].SnapshotID]
+		if !ok {
+			statuses[i].State = string(ec2types.SnapshotStateError)
+			statuses[i].Message = "snapshot no longer exists"
+			continue
+		}
+		statuses[i].State = string(s.State)
+		statuses[i].Progress = aws.ToString(s.Progress)
+		statuses[i].Message = aws.ToString(s.StateMessage)
+	}
+	return nil
+}
+
+// deleteSnapshots deletes the snapshots that still exist.
+func deleteSnapshots(ctx context.Context, api snapshotAPI, statuses []computev1.VolumeSnapshotStatus) error {
+	ids := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		ids = append(ids, status.SnapshotID)
+	}
+	described, err := api.DescribeSnapshots(ctx, &ec2.DescribeSnapshotsInput{
+		Filters: []ec2types.Filter{{Name: aws.String("snapshot-id"), Values: ids}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe snapshots: %w", err)
+	}
+	for _, s := range described.Snapshots {
+		log.FromContext(ctx).Info("Deleting EBS snapshot", "snapshotID", aws.ToString(s.SnapshotId))
+		if _, err := api.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{SnapshotId: s.SnapshotId}); err != nil {
+			return fmt.Errorf("failed to delete snapshot %s: %w", aws.ToString(s.SnapshotId), err)
+		}
+	}
+	return nil
+}
+
+func setSnapshotReady(snapshot *computev1.Ec2Snapshot, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&snapshot.Status.Conditions, metav1.Condition{
+		Type:               computev1.ConditionSnapshotReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: snapshot.Generation,
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *Ec2SnapshotReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&computev1.Ec2Snapshot{}).
+		Named("ec2snapshot").
+		Complete(r)
+}
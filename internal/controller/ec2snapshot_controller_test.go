@@ -0,0 +1,191 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// fakeSnapshots snapshots an instance with a root volume on /dev/xvda and a data volume on /dev/sdf.
+// Snapshots are pending when taken, and completed once described.
+type fakeSnapshots struct {
+	snapshots map[string]ec2types.Snapshot
+	taken     int
+	deleted   []string
+}
+
+func newFakeSnapshots() *fakeSnapshots {
+	return &fakeSnapshots{snapshots: map[string]ec2types.Snapshot{}}
+}
+
+func (f *fakeSnapshots) DescribeInstances(_ context.Context, _ *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return newFakeVolumes().DescribeInstances(context.Background(), nil)
+}
+
+func (f *fakeSnapshots) DescribeSnapshots(_ context.Context, params *ec2.DescribeSnapshotsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+	output := &ec2.DescribeSnapshotsOutput{}
+	for _, filter := range params.Filters {
+		for _, value := range filter.Values {
+			for id, snapshot := range f.snapshots {
+				if id == value || snapshotTagged(snapshot, aws.ToString(filter.Name), value) {
+					snapshot.State = ec2types.SnapshotStateCompleted
+					snapshot.Progress = aws.String("100%")
+					f.snapshots[id] = snapshot
+					output.Snapshots = append(output.Snapshots, snapshot)
+				}
+			}
+		}
+	}
+	return output, nil
+}
+
+func snapshotTagged(snapshot ec2types.Snapshot, filter, value string) bool {
+	for _, tag := range snapshot.Tags {
+		if "tag:"+aws.ToString(tag.Key) == filter && aws.ToString(tag.Value) == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeSnapshots) take(volumeID string, tags []ec2types.TagSpecification) ec2types.Snapshot {
+	f.taken++
+	snapshot := ec2types.Snapshot{
+		SnapshotId: aws.String(fmt.Sprintf("snap-%d", f.taken)),
+		VolumeId:   aws.String(volumeID),
+		State:      ec2types.SnapshotStatePending,
+		Progress:   aws.String("0%"),
+		Tags:       tags[0].Tags,
+	}
+	f.snapshots[aws.ToString(snapshot.SnapshotId)] = snapshot
+	return snapshot
+}
+
+func (f *fakeSnapshots) CreateSnapshot(_ context.Context, params *ec2.CreateSnapshotInput, _ ...func(*ec2.Options)) (*ec2.CreateSnapshotOutput, error) {
+	snapshot := f.take(aws.ToString(params.VolumeId), params.TagSpecifications)
+	return &ec2.CreateSnapshotOutput{SnapshotId: snapshot.SnapshotId, VolumeId: snapshot.VolumeId, State: snapshot.State, Progress: snapshot.Progress}, nil
+}
+
+func (f *fakeSnapshots) CreateSnapshots(_ context.Context, params *ec2.CreateSnapshotsInput, _ ...func(*ec2.Options)) (*ec2.CreateSnapshotsOutput, error) {
+	output := &ec2.CreateSnapshotsOutput{}
+	for _, volumeID := range []string{"vol-root", "vol-data"} {
+		snapshot := f.take(volumeID, params.TagSpecifications)
+		output.Snapshots = append(output.Snapshots, ec2types.SnapshotInfo{SnapshotId: snapshot.SnapshotId, VolumeId: snapshot.VolumeId, State: snapshot.State, Progress: snapshot.Progress})
+	}
+	return output, nil
+}
+
+func (f *fakeSnapshots) DeleteSnapshot(_ context.Context, params *ec2.DeleteSnapshotInput, _ ...func(*ec2.Options)) (*ec2.DeleteSnapshotOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(params.SnapshotId))
+	delete(f.snapshots, aws.ToString(params.SnapshotId))
+	return &ec2.DeleteSnapshotOutput{}, nil
+}
+
+var _ = Describe("Ec2Snapshot Controller", func() {
+	ctx := context.Background()
+
+	var (
+		api      *fakeSnapshots
+		snapshot *computev1.Ec2Snapshot
+	)
+
+	BeforeEach(func() {
+		api = newFakeSnapshots()
+		snapshot = &computev1.Ec2Snapshot{ObjectMeta: metav1.ObjectMeta{Name: "db-backup", Namespace: "default", UID: "1234"}}
+	})
+
+	It("should snapshot all volumes of an instance together and follow them until they complete", func() {
+		statuses, err := takeSnapshots(ctx, api, snapshot, snapshotTarget{instanceID: "i-0123"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statuses).To(Equal([]computev1.VolumeSnapshotStatus{
+			{DeviceName: "/dev/xvda", VolumeID: "vol-root", SnapshotID: "snap-1", State: "pending", Progress: "0%"},
+			{DeviceName: "/dev/sdf", VolumeID: "vol-data", SnapshotID: "snap-2", State: "pending", Progress: "0%"},
+		}))
+
+		Expect(refreshSnapshots(ctx, api, statuses)).To(Succeed())
+		Expect(statuses[0].State).To(Equal("completed"))
+		Expect(statuses[1].Progress).To(Equal("100%"))
+	})
+
+	It("should not take the snapshots twice", func() {
+		_, err := takeSnapshots(ctx, api, snapshot, snapshotTarget{volumeID: "vol-data"})
+		Expect(err).NotTo(HaveOccurred())
+
+		statuses, err := takeSnapshots(ctx, api, snapshot, snapshotTarget{volumeID: "vol-data"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api.taken).To(Equal(1))
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].SnapshotID).To(Equal("snap-1"))
+	})
+
+	It("should report snapshots deleted outside of the operator as failed", func() {
+		statuses := []computev1.VolumeSnapshotStatus{{VolumeID: "vol-data", SnapshotID: "snap-gone", State: "completed"}}
+		Expect(refreshSnapshots(ctx, api, statuses)).To(Succeed())
+		Expect(statuses[0].State).To(Equal("error"))
+	})
+
+	It("should delete only the snapshots that still exist", func() {
+		statuses, err := takeSnapshots(ctx, api, snapshot, snapshotTarget{instanceID: "i-0123"})
+		Expect(err).NotTo(HaveOccurred())
+		delete(api.snapshots, "snap-1")
+
+		Expect(deleteSnapshots(ctx, api, statuses)).To(Succeed())
+		Expect(api.deleted).To(ConsistOf("snap-2"))
+	})
+
+	Context("When resolving the source", func() {
+		It("should wait for the instance to be launched", func() {
+			instance := &computev1.Ec2Instance{
+				ObjectMeta: metav1.ObjectMeta{Name: "snapshot-source", Namespace: "default"},
+				Spec:       computev1.Ec2InstanceSpec{InstanceType: "t3.micro", AMIId: "ami-09042b2f6d07d164a", Region: "eu-central-1"},
+			}
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+			})
+
+			var sourceErr *snapshotSourceError
+			_, err := resolveSnapshotSource(ctx, k8sClient, "default", computev1.SnapshotSource{InstanceName: "snapshot-source"})
+			Expect(errors.As(err, &sourceErr)).To(BeTrue())
+			Expect(sourceErr.reason).To(Equal(computev1.ReasonSnapshotSourceNotReady))
+
+			instance.Status.InstanceID = "i-0123"
+			Expect(k8sClient.Status().Update(ctx, instance)).To(Succeed())
+			target, err := resolveSnapshotSource(ctx, k8sClient, "default", computev1.SnapshotSource{InstanceName: "snapshot-source"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(target).To(Equal(snapshotTarget{region: "eu-central-1", instanceID: "i-0123"}))
+		})
+
+		It("should report a missing volume", func() {
+			var sourceErr *snapshotSourceError
+			_, err := resolveSnapshotSource(ctx, k8sClient, "default", computev1.SnapshotSource{VolumeName: "missing"})
+			Expect(errors.As(err, &sourceErr)).To(BeTrue())
+			Expect(sourceErr.reason).To(Equal(computev1.ReasonSnapshotSourceNotFound))
+		})
+	})
+})
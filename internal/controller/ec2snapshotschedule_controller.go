@@ -0,0 +1,250 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// maxMissedSchedules bounds how many missed schedule times are skipped over, e.g. after the operator was down
+// for a long time with a schedule firing every minute. Like for CronJobs, only the most recent one is run.
+const maxMissedSchedules = 1000
+
+// Ec2SnapshotScheduleReconciler reconciles a Ec2SnapshotSchedule object.
+// It creates an Ec2Snapshot every time the schedule fires and prunes the snapshots its retention no longer keeps;
+// the Ec2SnapshotReconciler takes and deletes the actual EBS snapshots.
+type Ec2SnapshotScheduleReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2snapshotschedules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2snapshotschedules/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2snapshotschedules/finalizers,verbs=update
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=ec2snapshots,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile takes a snapshot when one is due, prunes old snapshots, and requeues for the next schedule time.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.2/pkg/reconcile
+func (r *Ec2SnapshotScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	schedule := &computev1.Ec2SnapshotSchedule{}
+	if err := r.Get(ctx, req.NamespacedName, schedule); err != nil {
+		// Owned Ec2Snapshots are garbage collected through their owner reference.
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !schedule.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	snapshots, err := r.ownedSnapshots(ctx, schedule)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	cronSchedule, err := cron.ParseStandard(schedule.Spec.Schedule)
+	if err != nil {
+		meta.SetStatusCondition(&schedule.Status.Conditions, metav1.Condition{
+			Type:               computev1.ConditionScheduleValid,
+			Status:             metav1.ConditionFalse,
+			Reason:             computev1.ReasonScheduleInvalid,
+			Message:            fmt.Sprintf("Invalid schedule %q: %v", schedule.Spec.Schedule, err),
+			ObservedGeneration: schedule.Generation,
+		})
+		schedule.Status.NextScheduleTime = nil
+		// Kubernetes will not retry - the schedule has to be fixed first
+		return ctrl.Result{}, r.updateStatus(ctx, schedule, snapshots)
+	}
+	meta.SetStatusCondition(&schedule.Status.Conditions, metav1.Condition{
+		Type:               computev1.ConditionScheduleValid,
+		Status:             metav1.ConditionTrue,
+		Reason:             computev1.ReasonScheduleValid,
+		Message:            fmt.Sprintf("Snapshots are taken on schedule %q", schedule.Spec.Schedule),
+		ObservedGeneration: schedule.Generation,
+	})
+
+	now := time.Now().UTC()
+	result := ctrl.Result{}
+	if schedule.Spec.Suspend {
+		schedule.Status.NextScheduleTime = nil
+	} else {
+		last := schedule.CreationTimestamp.Time
+		if schedule.Status.LastScheduleTime != nil {
+			last = schedule.Status.LastScheduleTime.Time
+		}
+		if due, ok := mostRecentScheduleTime(cronSchedule, last, now); ok {
+			snapshot, err := r.newSnapshot(schedule, due)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			l.Info("Taking scheduled snapshot", "snapshot", snapshot.Name, "scheduledFor", due)
+			switch err := r.Create(ctx, snapshot); {
+			case errors.IsAlreadyExists(err):
+				// Created by an earlier reconcile whose status update failed; it is among the owned snapshots.
+			case err != nil:
+				l.Error(err, "Failed to create Ec2Snapshot")
+				return ctrl.Result{}, err
+			default:
+				snapshots = append([]computev1.Ec2Snapshot{*snapshot}, snapshots...)
+			}
+			schedule.Status.LastScheduleTime = &metav1.Time{Time: due}
+		}
+		next := cronSchedule.Next(now)
+		schedule.Status.NextScheduleTime = &metav1.Time{Time: next}
+		result.RequeueAfter = next.Sub(now)
+	}
+
+	for _, snapshot := range snapshotsToPrune(snapshots, schedule.Spec.Retention, now) {
+		l.Info("Pruning snapshot", "snapshot", snapshot.Name)
+		if err := r.Delete(ctx, &snapshot); client.IgnoreNotFound(err) != nil {
+			l.Error(err, "Failed to delete Ec2Snapshot", "snapshot", snapshot.Name)
+			return ctrl.Result{}, err
+		}
+		snapshots = removeSnapshot(snapshots, snapshot.Name)
+	}
+
+	return result, r.updateStatus(ctx, schedule, snapshots)
+}
+
+// ownedSnapshots lists the Ec2Snapshots controlled by the schedule that are not being deleted, newest first.
+func (r *Ec2SnapshotScheduleReconciler) ownedSnapshots(ctx context.Context, schedule *computev1.Ec2SnapshotSchedule) ([]computev1.Ec2Snapshot, error) {
+	list := &computev1.Ec2SnapshotList{}
+	if err := r.List(ctx, list, client.InNamespace(schedule.Namespace), client.MatchingLabels{computev1.SnapshotScheduleLabel: schedule.Name}); err != nil {
+		return nil, err
+	}
+	var owned []computev1.Ec2Snapshot
+	for _, snapshot := range list.Items {
+		if !snapshot.DeletionTimestamp.IsZero() || !metav1.IsControlledBy(&snapshot, schedule) {
+			continue
+		}
+		owned = append(owned, snapshot)
+	}
+	sortSnapshotsNewestFirst(owned)
+	return owned, nil
+}
+
+// newSnapshot builds the Ec2Snapshot for a schedule time. The name is derived from the time,
+// so that a snapshot is never taken twice for the same schedule time.
+func (r *Ec2SnapshotScheduleReconciler) newSnapshot(schedule *computev1.Ec2SnapshotSchedule, scheduledFor time.Time) (*computev1.Ec2Snapshot, error) {
+	snapshot := &computev1.Ec2Snapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", schedule.Name, scheduledFor.Unix()),
+			Namespace: schedule.Namespace,
+			Labels:    map[string]string{computev1.SnapshotScheduleLabel: schedule.Name},
+		},
+		Spec: computev1.Ec2SnapshotSpec{
+			Source:         schedule.Spec.Source,
+			Description:    fmt.Sprintf("Ec2SnapshotSchedule %s/%s at %s", schedule.Namespace, schedule.Name, scheduledFor.Format(time.RFC3339)),
+			Tags:           schedule.Spec.Tags,
+			DeletionPolicy: schedule.Spec.DeletionPolicy,
+		},
+	}
+	if err := controllerutil.SetControllerReference(schedule, snapshot, r.Scheme); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// updateStatus reports the kept snapshots and the most recent one that is ready to use.
+func (r *Ec2SnapshotScheduleReconciler) updateStatus(ctx context.Context, schedule *computev1.Ec2SnapshotSchedule, snapshots []computev1.Ec2Snapshot) error {
+	schedule.Status.Snapshots = int32(len(snapshots))
+	for _, snapshot := range snapshots {
+		if snapshot.Status.ReadyToUse {
+			schedule.Status.LastSuccessfulSnapshot = snapshot.Name
+			break
+		}
+	}
+	if err := r.Status().Update(ctx, schedule); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update status")
+		return err
+	}
+	return nil
+}
+
+// mostRecentScheduleTime returns the latest time the schedule fired after last and no later than now.
+func mostRecentScheduleTime(schedule cron.Schedule, last, now time.Time) (time.Time, bool) {
+	var due time.Time
+	for t, i := schedule.Next(last.UTC()), 0; !t.After(now) && i < maxMissedSchedules; t, i = schedule.Next(t), i+1 {
+		due = t
+	}
+	return due, !due.IsZero()
+}
+
+// snapshotsToPrune returns the snapshots, sorted newest first, that are beyond the retention count or older than
+// its maximum age. Snapshots that are still being taken are kept, but do count towards the retention count.
+func snapshotsToPrune(snapshots []computev1.Ec2Snapshot, retention computev1.SnapshotRetention, now time.Time) []computev1.Ec2Snapshot {
+	var prune []computev1.Ec2Snapshot
+	for i, snapshot := range snapshots {
+		if !snapshot.Status.ReadyToUse && !snapshotFailed(&snapshot) {
+			continue
+		}
+		tooMany := retention.Count != nil && i >= int(*retention.Count)
+		tooOld := retention.MaxAge != nil && now.Sub(snapshot.CreationTimestamp.Time) > retention.MaxAge.Duration
+		if tooMany || tooOld {
+			prune = append(prune, snapshot)
+		}
+	}
+	return prune
+}
+
+func snapshotFailed(snapshot *computev1.Ec2Snapshot) bool {
+	condition := meta.FindStatusCondition(snapshot.Status.Conditions, computev1.ConditionSnapshotReady)
+	return condition != nil && condition.Reason == computev1.ReasonSnapshotFailed
+}
+
+func sortSnapshotsNewestFirst(snapshots []computev1.Ec2Snapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[j].CreationTimestamp.Before(&snapshots[i].CreationTimestamp)
+	})
+}
+
+func removeSnapshot(snapshots []computev1.Ec2Snapshot, name string) []computev1.Ec2Snapshot {
+	kept := snapshots[:0]
+	for _, snapshot := range snapshots {
+		if snapshot.Name != name {
+			kept = append(kept, snapshot)
+		}
+	}
+	return kept
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Owned Ec2Snapshots are watched so that the last successful snapshot follows their progress.
+func (r *Ec2SnapshotScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&computev1.Ec2SnapshotSchedule{}).
+		Owns(&computev1.Ec2Snapshot{}).
+		Named("ec2snapshotschedule").
+		Complete(r)
+}
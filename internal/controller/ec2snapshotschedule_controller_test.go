@@ -0,0 +1,138 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+var _ = Describe("Ec2SnapshotSchedule Controller", func() {
+	ctx := context.Background()
+
+	It("should run only the most recent missed schedule time", func() {
+		schedule, err := cron.ParseStandard("0 3 * * *")
+		Expect(err).NotTo(HaveOccurred())
+		last := time.Date(2025, 3, 1, 3, 0, 0, 0, time.UTC)
+
+		_, ok := mostRecentScheduleTime(schedule, last, last.Add(23*time.Hour))
+		Expect(ok).To(BeFalse())
+
+		due, ok := mostRecentScheduleTime(schedule, last, last.Add(72*time.Hour+time.Minute))
+		Expect(ok).To(BeTrue())
+		Expect(due).To(Equal(time.Date(2025, 3, 4, 3, 0, 0, 0, time.UTC)))
+	})
+
+	It("should prune beyond the retention count and age, but never snapshots in progress", func() {
+		now := time.Now()
+		snapshot := func(name string, age time.Duration, ready bool) computev1.Ec2Snapshot {
+			return computev1.Ec2Snapshot{
+				ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(now.Add(-age))},
+				Status:     computev1.Ec2SnapshotStatus{ReadyToUse: ready},
+			}
+		}
+		snapshots := []computev1.Ec2Snapshot{
+			snapshot("pending", 0, false),
+			snapshot("day-1", 24*time.Hour, true),
+			snapshot("day-2", 48*time.Hour, true),
+			snapshot("day-3", 72*time.Hour, true),
+		}
+		names := func(snapshots []computev1.Ec2Snapshot) []string {
+			var names []string
+			for _, snapshot := range snapshots {
+				names = append(names, snapshot.Name)
+			}
+			return names
+		}
+
+		Expect(snapshotsToPrune(snapshots, computev1.SnapshotRetention{}, now)).To(BeEmpty())
+		Expect(names(snapshotsToPrune(snapshots, computev1.SnapshotRetention{Count: ptr.To[int32](2)}, now))).To(Equal([]string{"day-2", "day-3"}))
+		Expect(names(snapshotsToPrune(snapshots, computev1.SnapshotRetention{MaxAge: &metav1.Duration{Duration: 36 * time.Hour}}, now))).To(Equal([]string{"day-2", "day-3"}))
+		Expect(names(snapshotsToPrune(snapshots, computev1.SnapshotRetention{Count: ptr.To[int32](1), MaxAge: &metav1.Duration{Duration: time.Minute}}, now))).
+			To(Equal([]string{"day-1", "day-2", "day-3"}))
+	})
+
+	Context("When reconciling a resource", func() {
+		const resourceName = "nightly"
+		typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"}
+
+		var schedule *computev1.Ec2SnapshotSchedule
+
+		BeforeEach(func() {
+			schedule = &computev1.Ec2SnapshotSchedule{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: computev1.Ec2SnapshotScheduleSpec{
+					Schedule: "*/5 * * * *",
+					Source:   computev1.SnapshotSource{VolumeName: "data"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, schedule)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, schedule)).To(Succeed())
+				Expect(k8sClient.DeleteAllOf(ctx, &computev1.Ec2Snapshot{}, client.InNamespace("default"),
+					client.MatchingLabels{computev1.SnapshotScheduleLabel: resourceName})).To(Succeed())
+			})
+		})
+
+		It("should create a snapshot when the schedule is due, once", func() {
+			schedule.Status.LastScheduleTime = &metav1.Time{Time: time.Now().Add(-10 * time.Minute)}
+			Expect(k8sClient.Status().Update(ctx, schedule)).To(Succeed())
+
+			controllerReconciler := &Ec2SnapshotScheduleReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("<=", 5*time.Minute))
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			snapshots := &computev1.Ec2SnapshotList{}
+			Expect(k8sClient.List(ctx, snapshots, client.MatchingLabels{computev1.SnapshotScheduleLabel: resourceName})).To(Succeed())
+			Expect(snapshots.Items).To(HaveLen(1))
+			Expect(snapshots.Items[0].Spec.Source.VolumeName).To(Equal("data"))
+			Expect(metav1.IsControlledBy(&snapshots.Items[0], schedule)).To(BeTrue())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, schedule)).To(Succeed())
+			Expect(schedule.Status.Snapshots).To(BeEquivalentTo(1))
+			Expect(schedule.Status.NextScheduleTime).NotTo(BeNil())
+		})
+
+		It("should report an invalid schedule", func() {
+			schedule.Spec.Schedule = "every night"
+			Expect(k8sClient.Update(ctx, schedule)).To(Succeed())
+
+			controllerReconciler := &Ec2SnapshotScheduleReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, schedule)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(schedule.Status.Conditions, computev1.ConditionScheduleValid)).To(BeTrue())
+		})
+	})
+})
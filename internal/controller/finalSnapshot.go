@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// finalSnapshotName derives the name of an instance's final Ec2Snapshot from its instance ID,
+// so that an instance launched again under the same name gets a final snapshot of its own.
+func finalSnapshotName(ec2Instance *computev1.Ec2Instance) string {
+	return fmt.Sprintf("%s-final-%s", ec2Instance.Name, ec2Instance.Status.InstanceID)
+}
+
+// finalSnapshot returns the final Ec2Snapshot of a deleted instance, creating it on first call.
+// The Ec2Snapshot is not owned by the instance, so that it is kept once the instance is gone.
+func (r *Ec2InstanceReconciler) finalSnapshot(ctx context.Context, ec2Instance *computev1.Ec2Instance) (*computev1.Ec2Snapshot, error) {
+	snapshot := &computev1.Ec2Snapshot{}
+	key := types.NamespacedName{Namespace: ec2Instance.Namespace, Name: finalSnapshotName(ec2Instance)}
+	if err := r.Get(ctx, key, snapshot); !errors.IsNotFound(err) {
+		return snapshot, err
+	}
+
+	tags := maps.Clone(ec2Instance.Spec.Tags)
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	maps.Copy(tags, ec2Instance.Spec.FinalSnapshot.Tags)
+	snapshot = &computev1.Ec2Snapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels:    map[string]string{computev1.FinalSnapshotLabel: ec2Instance.Name},
+		},
+		Spec: computev1.Ec2SnapshotSpec{
+			Source:         computev1.SnapshotSource{InstanceName: ec2Instance.Name},
+			Description:    fmt.Sprintf("Final snapshot of Ec2Instance %s/%s (%s)", ec2Instance.Namespace, ec2Instance.Name, ec2Instance.Status.InstanceID),
+			Tags:           tags,
+			DeletionPolicy: ec2Instance.Spec.FinalSnapshot.DeletionPolicy,
+		},
+	}
+	log.FromContext(ctx).Info("Taking final snapshot", "snapshot", snapshot.Name, "instanceID", ec2Instance.Status.InstanceID)
+	if err := r.Create(ctx, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// setFinalSnapshotCondition reports the progress of the final snapshot on the instance, using the reason
+// and message of the Ec2Snapshot's Ready condition.
+func setFinalSnapshotCondition(ec2Instance *computev1.Ec2Instance, snapshot *computev1.Ec2Snapshot) {
+	condition := metav1.Condition{
+		Type:               computev1.ConditionFinalSnapshotTaken,
+		Status:             metav1.ConditionFalse,
+		Reason:             computev1.ReasonSnapshotPending,
+		Message:            fmt.Sprintf("Waiting for Ec2Snapshot %s", snapshot.Name),
+		ObservedGeneration: ec2Instance.Generation,
+	}
+	if ready := meta.FindStatusCondition(snapshot.Status.Conditions, computev1.ConditionSnapshotReady); ready != nil {
+		condition.Status = ready.Status
+		condition.Reason = ready.Reason
+		condition.Message = fmt.Sprintf("Ec2Snapshot %s: %s", snapshot.Name, ready.Message)
+	}
+	meta.SetStatusCondition(&ec2Instance.Status.Conditions, condition)
+}
+
+// instanceForFinalSnapshot maps a final Ec2Snapshot to a reconcile request for the instance waiting for it.
+func (r *Ec2InstanceReconciler) instanceForFinalSnapshot(_ context.Context, snapshot client.Object) []reconcile.Request {
+	name, ok := snapshot.GetLabels()[computev1.FinalSnapshotLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: snapshot.GetNamespace(), Name: name}}}
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+var _ = Describe("Final snapshot", func() {
+	ctx := context.Background()
+	typeNamespacedName := types.NamespacedName{Name: "final-snapshot", Namespace: "default"}
+
+	It("should snapshot the volumes of a deleted instance before terminating it", func() {
+		instance := &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       typeNamespacedName.Name,
+				Namespace:  typeNamespacedName.Namespace,
+				Finalizers: []string{"ec2instance.compute.cloud.com"},
+			},
+			Spec: computev1.Ec2InstanceSpec{
+				InstanceType:  "t3.micro",
+				AMIId:         "ami-09042b2f6d07d164a",
+				Region:        "eu-central-1",
+				Tags:          map[string]string{"team": "data"},
+				FinalSnapshot: &computev1.FinalSnapshot{Tags: map[string]string{"purpose": "final"}, DeletionPolicy: computev1.VolumeDeletionPolicyRetain},
+			},
+		}
+		Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		instance.Status.InstanceID = "i-0123"
+		Expect(k8sClient.Status().Update(ctx, instance)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+
+		// No AWS call is made while the snapshot is pending, so the reconcile succeeds without credentials.
+		controllerReconciler := &Ec2InstanceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(reconcile.Result{}))
+
+		snapshot := &computev1.Ec2Snapshot{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "final-snapshot-final-i-0123", Namespace: "default"}, snapshot)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, snapshot)).To(Succeed())
+		})
+		Expect(snapshot.Spec.Source).To(Equal(computev1.SnapshotSource{InstanceName: typeNamespacedName.Name}))
+		Expect(snapshot.Spec.Tags).To(Equal(map[string]string{"team": "data", "purpose": "final"}))
+		Expect(snapshot.Spec.DeletionPolicy).To(Equal(computev1.VolumeDeletionPolicyRetain))
+		Expect(snapshot.OwnerReferences).To(BeEmpty())
+		Expect(controllerReconciler.instanceForFinalSnapshot(ctx, snapshot)).To(ConsistOf(reconcile.Request{NamespacedName: typeNamespacedName}))
+
+		Expect(k8sClient.Get(ctx, typeNamespacedName, instance)).To(Succeed())
+		condition := meta.FindStatusCondition(instance.Status.Conditions, computev1.ConditionFinalSnapshotTaken)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(computev1.ReasonSnapshotPending))
+
+		By("reusing the Ec2Snapshot on the next reconcile")
+		_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(k8sClient.Get(ctx, typeNamespacedName, instance)).To(Succeed())
+		controllerutil.RemoveFinalizer(instance, "ec2instance.compute.cloud.com")
+		Expect(k8sClient.Update(ctx, instance)).To(Succeed())
+	})
+})
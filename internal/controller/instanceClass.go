@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// classNameField is the field index used to find the Ec2Instances referencing a class.
+const classNameField = ".spec.className"
+
+// classForbiddenError is returned when an Ec2Instance asks for something its class does not allow.
+// Unlike other resolution errors it will not go away by retrying, only by changing the spec or the class.
+type classForbiddenError struct {
+	reason string
+}
+
+func (e *classForbiddenError) Error() string {
+	return e.reason
+}
+
+// resolveEc2InstanceSpec merges the Ec2InstanceClass referenced by spec.className into the spec.
+// It returns a copy of the Ec2Instance carrying the effective spec, and the class it was resolved from
+// (nil when no class is referenced). The passed object is never modified.
+func resolveEc2InstanceSpec(ctx context.Context, c client.Client, ec2Instance *computev1.Ec2Instance) (*computev1.Ec2Instance, *computev1.Ec2InstanceClass, error) {
+	resolved := ec2Instance.DeepCopy()
+	if ec2Instance.Spec.ClassName == "" {
+		return resolved, nil, nil
+	}
+
+	class := &computev1.Ec2InstanceClass{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ec2Instance.Spec.ClassName}, class); err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkClassAllowsNamespace(ctx, c, class, ec2Instance.Namespace); err != nil {
+		return nil, nil, err
+	}
+	if err := checkClassAllowsOverrides(class, &ec2Instance.Spec); err != nil {
+		return nil, nil, err
+	}
+
+	mergeClassIntoSpec(&resolved.Spec, &class.Spec)
+
+	if err := checkClassAllowsInstanceType(class, resolved.Spec.InstanceType); err != nil {
+		return nil, nil, err
+	}
+
+	return resolved, class, nil
+}
+
+// mergeClassIntoSpec fills every field the spec leaves unset from the class.
+// Class tags are applied last so that instances cannot replace them.
+func mergeClassIntoSpec(spec *computev1.Ec2InstanceSpec, class *computev1.Ec2InstanceClassSpec) {
+	fillString(&spec.InstanceType, class.InstanceType)
+	// amiId and image are two ways of choosing the AMI, the class only provides one when the spec sets neither.
+	if spec.AMIId == "" && spec.Image == nil {
+		spec.AMIId = class.AMIId
+		spec.Image = class.Image.DeepCopy()
+	}
+	fillString(&spec.Region, class.Region)
+	fillString(&spec.AvailabilityZone, class.AvailabilityZone)
+	fillString(&spec.KeyPair, class.KeyPair)
+	fillString(&spec.Subnet, class.Subnet)
+	fillString(&spec.IAMInstanceProfile, class.IAMInstanceProfile)
+	fillString(&spec.UserData, class.UserData)
+
+	if len(spec.SecurityGroups) == 0 {
+		spec.SecurityGroups = slices.Clone(class.SecurityGroups)
+	}
+	if class.Storage != nil && isStorageUnset(&spec.Storage) {
+		class.Storage.DeepCopyInto(&spec.Storage)
+	}
+	if !spec.AssociatePublicIP && class.AssociatePublicIP != nil {
+		spec.AssociatePublicIP = *class.AssociatePublicIP
+	}
+
+	if len(class.Tags) > 0 && spec.Tags == nil {
+		spec.Tags = map[string]string{}
+	}
+	for key, value := range class.Tags {
+		spec.Tags[key] = value
+	}
+}
+
+// overriddenFields returns the JSON names of the fields an Ec2Instance sets itself, excluding
+// the class reference and tags, which are merged rather than overridden. Fields that replace what
+// the class governs in another way are reported under the name of the class field they override.
+func overriddenFields(spec *computev1.Ec2InstanceSpec) []string {
+	var fields []string
+	set := func(name string, isSet bool) {
+		if isSet {
+			fields = append(fields, name)
+		}
+	}
+	set("instanceType", spec.InstanceType != "")
+	set("amiId", spec.AMIId != "")
+	set("image", spec.Image != nil)
+	set("region", spec.Region != "")
+	// EbsVolumes decide the availability zone the instance is launched in.
+	set("availabilityZone", spec.AvailabilityZone != "" || len(spec.Volumes) > 0)
+	set("keyPair", spec.KeyPair != "" || spec.KeyPairRef != "")
+	set("securityGroups", len(spec.SecurityGroups) > 0 || len(spec.SecurityGroupRefs) > 0)
+	set("subnet", spec.Subnet != "")
+	set("iamInstanceProfile", spec.IAMInstanceProfile != "")
+	set("userData", spec.UserData != "" || spec.UserDataTemplate || spec.CloudInit != nil || len(spec.UserDataFrom) > 0)
+	set("storage", !isStorageUnset(&spec.Storage))
+	set("associatePublicIP", spec.AssociatePublicIP)
+	return fields
+}
+
+func checkClassAllowsOverrides(class *computev1.Ec2InstanceClass, spec *computev1.Ec2InstanceSpec) error {
+	if len(class.Spec.AllowedOverrides) == 0 {
+		return nil
+	}
+	for _, name := range overriddenFields(spec) {
+		if !slices.Contains(class.Spec.AllowedOverrides, name) {
+			return &classForbiddenError{fmt.Sprintf("Ec2InstanceClass %s does not allow overriding %s (allowed: %v)",
+				class.Name, name, class.Spec.AllowedOverrides)}
+		}
+	}
+	return nil
+}
+
+func checkClassAllowsInstanceType(class *computev1.Ec2InstanceClass, instanceType string) error {
+	if len(class.Spec.AllowedInstanceTypes) == 0 {
+		return nil
+	}
+	for _, pattern := range class.Spec.AllowedInstanceTypes {
+		if ok, _ := path.Match(pattern, instanceType); ok {
+			return nil
+		}
+	}
+	return &classForbiddenError{fmt.Sprintf("Ec2InstanceClass %s does not allow instance type %q (allowed: %v)",
+		class.Name, instanceType, class.Spec.AllowedInstanceTypes)}
+}
+
+func checkClassAllowsNamespace(ctx context.Context, c client.Client, class *computev1.Ec2InstanceClass, namespace string) error {
+	if class.Spec.NamespaceSelector == nil {
+		return nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(class.Spec.NamespaceSelector)
+	if err != nil {
+		return &classForbiddenError{fmt.Sprintf("Ec2InstanceClass %s has an invalid namespaceSelector: %v", class.Name, err)}
+	}
+
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return err
+	}
+	if !selector.Matches(labels.Set(ns.Labels)) {
+		return &classForbiddenError{fmt.Sprintf("Ec2InstanceClass %s may not be used in namespace %s", class.Name, namespace)}
+	}
+	return nil
+}
+
+func fillString(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+func isStorageUnset(storage *computev1.StorageConfig) bool {
+	return storage.RootVolume == (computev1.VolumeConfig{}) && len(storage.AdditionalVolumes) == 0
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+var _ = Describe("Ec2InstanceClass resolution", func() {
+	ctx := context.Background()
+
+	var (
+		class    *computev1.Ec2InstanceClass
+		instance *computev1.Ec2Instance
+	)
+
+	BeforeEach(func() {
+		class = &computev1.Ec2InstanceClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-small"},
+			Spec: computev1.Ec2InstanceClassSpec{
+				InstanceType:       "t3.small",
+				AMIId:              "ami-09042b2f6d07d164a",
+				Region:             "eu-central-1",
+				SecurityGroups:     []string{"sg-09f5c9270d3d1d5f6"},
+				Subnet:             "subnet-0d417570cce95f348",
+				IAMInstanceProfile: "web-server",
+				Storage:            &computev1.StorageConfig{RootVolume: computev1.VolumeConfig{Size: 30, Type: "gp3"}},
+				Tags:               map[string]string{"CostCenter": "platform"},
+			},
+		}
+		instance = &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-server-1", Namespace: "default"},
+			Spec: computev1.Ec2InstanceSpec{
+				ClassName: "web-small",
+				Tags:      map[string]string{"CostCenter": "web", "Team": "web"},
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		Expect(k8sClient.Create(ctx, class)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, class)).To(Succeed())
+		})
+	})
+
+	It("should fill the unset fields from the class", func() {
+		instance.Spec.InstanceType = "t3.medium"
+
+		resolved, resolvedClass, err := resolveEc2InstanceSpec(ctx, k8sClient, instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolvedClass.Name).To(Equal("web-small"))
+		Expect(resolved.Spec.InstanceType).To(Equal("t3.medium"))
+		Expect(resolved.Spec.AMIId).To(Equal("ami-09042b2f6d07d164a"))
+		Expect(resolved.Spec.IAMInstanceProfile).To(Equal("web-server"))
+		Expect(resolved.Spec.Storage.RootVolume.Size).To(BeEquivalentTo(30))
+		By("keeping class tags and merging the instance tags")
+		Expect(resolved.Spec.Tags).To(Equal(map[string]string{"CostCenter": "platform", "Team": "web"}))
+		By("leaving the original object untouched")
+		Expect(instance.Spec.AMIId).To(BeEmpty())
+	})
+
+	It("should report a missing class as not found", func() {
+		instance.Spec.ClassName = "does-not-exist"
+		_, _, err := resolveEc2InstanceSpec(ctx, k8sClient, instance)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	Context("when the class restricts overrides", func() {
+		BeforeEach(func() {
+			class.Spec.AllowedOverrides = []string{"instanceType"}
+			class.Spec.AllowedInstanceTypes = []string{"t3.*"}
+		})
+
+		It("should allow overriding a listed field within the allowed instance types", func() {
+			instance.Spec.InstanceType = "t3.large"
+			_, _, err := resolveEc2InstanceSpec(ctx, k8sClient, instance)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should forbid overriding a field that is not listed", func() {
+			instance.Spec.Subnet = "subnet-0other"
+			_, _, err := resolveEc2InstanceSpec(ctx, k8sClient, instance)
+			var forbidden *classForbiddenError
+			Expect(err).To(BeAssignableToTypeOf(forbidden))
+			Expect(err.Error()).To(ContainSubstring("does not allow overriding subnet"))
+		})
+
+		DescribeTable("should forbid the fields replacing a governed field that is not listed",
+			func(override func(*computev1.Ec2InstanceSpec), name string) {
+				override(&instance.Spec)
+				_, _, err := resolveEc2InstanceSpec(ctx, k8sClient, instance)
+				var forbidden *classForbiddenError
+				Expect(err).To(BeAssignableToTypeOf(forbidden))
+				Expect(err.Error()).To(ContainSubstring("does not allow overriding " + name))
+			},
+			Entry("volumes", func(spec *computev1.Ec2InstanceSpec) {
+				spec.Volumes = []computev1.EbsVolumeAttachment{{Name: "data", DeviceName: "/dev/sdh"}}
+			}, "availabilityZone"),
+			Entry("securityGroupRefs", func(spec *computev1.Ec2InstanceSpec) { spec.SecurityGroupRefs = []string{"ssh"} }, "securityGroups"),
+			Entry("keyPairRef", func(spec *computev1.Ec2InstanceSpec) { spec.KeyPairRef = "admin" }, "keyPair"),
+			Entry("userDataFrom", func(spec *computev1.Ec2InstanceSpec) {
+				spec.UserDataFrom = []computev1.UserDataSource{{ConfigMapKeyRef: &computev1.UserDataKeyReference{Name: "bootstrap", Key: "setup.sh"}}}
+			}, "userData"),
+			Entry("userDataTemplate", func(spec *computev1.Ec2InstanceSpec) { spec.UserDataTemplate = true }, "userData"),
+			Entry("cloudInit", func(spec *computev1.Ec2InstanceSpec) {
+				spec.CloudInit = &computev1.CloudInitConfig{Packages: []string{"nginx"}}
+			}, "userData"),
+		)
+
+		It("should forbid instance types outside the allowed patterns", func() {
+			instance.Spec.InstanceType = "p4d.24xlarge"
+			_, _, err := resolveEc2InstanceSpec(ctx, k8sClient, instance)
+			Expect(err).To(MatchError(ContainSubstring(`does not allow instance type "p4d.24xlarge"`)))
+		})
+	})
+
+	Context("when the class restricts namespaces", func() {
+		BeforeEach(func() {
+			class.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}}
+		})
+
+		It("should forbid namespaces that do not match the selector", func() {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "class-tenant-a"}}
+			Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+			instance.Namespace = ns.Name
+
+			_, _, err := resolveEc2InstanceSpec(ctx, k8sClient, instance)
+			Expect(err).To(MatchError(ContainSubstring("may not be used in namespace class-tenant-a")))
+		})
+
+		It("should allow namespaces that match the selector", func() {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "class-tenant-b", Labels: map[string]string{"team": "web"}}}
+			Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+			instance.Namespace = ns.Name
+
+			_, _, err := resolveEc2InstanceSpec(ctx, k8sClient, instance)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when the instance is already launched", func() {
+		var reconciler *Ec2InstanceReconciler
+
+		BeforeEach(func() {
+			reconciler = &Ec2InstanceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		})
+
+		JustBeforeEach(func() {
+			Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+			})
+			instance.Status.InstanceID = "i-0123"
+			Expect(k8sClient.Status().Update(ctx, instance)).To(Succeed())
+		})
+
+		classResolved := func() *metav1.Condition {
+			return meta.FindStatusCondition(instance.Status.Conditions, computev1.ConditionClassResolved)
+		}
+
+		It("should keep reconciling it without the class once the class is gone", func() {
+			Expect(k8sClient.Delete(ctx, class)).To(Succeed())
+
+			resolved, err := reconciler.resolveLaunchedInstanceSpec(ctx, instance)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resolved).To(BeNil())
+			Expect(classResolved().Status).To(Equal(metav1.ConditionFalse))
+			Expect(classResolved().Reason).To(Equal(computev1.ReasonClassNotFound))
+
+			By("reporting the class as resolved again once it is back")
+			class.ResourceVersion = ""
+			Expect(k8sClient.Create(ctx, class)).To(Succeed())
+			resolved, err = reconciler.resolveLaunchedInstanceSpec(ctx, instance)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resolved.Spec.InstanceType).To(Equal("t3.small"))
+			Expect(classResolved().Status).To(Equal(metav1.ConditionTrue))
+			stored := &computev1.Ec2Instance{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(instance), stored)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(stored.Status.Conditions, computev1.ConditionClassResolved)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	defaultDNSRecordType = "A"
+	defaultDNSTTL        = 300
+	// dnsChangePollInterval is how often a pending Route 53 change is checked for propagation.
+	dnsChangePollInterval = 10 * time.Second
+)
+
+// dnsAPI is the part of the Route 53 client used to maintain the record of an instance.
+type dnsAPI interface {
+	ChangeResourceRecordSets(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error)
+	GetChange(ctx context.Context, params *route53.GetChangeInput, optFns ...func(*route53.Options)) (*route53.GetChangeOutput, error)
+}
+
+// reconcileDNS upserts the Route 53 record of spec.dns with the current address of the instance, deletes
+// the record written before when the record or the address goes away, and follows the propagation of the
+// change in status.dns.
+func (r *Ec2InstanceReconciler) reconcileDNS(ctx context.Context, api dnsAPI, ec2Instance *computev1.Ec2Instance) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	if ec2Instance.Spec.DNS == nil && ec2Instance.Status.DNS == nil {
+		return ctrl.Result{}, nil
+	}
+	observed := ec2Instance.Status.DeepCopy()
+	result, err := syncDNSRecord(ctx, api, ec2Instance)
+	if err != nil {
+		l.Error(err, "Failed to reconcile DNS record")
+		setDNSRecordSynced(ec2Instance, metav1.ConditionFalse, computev1.ReasonDNSChangeFailed, err.Error())
+	}
+	if equality.Semantic.DeepEqual(observed, &ec2Instance.Status) {
+		return result, err
+	}
+	if updateErr := r.Status().Update(ctx, ec2Instance); updateErr != nil {
+		l.Error(updateErr, "Failed to update status")
+		return ctrl.Result{}, updateErr
+	}
+	// Kubernetes will retry with backoff on err
+	return result, err
+}
+
+// syncDNSRecord brings the record of the instance in line with spec.dns and records it in the status.
+func syncDNSRecord(ctx context.Context, api dnsAPI, ec2Instance *computev1.Ec2Instance) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	desired := desiredDNSRecord(ec2Instance)
+	current := ec2Instance.Status.DNS
+
+	// The record written before has to go when spec.dns was removed, points elsewhere now, or the instance lost its address.
+	if current != nil && (desired == nil || desired.Value == "" || !sameDNSRecord(current, desired)) {
+		l.Info("Deleting DNS record", "record", current.RecordName, "type", current.RecordType, "value", current.Value)
+		if err := deleteDNSRecord(ctx, api, current); err != nil {
+			return ctrl.Result{}, err
+		}
+		ec2Instance.Status.DNS = nil
+		current = nil
+	}
+	if desired == nil {
+		meta.RemoveStatusCondition(&ec2Instance.Status.Conditions, computev1.ConditionDNSRecordSynced)
+		return ctrl.Result{}, nil
+	}
+	if desired.Value == "" {
+		setDNSRecordSynced(ec2Instance, metav1.ConditionFalse, computev1.ReasonDNSRecordNoAddress,
+			fmt.Sprintf("Instance %s has no address for a %s record while it is %s", ec2Instance.Status.InstanceID, desired.RecordType, ec2Instance.Status.State))
+		return ctrl.Result{}, nil
+	}
+
+	if current == nil || current.Value != desired.Value || current.TTL != desired.TTL {
+		l.Info("Upserting DNS record", "record", desired.RecordName, "type", desired.RecordType, "value", desired.Value)
+		output, err := api.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(desired.HostedZoneID),
+			ChangeBatch: &route53types.ChangeBatch{
+				Comment: aws.String(fmt.Sprintf("Ec2Instance %s/%s", ec2Instance.Namespace, ec2Instance.Name)),
+				Changes: []route53types.Change{{Action: route53types.ChangeActionUpsert, ResourceRecordSet: resourceRecordSet(desired)}},
+			},
+		})
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to upsert record %s in hosted zone %s: %w", desired.RecordName, desired.HostedZoneID, err)
+		}
+		observeDNSChange(desired, output.ChangeInfo)
+		ec2Instance.Status.DNS = desired
+	} else if current.ChangeStatus == string(route53types.ChangeStatusPending) {
+		output, err := api.GetChange(ctx, &route53.GetChangeInput{Id: aws.String(current.ChangeID)})
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to read change %s: %w", current.ChangeID, err)
+		}
+		observeDNSChange(current, output.ChangeInfo)
+	}
+
+	record := ec2Instance.Status.DNS
+	if record.ChangeStatus == string(route53types.ChangeStatusPending) {
+		setDNSRecordSynced(ec2Instance, metav1.ConditionFalse, computev1.ReasonDNSRecordPending,
+			fmt.Sprintf("Record %s %s %s is propagating", record.RecordName, record.RecordType, record.Value))
+		return ctrl.Result{RequeueAfter: dnsChangePollInterval}, nil
+	}
+	setDNSRecordSynced(ec2Instance, metav1.ConditionTrue, computev1.ReasonDNSRecordInSync,
+		fmt.Sprintf("Record %s %s %s is in sync", record.RecordName, record.RecordType, record.Value))
+	return ctrl.Result{}, nil
+}
+
+// desiredDNSRecord is the record spec.dns asks for, with the address of the instance as value,
+// or nil without spec.dns. The value is empty when the instance has no such address.
+func desiredDNSRecord(ec2Instance *computev1.Ec2Instance) *computev1.DNSRecordStatus {
+	dns := ec2Instance.Spec.DNS
+	if dns == nil {
+		return nil
+	}
+	record := &computev1.DNSRecordStatus{
+		HostedZoneID: dns.HostedZoneID,
+		RecordName:   strings.TrimSuffix(dns.RecordName, "."),
+		RecordType:   dns.RecordType,
+		TTL:          defaultDNSTTL,
+	}
+	if record.RecordType == "" {
+		record.RecordType = defaultDNSRecordType
+	}
+	if dns.TTL != nil {
+		record.TTL = *dns.TTL
+	}
+
+	status := ec2Instance.Status
+	private := dns.Target == computev1.DNSTargetPrivate
+	switch {
+	case record.RecordType == "AAAA":
+		record.Value = status.IPv6Address
+	case record.RecordType == "CNAME" && private:
+		record.Value = status.PrivateDNS
+	case record.RecordType == "CNAME":
+		record.Value = status.PublicDNS
+	case private:
+		record.Value = status.PrivateIP
+	default:
+		record.Value = status.PublicIP
+	}
+	return record
+}
+
+// sameDNSRecord tells whether two records are the same record set, whose value can be upserted.
+func sameDNSRecord(a, b *computev1.DNSRecordStatus) bool {
+	return a.HostedZoneID == b.HostedZoneID && a.RecordName == b.RecordName && a.RecordType == b.RecordType
+}
+
+// deleteDNSRecord deletes a record written for an instance. A record or hosted zone that is already gone
+// is not an error.
+func deleteDNSRecord(ctx context.Context, api dnsAPI, record *computev1.DNSRecordStatus) error {
+	_, err := api.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(record.HostedZoneID),
+		ChangeBatch: &route53types.ChangeBatch{
+			Changes: []route53types.Change{{Action: route53types.ChangeActionDelete, ResourceRecordSet: resourceRecordSet(record)}},
+		},
+	})
+	if err != nil && !strings.Contains(err.Error(), "but it was not found") && !strings.Contains(err.Error(), "NoSuchHostedZone") {
+		return fmt.Errorf("failed to delete record %s in hosted zone %s: %w", record.RecordName, record.HostedZoneID, err)
+	}
+	return nil
+}
+
+// resourceRecordSet is the Route 53 record set of a record. A delete has to match it exactly, TTL included.
+func resourceRecordSet(record *computev1.DNSRecordStatus) *route53types.ResourceRecordSet {
+	return &route53types.ResourceRecordSet{
+		Name:            aws.String(record.RecordName),
+		Type:            route53types.RRType(record.RecordType),
+		TTL:             aws.Int64(record.TTL),
+		ResourceRecords: []route53types.ResourceRecord{{Value: aws.String(record.Value)}},
+	}
+}
+
+// observeDNSChange records the ID and status of a Route 53 change.
+func observeDNSChange(record *computev1.DNSRecordStatus, change *route53types.ChangeInfo) {
+	if change == nil {
+		return
+	}
+	record.ChangeID = aws.ToString(change.Id)
+	record.ChangeStatus = string(change.Status)
+	if change.SubmittedAt != nil {
+		record.SubmittedAt = &metav1.Time{Time: *change.SubmittedAt}
+	}
+}
+
+func setDNSRecordSynced(ec2Instance *computev1.Ec2Instance, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+		Type:               computev1.ConditionDNSRecordSynced,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: ec2Instance.Generation,
+	})
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// fakeRoute53 keeps record values by zone, name and type, and changes by ID.
+type fakeRoute53 struct {
+	records map[string]string
+	changes map[string]route53types.ChangeStatus
+	nextID  int
+}
+
+func (f *fakeRoute53) ChangeResourceRecordSets(_ context.Context, params *route53.ChangeResourceRecordSetsInput, _ ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+	for _, change := range params.ChangeBatch.Changes {
+		set := change.ResourceRecordSet
+		key := fmt.Sprintf("%s/%s/%s", aws.ToString(params.HostedZoneId), aws.ToString(set.Name), set.Type)
+		value := aws.ToString(set.ResourceRecords[0].Value)
+		switch change.Action {
+		case route53types.ChangeActionUpsert:
+			f.records[key] = value
+		case route53types.ChangeActionDelete:
+			if f.records[key] != value {
+				return nil, errors.New("InvalidChangeBatch: Tried to delete resource record set but it was not found")
+			}
+			delete(f.records, key)
+		}
+	}
+	f.nextID++
+	id := fmt.Sprintf("/change/C%d", f.nextID)
+	f.changes[id] = route53types.ChangeStatusPending
+	return &route53.ChangeResourceRecordSetsOutput{ChangeInfo: &route53types.ChangeInfo{Id: aws.String(id), Status: route53types.ChangeStatusPending}}, nil
+}
+
+func (f *fakeRoute53) GetChange(_ context.Context, params *route53.GetChangeInput, _ ...func(*route53.Options)) (*route53.GetChangeOutput, error) {
+	return &route53.GetChangeOutput{ChangeInfo: &route53types.ChangeInfo{Id: params.Id, Status: f.changes[aws.ToString(params.Id)]}}, nil
+}
+
+var _ = Describe("Instance DNS record", func() {
+	ctx := context.Background()
+
+	var (
+		api        *fakeRoute53
+		reconciler *Ec2InstanceReconciler
+		instance   *computev1.Ec2Instance
+	)
+
+	BeforeEach(func() {
+		api = &fakeRoute53{records: map[string]string{}, changes: map[string]route53types.ChangeStatus{}}
+		reconciler = &Ec2InstanceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		instance = &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: computev1.Ec2InstanceSpec{
+				InstanceType: "t3.micro",
+				AMIId:        "ami-09042b2f6d07d164a",
+				Region:       "eu-central-1",
+				DNS:          &computev1.InstanceDNS{HostedZoneID: "Z0123", RecordName: "web.example.com."},
+			},
+		}
+		Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		instance.Status = computev1.Ec2InstanceStatus{InstanceID: "i-0123", State: "running", PublicIP: "3.120.0.1", PrivateIP: "10.0.1.5"}
+		Expect(k8sClient.Status().Update(ctx, instance)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+	})
+
+	It("should upsert the record and follow its change until it is in sync", func() {
+		result, err := reconciler.reconcileDNS(ctx, api, instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(dnsChangePollInterval))
+		Expect(api.records).To(Equal(map[string]string{"Z0123/web.example.com/A": "3.120.0.1"}))
+		Expect(instance.Status.DNS.ChangeStatus).To(Equal("PENDING"))
+		Expect(meta.FindStatusCondition(instance.Status.Conditions, computev1.ConditionDNSRecordSynced).Reason).To(Equal(computev1.ReasonDNSRecordPending))
+
+		api.changes[instance.Status.DNS.ChangeID] = route53types.ChangeStatusInsync
+		result, err = reconciler.reconcileDNS(ctx, api, instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(meta.IsStatusConditionTrue(instance.Status.Conditions, computev1.ConditionDNSRecordSynced)).To(BeTrue())
+		Expect(api.nextID).To(Equal(1))
+	})
+
+	It("should follow the public IP of the instance across a stop and start", func() {
+		Expect(reconciler.reconcileDNS(ctx, api, instance)).Error().NotTo(HaveOccurred())
+
+		By("deleting the record while the instance has no public IP")
+		instance.Status.State = "stopped"
+		instance.Status.PublicIP = ""
+		Expect(reconciler.reconcileDNS(ctx, api, instance)).Error().NotTo(HaveOccurred())
+		Expect(api.records).To(BeEmpty())
+		Expect(instance.Status.DNS).To(BeNil())
+		Expect(meta.FindStatusCondition(instance.Status.Conditions, computev1.ConditionDNSRecordSynced).Reason).To(Equal(computev1.ReasonDNSRecordNoAddress))
+
+		By("writing the new public IP once started again")
+		instance.Status.State = "running"
+		instance.Status.PublicIP = "3.120.0.2"
+		Expect(reconciler.reconcileDNS(ctx, api, instance)).Error().NotTo(HaveOccurred())
+		Expect(api.records).To(Equal(map[string]string{"Z0123/web.example.com/A": "3.120.0.2"}))
+	})
+
+	It("should move the record when it is renamed, and delete it when spec.dns is removed", func() {
+		Expect(reconciler.reconcileDNS(ctx, api, instance)).Error().NotTo(HaveOccurred())
+
+		instance.Spec.DNS = &computev1.InstanceDNS{HostedZoneID: "Z0123", RecordName: "web.internal.example.com", RecordType: "CNAME", Target: computev1.DNSTargetPrivate}
+		instance.Status.PrivateDNS = "ip-10-0-1-5.eu-central-1.compute.internal"
+		Expect(reconciler.reconcileDNS(ctx, api, instance)).Error().NotTo(HaveOccurred())
+		Expect(api.records).To(Equal(map[string]string{"Z0123/web.internal.example.com/CNAME": "ip-10-0-1-5.eu-central-1.compute.internal"}))
+
+		instance.Spec.DNS = nil
+		Expect(reconciler.reconcileDNS(ctx, api, instance)).Error().NotTo(HaveOccurred())
+		Expect(api.records).To(BeEmpty())
+		Expect(instance.Status.DNS).To(BeNil())
+		Expect(meta.FindStatusCondition(instance.Status.Conditions, computev1.ConditionDNSRecordSynced)).To(BeNil())
+	})
+
+	It("should delete a record that is already gone without error", func() {
+		Expect(deleteDNSRecord(ctx, api, &computev1.DNSRecordStatus{HostedZoneID: "Z0123", RecordName: "gone.example.com", RecordType: "A", TTL: 300, Value: "3.120.0.1"})).To(Succeed())
+	})
+})
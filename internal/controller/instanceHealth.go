@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	defaultHealthCheckPeriod    = 30 * time.Second
+	defaultHealthCheckTimeout   = 5 * time.Second
+	defaultHealthCheckSuccesses = 1
+	defaultHealthCheckFailures  = 3
+)
+
+// instanceStatusAPI is the part of the EC2 client used to read the status checks of an instance.
+type instanceStatusAPI interface {
+	DescribeInstanceStatus(ctx context.Context, params *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error)
+}
+
+// checkHealth checks a running instance once every period of spec.healthCheck, counts the consecutive results
+// in status.health and sets the Ready condition once a threshold is reached. Until then, Ready keeps its last
+// Healthy or Unhealthy result. launchTime is when the instance was last started; it is not checked before the
+// initial delay passed, nor before status.remediation.healthChecksResumeAt after a remediation. It returns when
+// the instance is to be checked next.
+func checkHealth(ctx context.Context, api instanceStatusAPI, ec2Instance *computev1.Ec2Instance, launchTime, now time.Time) (time.Duration, error) {
+	healthCheck := ec2Instance.Spec.HealthCheck
+	if ec2Instance.Status.State != string(ec2types.InstanceStateNameRunning) {
+		// observeInstance reports the instance as not running; counting starts over once it runs again.
+		ec2Instance.Status.Health = nil
+		return 0, nil
+	}
+	if ec2Instance.Status.Health == nil {
+		ec2Instance.Status.Health = &computev1.InstanceHealthStatus{}
+	}
+	health := ec2Instance.Status.Health
+
+	if checkAt := launchTime.Add(time.Duration(healthCheck.InitialDelaySeconds) * time.Second); now.Before(checkAt) {
+		setHealthCondition(ec2Instance, metav1.ConditionFalse, computev1.ReasonHealthCheckPending,
+			fmt.Sprintf("Instance %s is checked after the initial delay of %ds", ec2Instance.Status.InstanceID, healthCheck.InitialDelaySeconds))
+		return checkAt.Sub(now), nil
+	}
+	if remediation := ec2Instance.Status.Remediation; remediation != nil && remediation.HealthChecksResumeAt != nil && now.Before(remediation.HealthChecksResumeAt.Time) {
+		setHealthCondition(ec2Instance, metav1.ConditionFalse, computev1.ReasonHealthCheckPending,
+			fmt.Sprintf("Instance %s is checked again from %s after its remediation", ec2Instance.Status.InstanceID,
+				remediation.HealthChecksResumeAt.UTC().Format(time.RFC3339)))
+		return remediation.HealthChecksResumeAt.Sub(now), nil
+	}
+	period := durationOrDefault(healthCheck.PeriodSeconds, defaultHealthCheckPeriod)
+	if health.LastCheckTime != nil && now.Before(health.LastCheckTime.Add(period)) {
+		return health.LastCheckTime.Add(period).Sub(now), nil
+	}
+
+	healthy, initializing, message, err := probeInstance(ctx, api, ec2Instance)
+	if err != nil {
+		return 0, err
+	}
+	health.Message = message
+	health.LastCheckTime = &metav1.Time{Time: now}
+	switch {
+	case initializing:
+		// Status checks take a few minutes after the instance started; that is neither a success nor a failure.
+	case healthy:
+		health.ConsecutiveSuccesses++
+		health.ConsecutiveFailures = 0
+	default:
+		health.ConsecutiveFailures++
+		health.ConsecutiveSuccesses = 0
+	}
+
+	ready := meta.FindStatusCondition(ec2Instance.Status.Conditions, computev1.ConditionReady)
+	switch {
+	case health.ConsecutiveSuccesses >= thresholdOrDefault(healthCheck.SuccessThreshold, defaultHealthCheckSuccesses):
+		setHealthCondition(ec2Instance, metav1.ConditionTrue, computev1.ReasonInstanceHealthy, message)
+	case health.ConsecutiveFailures >= thresholdOrDefault(healthCheck.FailureThreshold, defaultHealthCheckFailures):
+		setHealthCondition(ec2Instance, metav1.ConditionFalse, computev1.ReasonInstanceUnhealthy, message)
+	case ready == nil || (ready.Reason != computev1.ReasonInstanceHealthy && ready.Reason != computev1.ReasonInstanceUnhealthy):
+		setHealthCondition(ec2Instance, metav1.ConditionFalse, computev1.ReasonHealthCheckPending, message)
+	}
+	return period, nil
+}
+
+// probeInstance runs the EC2 status checks and the probe of spec.healthCheck once. initializing is true while
+// the status checks have no result yet. AWS errors are returned; a failed probe is only unhealthy.
+func probeInstance(ctx context.Context, api instanceStatusAPI, ec2Instance *computev1.Ec2Instance) (healthy, initializing bool, message string, err error) {
+	instanceID := ec2Instance.Status.InstanceID
+	output, err := api.DescribeInstanceStatus(ctx, &ec2.DescribeInstanceStatusInput{
+		InstanceIds:         []string{instanceID},
+		IncludeAllInstances: aws.Bool(true),
+	})
+	if err != nil {
+		return false, false, "", fmt.Errorf("failed to describe status of instance %s: %w", instanceID, err)
+	}
+	health := ec2Instance.Status.Health
+	health.SystemStatus, health.InstanceStatus = "", ""
+	if len(output.InstanceStatuses) > 0 {
+		status := output.InstanceStatuses[0]
+		if status.SystemStatus != nil {
+			health.SystemStatus = string(status.SystemStatus.Status)
+		}
+		if status.InstanceStatus != nil {
+			health.InstanceStatus = string(status.InstanceStatus.Status)
+		}
+	}
+	ok := string(ec2types.SummaryStatusOk)
+	initializingStatus := string(ec2types.SummaryStatusInitializing)
+	switch {
+	case health.SystemStatus == initializingStatus || health.InstanceStatus == initializingStatus:
+		return false, true, "EC2 status checks are initializing", nil
+	case health.SystemStatus != ok || health.InstanceStatus != ok:
+		return false, false, fmt.Sprintf("EC2 status checks failed: system %s, instance %s",
+			statusOrUnknown(health.SystemStatus), statusOrUnknown(health.InstanceStatus)), nil
+	}
+
+	healthCheck := ec2Instance.Spec.HealthCheck
+	if healthCheck.TCP == nil && healthCheck.HTTP == nil {
+		return true, false, "EC2 status checks passed", nil
+	}
+	address := ec2Instance.Status.PrivateIP
+	if healthCheck.Address == computev1.ProbeAddressPublic {
+		address = ec2Instance.Status.PublicIP
+	}
+	if address == "" {
+		return false, false, fmt.Sprintf("Instance %s has no %s IP to probe", instanceID, probeAddress(healthCheck)), nil
+	}
+	timeout := durationOrDefault(healthCheck.TimeoutSeconds, defaultHealthCheckTimeout)
+	if healthCheck.TCP != nil {
+		if err := probeTCP(ctx, address, healthCheck.TCP.Port, timeout); err != nil {
+			return false, false, fmt.Sprintf("TCP probe failed: %v", err), nil
+		}
+	}
+	if healthCheck.HTTP != nil {
+		if err := probeHTTP(ctx, address, healthCheck.HTTP, timeout); err != nil {
+			return false, false, fmt.Sprintf("HTTP probe failed: %v", err), nil
+		}
+	}
+	return true, false, "EC2 status checks and probe passed", nil
+}
+
+// probeTCP opens and closes a connection to the port.
+func probeTCP(ctx context.Context, address string, port int32, timeout time.Duration) error {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(int(port))))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeHTTP sends a GET request, which succeeds with a status code from 200 to 399. Redirects are not followed.
+func probeHTTP(ctx context.Context, address string, probe *computev1.HTTPHealthProbe, timeout time.Duration) error {
+	scheme, path := "http", probe.Path
+	if probe.Scheme == "HTTPS" {
+		scheme = "https"
+	}
+	if path == "" {
+		path = "/"
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(address, strconv.Itoa(int(probe.Port))), path), nil)
+	if err != nil {
+		return err
+	}
+	httpClient := &http.Client{
+		Timeout: timeout,
+		// Instances mostly serve self-signed certificates for their IP, which cannot be verified anyway.
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode < 200 || response.StatusCode >= 400 {
+		return fmt.Errorf("%s returned %s", path, response.Status)
+	}
+	return nil
+}
+
+// setHealthCondition sets the Ready condition of a running instance from its health checks.
+func setHealthCondition(ec2Instance *computev1.Ec2Instance, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+		Type:               computev1.ConditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: ec2Instance.Generation,
+	})
+}
+
+func probeAddress(healthCheck *computev1.InstanceHealthCheck) string {
+	if healthCheck.Address == computev1.ProbeAddressPublic {
+		return "public"
+	}
+	return "private"
+}
+
+func statusOrUnknown(status string) string {
+	if status == "" {
+		return "unknown"
+	}
+	return status
+}
+
+// durationOrDefault converts seconds of the spec to a duration, using the default when unset.
+func durationOrDefault(seconds int32, defaultDuration time.Duration) time.Duration {
+	if seconds <= 0 {
+		return defaultDuration
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// thresholdOrDefault returns the threshold of the spec, or the default when unset.
+func thresholdOrDefault(threshold, defaultThreshold int32) int32 {
+	if threshold <= 0 {
+		return defaultThreshold
+	}
+	return threshold
+}
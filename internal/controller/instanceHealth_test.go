@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// fakeInstanceStatus reports the same system and instance status check result for every instance.
+type fakeInstanceStatus struct {
+	status ec2types.SummaryStatus
+}
+
+func (f *fakeInstanceStatus) DescribeInstanceStatus(_ context.Context, params *ec2.DescribeInstanceStatusInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+	return &ec2.DescribeInstanceStatusOutput{InstanceStatuses: []ec2types.InstanceStatus{{
+		InstanceId:     aws.String(params.InstanceIds[0]),
+		SystemStatus:   &ec2types.InstanceStatusSummary{Status: f.status},
+		InstanceStatus: &ec2types.InstanceStatusSummary{Status: f.status},
+	}}}, nil
+}
+
+var _ = Describe("Instance health checks", func() {
+	ctx := context.Background()
+
+	var (
+		api      *fakeInstanceStatus
+		instance *computev1.Ec2Instance
+		launched time.Time
+		now      time.Time
+	)
+
+	BeforeEach(func() {
+		api = &fakeInstanceStatus{status: ec2types.SummaryStatusInitializing}
+		instance = &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: computev1.Ec2InstanceSpec{
+				InstanceType: "t3.micro",
+				AMIId:        "ami-09042b2f6d07d164a",
+				Region:       "eu-central-1",
+				HealthCheck:  &computev1.InstanceHealthCheck{InitialDelaySeconds: 60, PeriodSeconds: 10, SuccessThreshold: 2, FailureThreshold: 2},
+			},
+			Status: computev1.Ec2InstanceStatus{InstanceID: "i-0123", State: "running", PrivateIP: "127.0.0.1"},
+		}
+		launched = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		now = launched
+	})
+
+	check := func() time.Duration {
+		next, err := checkHealth(ctx, api, instance, launched, now)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		now = now.Add(next)
+		return next
+	}
+	ready := func() *metav1.Condition {
+		return meta.FindStatusCondition(instance.Status.Conditions, computev1.ConditionReady)
+	}
+
+	It("should make the instance Ready after the success threshold and not before the initial delay", func() {
+		Expect(check()).To(Equal(time.Minute))
+		Expect(ready().Reason).To(Equal(computev1.ReasonHealthCheckPending))
+
+		Expect(check()).To(Equal(10 * time.Second))
+		Expect(instance.Status.Health.Message).To(Equal("EC2 status checks are initializing"))
+		Expect(instance.Status.Health.ConsecutiveFailures).To(BeZero())
+
+		api.status = ec2types.SummaryStatusOk
+		// Checked again before the period passed, the last result stands.
+		Expect(checkHealth(ctx, api, instance, launched, now.Add(-time.Second))).To(Equal(time.Second))
+		Expect(instance.Status.Health.ConsecutiveSuccesses).To(BeZero())
+
+		check()
+		Expect(ready().Status).To(Equal(metav1.ConditionFalse))
+		check()
+		Expect(ready().Status).To(Equal(metav1.ConditionTrue))
+		Expect(ready().Reason).To(Equal(computev1.ReasonInstanceHealthy))
+		Expect(instance.Status.Health.SystemStatus).To(Equal("ok"))
+	})
+
+	It("should keep the instance Ready until the failure threshold of the probe", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/healthz" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		DeferCleanup(server.Close)
+		_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		portNumber, err := strconv.Atoi(port)
+		Expect(err).NotTo(HaveOccurred())
+
+		api.status = ec2types.SummaryStatusOk
+		instance.Spec.HealthCheck = &computev1.InstanceHealthCheck{HTTP: &computev1.HTTPHealthProbe{Port: int32(portNumber), Path: "/healthz"}, FailureThreshold: 2}
+		check()
+		Expect(ready().Reason).To(Equal(computev1.ReasonInstanceHealthy))
+		Expect(instance.Status.Health.Message).To(Equal("EC2 status checks and probe passed"))
+
+		instance.Spec.HealthCheck.HTTP.Path = "/"
+		check()
+		Expect(ready().Status).To(Equal(metav1.ConditionTrue))
+		Expect(instance.Status.Health.Message).To(Equal("HTTP probe failed: / returned 503 Service Unavailable"))
+		check()
+		Expect(ready().Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready().Reason).To(Equal(computev1.ReasonInstanceUnhealthy))
+		Expect(instance.Status.Health.ConsecutiveFailures).To(BeEquivalentTo(2))
+
+		server.Close()
+		instance.Spec.HealthCheck.HTTP = nil
+		instance.Spec.HealthCheck.TCP = &computev1.TCPHealthProbe{Port: int32(portNumber)}
+		check()
+		Expect(instance.Status.Health.Message).To(HavePrefix("TCP probe failed: "))
+		Expect(instance.Status.Health.ConsecutiveFailures).To(BeEquivalentTo(3))
+	})
+
+	It("should not check a remediated instance before it had the time to come back", func() {
+		api.status = ec2types.SummaryStatusImpaired
+		instance.Spec.HealthCheck.InitialDelaySeconds = 0
+		instance.Status.Remediation = &computev1.RemediationStatus{HealthChecksResumeAt: &metav1.Time{Time: now.Add(time.Minute)}}
+		Expect(check()).To(Equal(time.Minute))
+		Expect(ready().Reason).To(Equal(computev1.ReasonHealthCheckPending))
+		Expect(instance.Status.Health.ConsecutiveFailures).To(BeZero())
+
+		check()
+		Expect(instance.Status.Health.ConsecutiveFailures).To(BeEquivalentTo(1))
+	})
+
+	It("should start counting over once a stopped instance runs again", func() {
+		api.status = ec2types.SummaryStatusImpaired
+		instance.Spec.HealthCheck.InitialDelaySeconds = 0
+		check()
+		Expect(instance.Status.Health.Message).To(Equal("EC2 status checks failed: system impaired, instance impaired"))
+		Expect(instance.Status.Health.ConsecutiveFailures).To(BeEquivalentTo(1))
+
+		instance.Status.State = "stopped"
+		check()
+		Expect(instance.Status.Health).To(BeNil())
+	})
+})
@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	defaultRemediationBackoff = 5 * time.Minute
+	defaultRemediationWindow  = time.Hour
+	defaultMaxRemediations    = 3
+)
+
+// remediationAPI is the part of the EC2 client used to reboot, stop and start an unhealthy instance.
+type remediationAPI interface {
+	RebootInstances(ctx context.Context, params *ec2.RebootInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RebootInstancesOutput, error)
+	StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error)
+	StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error)
+}
+
+// reconcileRemediation remediates an instance whose health checks failed spec.remediation.failureThreshold times
+// in a row, unless it is backing off from the last remediation or reached the maximum within the window. Every
+// remediation is recorded in an event and counted in status.remediation. A replaced instance has no instance ID
+// anymore; the next reconcile launches it again.
+func (r *Ec2InstanceReconciler) reconcileRemediation(ctx context.Context, api remediationAPI, ec2Instance *computev1.Ec2Instance, now time.Time) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	if ec2Instance.Spec.Remediation == nil || ec2Instance.Spec.HealthCheck == nil {
+		return ctrl.Result{}, nil
+	}
+	observed := ec2Instance.Status.DeepCopy()
+	if ec2Instance.Status.Remediation == nil {
+		ec2Instance.Status.Remediation = &computev1.RemediationStatus{}
+	}
+
+	result, err := r.remediate(ctx, api, ec2Instance, now)
+	if err != nil {
+		l.Error(err, "Failed to remediate instance")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	if equality.Semantic.DeepEqual(observed, &ec2Instance.Status) {
+		return result, nil
+	}
+	if err := r.Status().Update(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// remediate decides whether the instance is remediated now, and does so.
+func (r *Ec2InstanceReconciler) remediate(ctx context.Context, api remediationAPI, ec2Instance *computev1.Ec2Instance, now time.Time) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	remediation := ec2Instance.Spec.Remediation
+	status := ec2Instance.Status.Remediation
+	instanceID := ec2Instance.Status.InstanceID
+
+	// A stop/start is finished once the stopped instance is started again.
+	if status.InProgress == computev1.RemediationStopStart {
+		switch ec2Instance.Status.State {
+		case string(ec2types.InstanceStateNameStopped):
+			l.Info("Starting stopped instance", "instanceID", instanceID)
+			if _, err := api.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: []string{instanceID}}); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to start instance %s: %w", instanceID, err)
+			}
+			status.InProgress = ""
+		case string(ec2types.InstanceStateNameRunning):
+			// Started outside of the operator.
+			status.InProgress = ""
+		}
+		return ctrl.Result{RequeueAfter: instanceTransitionPollInterval}, nil
+	}
+
+	window := durationOrDefault(remediation.WindowSeconds, defaultRemediationWindow)
+	var recent []metav1.Time
+	for _, at := range status.Recent {
+		if now.Before(at.Add(window)) {
+			recent = append(recent, at)
+		}
+	}
+	status.Recent = recent
+
+	healthCheck := ec2Instance.Spec.HealthCheck
+	threshold := thresholdOrDefault(remediation.FailureThreshold, thresholdOrDefault(healthCheck.FailureThreshold, defaultHealthCheckFailures))
+	if ec2Instance.Status.Health == nil || ec2Instance.Status.Health.ConsecutiveFailures < threshold {
+		setRemediatingCondition(ec2Instance, metav1.ConditionFalse, computev1.ReasonRemediationNotNeeded,
+			fmt.Sprintf("Instance is remediated after %d consecutive failed health checks", threshold))
+		return ctrl.Result{}, nil
+	}
+
+	maxRemediations := thresholdOrDefault(remediation.MaxRemediations, defaultMaxRemediations)
+	if len(recent) >= int(maxRemediations) {
+		message := fmt.Sprintf("Instance was remediated %d times within %s; not remediating it again before %s",
+			len(recent), window, recent[0].Add(window).UTC().Format(time.RFC3339))
+		if setRemediatingCondition(ec2Instance, metav1.ConditionFalse, computev1.ReasonRemediationLimitReached, message) {
+			r.Recorder.Event(ec2Instance, corev1.EventTypeWarning, "RemediationLimitReached", message)
+		}
+		return ctrl.Result{RequeueAfter: recent[0].Add(window).Sub(now)}, nil
+	}
+	if len(recent) > 0 {
+		backoff := defaultRemediationBackoff
+		if remediation.BackoffSeconds != nil {
+			backoff = time.Duration(*remediation.BackoffSeconds) * time.Second
+		}
+		backoff <<= len(recent) - 1
+		if next := recent[len(recent)-1].Add(backoff); now.Before(next) {
+			setRemediatingCondition(ec2Instance, metav1.ConditionFalse, computev1.ReasonRemediationBackingOff,
+				fmt.Sprintf("Backing off from the last remediation until %s", next.UTC().Format(time.RFC3339)))
+			return ctrl.Result{RequeueAfter: next.Sub(now)}, nil
+		}
+	}
+
+	reason := fmt.Sprintf("after %d consecutive failed health checks: %s", ec2Instance.Status.Health.ConsecutiveFailures, ec2Instance.Status.Health.Message)
+	result := ctrl.Result{RequeueAfter: instanceTransitionPollInterval}
+	switch remediation.Action {
+	case computev1.RemediationReboot:
+		l.Info("Rebooting unhealthy instance", "instanceID", instanceID)
+		if _, err := api.RebootInstances(ctx, &ec2.RebootInstancesInput{InstanceIds: []string{instanceID}}); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to reboot instance %s: %w", instanceID, err)
+		}
+		status.Reboots++
+		setRemediatingCondition(ec2Instance, metav1.ConditionTrue, computev1.ReasonRemediationRebooting, "Rebooted instance "+reason)
+		r.Recorder.Eventf(ec2Instance, corev1.EventTypeWarning, "Remediated", "Rebooted instance %s %s", instanceID, reason)
+	case computev1.RemediationStopStart:
+		l.Info("Stopping unhealthy instance to start it again", "instanceID", instanceID)
+		if _, err := api.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: []string{instanceID}}); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to stop instance %s: %w", instanceID, err)
+		}
+		status.StopStarts++
+		status.InProgress = computev1.RemediationStopStart
+		setRemediatingCondition(ec2Instance, metav1.ConditionTrue, computev1.ReasonRemediationStopStarting, "Stopping and starting instance "+reason)
+		r.Recorder.Eventf(ec2Instance, corev1.EventTypeWarning, "Remediated", "Stopping and starting instance %s %s", instanceID, reason)
+	case computev1.RemediationReplace:
+		setRemediatingCondition(ec2Instance, metav1.ConditionTrue, computev1.ReasonRemediationReplacing, "Replacing instance "+reason)
+		l.Info("Replacing unhealthy instance", "instanceID", instanceID)
+		replaced, err := replaceInstance(ctx, ec2Instance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !replaced {
+			// Counted once the connections drained and the instance is gone.
+			return ctrl.Result{RequeueAfter: targetHealthPollInterval}, nil
+		}
+		status.Replacements++
+		r.Recorder.Eventf(ec2Instance, corev1.EventTypeWarning, "Remediated", "Replaced instance %s %s", instanceID, reason)
+		result.RequeueAfter = time.Second
+	}
+	status.Total++
+	status.LastAction = remediation.Action
+	status.LastRemediationTime = &metav1.Time{Time: now}
+	status.Recent = append(status.Recent, metav1.Time{Time: now})
+	// The health of the remediated instance is checked anew, once it had the time to come back.
+	ec2Instance.Status.Health = nil
+	resumeAfter := max(time.Duration(healthCheck.InitialDelaySeconds)*time.Second, durationOrDefault(healthCheck.PeriodSeconds, defaultHealthCheckPeriod))
+	status.HealthChecksResumeAt = &metav1.Time{Time: now.Add(resumeAfter)}
+	return result, nil
+}
+
+// setRemediatingCondition sets the Remediating condition, and tells whether it changed.
+func setRemediatingCondition(ec2Instance *computev1.Ec2Instance, status metav1.ConditionStatus, reason, message string) bool {
+	return meta.SetStatusCondition(&ec2Instance.Status.Conditions, metav1.Condition{
+		Type:               computev1.ConditionRemediating,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: ec2Instance.Generation,
+	})
+}
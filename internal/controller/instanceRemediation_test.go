@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// fakeRemediation records the instances that were rebooted, stopped and started.
+type fakeRemediation struct {
+	rebooted []string
+	stopped  []string
+	started  []string
+}
+
+func (f *fakeRemediation) RebootInstances(_ context.Context, params *ec2.RebootInstancesInput, _ ...func(*ec2.Options)) (*ec2.RebootInstancesOutput, error) {
+	f.rebooted = append(f.rebooted, params.InstanceIds...)
+	return &ec2.RebootInstancesOutput{}, nil
+}
+
+func (f *fakeRemediation) StopInstances(_ context.Context, params *ec2.StopInstancesInput, _ ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	f.stopped = append(f.stopped, params.InstanceIds...)
+	return &ec2.StopInstancesOutput{}, nil
+}
+
+func (f *fakeRemediation) StartInstances(_ context.Context, params *ec2.StartInstancesInput, _ ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+	f.started = append(f.started, params.InstanceIds...)
+	return &ec2.StartInstancesOutput{}, nil
+}
+
+var _ = Describe("Instance remediation", func() {
+	ctx := context.Background()
+
+	var (
+		api        *fakeRemediation
+		recorder   *record.FakeRecorder
+		reconciler *Ec2InstanceReconciler
+		instance   *computev1.Ec2Instance
+		now        time.Time
+	)
+
+	BeforeEach(func() {
+		api = &fakeRemediation{}
+		recorder = record.NewFakeRecorder(10)
+		reconciler = &Ec2InstanceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme(), Recorder: recorder}
+		instance = &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: computev1.Ec2InstanceSpec{
+				InstanceType: "t3.micro",
+				AMIId:        "ami-09042b2f6d07d164a",
+				Region:       "eu-central-1",
+				HealthCheck:  &computev1.InstanceHealthCheck{FailureThreshold: 2},
+				Remediation: &computev1.InstanceRemediation{
+					Action:          computev1.RemediationReboot,
+					BackoffSeconds:  ptr.To[int32](60),
+					MaxRemediations: 2,
+					WindowSeconds:   3600,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+		instance.Status = computev1.Ec2InstanceStatus{InstanceID: "i-0123", State: "running"}
+		now = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	fail := func(failures int32) {
+		instance.Status.Health = &computev1.InstanceHealthStatus{ConsecutiveFailures: failures, Message: "EC2 status checks failed: system ok, instance impaired"}
+	}
+	remediating := func() *metav1.Condition {
+		return meta.FindStatusCondition(instance.Status.Conditions, computev1.ConditionRemediating)
+	}
+
+	It("should reboot after the failure threshold, backing off from the last remediation", func() {
+		fail(1)
+		Expect(reconciler.reconcileRemediation(ctx, api, instance, now)).To(Equal(ctrl.Result{}))
+		Expect(remediating().Reason).To(Equal(computev1.ReasonRemediationNotNeeded))
+		Expect(api.rebooted).To(BeEmpty())
+
+		fail(2)
+		Expect(reconciler.reconcileRemediation(ctx, api, instance, now)).To(Equal(ctrl.Result{RequeueAfter: instanceTransitionPollInterval}))
+		Expect(api.rebooted).To(ConsistOf("i-0123"))
+		Expect(remediating().Status).To(Equal(metav1.ConditionTrue))
+		Expect(remediating().Reason).To(Equal(computev1.ReasonRemediationRebooting))
+		Expect(instance.Status.Remediation.Total).To(BeEquivalentTo(1))
+		Expect(instance.Status.Remediation.Reboots).To(BeEquivalentTo(1))
+		Expect(instance.Status.Remediation.LastAction).To(Equal(computev1.RemediationReboot))
+		Expect(instance.Status.Health).To(BeNil())
+		By("checking the health again after one period of the health check")
+		Expect(instance.Status.Remediation.HealthChecksResumeAt.Time).To(BeTemporally("==", now.Add(30*time.Second)))
+		Expect(recorder.Events).To(Receive(Equal("Warning Remediated Rebooted instance i-0123 after 2 consecutive failed health checks: EC2 status checks failed: system ok, instance impaired")))
+
+		fail(2)
+		now = now.Add(20 * time.Second)
+		Expect(reconciler.reconcileRemediation(ctx, api, instance, now)).To(Equal(ctrl.Result{RequeueAfter: 40 * time.Second}))
+		Expect(remediating().Reason).To(Equal(computev1.ReasonRemediationBackingOff))
+		Expect(api.rebooted).To(HaveLen(1))
+	})
+
+	It("should stop remediating once the maximum within the window is reached", func() {
+		for range 2 {
+			fail(2)
+			_, err := reconciler.reconcileRemediation(ctx, api, instance, now)
+			Expect(err).NotTo(HaveOccurred())
+			now = now.Add(time.Minute)
+		}
+		Expect(api.rebooted).To(HaveLen(2))
+
+		fail(2)
+		Expect(reconciler.reconcileRemediation(ctx, api, instance, now)).To(Equal(ctrl.Result{RequeueAfter: 58 * time.Minute}))
+		Expect(api.rebooted).To(HaveLen(2))
+		Expect(remediating().Reason).To(Equal(computev1.ReasonRemediationLimitReached))
+		Eventually(recorder.Events).Should(Receive(HavePrefix("Warning RemediationLimitReached Instance was remediated 2 times within 1h0m0s")))
+
+		// The oldest remediation left the window.
+		now = now.Add(58 * time.Minute)
+		_, err := reconciler.reconcileRemediation(ctx, api, instance, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api.rebooted).To(HaveLen(3))
+		Expect(instance.Status.Remediation.Recent).To(HaveLen(2))
+	})
+
+	It("should start a stopped instance again", func() {
+		instance.Spec.Remediation.Action = computev1.RemediationStopStart
+		status := instance.Status
+		Expect(k8sClient.Update(ctx, instance)).To(Succeed())
+		instance.Status = status
+		fail(3)
+		_, err := reconciler.reconcileRemediation(ctx, api, instance, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api.stopped).To(ConsistOf("i-0123"))
+		Expect(instance.Status.Remediation.InProgress).To(Equal(computev1.RemediationStopStart))
+		Expect(remediating().Reason).To(Equal(computev1.ReasonRemediationStopStarting))
+
+		instance.Status.State = "stopping"
+		_, err = reconciler.reconcileRemediation(ctx, api, instance, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api.started).To(BeEmpty())
+
+		instance.Status.State = "stopped"
+		_, err = reconciler.reconcileRemediation(ctx, api, instance, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api.started).To(ConsistOf("i-0123"))
+		Expect(instance.Status.Remediation.InProgress).To(BeEmpty())
+		Expect(instance.Status.Remediation.StopStarts).To(BeEquivalentTo(1))
+	})
+})
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	// instanceServiceLabel marks the Service and EndpointSlice of an instance with the instance's name,
+	// so that they can be found again when spec.service is renamed or removed.
+	instanceServiceLabel = "compute.cloud.com/ec2instance"
+	// endpointSliceManager is the manager of the EndpointSlices, which keeps the EndpointSlice controller off them.
+	endpointSliceManager = "ec2operator.compute.cloud.com"
+)
+
+// serviceName is the name of the Service of the instance, or empty without spec.service.
+func serviceName(ec2Instance *computev1.Ec2Instance) string {
+	switch {
+	case ec2Instance.Spec.Service == nil:
+		return ""
+	case ec2Instance.Spec.Service.Name != "":
+		return ec2Instance.Spec.Service.Name
+	default:
+		return ec2Instance.Name
+	}
+}
+
+// reconcileService maintains the Service of spec.service and its EndpointSlice, and deletes the ones
+// left behind by an earlier name of the Service.
+func (r *Ec2InstanceReconciler) reconcileService(ctx context.Context, ec2Instance *computev1.Ec2Instance) error {
+	name := serviceName(ec2Instance)
+	if err := r.deleteStaleServices(ctx, ec2Instance, name); err != nil {
+		return err
+	}
+	if name == "" {
+		return nil
+	}
+	labels := map[string]string{instanceServiceLabel: ec2Instance.Name}
+
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ec2Instance.Namespace}}
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		if service.ResourceVersion != "" && !metav1.IsControlledBy(service, ec2Instance) {
+			return fmt.Errorf("service %s already exists and is not owned by the Ec2Instance", name)
+		}
+		service.Labels = labels
+		// Without a selector, the endpoints come from the EndpointSlice below.
+		service.Spec.Selector = nil
+		service.Spec.Ports = servicePorts(ec2Instance.Spec.Service)
+		return controllerutil.SetControllerReference(ec2Instance, service, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write service %s: %w", name, err)
+	}
+	if result != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("Wrote service", "service", name, "operation", result)
+	}
+
+	slice := &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ec2Instance.Namespace}}
+	result, err = controllerutil.CreateOrUpdate(ctx, r.Client, slice, func() error {
+		if slice.ResourceVersion != "" && !metav1.IsControlledBy(slice, ec2Instance) {
+			return fmt.Errorf("endpointslice %s already exists and is not owned by the Ec2Instance", name)
+		}
+		slice.Labels = map[string]string{
+			instanceServiceLabel:         ec2Instance.Name,
+			discoveryv1.LabelServiceName: name,
+			discoveryv1.LabelManagedBy:   endpointSliceManager,
+		}
+		slice.AddressType = discoveryv1.AddressTypeIPv4
+		slice.Ports = endpointPorts(ec2Instance.Spec.Service)
+		slice.Endpoints = instanceEndpoints(ec2Instance)
+		return controllerutil.SetControllerReference(ec2Instance, slice, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write endpointslice %s: %w", name, err)
+	}
+	if result != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info("Wrote endpointslice", "endpointSlice", name, "operation", result, "endpoints", len(slice.Endpoints))
+	}
+	return nil
+}
+
+// deleteStaleServices deletes the Services and EndpointSlices of the instance not named name.
+func (r *Ec2InstanceReconciler) deleteStaleServices(ctx context.Context, ec2Instance *computev1.Ec2Instance, name string) error {
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, client.InNamespace(ec2Instance.Namespace), client.MatchingLabels{instanceServiceLabel: ec2Instance.Name}); err != nil {
+		return err
+	}
+	slices := &discoveryv1.EndpointSliceList{}
+	if err := r.List(ctx, slices, client.InNamespace(ec2Instance.Namespace), client.MatchingLabels{instanceServiceLabel: ec2Instance.Name}); err != nil {
+		return err
+	}
+	var stale []client.Object
+	for i := range services.Items {
+		stale = append(stale, &services.Items[i])
+	}
+	for i := range slices.Items {
+		stale = append(stale, &slices.Items[i])
+	}
+	for _, obj := range stale {
+		if obj.GetName() == name || !metav1.IsControlledBy(obj, ec2Instance) {
+			continue
+		}
+		log.FromContext(ctx).Info("Deleting stale service object", "name", obj.GetName())
+		if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// servicePorts are the ports of the Service, forwarding to the target ports of the instance.
+func servicePorts(service *computev1.InstanceService) []corev1.ServicePort {
+	ports := make([]corev1.ServicePort, 0, len(service.Ports))
+	for _, port := range service.Ports {
+		ports = append(ports, corev1.ServicePort{
+			Name:       port.Name,
+			Protocol:   portProtocol(port),
+			Port:       port.Port,
+			TargetPort: intstr.FromInt32(portTarget(port)),
+		})
+	}
+	return ports
+}
+
+// endpointPorts are the ports of the EndpointSlice, i.e. the target ports on the instance.
+func endpointPorts(service *computev1.InstanceService) []discoveryv1.EndpointPort {
+	ports := make([]discoveryv1.EndpointPort, 0, len(service.Ports))
+	for _, port := range service.Ports {
+		ports = append(ports, discoveryv1.EndpointPort{
+			Name:     ptr.To(port.Name),
+			Protocol: ptr.To(portProtocol(port)),
+			Port:     ptr.To(portTarget(port)),
+		})
+	}
+	return ports
+}
+
+func portProtocol(port computev1.InstanceServicePort) corev1.Protocol {
+	if port.Protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return corev1.Protocol(port.Protocol)
+}
+
+func portTarget(port computev1.InstanceServicePort) int32 {
+	if port.TargetPort == 0 {
+		return port.Port
+	}
+	return port.TargetPort
+}
+
+// instanceEndpoints is the endpoint of the instance at its private IP, ready when the instance is.
+// A stopped instance has no endpoint at all, so that clients fail fast instead of connecting to it.
+func instanceEndpoints(ec2Instance *computev1.Ec2Instance) []discoveryv1.Endpoint {
+	state := ec2types.InstanceStateName(ec2Instance.Status.State)
+	if ec2Instance.Status.PrivateIP == "" || (state != ec2types.InstanceStateNameRunning && state != ec2types.InstanceStateNamePending) {
+		return nil
+	}
+	ready := meta.IsStatusConditionTrue(ec2Instance.Status.Conditions, computev1.ConditionReady)
+	return []discoveryv1.Endpoint{{
+		Addresses: []string{ec2Instance.Status.PrivateIP},
+		Conditions: discoveryv1.EndpointConditions{
+			Ready:       ptr.To(ready),
+			Serving:     ptr.To(ready),
+			Terminating: ptr.To(false),
+		},
+	}}
+}
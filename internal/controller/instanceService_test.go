@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+var _ = Describe("Instance service", func() {
+	ctx := context.Background()
+	serviceKey := types.NamespacedName{Name: "db", Namespace: "default"}
+
+	var (
+		reconciler *Ec2InstanceReconciler
+		instance   *computev1.Ec2Instance
+	)
+
+	running := ec2types.Instance{
+		State:            &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning},
+		PrivateIpAddress: aws.String("10.0.1.5"),
+		PrivateDnsName:   aws.String("ip-10-0-1-5.eu-central-1.compute.internal"),
+	}
+
+	BeforeEach(func() {
+		reconciler = &Ec2InstanceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		instance = &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "postgres", Namespace: "default"},
+			Spec: computev1.Ec2InstanceSpec{
+				InstanceType: "t3.micro",
+				AMIId:        "ami-09042b2f6d07d164a",
+				Region:       "eu-central-1",
+				Service: &computev1.InstanceService{
+					Name:  "db",
+					Ports: []computev1.InstanceServicePort{{Name: "postgres", Port: 5432}, {Name: "metrics", Port: 80, TargetPort: 9187}},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		instance.Status.InstanceID = "i-0123"
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+			Expect(k8sClient.DeleteAllOf(ctx, &corev1.Service{}, client.InNamespace("default"))).To(Succeed())
+			Expect(k8sClient.DeleteAllOf(ctx, &discoveryv1.EndpointSlice{}, client.InNamespace("default"))).To(Succeed())
+		})
+	})
+
+	It("should observe the state and addresses of the instance", func() {
+		observeInstance(instance, running)
+		Expect(instance.Status.State).To(Equal("running"))
+		Expect(instance.Status.PrivateIP).To(Equal("10.0.1.5"))
+		Expect(meta.IsStatusConditionTrue(instance.Status.Conditions, computev1.ConditionReady)).To(BeTrue())
+
+		stopped := running
+		stopped.State = &ec2types.InstanceState{Name: ec2types.InstanceStateNameStopped}
+		stopped.PublicIpAddress = nil
+		observeInstance(instance, stopped)
+		condition := meta.FindStatusCondition(instance.Status.Conditions, computev1.ConditionReady)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Message).To(Equal("Instance i-0123 is stopped"))
+	})
+
+	It("should point a selector-less Service at the private IP of the running instance", func() {
+		observeInstance(instance, running)
+		Expect(reconciler.reconcileService(ctx, instance)).To(Succeed())
+
+		service := &corev1.Service{}
+		Expect(k8sClient.Get(ctx, serviceKey, service)).To(Succeed())
+		Expect(service.Spec.Selector).To(BeEmpty())
+		Expect(service.Spec.Ports).To(HaveLen(2))
+		Expect(service.Spec.Ports[1].TargetPort).To(Equal(intstr.FromInt32(9187)))
+		Expect(metav1.IsControlledBy(service, instance)).To(BeTrue())
+
+		slice := &discoveryv1.EndpointSlice{}
+		Expect(k8sClient.Get(ctx, serviceKey, slice)).To(Succeed())
+		Expect(slice.Labels).To(HaveKeyWithValue(discoveryv1.LabelServiceName, "db"))
+		Expect(slice.Labels).To(HaveKeyWithValue(discoveryv1.LabelManagedBy, endpointSliceManager))
+		Expect(*slice.Ports[1].Port).To(BeEquivalentTo(9187))
+		Expect(slice.Endpoints).To(HaveLen(1))
+		Expect(slice.Endpoints[0].Addresses).To(Equal([]string{"10.0.1.5"}))
+		Expect(*slice.Endpoints[0].Conditions.Ready).To(BeTrue())
+	})
+
+	It("should remove the endpoint while the instance is stopped", func() {
+		stopped := running
+		stopped.State = &ec2types.InstanceState{Name: ec2types.InstanceStateNameStopped}
+		observeInstance(instance, stopped)
+		Expect(reconciler.reconcileService(ctx, instance)).To(Succeed())
+
+		slice := &discoveryv1.EndpointSlice{}
+		Expect(k8sClient.Get(ctx, serviceKey, slice)).To(Succeed())
+		Expect(slice.Endpoints).To(BeEmpty())
+	})
+
+	It("should delete the Service of an earlier name", func() {
+		observeInstance(instance, running)
+		Expect(reconciler.reconcileService(ctx, instance)).To(Succeed())
+
+		instance.Spec.Service.Name = "postgres"
+		Expect(reconciler.reconcileService(ctx, instance)).To(Succeed())
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, serviceKey, &corev1.Service{}))).To(BeTrue())
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, serviceKey, &discoveryv1.EndpointSlice{}))).To(BeTrue())
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "postgres", Namespace: "default"}, &corev1.Service{})).To(Succeed())
+
+		instance.Spec.Service = nil
+		Expect(reconciler.reconcileService(ctx, instance)).To(Succeed())
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, types.NamespacedName{Name: "postgres", Namespace: "default"}, &corev1.Service{}))).To(BeTrue())
+	})
+})
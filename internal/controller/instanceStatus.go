@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	// instanceStatusResyncInterval is how often the state of a launched instance is read from AWS,
+	// to notice instances stopped or started outside of the operator.
+	instanceStatusResyncInterval = 5 * time.Minute
+	// instanceTransitionPollInterval is how often an instance that is starting or stopping is checked.
+	instanceTransitionPollInterval = 15 * time.Second
+)
+
+// reconcileInstanceStatus reads the state and addresses of a launched instance from AWS into the status,
+// and sets the Ready condition from them, and from the health checks of spec.healthCheck if set.
+// The addresses change when a stopped instance is started again.
+func (r *Ec2InstanceReconciler) reconcileInstanceStatus(ctx context.Context, ec2Instance *computev1.Ec2Instance) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	api := awsClient(instanceRegion(ec2Instance))
+	instance, err := describeInstance(ctx, api, ec2Instance.Status.InstanceID)
+	if err != nil {
+		l.Error(err, "Failed to read instance state")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	result := ctrl.Result{RequeueAfter: instanceStatusResyncInterval}
+	if state := instanceState(instance); state == ec2types.InstanceStateNamePending || state == ec2types.InstanceStateNameStopping ||
+		state == ec2types.InstanceStateNameShuttingDown {
+		result.RequeueAfter = instanceTransitionPollInterval
+	}
+
+	observed := ec2Instance.Status.DeepCopy()
+	observeInstance(ec2Instance, instance)
+	if ec2Instance.Spec.HealthCheck != nil {
+		next, err := checkHealth(ctx, api, ec2Instance, aws.ToTime(instance.LaunchTime), time.Now())
+		if err != nil {
+			l.Error(err, "Failed to check instance health")
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+		result = earliestResult(result, ctrl.Result{RequeueAfter: next})
+	} else {
+		ec2Instance.Status.Health = nil
+	}
+	if equality.Semantic.DeepEqual(observed, &ec2Instance.Status) {
+		return result, nil
+	}
+	l.Info("Instance changed", "state", ec2Instance.Status.State, "privateIP", ec2Instance.Status.PrivateIP, "publicIP", ec2Instance.Status.PublicIP)
+	if err := r.Status().Update(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// instanceState is the state of an instance as reported by AWS.
+func instanceState(instance ec2types.Instance) ec2types.InstanceStateName {
+	if instance.State == nil {
+		return ""
+	}
+	return instance.State.Name
+}
+
+// observeInstance copies the state and addresses of the instance into the status, and sets the Ready condition,
+// unless the instance runs and has health checks.
+func observeInstance(ec2Instance *computev1.Ec2Instance, instance ec2types.Instance) {
+	state := instanceState(instance)
+	ec2Instance.Status.State = string(state)
+	ec2Instance.Status.PublicIP = aws.ToString(instance.PublicIpAddress)
+	ec2Instance.Status.PrivateIP = aws.ToString(instance.PrivateIpAddress)
+	ec2Instance.Status.PublicDNS = aws.ToString(instance.PublicDnsName)
+	ec2Instance.Status.PrivateDNS = aws.ToString(instance.PrivateDnsName)
+	ec2Instance.Status.IPv6Address = aws.ToString(instance.Ipv6Address)
+
+	condition := metav1.Condition{
+		Type:               computev1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             computev1.ReasonInstanceRunning,
+		Message:            fmt.Sprintf("Instance %s is running", ec2Instance.Status.InstanceID),
+		ObservedGeneration: ec2Instance.Generation,
+	}
+	if state == ec2types.InstanceStateNameRunning && ec2Instance.Spec.HealthCheck != nil {
+		// checkHealth decides whether a running instance is Ready.
+		return
+	}
+	if state != ec2types.InstanceStateNameRunning {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = computev1.ReasonInstanceNotRunning
+		condition.Message = fmt.Sprintf("Instance %s is %s", ec2Instance.Status.InstanceID, state)
+	}
+	meta.SetStatusCondition(&ec2Instance.Status.Conditions, condition)
+}
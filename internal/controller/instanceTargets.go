@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	elbv2 "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// targetHealthPollInterval is how often a target that is being registered or drained is checked.
+const targetHealthPollInterval = 15 * time.Second
+
+// targetGroupAPI is the part of the ELBv2 client used to register an instance in its target groups.
+type targetGroupAPI interface {
+	RegisterTargets(ctx context.Context, params *elbv2.RegisterTargetsInput, optFns ...func(*elbv2.Options)) (*elbv2.RegisterTargetsOutput, error)
+	DeregisterTargets(ctx context.Context, params *elbv2.DeregisterTargetsInput, optFns ...func(*elbv2.Options)) (*elbv2.DeregisterTargetsOutput, error)
+	DescribeTargetHealth(ctx context.Context, params *elbv2.DescribeTargetHealthInput, optFns ...func(*elbv2.Options)) (*elbv2.DescribeTargetHealthOutput, error)
+}
+
+// reconcileTargetGroups registers a Ready instance in the target groups of spec.targetGroups, deregisters it
+// from the ones removed from the spec and while it is not Ready, and reports its health in status.targetGroups.
+// While a target is registering or draining, the instance is checked again shortly.
+func (r *Ec2InstanceReconciler) reconcileTargetGroups(ctx context.Context, api targetGroupAPI, ec2Instance *computev1.Ec2Instance) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	if len(ec2Instance.Spec.TargetGroups) == 0 && len(ec2Instance.Status.TargetGroups) == 0 {
+		return ctrl.Result{}, nil
+	}
+	statuses, inTransition, err := syncTargets(ctx, api, ec2Instance)
+	if err != nil {
+		l.Error(err, "Failed to reconcile target groups")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	result := ctrl.Result{}
+	if inTransition {
+		result.RequeueAfter = targetHealthPollInterval
+	}
+	if equality.Semantic.DeepEqual(statuses, ec2Instance.Status.TargetGroups) {
+		return result, nil
+	}
+	ec2Instance.Status.TargetGroups = statuses
+	if err := r.Status().Update(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// syncTargets brings the registrations of the instance in line with the spec and its readiness,
+// and returns their health. inTransition is true while any target is registering or draining.
+func syncTargets(ctx context.Context, api targetGroupAPI, ec2Instance *computev1.Ec2Instance) (statuses []computev1.TargetGroupStatus, inTransition bool, err error) {
+	l := log.FromContext(ctx)
+
+	instanceID := ec2Instance.Status.InstanceID
+	ready := meta.IsStatusConditionTrue(ec2Instance.Status.Conditions, computev1.ConditionReady)
+
+	// Registrations removed from the spec, or moved to another port, are deregistered without waiting
+	// for draining: the instance keeps running and serves the connections it still has.
+	desired := map[string]computev1.TargetGroupRegistration{}
+	for _, registration := range ec2Instance.Spec.TargetGroups {
+		desired[registration.ARN] = registration
+	}
+	for _, status := range ec2Instance.Status.TargetGroups {
+		if registration, ok := desired[status.ARN]; ok && registration.Port == status.Port {
+			continue
+		}
+		l.Info("Deregistering instance from target group", "targetGroup", status.ARN)
+		if err := deregisterTarget(ctx, api, status.ARN, instanceID, status.Port); err != nil {
+			return nil, false, err
+		}
+	}
+
+	for _, registration := range ec2Instance.Spec.TargetGroups {
+		status, err := describeTarget(ctx, api, registration.ARN, instanceID, registration.Port)
+		if err != nil {
+			return nil, false, err
+		}
+		switch {
+		case ready && !targetRegistered(status):
+			l.Info("Registering instance in target group", "targetGroup", registration.ARN)
+			if _, err := api.RegisterTargets(ctx, &elbv2.RegisterTargetsInput{
+				TargetGroupArn: aws.String(registration.ARN),
+				Targets:        []elbv2types.TargetDescription{targetDescription(instanceID, registration.Port)},
+			}); err != nil {
+				return nil, false, fmt.Errorf("failed to register instance %s in target group %s: %w", instanceID, registration.ARN, err)
+			}
+		case !ready && targetRegistered(status) && !targetDraining(status):
+			l.Info("Deregistering instance that is not ready from target group", "targetGroup", registration.ARN)
+			if err := deregisterTarget(ctx, api, registration.ARN, instanceID, registration.Port); err != nil {
+				return nil, false, err
+			}
+		default:
+			statuses = append(statuses, status)
+			inTransition = inTransition || status.State == string(elbv2types.TargetHealthStateEnumInitial) || targetDraining(status)
+			continue
+		}
+		if status, err = describeTarget(ctx, api, registration.ARN, instanceID, registration.Port); err != nil {
+			return nil, false, err
+		}
+		statuses = append(statuses, status)
+		inTransition = true
+	}
+	return statuses, inTransition, nil
+}
+
+// drainTargets deregisters the instance from every target group it is registered in, and updates their
+// health in the status. drained is true once no connection is draining anymore, so the instance can go.
+func drainTargets(ctx context.Context, api targetGroupAPI, ec2Instance *computev1.Ec2Instance) (drained bool, err error) {
+	l := log.FromContext(ctx)
+
+	drained = true
+	for i, status := range ec2Instance.Status.TargetGroups {
+		if targetRegistered(status) && !targetDraining(status) {
+			l.Info("Draining instance from target group", "targetGroup", status.ARN)
+			if err := deregisterTarget(ctx, api, status.ARN, ec2Instance.Status.InstanceID, status.Port); err != nil {
+				return false, err
+			}
+		}
+		status, err := describeTarget(ctx, api, status.ARN, ec2Instance.Status.InstanceID, status.Port)
+		if err != nil {
+			return false, err
+		}
+		ec2Instance.Status.TargetGroups[i] = status
+		drained = drained && !targetDraining(status)
+	}
+	return drained, nil
+}
+
+// describeTarget reads the health of the instance in a target group.
+func describeTarget(ctx context.Context, api targetGroupAPI, arn, instanceID string, port int32) (computev1.TargetGroupStatus, error) {
+	status := computev1.TargetGroupStatus{ARN: arn, Port: port}
+	output, err := api.DescribeTargetHealth(ctx, &elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(arn),
+		Targets:        []elbv2types.TargetDescription{targetDescription(instanceID, port)},
+	})
+	if err != nil {
+		return status, fmt.Errorf("failed to describe health of instance %s in target group %s: %w", instanceID, arn, err)
+	}
+	if len(output.TargetHealthDescriptions) == 0 || output.TargetHealthDescriptions[0].TargetHealth == nil {
+		return status, nil
+	}
+	health := output.TargetHealthDescriptions[0].TargetHealth
+	status.State = string(health.State)
+	status.Reason = string(health.Reason)
+	status.Description = aws.ToString(health.Description)
+	return status, nil
+}
+
+// deregisterTarget deregisters the instance from a target group. A target group that is already gone is not an error.
+func deregisterTarget(ctx context.Context, api targetGroupAPI, arn, instanceID string, port int32) error {
+	_, err := api.DeregisterTargets(ctx, &elbv2.DeregisterTargetsInput{
+		TargetGroupArn: aws.String(arn),
+		Targets:        []elbv2types.TargetDescription{targetDescription(instanceID, port)},
+	})
+	if err != nil && !strings.Contains(err.Error(), "TargetGroupNotFound") {
+		return fmt.Errorf("failed to deregister instance %s from target group %s: %w", instanceID, arn, err)
+	}
+	return nil
+}
+
+// targetDescription is the instance as a target, on the port of the target group unless port is set.
+func targetDescription(instanceID string, port int32) elbv2types.TargetDescription {
+	target := elbv2types.TargetDescription{Id: aws.String(instanceID)}
+	if port != 0 {
+		target.Port = aws.Int32(port)
+	}
+	return target
+}
+
+// targetRegistered tells whether the instance is registered in the target group, possibly draining.
+func targetRegistered(status computev1.TargetGroupStatus) bool {
+	return status.State != "" && status.Reason != string(elbv2types.TargetHealthReasonEnumNotRegistered)
+}
+
+// targetDraining tells whether connections to the instance are draining after it was deregistered.
+func targetDraining(status computev1.TargetGroupStatus) bool {
+	return status.State == string(elbv2types.TargetHealthStateEnumDraining) ||
+		status.State == string(elbv2types.TargetHealthStateEnumUnhealthyDraining)
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	elbv2 "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const webTargetGroup = "arn:aws:elasticloadbalancing:eu-central-1:123456789012:targetgroup/web/0123456789abcdef"
+
+// fakeTargetGroups keeps the health state of targets by target group ARN; deregistered targets start draining.
+type fakeTargetGroups struct {
+	states       map[string]elbv2types.TargetHealthStateEnum
+	registered   []string
+	deregistered []string
+}
+
+func (f *fakeTargetGroups) RegisterTargets(_ context.Context, params *elbv2.RegisterTargetsInput, _ ...func(*elbv2.Options)) (*elbv2.RegisterTargetsOutput, error) {
+	f.states[aws.ToString(params.TargetGroupArn)] = elbv2types.TargetHealthStateEnumInitial
+	f.registered = append(f.registered, aws.ToString(params.TargetGroupArn))
+	return &elbv2.RegisterTargetsOutput{}, nil
+}
+
+func (f *fakeTargetGroups) DeregisterTargets(_ context.Context, params *elbv2.DeregisterTargetsInput, _ ...func(*elbv2.Options)) (*elbv2.DeregisterTargetsOutput, error) {
+	f.states[aws.ToString(params.TargetGroupArn)] = elbv2types.TargetHealthStateEnumDraining
+	f.deregistered = append(f.deregistered, aws.ToString(params.TargetGroupArn))
+	return &elbv2.DeregisterTargetsOutput{}, nil
+}
+
+func (f *fakeTargetGroups) DescribeTargetHealth(_ context.Context, params *elbv2.DescribeTargetHealthInput, _ ...func(*elbv2.Options)) (*elbv2.DescribeTargetHealthOutput, error) {
+	health := &elbv2types.TargetHealth{State: f.states[aws.ToString(params.TargetGroupArn)]}
+	if health.State == "" {
+		health.State = elbv2types.TargetHealthStateEnumUnused
+		health.Reason = elbv2types.TargetHealthReasonEnumNotRegistered
+	}
+	return &elbv2.DescribeTargetHealthOutput{TargetHealthDescriptions: []elbv2types.TargetHealthDescription{{Target: &params.Targets[0], TargetHealth: health}}}, nil
+}
+
+// drained makes the deregistration of every draining target complete.
+func (f *fakeTargetGroups) drained() {
+	for arn, state := range f.states {
+		if state == elbv2types.TargetHealthStateEnumDraining {
+			delete(f.states, arn)
+		}
+	}
+}
+
+var _ = Describe("Instance target groups", func() {
+	ctx := context.Background()
+
+	var (
+		api        *fakeTargetGroups
+		reconciler *Ec2InstanceReconciler
+		instance   *computev1.Ec2Instance
+	)
+
+	BeforeEach(func() {
+		api = &fakeTargetGroups{states: map[string]elbv2types.TargetHealthStateEnum{}}
+		reconciler = &Ec2InstanceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		instance = &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: computev1.Ec2InstanceSpec{
+				InstanceType: "t3.micro",
+				AMIId:        "ami-09042b2f6d07d164a",
+				Region:       "eu-central-1",
+				TargetGroups: []computev1.TargetGroupRegistration{{ARN: webTargetGroup, Port: 8080}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		instance.Status = computev1.Ec2InstanceStatus{InstanceID: "i-0123", State: "pending"}
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{Type: computev1.ConditionReady, Status: metav1.ConditionFalse, Reason: computev1.ReasonInstanceNotRunning})
+		Expect(k8sClient.Status().Update(ctx, instance)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+	})
+
+	setReady := func(status metav1.ConditionStatus) {
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{Type: computev1.ConditionReady, Status: status, Reason: computev1.ReasonInstanceRunning})
+	}
+
+	It("should register the instance once it is ready and report its health", func() {
+		Expect(reconciler.reconcileTargetGroups(ctx, api, instance)).Error().NotTo(HaveOccurred())
+		Expect(api.registered).To(BeEmpty())
+		Expect(instance.Status.TargetGroups).To(ConsistOf(HaveField("State", "unused")))
+
+		setReady(metav1.ConditionTrue)
+		result, err := reconciler.reconcileTargetGroups(ctx, api, instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(targetHealthPollInterval))
+		Expect(api.registered).To(Equal([]string{webTargetGroup}))
+		Expect(instance.Status.TargetGroups).To(Equal([]computev1.TargetGroupStatus{{ARN: webTargetGroup, Port: 8080, State: "initial"}}))
+
+		api.states[webTargetGroup] = elbv2types.TargetHealthStateEnumHealthy
+		result, err = reconciler.reconcileTargetGroups(ctx, api, instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(instance.Status.TargetGroups[0].State).To(Equal("healthy"))
+		Expect(api.registered).To(HaveLen(1))
+	})
+
+	It("should deregister the instance while it is not ready, and when the target group is removed", func() {
+		setReady(metav1.ConditionTrue)
+		Expect(reconciler.reconcileTargetGroups(ctx, api, instance)).Error().NotTo(HaveOccurred())
+
+		setReady(metav1.ConditionFalse)
+		Expect(reconciler.reconcileTargetGroups(ctx, api, instance)).Error().NotTo(HaveOccurred())
+		Expect(api.deregistered).To(Equal([]string{webTargetGroup}))
+		Expect(instance.Status.TargetGroups[0].State).To(Equal("draining"))
+
+		api.drained()
+		setReady(metav1.ConditionTrue)
+		Expect(reconciler.reconcileTargetGroups(ctx, api, instance)).Error().NotTo(HaveOccurred())
+		Expect(api.registered).To(HaveLen(2))
+
+		instance.Spec.TargetGroups = nil
+		Expect(reconciler.reconcileTargetGroups(ctx, api, instance)).Error().NotTo(HaveOccurred())
+		Expect(api.deregistered).To(HaveLen(2))
+		Expect(instance.Status.TargetGroups).To(BeEmpty())
+	})
+
+	It("should wait for connection draining before the instance goes", func() {
+		setReady(metav1.ConditionTrue)
+		Expect(reconciler.reconcileTargetGroups(ctx, api, instance)).Error().NotTo(HaveOccurred())
+
+		Expect(drainTargets(ctx, api, instance)).To(BeFalse())
+		Expect(drainTargets(ctx, api, instance)).To(BeFalse())
+		Expect(api.deregistered).To(HaveLen(1))
+
+		api.drained()
+		Expect(drainTargets(ctx, api, instance)).To(BeTrue())
+		Expect(instance.Status.TargetGroups[0].Reason).To(Equal("Target.NotRegistered"))
+	})
+})
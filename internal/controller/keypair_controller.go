@@ -0,0 +1,355 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	keyPairFinalizer = "keypair.compute.cloud.com"
+	// keyPairUIDTag marks the key pair created for a KeyPair, so that a key pair created by a reconcile
+	// whose status update failed is found instead of failing on the duplicate name.
+	keyPairUIDTag = "compute.cloud.com/key-pair-uid"
+	// keyPairIDAnnotation records on the private key Secret which key pair the key belongs to.
+	keyPairIDAnnotation = "compute.cloud.com/key-pair-id"
+	// keyPairPollInterval is how often a KeyPair waiting for the Secret with its public key is checked.
+	keyPairPollInterval = time.Minute
+	// defaultPublicKeySecretKey is the Secret key the public key is read from, as in kubernetes.io/ssh-auth Secrets.
+	defaultPublicKeySecretKey = "ssh-publickey"
+)
+
+// keyPairAPI is the part of the EC2 client used to manage key pairs.
+type keyPairAPI interface {
+	DescribeKeyPairs(ctx context.Context, params *ec2.DescribeKeyPairsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeKeyPairsOutput, error)
+	CreateKeyPair(ctx context.Context, params *ec2.CreateKeyPairInput, optFns ...func(*ec2.Options)) (*ec2.CreateKeyPairOutput, error)
+	ImportKeyPair(ctx context.Context, params *ec2.ImportKeyPairInput, optFns ...func(*ec2.Options)) (*ec2.ImportKeyPairOutput, error)
+	DeleteKeyPair(ctx context.Context, params *ec2.DeleteKeyPairInput, optFns ...func(*ec2.Options)) (*ec2.DeleteKeyPairOutput, error)
+}
+
+// publicKeyNotFoundError is returned when the Secret of spec.publicKeyFrom, or its key, does not exist (yet).
+type publicKeyNotFoundError struct {
+	message string
+}
+
+func (e *publicKeyNotFoundError) Error() string {
+	return e.message
+}
+
+// KeyPairReconciler reconciles a KeyPair object.
+// It generates a key pair and stores the private key in an owned Secret, or imports a public key,
+// and deletes the key pair when the KeyPair is deleted.
+type KeyPairReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=keypairs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=keypairs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=keypairs/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+
+// Reconcile creates or imports the key pair of a new KeyPair.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.2/pkg/reconcile
+func (r *KeyPairReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	keyPair := &computev1.KeyPair{}
+	if err := r.Get(ctx, req.NamespacedName, keyPair); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !keyPair.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(keyPair, keyPairFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		// The Secret with the private key is deleted by the garbage collector.
+		if keyPair.Status.KeyPairID != "" {
+			if err := deleteKeyPair(ctx, awsClient(keyPair.Status.Region), keyPair.Status.KeyPairID); err != nil {
+				l.Error(err, "Failed to delete key pair")
+				// Kubernetes will retry with backoff
+				return ctrl.Result{}, err
+			}
+		}
+		controllerutil.RemoveFinalizer(keyPair, keyPairFinalizer)
+		if err := r.Update(ctx, keyPair); err != nil {
+			l.Error(err, "Failed to remove finalizer")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if controllerutil.AddFinalizer(keyPair, keyPairFinalizer) {
+		if err := r.Update(ctx, keyPair); err != nil {
+			l.Error(err, "Failed to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if keyPair.Status.KeyPairID == "" {
+		api := awsClient(keyPair.Spec.Region)
+		var (
+			info   *ec2types.KeyPairInfo
+			reason string
+			err    error
+		)
+		if keyPair.Spec.PublicKeyFrom != nil {
+			info, err = r.importKeyPair(ctx, api, keyPair)
+			reason = computev1.ReasonKeyPairImported
+		} else {
+			info, err = r.generateKeyPair(ctx, api, keyPair)
+			reason = computev1.ReasonKeyPairCreated
+			keyPair.Status.SecretName = privateKeySecretName(keyPair)
+		}
+		var notFound *publicKeyNotFoundError
+		switch {
+		case stderrors.As(err, &notFound):
+			l.Info("Not importing key pair yet", "message", notFound.message)
+			setKeyPairReady(keyPair, metav1.ConditionFalse, computev1.ReasonKeyPairPublicKeyNotFound, notFound.message)
+			if err := r.Status().Update(ctx, keyPair); err != nil {
+				l.Error(err, "Failed to update status")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: keyPairPollInterval}, nil
+		case err != nil:
+			l.Error(err, "Failed to create key pair")
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+		keyPair.Status.KeyPairID = aws.ToString(info.KeyPairId)
+		keyPair.Status.KeyName = aws.ToString(info.KeyName)
+		keyPair.Status.Fingerprint = aws.ToString(info.KeyFingerprint)
+		keyPair.Status.Region = keyPair.Spec.Region
+		setKeyPairReady(keyPair, metav1.ConditionTrue, reason, fmt.Sprintf("Key pair %s is ready", keyPair.Status.KeyName))
+	}
+
+	// A generated private key exists nowhere but in its Secret. It cannot be recovered once the Secret is deleted.
+	if keyPair.Status.SecretName != "" {
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: keyPair.Namespace, Name: keyPair.Status.SecretName}, secret)
+		switch {
+		case errors.IsNotFound(err):
+			setKeyPairReady(keyPair, metav1.ConditionFalse, computev1.ReasonKeyPairPrivateKeyLost,
+				fmt.Sprintf("Secret %s with the private key was deleted; delete the KeyPair to generate a new key", keyPair.Status.SecretName))
+		case err != nil:
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.Status().Update(ctx, keyPair); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// keyPairName is the name of the key pair, defaulting to one derived from the KeyPair.
+func keyPairName(keyPair *computev1.KeyPair) string {
+	if keyPair.Spec.KeyName != "" {
+		return keyPair.Spec.KeyName
+	}
+	return keyPair.Namespace + "-" + keyPair.Name
+}
+
+// privateKeySecretName is the name of the Secret the private key of a generated key pair is stored in.
+func privateKeySecretName(keyPair *computev1.KeyPair) string {
+	if keyPair.Spec.SecretName != "" {
+		return keyPair.Spec.SecretName
+	}
+	return keyPair.Name + "-ssh-key"
+}
+
+// keyPairTags are the tags of the key pair, marking it as created for the KeyPair.
+func keyPairTags(keyPair *computev1.KeyPair) []ec2types.TagSpecification {
+	tags := []ec2types.Tag{{Key: aws.String(keyPairUIDTag), Value: aws.String(string(keyPair.UID))}}
+	for key, value := range keyPair.Spec.Tags {
+		tags = append(tags, ec2types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return []ec2types.TagSpecification{{ResourceType: ec2types.ResourceTypeKeyPair, Tags: tags}}
+}
+
+// findKeyPair returns the key pair already created for the KeyPair, or nil.
+func findKeyPair(ctx context.Context, api keyPairAPI, keyPair *computev1.KeyPair) (*ec2types.KeyPairInfo, error) {
+	existing, err := api.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{
+		Filters: []ec2types.Filter{{Name: aws.String("tag:" + keyPairUIDTag), Values: []string{string(keyPair.UID)}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe key pairs: %w", err)
+	}
+	if len(existing.KeyPairs) == 0 {
+		return nil, nil
+	}
+	return &existing.KeyPairs[0], nil
+}
+
+// importKeyPair imports the public key of spec.publicKeyFrom. A key pair already imported for the KeyPair
+// is returned instead.
+func (r *KeyPairReconciler) importKeyPair(ctx context.Context, api keyPairAPI, keyPair *computev1.KeyPair) (*ec2types.KeyPairInfo, error) {
+	if existing, err := findKeyPair(ctx, api, keyPair); err != nil || existing != nil {
+		return existing, err
+	}
+
+	ref := keyPair.Spec.PublicKeyFrom
+	key := ref.Key
+	if key == "" {
+		key = defaultPublicKeySecretKey
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: keyPair.Namespace, Name: ref.Name}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, &publicKeyNotFoundError{fmt.Sprintf("Secret %s not found", ref.Name)}
+		}
+		return nil, err
+	}
+	publicKey, ok := secret.Data[key]
+	if !ok {
+		return nil, &publicKeyNotFoundError{fmt.Sprintf("Secret %s has no key %s", ref.Name, key)}
+	}
+
+	log.FromContext(ctx).Info("Importing key pair", "keyName", keyPairName(keyPair), "secret", ref.Name)
+	output, err := api.ImportKeyPair(ctx, &ec2.ImportKeyPairInput{
+		KeyName:           aws.String(keyPairName(keyPair)),
+		PublicKeyMaterial: publicKey,
+		TagSpecifications: keyPairTags(keyPair),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import key pair %s: %w", keyPairName(keyPair), err)
+	}
+	return &ec2types.KeyPairInfo{KeyPairId: output.KeyPairId, KeyName: output.KeyName, KeyFingerprint: output.KeyFingerprint}, nil
+}
+
+// generateKeyPair creates a key pair and stores its private key in the owned Secret. AWS returns the private
+// key only once, so a key pair created earlier for the KeyPair is only reused when its key made it to the
+// Secret; otherwise it is deleted and generated again.
+func (r *KeyPairReconciler) generateKeyPair(ctx context.Context, api keyPairAPI, keyPair *computev1.KeyPair) (*ec2types.KeyPairInfo, error) {
+	l := log.FromContext(ctx)
+
+	secret := &corev1.Secret{}
+	secretKey := types.NamespacedName{Namespace: keyPair.Namespace, Name: privateKeySecretName(keyPair)}
+	secretExists := true
+	if err := r.Get(ctx, secretKey, secret); err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		secretExists = false
+	}
+	if secretExists && !metav1.IsControlledBy(secret, keyPair) {
+		return nil, fmt.Errorf("secret %s already exists and is not owned by the KeyPair", secretKey.Name)
+	}
+
+	existing, err := findKeyPair(ctx, api, keyPair)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if secretExists && secret.Annotations[keyPairIDAnnotation] == aws.ToString(existing.KeyPairId) {
+			return existing, nil
+		}
+		l.Info("Deleting key pair whose private key was not stored", "keyPairID", aws.ToString(existing.KeyPairId))
+		if err := deleteKeyPair(ctx, api, aws.ToString(existing.KeyPairId)); err != nil {
+			return nil, err
+		}
+	}
+
+	keyType := ec2types.KeyTypeEd25519
+	if keyPair.Spec.KeyType == "rsa" {
+		keyType = ec2types.KeyTypeRsa
+	}
+	l.Info("Creating key pair", "keyName", keyPairName(keyPair), "keyType", keyType)
+	output, err := api.CreateKeyPair(ctx, &ec2.CreateKeyPairInput{
+		KeyName:           aws.String(keyPairName(keyPair)),
+		KeyType:           keyType,
+		KeyFormat:         ec2types.KeyFormatPem,
+		TagSpecifications: keyPairTags(keyPair),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key pair %s: %w", keyPairName(keyPair), err)
+	}
+
+	secret.Name, secret.Namespace = secretKey.Name, secretKey.Namespace
+	secret.Type = corev1.SecretTypeSSHAuth
+	secret.Annotations = map[string]string{keyPairIDAnnotation: aws.ToString(output.KeyPairId)}
+	secret.Data = map[string][]byte{corev1.SSHAuthPrivateKey: []byte(aws.ToString(output.KeyMaterial))}
+	if err := controllerutil.SetControllerReference(keyPair, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+	if secretExists {
+		err = r.Update(ctx, secret)
+	} else {
+		err = r.Create(ctx, secret)
+	}
+	if err != nil {
+		// Without its private key the key pair is useless; generate a new one on the next attempt.
+		if deleteErr := deleteKeyPair(ctx, api, aws.ToString(output.KeyPairId)); deleteErr != nil {
+			l.Error(deleteErr, "Failed to delete key pair whose private key was not stored")
+		}
+		return nil, fmt.Errorf("failed to store private key in secret %s: %w", secretKey.Name, err)
+	}
+	return &ec2types.KeyPairInfo{KeyPairId: output.KeyPairId, KeyName: output.KeyName, KeyFingerprint: output.KeyFingerprint}, nil
+}
+
+// deleteKeyPair deletes the key pair. A key pair that no longer exists is not an error.
+func deleteKeyPair(ctx context.Context, api keyPairAPI, keyPairID string) error {
+	log.FromContext(ctx).Info("Deleting key pair", "keyPairID", keyPairID)
+	_, err := api.DeleteKeyPair(ctx, &ec2.DeleteKeyPairInput{KeyPairId: aws.String(keyPairID)})
+	if err != nil && !strings.Contains(err.Error(), "InvalidKeyPair.NotFound") {
+		return fmt.Errorf("failed to delete key pair %s: %w", keyPairID, err)
+	}
+	return nil
+}
+
+func setKeyPairReady(keyPair *computev1.KeyPair, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&keyPair.Status.Conditions, metav1.Condition{
+		Type:               computev1.ConditionKeyPairReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: keyPair.Generation,
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// The private key Secrets are owned, so that deleting one is reported on its KeyPair.
+func (r *KeyPairReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&computev1.KeyPair{}).
+		Owns(&corev1.Secret{}).
+		Named("keypair").
+		Complete(r)
+}
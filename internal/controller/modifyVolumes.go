@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	// volumeModificationPollInterval is how often a volume being created, attached, detached or modified
+	// is checked for progress.
+	volumeModificationPollInterval = 30 * time.Second
+	// volumeModificationRetryInterval is how long a modification AWS rejected waits before it is requested
+	// again, e.g. while the volume is in the six hour cooldown after its last modification.
+	volumeModificationRetryInterval = time.Hour
+)
+
+// volumeAPI is the part of the EC2 client used to reconcile the volumes of a launched instance.
+type volumeAPI interface {
+	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	DescribeVolumes(ctx context.Context, params *ec2.DescribeVolumesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error)
+	DescribeVolumesModifications(ctx context.Context, params *ec2.DescribeVolumesModificationsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesModificationsOutput, error)
+	ModifyVolume(ctx context.Context, params *ec2.ModifyVolumeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyVolumeOutput, error)
+	CreateVolume(ctx context.Context, params *ec2.CreateVolumeInput, optFns ...func(*ec2.Options)) (*ec2.CreateVolumeOutput, error)
+	AttachVolume(ctx context.Context, params *ec2.AttachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.AttachVolumeOutput, error)
+	DetachVolume(ctx context.Context, params *ec2.DetachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.DetachVolumeOutput, error)
+	DeleteVolume(ctx context.Context, params *ec2.DeleteVolumeInput, optFns ...func(*ec2.Options)) (*ec2.DeleteVolumeOutput, error)
+	ModifyInstanceAttribute(ctx context.Context, params *ec2.ModifyInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error)
+}
+
+// reconcileVolumes brings the volumes of a launched instance in line with the resolved spec and reports
+// them in status.volumes: additional volumes are created and attached or detached and released, and
+// attached volumes are modified. While any of that is running the instance is checked again shortly,
+// so that the status follows its progress.
+func (r *Ec2InstanceReconciler) reconcileVolumes(ctx context.Context, ec2Instance *computev1.Ec2Instance, resolved *computev1.Ec2Instance) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	api := awsClient(instanceRegion(ec2Instance))
+	instance, err := describeInstance(ctx, api, ec2Instance.Status.InstanceID)
+	if err != nil {
+		l.Error(err, "Failed to reconcile volumes")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+	pending, attaching, err := syncAttachments(ctx, api, instance, resolved.Spec.Storage, ec2Instance.Status.Volumes, resolved.Spec.Tags)
+	if err != nil {
+		l.Error(err, "Failed to attach or detach volumes")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+	volumes, next, err := syncVolumes(ctx, api, instance, resolved.Spec.Storage, ec2Instance.Status.Volumes, time.Now())
+	if err != nil {
+		l.Error(err, "Failed to reconcile volumes")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+	volumes = append(volumes, pending...)
+
+	result := ctrl.Result{RequeueAfter: next}
+	if attaching {
+		result = earliestResult(result, ctrl.Result{RequeueAfter: volumeModificationPollInterval})
+	}
+	if equality.Semantic.DeepEqual(volumes, ec2Instance.Status.Volumes) {
+		return result, nil
+	}
+	ec2Instance.Status.Volumes = volumes
+	if err := r.Status().Update(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// syncVolumes compares the root and additional volumes of the spec with the volumes attached to the instance,
+// starts a ModifyVolume for every volume that has to grow or change type, IOPS or throughput, and returns
+// their status. next is when the volumes are to be checked again: shortly while any of them is still being
+// modified, and after the retry interval kept in previous when AWS rejected a modification.
+// Volumes of the spec that are not attached to the instance are left out.
+func syncVolumes(ctx context.Context, api volumeAPI, instance ec2types.Instance, storage computev1.StorageConfig,
+	previous []computev1.VolumeStatus, now time.Time) (statuses []computev1.VolumeStatus, next time.Duration, err error) {
+	l := log.FromContext(ctx)
+	requeueAfter := func(after time.Duration) {
+		if next == 0 || after < next {
+			next = after
+		}
+	}
+
+	instanceID := aws.ToString(instance.InstanceId)
+
+	// The root volume is usually declared without a device name, it is the instance's root device.
+	desired := map[string]computev1.VolumeConfig{}
+	rootVolume := storage.RootVolume
+	if rootVolume.DeviceName == "" {
+		rootVolume.DeviceName = aws.ToString(instance.RootDeviceName)
+	}
+	desired[rootVolume.DeviceName] = rootVolume
+	for _, volume := range storage.AdditionalVolumes {
+		if volume.DeviceName != "" {
+			desired[volume.DeviceName] = volume
+		}
+	}
+
+	var devices []string
+	volumeDevices := map[string]string{}
+	for _, mapping := range instance.BlockDeviceMappings {
+		device := aws.ToString(mapping.DeviceName)
+		if _, ok := desired[device]; !ok || mapping.Ebs == nil {
+			continue
+		}
+		devices = append(devices, device)
+		volumeDevices[aws.ToString(mapping.Ebs.VolumeId)] = device
+	}
+	if len(devices) == 0 {
+		return nil, 0, nil
+	}
+	volumeIDs := make([]string, 0, len(volumeDevices))
+	for volumeID := range volumeDevices {
+		volumeIDs = append(volumeIDs, volumeID)
+	}
+
+	described, err := api.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{VolumeIds: volumeIDs})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to describe volumes of instance %s: %w", instanceID, err)
+	}
+	// Filtering instead of passing volume IDs, because AWS returns an error for volumes never modified.
+	modifications, err := api.DescribeVolumesModifications(ctx, &ec2.DescribeVolumesModificationsInput{
+		Filters: []ec2types.Filter{{Name: aws.String("volume-id"), Values: volumeIDs}},
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to describe volume modifications of instance %s: %w", instanceID, err)
+	}
+	latest := map[string]ec2types.VolumeModification{}
+	for _, modification := range modifications.VolumesModifications {
+		volumeID := aws.ToString(modification.VolumeId)
+		if previous, ok := latest[volumeID]; !ok || aws.ToTime(modification.StartTime).After(aws.ToTime(previous.StartTime)) {
+			latest[volumeID] = modification
+		}
+	}
+
+	byDevice := map[string]computev1.VolumeStatus{}
+	for _, volume := range described.Volumes {
+		volumeID := aws.ToString(volume.VolumeId)
+		device := volumeDevices[volumeID]
+		status := computev1.VolumeStatus{
+			DeviceName: device,
+			VolumeID:   volumeID,
+			Size:       aws.ToInt32(volume.Size),
+			Type:       string(volume.VolumeType),
+			IOPS:       aws.ToInt32(volume.Iops),
+			Throughput: aws.ToInt32(volume.Throughput),
+			State:      string(volume.State),
+		}
+		if attachment := volumeAttachment(volume, instanceID); attachment != nil {
+			status.AttachmentState = string(attachment.State)
+		}
+		if device != rootVolume.DeviceName {
+			status.DeletionPolicy = volumeDeletionPolicy(desired[device])
+		}
+
+		modification, modified := latest[volumeID]
+		if modified {
+			status.ModificationState = string(modification.ModificationState)
+			status.ModificationProgress = aws.ToInt64(modification.Progress)
+			// The described volume keeps its original attributes until the modification is done, so
+			// report the target values, which are what the volume is being turned into.
+			if modification.ModificationState != ec2types.VolumeModificationStateFailed {
+				status.Size = aws.ToInt32(modification.TargetSize)
+				status.Type = string(modification.TargetVolumeType)
+				status.IOPS = aws.ToInt32(modification.TargetIops)
+				status.Throughput = aws.ToInt32(modification.TargetThroughput)
+			}
+		}
+
+		switch modification.ModificationState {
+		case ec2types.VolumeModificationStateModifying, ec2types.VolumeModificationStateOptimizing:
+			// A volume can only be modified again once the running modification has completed.
+			requeueAfter(volumeModificationPollInterval)
+			byDevice[device] = status
+			continue
+		case ec2types.VolumeModificationStateFailed:
+			status.Message = aws.ToString(modification.StatusMessage)
+		}
+
+		input := volumeModification(desired[device], status)
+		if input == nil {
+			byDevice[device] = status
+			continue
+		}
+		if modification.ModificationState == ec2types.VolumeModificationStateFailed && sameModification(input, modification) {
+			// Retrying the same modification would fail the same way; the spec has to change first.
+			byDevice[device] = status
+			continue
+		}
+
+		if rejected := previousVolumeStatus(previous, device); rejected != nil && rejected.ModificationRetryAt != nil &&
+			now.Before(rejected.ModificationRetryAt.Time) {
+			status.Message = rejected.Message
+			status.ModificationRetryAt = rejected.ModificationRetryAt
+			requeueAfter(rejected.ModificationRetryAt.Sub(now))
+			byDevice[device] = status
+			continue
+		}
+
+		input.VolumeId = volume.VolumeId
+		l.Info("Modifying volume", "volumeID", volumeID, "device", device)
+		output, err := api.ModifyVolume(ctx, input)
+		if err != nil {
+			// E.g. the volume was modified less than six hours ago. Report it and try again much later,
+			// instead of asking AWS again on every poll.
+			status.Message = err.Error()
+			status.ModificationRetryAt = &metav1.Time{Time: now.Add(volumeModificationRetryInterval)}
+			requeueAfter(volumeModificationRetryInterval)
+			byDevice[device] = status
+			continue
+		}
+		status.Message = ""
+		status.ModificationState = string(output.VolumeModification.ModificationState)
+		status.ModificationProgress = aws.ToInt64(output.VolumeModification.Progress)
+		status.Size = aws.ToInt32(output.VolumeModification.TargetSize)
+		status.Type = string(output.VolumeModification.TargetVolumeType)
+		status.IOPS = aws.ToInt32(output.VolumeModification.TargetIops)
+		status.Throughput = aws.ToInt32(output.VolumeModification.TargetThroughput)
+		requeueAfter(volumeModificationPollInterval)
+		byDevice[device] = status
+	}
+
+	for _, device := range devices {
+		if status, ok := byDevice[device]; ok {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, next, nil
+}
+
+// previousVolumeStatus returns the status last reported for the device, or nil.
+func previousVolumeStatus(previous []computev1.VolumeStatus, device string) *computev1.VolumeStatus {
+	for i := range previous {
+		if previous[i].DeviceName == device {
+			return &previous[i]
+		}
+	}
+	return nil
+}
+
+// instanceDescriber is the part of the EC2 client used to read an instance.
+type instanceDescriber interface {
+	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+}
+
+// describeInstance returns the instance with the given ID.
+func describeInstance(ctx context.Context, api instanceDescriber, instanceID string) (ec2types.Instance, error) {
+	instances, err := api.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}})
+	if err != nil {
+		return ec2types.Instance{}, fmt.Errorf("failed to describe instance %s: %w", instanceID, err)
+	}
+	if len(instances.Reservations) == 0 || len(instances.Reservations[0].Instances) == 0 {
+		return ec2types.Instance{}, fmt.Errorf("instance %s not found", instanceID)
+	}
+	return instances.Reservations[0].Instances[0], nil
+}
+
+// volumeModification returns the ModifyVolume request turning the current volume into the desired one,
+// or nil when nothing has to change. Unset attributes and smaller sizes are ignored.
+func volumeModification(desired computev1.VolumeConfig, current computev1.VolumeStatus) *ec2.ModifyVolumeInput {
+	input := &ec2.ModifyVolumeInput{}
+	changed := false
+	if desired.Size > current.Size {
+		input.Size = aws.Int32(desired.Size)
+		changed = true
+	}
+	if desired.Type != "" && desired.Type != current.Type {
+		input.VolumeType = ec2types.VolumeType(desired.Type)
+		changed = true
+	}
+	if desired.IOPS > 0 && desired.IOPS != current.IOPS {
+		input.Iops = aws.Int32(desired.IOPS)
+		changed = true
+	}
+	if desired.Throughput > 0 && desired.Throughput != current.Throughput {
+		input.Throughput = aws.Int32(desired.Throughput)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return input
+}
+
+// sameModification tells whether a request asks for the same target values as an earlier modification.
+func sameModification(input *ec2.ModifyVolumeInput, modification ec2types.VolumeModification) bool {
+	return (input.Size == nil || aws.ToInt32(input.Size) == aws.ToInt32(modification.TargetSize)) &&
+		(input.VolumeType == "" || input.VolumeType == modification.TargetVolumeType) &&
+		(input.Iops == nil || aws.ToInt32(input.Iops) == aws.ToInt32(modification.TargetIops)) &&
+		(input.Throughput == nil || aws.ToInt32(input.Throughput) == aws.ToInt32(modification.TargetThroughput))
+}
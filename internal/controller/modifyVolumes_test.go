@@ -0,0 +1,340 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// fakeVolumes is an instance in us-east-1a with a root volume on /dev/xvda and a data volume on /dev/sdf.
+// Volumes it creates are available right away, attaching and detaching completes on the next describe.
+type fakeVolumes struct {
+	volumes       map[string]ec2types.Volume
+	devices       map[string]string
+	modifications []ec2types.VolumeModification
+	modifyErr     error
+	modified      []*ec2.ModifyVolumeInput
+	created       []*ec2.CreateVolumeInput
+	deleted       []string
+	attributes    []*ec2.ModifyInstanceAttributeInput
+}
+
+func newFakeVolumes() *fakeVolumes {
+	attachment := []ec2types.VolumeAttachment{{InstanceId: aws.String("i-0123"), State: ec2types.VolumeAttachmentStateAttached}}
+	return &fakeVolumes{
+		volumes: map[string]ec2types.Volume{
+			"vol-root": {VolumeId: aws.String("vol-root"), Size: aws.Int32(30), VolumeType: ec2types.VolumeTypeGp3, Iops: aws.Int32(3000), Throughput: aws.Int32(125),
+				State: ec2types.VolumeStateInUse, Attachments: attachment},
+			"vol-data": {VolumeId: aws.String("vol-data"), Size: aws.Int32(100), VolumeType: ec2types.VolumeTypeGp2, Iops: aws.Int32(300),
+				State: ec2types.VolumeStateInUse, Attachments: attachment},
+		},
+		devices: map[string]string{"/dev/xvda": "vol-root", "/dev/sdf": "vol-data"},
+	}
+}
+
+// instance returns the instance as DescribeInstances reports it.
+func (f *fakeVolumes) instance() ec2types.Instance {
+	instance := ec2types.Instance{
+		InstanceId:     aws.String("i-0123"),
+		RootDeviceName: aws.String("/dev/xvda"),
+		Placement:      &ec2types.Placement{AvailabilityZone: aws.String("us-east-1a")},
+	}
+	for _, device := range []string{"/dev/xvda", "/dev/sdf", "/dev/sdg"} {
+		volumeID, ok := f.devices[device]
+		if !ok {
+			continue
+		}
+		volume := f.volumes[volumeID]
+		instance.BlockDeviceMappings = append(instance.BlockDeviceMappings, ec2types.InstanceBlockDeviceMapping{
+			DeviceName: aws.String(device),
+			Ebs: &ec2types.EbsInstanceBlockDevice{
+				VolumeId:            aws.String(volumeID),
+				Status:              ec2types.AttachmentStatus(volume.Attachments[0].State),
+				DeleteOnTermination: aws.Bool(device != "/dev/sdg"),
+			},
+		})
+	}
+	return instance
+}
+
+func (f *fakeVolumes) DescribeInstances(_ context.Context, _ *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{f.instance()}}}}, nil
+}
+
+func (f *fakeVolumes) DescribeVolumes(_ context.Context, params *ec2.DescribeVolumesInput, _ ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+	output := &ec2.DescribeVolumesOutput{}
+	for _, volumeID := range params.VolumeIds {
+		output.Volumes = append(output.Volumes, f.volumes[volumeID])
+	}
+	for _, filter := range params.Filters {
+		if aws.ToString(filter.Name) == "volume-id" {
+			if volume, ok := f.volumes[filter.Values[0]]; ok {
+				output.Volumes = append(output.Volumes, volume)
+			}
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeVolumes) CreateVolume(_ context.Context, params *ec2.CreateVolumeInput, _ ...func(*ec2.Options)) (*ec2.CreateVolumeOutput, error) {
+	f.created = append(f.created, params)
+	volumeID := "vol-new"
+	f.volumes[volumeID] = ec2types.Volume{VolumeId: aws.String(volumeID), Size: params.Size, VolumeType: params.VolumeType, State: ec2types.VolumeStateAvailable}
+	return &ec2.CreateVolumeOutput{VolumeId: aws.String(volumeID), State: ec2types.VolumeStateCreating}, nil
+}
+
+func (f *fakeVolumes) AttachVolume(_ context.Context, params *ec2.AttachVolumeInput, _ ...func(*ec2.Options)) (*ec2.AttachVolumeOutput, error) {
+	volume := f.volumes[aws.ToString(params.VolumeId)]
+	volume.State = ec2types.VolumeStateInUse
+	volume.Attachments = []ec2types.VolumeAttachment{{InstanceId: params.InstanceId, State: ec2types.VolumeAttachmentStateAttached}}
+	f.volumes[aws.ToString(params.VolumeId)] = volume
+	f.devices[aws.ToString(params.Device)] = aws.ToString(params.VolumeId)
+	return &ec2.AttachVolumeOutput{State: ec2types.VolumeAttachmentStateAttaching}, nil
+}
+
+func (f *fakeVolumes) DetachVolume(_ context.Context, params *ec2.DetachVolumeInput, _ ...func(*ec2.Options)) (*ec2.DetachVolumeOutput, error) {
+	volume := f.volumes[aws.ToString(params.VolumeId)]
+	volume.State = ec2types.VolumeStateAvailable
+	volume.Attachments = nil
+	f.volumes[aws.ToString(params.VolumeId)] = volume
+	for device, volumeID := range f.devices {
+		if volumeID == aws.ToString(params.VolumeId) {
+			delete(f.devices, device)
+		}
+	}
+	return &ec2.DetachVolumeOutput{State: ec2types.VolumeAttachmentStateDetaching}, nil
+}
+
+func (f *fakeVolumes) DeleteVolume(_ context.Context, params *ec2.DeleteVolumeInput, _ ...func(*ec2.Options)) (*ec2.DeleteVolumeOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(params.VolumeId))
+	delete(f.volumes, aws.ToString(params.VolumeId))
+	return &ec2.DeleteVolumeOutput{}, nil
+}
+
+func (f *fakeVolumes) ModifyInstanceAttribute(_ context.Context, params *ec2.ModifyInstanceAttributeInput, _ ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error) {
+	f.attributes = append(f.attributes, params)
+	return &ec2.ModifyInstanceAttributeOutput{}, nil
+}
+
+func (f *fakeVolumes) DescribeVolumesModifications(_ context.Context, _ *ec2.DescribeVolumesModificationsInput, _ ...func(*ec2.Options)) (*ec2.DescribeVolumesModificationsOutput, error) {
+	return &ec2.DescribeVolumesModificationsOutput{VolumesModifications: f.modifications}, nil
+}
+
+func (f *fakeVolumes) ModifyVolume(_ context.Context, params *ec2.ModifyVolumeInput, _ ...func(*ec2.Options)) (*ec2.ModifyVolumeOutput, error) {
+	if f.modifyErr != nil {
+		return nil, f.modifyErr
+	}
+	f.modified = append(f.modified, params)
+	volume := f.volumes[aws.ToString(params.VolumeId)]
+	modification := ec2types.VolumeModification{
+		VolumeId:          params.VolumeId,
+		ModificationState: ec2types.VolumeModificationStateModifying,
+		TargetSize:        volume.Size,
+		TargetVolumeType:  volume.VolumeType,
+		TargetIops:        volume.Iops,
+		TargetThroughput:  volume.Throughput,
+		StartTime:         aws.Time(time.Now()),
+	}
+	if params.Size != nil {
+		modification.TargetSize = params.Size
+	}
+	if params.VolumeType != "" {
+		modification.TargetVolumeType = params.VolumeType
+	}
+	f.modifications = append(f.modifications, modification)
+	return &ec2.ModifyVolumeOutput{VolumeModification: &modification}, nil
+}
+
+var _ = Describe("Volume reconciliation", func() {
+	ctx := context.Background()
+
+	var (
+		api     *fakeVolumes
+		storage computev1.StorageConfig
+	)
+
+	BeforeEach(func() {
+		api = newFakeVolumes()
+		storage = computev1.StorageConfig{
+			RootVolume:        computev1.VolumeConfig{Size: 30, Type: "gp3"},
+			AdditionalVolumes: []computev1.VolumeConfig{{Size: 100, Type: "gp2", DeviceName: "/dev/sdf"}},
+		}
+	})
+
+	It("should report the volumes without modifying them when they match the spec", func() {
+		statuses, next, err := syncVolumes(ctx, api, api.instance(), storage, nil, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(BeZero())
+		Expect(api.modified).To(BeEmpty())
+		Expect(statuses).To(HaveLen(2))
+		Expect(statuses[0]).To(Equal(computev1.VolumeStatus{DeviceName: "/dev/xvda", VolumeID: "vol-root", Size: 30, Type: "gp3", IOPS: 3000, Throughput: 125,
+			State: "in-use", AttachmentState: "attached"}))
+		Expect(statuses[1].DeletionPolicy).To(Equal(computev1.VolumeDeletionPolicyDelete))
+	})
+
+	It("should grow the root volume and change the type of a data volume", func() {
+		storage.RootVolume.Size = 50
+		storage.AdditionalVolumes[0].Type = "gp3"
+
+		statuses, next, err := syncVolumes(ctx, api, api.instance(), storage, nil, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(volumeModificationPollInterval))
+		Expect(api.modified).To(HaveLen(2))
+		Expect(statuses[0].Size).To(BeEquivalentTo(50))
+		Expect(statuses[0].ModificationState).To(Equal("modifying"))
+		Expect(statuses[1].Type).To(Equal("gp3"))
+
+		By("waiting for the running modifications instead of starting new ones")
+		_, next, err = syncVolumes(ctx, api, api.instance(), storage, nil, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(volumeModificationPollInterval))
+		Expect(api.modified).To(HaveLen(2))
+	})
+
+	It("should never shrink a volume", func() {
+		storage.RootVolume.Size = 20
+		_, _, err := syncVolumes(ctx, api, api.instance(), storage, nil, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api.modified).To(BeEmpty())
+	})
+
+	It("should report a rejected modification and retry it only after the retry interval", func() {
+		storage.RootVolume.Size = 50
+		api.modifyErr = errors.New("VolumeModificationRateExceeded")
+		now := time.Now()
+
+		statuses, next, err := syncVolumes(ctx, api, api.instance(), storage, nil, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(volumeModificationRetryInterval))
+		Expect(statuses[0].Size).To(BeEquivalentTo(30))
+		Expect(statuses[0].Message).To(ContainSubstring("VolumeModificationRateExceeded"))
+
+		By("not asking AWS again on the next polls")
+		api.modifyErr = nil
+		now = now.Add(10 * time.Minute)
+		statuses, next, err = syncVolumes(ctx, api, api.instance(), storage, statuses, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(50 * time.Minute))
+		Expect(api.modified).To(BeEmpty())
+		Expect(statuses[0].Message).To(ContainSubstring("VolumeModificationRateExceeded"))
+
+		now = now.Add(50 * time.Minute)
+		statuses, next, err = syncVolumes(ctx, api, api.instance(), storage, statuses, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(next).To(Equal(volumeModificationPollInterval))
+		Expect(api.modified).To(HaveLen(1))
+		Expect(statuses[0].Message).To(BeEmpty())
+	})
+
+	It("should not retry a failed modification with the same target", func() {
+		storage.RootVolume.Size = 50
+		api.modifications = []ec2types.VolumeModification{{
+			VolumeId:          aws.String("vol-root"),
+			ModificationState: ec2types.VolumeModificationStateFailed,
+			StatusMessage:     aws.String("size exceeds the limit"),
+			TargetSize:        aws.Int32(50),
+			TargetVolumeType:  ec2types.VolumeTypeGp3,
+			TargetIops:        aws.Int32(3000),
+			TargetThroughput:  aws.Int32(125),
+			StartTime:         aws.Time(time.Now()),
+		}}
+
+		statuses, _, err := syncVolumes(ctx, api, api.instance(), storage, nil, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api.modified).To(BeEmpty())
+		Expect(statuses[0].ModificationState).To(Equal("failed"))
+		Expect(statuses[0].Message).To(Equal("size exceeds the limit"))
+	})
+
+	Context("When additional volumes are added or removed", func() {
+		reconcile := func(previous []computev1.VolumeStatus) ([]computev1.VolumeStatus, bool) {
+			instance := api.instance()
+			pending, attaching, err := syncAttachments(ctx, api, instance, storage, previous, map[string]string{"team": "compute"})
+			Expect(err).NotTo(HaveOccurred())
+			statuses, _, err := syncVolumes(ctx, api, instance, storage, previous, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			return append(statuses, pending...), attaching
+		}
+
+		It("should create a new volume in the instance's zone and attach it once available", func() {
+			storage.AdditionalVolumes = append(storage.AdditionalVolumes, computev1.VolumeConfig{Size: 20, Type: "gp3", DeviceName: "/dev/sdg"})
+
+			statuses, attaching := reconcile(nil)
+			Expect(attaching).To(BeTrue())
+			Expect(api.created).To(HaveLen(1))
+			Expect(aws.ToString(api.created[0].AvailabilityZone)).To(Equal("us-east-1a"))
+			Expect(api.created[0].TagSpecifications[0].Tags).To(ContainElement(ec2types.Tag{Key: aws.String(volumeDeviceTag), Value: aws.String("/dev/sdg")}))
+			Expect(statuses[2]).To(Equal(computev1.VolumeStatus{DeviceName: "/dev/sdg", VolumeID: "vol-new", Size: 20, Type: "gp3",
+				State: "creating", DeletionPolicy: computev1.VolumeDeletionPolicyDelete}))
+
+			statuses, attaching = reconcile(statuses)
+			Expect(attaching).To(BeTrue())
+			Expect(api.created).To(HaveLen(1))
+			Expect(statuses[2].AttachmentState).To(Equal("attaching"))
+
+			By("making the attached volume go away with the instance, as its policy is Delete")
+			statuses, attaching = reconcile(statuses)
+			Expect(attaching).To(BeFalse())
+			Expect(statuses).To(HaveLen(3))
+			Expect(statuses[2].AttachmentState).To(Equal("attached"))
+			Expect(api.attributes).To(HaveLen(1))
+			Expect(aws.ToBool(api.attributes[0].BlockDeviceMappings[0].Ebs.DeleteOnTermination)).To(BeTrue())
+		})
+
+		It("should detach and delete a removed volume", func() {
+			statuses, _ := reconcile(nil)
+			storage.AdditionalVolumes = nil
+
+			statuses, detaching := reconcile(statuses)
+			Expect(detaching).To(BeTrue())
+			Expect(statuses).To(HaveLen(2))
+			Expect(statuses[1].AttachmentState).To(Equal("detaching"))
+			Expect(api.deleted).To(BeEmpty())
+
+			statuses, detaching = reconcile(statuses)
+			Expect(detaching).To(BeFalse())
+			Expect(statuses).To(HaveLen(1))
+			Expect(api.deleted).To(ConsistOf("vol-data"))
+		})
+
+		It("should detach and keep a removed volume with the Retain policy", func() {
+			storage.AdditionalVolumes[0].DeletionPolicy = computev1.VolumeDeletionPolicyRetain
+			statuses, _ := reconcile(nil)
+			Expect(statuses[1].DeletionPolicy).To(Equal(computev1.VolumeDeletionPolicyRetain))
+			Expect(api.attributes).To(HaveLen(1))
+			Expect(aws.ToBool(api.attributes[0].BlockDeviceMappings[0].Ebs.DeleteOnTermination)).To(BeFalse())
+
+			storage.AdditionalVolumes = nil
+			statuses, _ = reconcile(statuses)
+			statuses, detaching := reconcile(statuses)
+			Expect(detaching).To(BeFalse())
+			Expect(statuses).To(HaveLen(1))
+			Expect(api.deleted).To(BeEmpty())
+			Expect(api.volumes).To(HaveKey("vol-data"))
+		})
+	})
+})
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// defaultImageCheckInterval is how often spec.image is resolved again when no checkInterval is set.
+const defaultImageCheckInterval = time.Hour
+
+// reconcileImageRefresh periodically resolves spec.image of a launched instance again and records the newest
+// AMI in the status. With the OnNewVersion refresh policy, an instance that does not run the newest AMI is
+// terminated within its maintenance window; the next reconcile then launches it again from the newer AMI.
+func (r *Ec2InstanceReconciler) reconcileImageRefresh(ctx context.Context, ec2Instance *computev1.Ec2Instance, resolved *computev1.Ec2Instance) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	image := resolved.Spec.Image
+	if image == nil || resolved.Spec.AMIId != "" || ec2Instance.Status.ResolvedAMIId == "" {
+		return ctrl.Result{}, nil
+	}
+
+	now := time.Now()
+	interval := imageCheckInterval(image)
+	if checked := ec2Instance.Status.ImageCheckedAt; checked == nil || now.Sub(checked.Time) >= interval {
+		amiID, err := r.resolveInstanceImage(ctx, ec2Instance.Namespace, instanceRegion(ec2Instance), image)
+		var notFound *imageNotFoundError
+		switch {
+		case errors.As(err, &notFound):
+			// Keep the last known AMI; the image may be unpublished only temporarily.
+			l.Info("Image no longer resolves", "reason", notFound.Error())
+		case err != nil:
+			l.Error(err, "Failed to resolve image")
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		default:
+			ec2Instance.Status.AvailableAMIId = amiID
+		}
+		ec2Instance.Status.ImageCheckedAt = &metav1.Time{Time: now}
+	}
+	untilNextCheck := ec2Instance.Status.ImageCheckedAt.Add(interval).Sub(now)
+
+	current, available := ec2Instance.Status.ResolvedAMIId, ec2Instance.Status.AvailableAMIId
+	condition := metav1.Condition{
+		Type:               computev1.ConditionImageUpToDate,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec2Instance.Generation,
+	}
+	result := ctrl.Result{RequeueAfter: untilNextCheck}
+	refresh := false
+	switch {
+	case available == "" || available == current:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = computev1.ReasonImageCurrent
+		condition.Message = fmt.Sprintf("Instance runs the newest AMI %s", current)
+	case image.Refresh != computev1.ImageRefreshOnNewVersion:
+		condition.Reason = computev1.ReasonNewVersionAvailable
+		condition.Message = fmt.Sprintf("AMI %s is available, instance runs %s", available, current)
+	default:
+		inWindow, nextWindow := inMaintenanceWindow(image.MaintenanceWindow, now)
+		if inWindow {
+			refresh = true
+			condition.Reason = computev1.ReasonRefreshing
+			condition.Message = fmt.Sprintf("Replacing instance running %s with AMI %s", current, available)
+			break
+		}
+		condition.Reason = computev1.ReasonRefreshScheduled
+		condition.Message = fmt.Sprintf("Instance will be replaced with AMI %s in the maintenance window starting %s",
+			available, nextWindow.Format(time.RFC3339))
+		result.RequeueAfter = min(untilNextCheck, nextWindow.Sub(now))
+	}
+	meta.SetStatusCondition(&ec2Instance.Status.Conditions, condition)
+
+	if refresh {
+		l.Info("Refreshing instance", "instanceID", ec2Instance.Status.InstanceID, "from", current, "to", available)
+		replaced, err := replaceInstance(ctx, ec2Instance)
+		if err != nil {
+			l.Error(err, "Failed to terminate EC2 instance for refresh")
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+		if replaced {
+			// The next reconcile launches the instance again, from the pinned AMI.
+			ec2Instance.Status.ResolvedAMIId = available
+			result = ctrl.Result{RequeueAfter: time.Second}
+		} else {
+			condition.Message = fmt.Sprintf("Draining instance running %s before replacing it with AMI %s", current, available)
+			meta.SetStatusCondition(&ec2Instance.Status.Conditions, condition)
+			result.RequeueAfter = targetHealthPollInterval
+		}
+	}
+
+	if err := r.Status().Update(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+func imageCheckInterval(image *computev1.ImageSelector) time.Duration {
+	if image.CheckInterval == nil || image.CheckInterval.Duration <= 0 {
+		return defaultImageCheckInterval
+	}
+	return image.CheckInterval.Duration
+}
+
+// inMaintenanceWindow tells whether now falls into the window, and otherwise when the window opens next.
+// A nil window is always open.
+func inMaintenanceWindow(window *computev1.MaintenanceWindow, now time.Time) (bool, time.Time) {
+	if window == nil {
+		return true, time.Time{}
+	}
+	startOfDay, err := time.Parse("15:04", window.StartTime)
+	if err != nil {
+		// Rejected by the CRD pattern, so this only happens for objects stored before validation existed.
+		return false, now.Add(defaultImageCheckInterval)
+	}
+
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), startOfDay.Hour(), startOfDay.Minute(), 0, 0, time.UTC)
+	var next time.Time
+	// Windows last at most a week, so looking one week back and ahead finds both an open and the next window.
+	for offset := -7; offset <= 7; offset++ {
+		start := today.AddDate(0, 0, offset)
+		if len(window.Days) > 0 && !slices.Contains(window.Days, computev1.MaintenanceDay(start.Weekday().String())) {
+			continue
+		}
+		if !start.After(now) && now.Before(start.Add(window.Duration.Duration)) {
+			return true, time.Time{}
+		}
+		if start.After(now) && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return false, next
+}
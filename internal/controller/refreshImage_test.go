@@ -0,0 +1,68 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+var _ = Describe("Maintenance windows", func() {
+	// Saturday and Sunday nights from 22:00 to 02:00 UTC.
+	window := &computev1.MaintenanceWindow{
+		Days:      []computev1.MaintenanceDay{"Saturday", "Sunday"},
+		StartTime: "22:00",
+		Duration:  metav1.Duration{Duration: 4 * time.Hour},
+	}
+	at := func(value string) time.Time {
+		t, err := time.Parse(time.RFC3339, value)
+		Expect(err).NotTo(HaveOccurred())
+		return t
+	}
+
+	It("should always be open without a window", func() {
+		open, _ := inMaintenanceWindow(nil, at("2025-06-04T12:00:00Z"))
+		Expect(open).To(BeTrue())
+	})
+
+	It("should be open within the window", func() {
+		open, _ := inMaintenanceWindow(window, at("2025-06-07T23:30:00Z"))
+		Expect(open).To(BeTrue())
+	})
+
+	It("should be open past midnight when the window started the day before", func() {
+		open, _ := inMaintenanceWindow(window, at("2025-06-09T01:00:00Z"))
+		Expect(open).To(BeTrue())
+	})
+
+	It("should report the next opening outside the window", func() {
+		open, next := inMaintenanceWindow(window, at("2025-06-04T12:00:00+02:00"))
+		Expect(open).To(BeFalse())
+		Expect(next).To(Equal(at("2025-06-07T22:00:00Z")))
+	})
+
+	It("should be closed once the window has passed", func() {
+		open, next := inMaintenanceWindow(window, at("2025-06-09T02:00:00Z"))
+		Expect(open).To(BeFalse())
+		Expect(next).To(Equal(at("2025-06-14T22:00:00Z")))
+	})
+})
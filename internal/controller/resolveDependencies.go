@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// resolveDependencies checks that every Ec2Instance the instance depends on exists and meets its condition.
+// Dependencies that depend on the instance in turn would wait for each other forever, and are reported as a cycle.
+func resolveDependencies(ctx context.Context, c client.Client, ec2Instance *computev1.Ec2Instance) error {
+	cycle, err := findDependencyCycle(ctx, c, ec2Instance.Namespace, []string{ec2Instance.Name}, ec2Instance.Spec.DependsOn)
+	if err != nil {
+		return err
+	}
+	if cycle != nil {
+		return &resolutionError{computev1.ReasonDependencyCycle,
+			fmt.Sprintf("Dependencies form a cycle: %s", strings.Join(cycle, " -> "))}
+	}
+
+	for _, dependency := range ec2Instance.Spec.DependsOn {
+		instance := &computev1.Ec2Instance{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: ec2Instance.Namespace, Name: dependency.Name}, instance); err != nil {
+			if errors.IsNotFound(err) {
+				return &resolutionError{computev1.ReasonDependencyNotFound, fmt.Sprintf("Ec2Instance %s not found", dependency.Name)}
+			}
+			return err
+		}
+		condition := dependencyCondition(dependency)
+		if !meta.IsStatusConditionTrue(instance.Status.Conditions, condition) {
+			return &resolutionError{computev1.ReasonDependencyNotReady,
+				fmt.Sprintf("Waiting for Ec2Instance %s to be %s", dependency.Name, condition)}
+		}
+	}
+	return nil
+}
+
+// findDependencyCycle follows the dependencies from the end of path and returns the first path that leads back
+// to an instance already on it. Dependencies that do not exist end a path; they are reported on their own.
+func findDependencyCycle(ctx context.Context, c client.Client, namespace string, path []string, dependencies []computev1.InstanceDependency) ([]string, error) {
+	for _, dependency := range dependencies {
+		next := append(slices.Clone(path), dependency.Name)
+		if slices.Contains(path, dependency.Name) {
+			return next, nil
+		}
+		instance := &computev1.Ec2Instance{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: dependency.Name}, instance); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		cycle, err := findDependencyCycle(ctx, c, namespace, next, instance.Spec.DependsOn)
+		if err != nil || cycle != nil {
+			return cycle, err
+		}
+	}
+	return nil, nil
+}
+
+// dependencyCondition is the condition a dependency has to meet, Ready unless set.
+func dependencyCondition(dependency computev1.InstanceDependency) string {
+	if dependency.Condition == "" {
+		return computev1.ConditionReady
+	}
+	return dependency.Condition
+}
+
+// dependentInstances returns the names of the Ec2Instances depending on the instance. The instances of the
+// namespace are filtered instead of using a field index, so that it also works on an uncached client.
+func dependentInstances(ctx context.Context, c client.Client, ec2Instance *computev1.Ec2Instance) ([]string, error) {
+	instances := &computev1.Ec2InstanceList{}
+	if err := c.List(ctx, instances, client.InNamespace(ec2Instance.Namespace)); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, instance := range instances.Items {
+		dependsOn := slices.ContainsFunc(instance.Spec.DependsOn, func(dependency computev1.InstanceDependency) bool {
+			return dependency.Name == ec2Instance.Name
+		})
+		if dependsOn && instance.Name != ec2Instance.Name {
+			names = append(names, instance.Name)
+		}
+	}
+	return names, nil
+}
+
+// instancesForDependencies maps an Ec2Instance to reconcile requests for the instances depending on it, which may
+// be waiting to be launched, and for the instances it depends on, which may be waiting for it to be deleted.
+func (r *Ec2InstanceReconciler) instancesForDependencies(ctx context.Context, obj client.Object) []reconcile.Request {
+	ec2Instance := obj.(*computev1.Ec2Instance)
+	dependents, err := dependentInstances(ctx, r.Client, ec2Instance)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Ec2Instances depending on Ec2Instance", "instance", ec2Instance.Name)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(dependents)+len(ec2Instance.Spec.DependsOn))
+	for _, name := range dependents {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: ec2Instance.Namespace, Name: name}})
+	}
+	for _, dependency := range ec2Instance.Spec.DependsOn {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: ec2Instance.Namespace, Name: dependency.Name}})
+	}
+	return requests
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+var _ = Describe("Instance dependencies", func() {
+	ctx := context.Background()
+
+	newInstance := func(name string, dependsOn ...computev1.InstanceDependency) *computev1.Ec2Instance {
+		return &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: computev1.Ec2InstanceSpec{
+				InstanceType: "t3.micro",
+				AMIId:        "ami-09042b2f6d07d164a",
+				Region:       "eu-central-1",
+				DependsOn:    dependsOn,
+			},
+		}
+	}
+	create := func(instance *computev1.Ec2Instance) {
+		Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+	}
+	expectUnresolved := func(err error, reason, message string) {
+		var unresolved *resolutionError
+		ExpectWithOffset(1, errors.As(err, &unresolved)).To(BeTrue())
+		ExpectWithOffset(1, unresolved.reason).To(Equal(reason))
+		ExpectWithOffset(1, unresolved.message).To(Equal(message))
+	}
+
+	It("should wait until every dependency meets its condition", func() {
+		app := newInstance("app", computev1.InstanceDependency{Name: "db"}, computev1.InstanceDependency{Name: "cache", Condition: computev1.ConditionDNSRecordSynced})
+		expectUnresolved(resolveDependencies(ctx, k8sClient, app), computev1.ReasonDependencyNotFound, "Ec2Instance db not found")
+
+		db := newInstance("db")
+		create(db)
+		cache := newInstance("cache")
+		create(cache)
+		expectUnresolved(resolveDependencies(ctx, k8sClient, app), computev1.ReasonDependencyNotReady, "Waiting for Ec2Instance db to be Ready")
+
+		meta.SetStatusCondition(&db.Status.Conditions, metav1.Condition{Type: computev1.ConditionReady, Status: metav1.ConditionTrue, Reason: computev1.ReasonInstanceRunning})
+		Expect(k8sClient.Status().Update(ctx, db)).To(Succeed())
+		meta.SetStatusCondition(&cache.Status.Conditions, metav1.Condition{Type: computev1.ConditionReady, Status: metav1.ConditionTrue, Reason: computev1.ReasonInstanceRunning})
+		Expect(k8sClient.Status().Update(ctx, cache)).To(Succeed())
+		expectUnresolved(resolveDependencies(ctx, k8sClient, app), computev1.ReasonDependencyNotReady, "Waiting for Ec2Instance cache to be DNSRecordSynced")
+
+		meta.SetStatusCondition(&cache.Status.Conditions, metav1.Condition{Type: computev1.ConditionDNSRecordSynced, Status: metav1.ConditionTrue, Reason: computev1.ReasonDNSRecordInSync})
+		Expect(k8sClient.Status().Update(ctx, cache)).To(Succeed())
+		Expect(resolveDependencies(ctx, k8sClient, app)).To(Succeed())
+	})
+
+	It("should report dependencies that wait for each other", func() {
+		create(newInstance("db", computev1.InstanceDependency{Name: "vault"}))
+		create(newInstance("vault", computev1.InstanceDependency{Name: "app"}))
+		app := newInstance("app", computev1.InstanceDependency{Name: "db"})
+		expectUnresolved(resolveDependencies(ctx, k8sClient, app), computev1.ReasonDependencyCycle, "Dependencies form a cycle: app -> db -> vault -> app")
+	})
+
+	It("should block the deletion of an instance others depend on", func() {
+		db := newInstance("db")
+		create(db)
+		create(newInstance("app", computev1.InstanceDependency{Name: "db"}))
+		create(newInstance("worker", computev1.InstanceDependency{Name: "vault"}, computev1.InstanceDependency{Name: "db"}))
+		create(newInstance("vault"))
+		Expect(dependentInstances(ctx, k8sClient, db)).To(ConsistOf("app", "worker"))
+
+		reconciler := &Ec2InstanceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		Expect(reconciler.blockDeletion(ctx, db, []string{"app", "worker"})).To(Equal(ctrl.Result{}))
+		condition := meta.FindStatusCondition(db.Status.Conditions, computev1.ConditionDeletionBlocked)
+		Expect(condition.Reason).To(Equal(computev1.ReasonDependentsExist))
+		Expect(condition.Message).To(Equal(`Ec2Instances app, worker depend on the instance; delete them first or annotate the instance with compute.cloud.com/force-delete: "true"`))
+	})
+})
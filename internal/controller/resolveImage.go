@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// imageRetryInterval is how long to wait before looking for an image again when spec.image matched none.
+const imageRetryInterval = 5 * time.Minute
+
+// ec2ImageField is the field index used to find the Ec2Instances launching from an Ec2Image.
+const ec2ImageField = ".spec.image.ec2Image"
+
+// ssmParameterAPI is the part of the SSM client used to read AMI IDs from parameters.
+type ssmParameterAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// imageNotFoundError is returned when spec.image matches no AMI. It is reported in the ImageResolved
+// condition instead of being retried with backoff, as it usually takes a spec change or a new image release.
+type imageNotFoundError struct {
+	reason string
+}
+
+func (e *imageNotFoundError) Error() string {
+	return e.reason
+}
+
+// resolveImage returns the AMI ID an image selector currently points to: the value of the SSM parameter,
+// or the most recently created available image matching the owner, name and architecture filters.
+func resolveImage(ctx context.Context, ssmAPI ssmParameterAPI, ec2API ec2.DescribeImagesAPIClient, image *computev1.ImageSelector) (string, error) {
+	if image.SSMParameter != "" {
+		return resolveImageFromSSM(ctx, ssmAPI, image.SSMParameter)
+	}
+	return resolveImageFromFilters(ctx, ec2API, image)
+}
+
+// resolveInstanceImage resolves the image selector of an instance: Ec2Images are looked up in the instance's
+// namespace, SSM parameters and image filters in AWS.
+func (r *Ec2InstanceReconciler) resolveInstanceImage(ctx context.Context, namespace, region string, image *computev1.ImageSelector) (string, error) {
+	if image.Ec2Image != "" {
+		return resolveEc2Image(ctx, r.Client, namespace, region, image.Ec2Image)
+	}
+	return resolveImage(ctx, ssmClient(region), awsClient(region), image)
+}
+
+// resolveEc2Image returns the AMI ID of an Ec2Image once it is available in the region.
+func resolveEc2Image(ctx context.Context, c client.Client, namespace, region, name string) (string, error) {
+	image := &computev1.Ec2Image{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, image); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", &imageNotFoundError{fmt.Sprintf("Ec2Image %s not found", name)}
+		}
+		return "", err
+	}
+	if !meta.IsStatusConditionTrue(image.Status.Conditions, computev1.ConditionImageReady) {
+		return "", &imageNotFoundError{fmt.Sprintf("Ec2Image %s is not available yet", name)}
+	}
+	if image.Status.Region != region {
+		return "", &imageNotFoundError{fmt.Sprintf("Ec2Image %s is in region %s, not %s", name, image.Status.Region, region)}
+	}
+	return image.Status.ImageID, nil
+}
+
+func resolveImageFromSSM(ctx context.Context, ssmAPI ssmParameterAPI, name string) (string, error) {
+	output, err := ssmAPI.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(name)})
+	if err != nil {
+		var notFound *ssmtypes.ParameterNotFound
+		if errors.As(err, &notFound) {
+			return "", &imageNotFoundError{fmt.Sprintf("SSM parameter %s not found", name)}
+		}
+		return "", fmt.Errorf("failed to get SSM parameter %s: %w", name, err)
+	}
+
+	amiID := aws.ToString(output.Parameter.Value)
+	if !strings.HasPrefix(amiID, "ami-") {
+		return "", &imageNotFoundError{fmt.Sprintf("SSM parameter %s does not hold an AMI ID but %q", name, amiID)}
+	}
+	return amiID, nil
+}
+
+func resolveImageFromFilters(ctx context.Context, ec2API ec2.DescribeImagesAPIClient, image *computev1.ImageSelector) (string, error) {
+	input := &ec2.DescribeImagesInput{
+		Owners: image.Owners,
+		Filters: []ec2types.Filter{
+			{Name: aws.String("name"), Values: []string{image.Name}},
+			{Name: aws.String("state"), Values: []string{string(ec2types.ImageStateAvailable)}},
+		},
+	}
+	if image.Architecture != "" {
+		input.Filters = append(input.Filters, ec2types.Filter{Name: aws.String("architecture"), Values: []string{image.Architecture}})
+	}
+
+	var newest *ec2types.Image
+	paginator := ec2.NewDescribeImagesPaginator(ec2API, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to describe images named %q: %w", image.Name, err)
+		}
+		for i := range page.Images {
+			// Creation dates are ISO 8601 timestamps in UTC, so they sort as strings.
+			if newest == nil || aws.ToString(page.Images[i].CreationDate) > aws.ToString(newest.CreationDate) {
+				newest = &page.Images[i]
+			}
+		}
+	}
+
+	if newest == nil {
+		return "", &imageNotFoundError{fmt.Sprintf("no available image named %q owned by %v%s",
+			image.Name, image.Owners, architectureSuffix(image.Architecture))}
+	}
+	return aws.ToString(newest.ImageId), nil
+}
+
+func architectureSuffix(architecture string) string {
+	if architecture == "" {
+		return ""
+	}
+	return " for architecture " + architecture
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// fakeSSM serves parameters from a map.
+type fakeSSM map[string]string
+
+func (f fakeSSM) GetParameter(_ context.Context, params *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	value, ok := f[aws.ToString(params.Name)]
+	if !ok {
+		return nil, &ssmtypes.ParameterNotFound{}
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Name: params.Name, Value: aws.String(value)}}, nil
+}
+
+// fakeImages returns its images as-is, in pages of one, and records the last request.
+type fakeImages struct {
+	images []ec2types.Image
+	input  *ec2.DescribeImagesInput
+}
+
+func (f *fakeImages) DescribeImages(_ context.Context, params *ec2.DescribeImagesInput, _ ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	f.input = params
+	if len(f.images) == 0 {
+		return &ec2.DescribeImagesOutput{}, nil
+	}
+	start := 0
+	if params.NextToken != nil {
+		start = int(aws.ToString(params.NextToken)[0] - '0')
+	}
+	output := &ec2.DescribeImagesOutput{Images: f.images[start : start+1]}
+	if start+1 < len(f.images) {
+		output.NextToken = aws.String(string(rune('0' + start + 1)))
+	}
+	return output, nil
+}
+
+var _ = Describe("Image resolution", func() {
+	ctx := context.Background()
+
+	It("should read the AMI ID from an SSM parameter", func() {
+		parameters := fakeSSM{"/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64": "ami-0123456789abcdef0"}
+		amiID, err := resolveImage(ctx, parameters, &fakeImages{},
+			&computev1.ImageSelector{SSMParameter: "/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(amiID).To(Equal("ami-0123456789abcdef0"))
+	})
+
+	It("should report a missing SSM parameter as image not found", func() {
+		_, err := resolveImage(ctx, fakeSSM{}, &fakeImages{}, &computev1.ImageSelector{SSMParameter: "/does/not/exist"})
+		var notFound *imageNotFoundError
+		Expect(err).To(BeAssignableToTypeOf(notFound))
+		Expect(err.Error()).To(ContainSubstring("/does/not/exist not found"))
+	})
+
+	It("should pick the newest image matching the filters across pages", func() {
+		images := &fakeImages{images: []ec2types.Image{
+			{ImageId: aws.String("ami-00000000000000001"), CreationDate: aws.String("2025-03-01T10:00:00.000Z")},
+			{ImageId: aws.String("ami-00000000000000002"), CreationDate: aws.String("2025-05-01T10:00:00.000Z")},
+			{ImageId: aws.String("ami-00000000000000003"), CreationDate: aws.String("2025-04-01T10:00:00.000Z")},
+		}}
+		amiID, err := resolveImage(ctx, fakeSSM{}, images, &computev1.ImageSelector{
+			Owners:       []string{"099720109477"},
+			Name:         "ubuntu/images/hvm-ssd-gp3/ubuntu-noble-24.04-*",
+			Architecture: "arm64",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(amiID).To(Equal("ami-00000000000000002"))
+		Expect(images.input.Owners).To(Equal([]string{"099720109477"}))
+		Expect(images.input.Filters).To(ContainElement(ec2types.Filter{Name: aws.String("architecture"), Values: []string{"arm64"}}))
+	})
+
+	It("should report filters without a match as image not found", func() {
+		_, err := resolveImage(ctx, fakeSSM{}, &fakeImages{}, &computev1.ImageSelector{Owners: []string{"amazon"}, Name: "nothing-*"})
+		Expect(err).To(MatchError(`no available image named "nothing-*" owned by [amazon]`))
+	})
+
+	It("should launch from an Ec2Image once it is available in the region", func() {
+		image := &computev1.Ec2Image{
+			ObjectMeta: metav1.ObjectMeta{Name: "golden-web", Namespace: "default"},
+			Spec:       computev1.Ec2ImageSpec{InstanceName: "web"},
+		}
+		Expect(k8sClient.Create(ctx, image)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, image)).To(Succeed())
+		})
+
+		_, err := resolveEc2Image(ctx, k8sClient, "default", "eu-central-1", "missing")
+		Expect(err).To(MatchError("Ec2Image missing not found"))
+		_, err = resolveEc2Image(ctx, k8sClient, "default", "eu-central-1", "golden-web")
+		Expect(err).To(MatchError("Ec2Image golden-web is not available yet"))
+
+		image.Status = computev1.Ec2ImageStatus{ImageID: "ami-0baked", Region: "eu-central-1", State: "available"}
+		setImageReady(image, metav1.ConditionTrue, computev1.ReasonImageAvailable, "AMI ami-0baked is available")
+		Expect(k8sClient.Status().Update(ctx, image)).To(Succeed())
+
+		amiID, err := resolveEc2Image(ctx, k8sClient, "default", "eu-central-1", "golden-web")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(amiID).To(Equal("ami-0baked"))
+		_, err = resolveEc2Image(ctx, k8sClient, "default", "us-east-1", "golden-web")
+		Expect(err).To(MatchError("Ec2Image golden-web is in region eu-central-1, not us-east-1"))
+	})
+})
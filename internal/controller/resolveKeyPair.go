@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// keyPairRefIndexField is the field index used to find the Ec2Instances referencing a KeyPair.
+const keyPairRefIndexField = ".spec.keyPairRef"
+
+// resolveKeyPairName returns the name in AWS of the KeyPair the instance references.
+// The KeyPair must be ready, in the region of the instance.
+func resolveKeyPairName(ctx context.Context, c client.Client, resolved *computev1.Ec2Instance) (string, error) {
+	name := resolved.Spec.KeyPairRef
+	keyPair := &computev1.KeyPair{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: resolved.Namespace, Name: name}, keyPair); err != nil {
+		if errors.IsNotFound(err) {
+			return "", &resolutionError{computev1.ReasonKeyPairNotFound, fmt.Sprintf("KeyPair %s not found", name)}
+		}
+		return "", err
+	}
+	if keyPair.Spec.Region != resolved.Spec.Region {
+		return "", &resolutionError{computev1.ReasonKeyPairRegionConflict,
+			fmt.Sprintf("KeyPair %s is in region %s, the instance in %s", name, keyPair.Spec.Region, resolved.Spec.Region)}
+	}
+	if keyPair.Status.KeyName == "" || !meta.IsStatusConditionTrue(keyPair.Status.Conditions, computev1.ConditionKeyPairReady) {
+		return "", &resolutionError{computev1.ReasonKeyPairNotReady, fmt.Sprintf("KeyPair %s is not ready", name)}
+	}
+	return keyPair.Status.KeyName, nil
+}
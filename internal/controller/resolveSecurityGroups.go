@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// securityGroupRefsIndexField is the field index used to find the Ec2Instances referencing a SecurityGroup.
+const securityGroupRefsIndexField = ".spec.securityGroupRefs"
+
+// resolveSecurityGroupIDs returns the group IDs of the SecurityGroups the instance references.
+// All groups must have been created, in the region of the instance.
+func resolveSecurityGroupIDs(ctx context.Context, c client.Client, resolved *computev1.Ec2Instance) ([]string, error) {
+	ids := make([]string, 0, len(resolved.Spec.SecurityGroupRefs))
+	for _, name := range resolved.Spec.SecurityGroupRefs {
+		group := &computev1.SecurityGroup{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: resolved.Namespace, Name: name}, group); err != nil {
+			if errors.IsNotFound(err) {
+				return nil, &resolutionError{computev1.ReasonSecurityGroupNotFound, fmt.Sprintf("SecurityGroup %s not found", name)}
+			}
+			return nil, err
+		}
+		if group.Spec.Region != resolved.Spec.Region {
+			return nil, &resolutionError{computev1.ReasonSecurityGroupRegionConflict,
+				fmt.Sprintf("SecurityGroup %s is in region %s, the instance in %s", name, group.Spec.Region, resolved.Spec.Region)}
+		}
+		if group.Status.GroupID == "" {
+			return nil, &resolutionError{computev1.ReasonSecurityGroupNotReady, fmt.Sprintf("SecurityGroup %s has not been created", name)}
+		}
+		ids = append(ids, group.Status.GroupID)
+	}
+	return ids, nil
+}
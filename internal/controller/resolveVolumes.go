@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// volumeNamesField is the field index used to find the Ec2Instances referencing an EbsVolume.
+const volumeNamesField = ".spec.volumes.name"
+
+// resolveVolumeZone returns the availability zone the instance has to be launched in to attach the EbsVolumes
+// of its spec. All volumes must exist, be in the region of the instance and share one zone, which must also be
+// the zone of the spec when it sets one.
+func resolveVolumeZone(ctx context.Context, c client.Client, resolved *computev1.Ec2Instance) (string, error) {
+	zone, zoneFrom := resolved.Spec.AvailabilityZone, "spec.availabilityZone"
+	for _, attachment := range resolved.Spec.Volumes {
+		volume := &computev1.EbsVolume{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: resolved.Namespace, Name: attachment.Name}, volume); err != nil {
+			if errors.IsNotFound(err) {
+				return "", &resolutionError{computev1.ReasonVolumeNotFound, fmt.Sprintf("EbsVolume %s not found", attachment.Name)}
+			}
+			return "", err
+		}
+		if volume.Spec.Region != resolved.Spec.Region {
+			return "", &resolutionError{computev1.ReasonVolumeRegionConflict,
+				fmt.Sprintf("EbsVolume %s is in region %s, the instance in %s", volume.Name, volume.Spec.Region, resolved.Spec.Region)}
+		}
+		if zone != "" && volume.Spec.AvailabilityZone != zone {
+			return "", &resolutionError{computev1.ReasonVolumeZoneConflict,
+				fmt.Sprintf("EbsVolume %s is in availability zone %s, but %s is %s", volume.Name, volume.Spec.AvailabilityZone, zoneFrom, zone)}
+		}
+		zone, zoneFrom = volume.Spec.AvailabilityZone, "EbsVolume "+volume.Name
+	}
+	return zone, nil
+}
@@ -0,0 +1,546 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	securityGroupFinalizer = "securitygroup.compute.cloud.com"
+	// securityGroupUIDTag marks the security group created for a SecurityGroup, so that a group created by a
+	// reconcile whose status update failed is found and reused instead of failing on the duplicate name.
+	securityGroupUIDTag = "compute.cloud.com/security-group-uid"
+	// securityGroupRefsField is the field index used to find the SecurityGroups whose rules reference another one.
+	securityGroupRefsField = ".spec.rules.securityGroupRefs"
+	// securityGroupResyncInterval is how often rules are compared with AWS, reverting changes made outside the operator.
+	securityGroupResyncInterval = 10 * time.Minute
+	// securityGroupInUseRetryInterval is how long to wait before deleting a group again that is still in use.
+	securityGroupInUseRetryInterval = time.Minute
+)
+
+// securityGroupAPI is the part of the EC2 client used to manage security groups and their rules.
+type securityGroupAPI interface {
+	DescribeSecurityGroups(ctx context.Context, params *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error)
+	CreateSecurityGroup(ctx context.Context, params *ec2.CreateSecurityGroupInput, optFns ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error)
+	DeleteSecurityGroup(ctx context.Context, params *ec2.DeleteSecurityGroupInput, optFns ...func(*ec2.Options)) (*ec2.DeleteSecurityGroupOutput, error)
+	DescribeSecurityGroupRules(ctx context.Context, params *ec2.DescribeSecurityGroupRulesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupRulesOutput, error)
+	AuthorizeSecurityGroupIngress(ctx context.Context, params *ec2.AuthorizeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error)
+	AuthorizeSecurityGroupEgress(ctx context.Context, params *ec2.AuthorizeSecurityGroupEgressInput, optFns ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupEgressOutput, error)
+	RevokeSecurityGroupIngress(ctx context.Context, params *ec2.RevokeSecurityGroupIngressInput, optFns ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupIngressOutput, error)
+	RevokeSecurityGroupEgress(ctx context.Context, params *ec2.RevokeSecurityGroupEgressInput, optFns ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupEgressOutput, error)
+	ModifySecurityGroupRules(ctx context.Context, params *ec2.ModifySecurityGroupRulesInput, optFns ...func(*ec2.Options)) (*ec2.ModifySecurityGroupRulesOutput, error)
+}
+
+// securityGroupPermission identifies a single rule of a security group, independent of its description.
+// Exactly one of the peer fields is set.
+type securityGroupPermission struct {
+	egress   bool
+	protocol string
+	fromPort int32
+	toPort   int32
+
+	cidrIPv4     string
+	cidrIPv6     string
+	prefixListID string
+	groupID      string
+}
+
+// securityGroupReferenceError is returned when a rule references a SecurityGroup that cannot be used (yet).
+// It is reported in the Ready condition; the referenced group's events bring the SecurityGroup back.
+type securityGroupReferenceError struct {
+	reason  string
+	message string
+}
+
+func (e *securityGroupReferenceError) Error() string {
+	return e.message
+}
+
+// SecurityGroupReconciler reconciles a SecurityGroup object.
+// It creates the security group and makes its rules match the spec one by one, so that unchanged rules
+// never stop allowing traffic while others are added or revoked.
+type SecurityGroupReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=securitygroups,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=securitygroups/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=compute.cloud.com,resources=securitygroups/finalizers,verbs=update
+
+// Reconcile creates the security group and applies its rules.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.2/pkg/reconcile
+func (r *SecurityGroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	group := &computev1.SecurityGroup{}
+	if err := r.Get(ctx, req.NamespacedName, group); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !group.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, group)
+	}
+
+	if controllerutil.AddFinalizer(group, securityGroupFinalizer) {
+		if err := r.Update(ctx, group); err != nil {
+			l.Error(err, "Failed to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	api := awsClient(group.Spec.Region)
+	if group.Status.GroupID == "" {
+		groupID, err := createSecurityGroup(ctx, api, group)
+		if err != nil {
+			l.Error(err, "Failed to create security group")
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+		group.Status.GroupID = groupID
+		group.Status.Region = group.Spec.Region
+	}
+
+	desired, err := r.desiredPermissions(ctx, group)
+	var refErr *securityGroupReferenceError
+	switch {
+	case stderrors.As(err, &refErr):
+		l.Info("Not applying rules", "reason", refErr.reason, "message", refErr.message)
+		setSecurityGroupReady(group, metav1.ConditionFalse, refErr.reason, refErr.message)
+		// The status also records the group ID of a group that was just created.
+		if err := r.Status().Update(ctx, group); err != nil {
+			l.Error(err, "Failed to update status")
+			return ctrl.Result{}, err
+		}
+		// Kubernetes will not retry - the referenced SecurityGroup's events bring the group back
+		return ctrl.Result{}, nil
+	case err != nil:
+		return ctrl.Result{}, err
+	}
+
+	if err := syncSecurityGroupRules(ctx, api, group.Status.GroupID, desired); err != nil {
+		l.Error(err, "Failed to apply security group rules")
+		setSecurityGroupReady(group, metav1.ConditionFalse, computev1.ReasonSecurityGroupRulesNotApplied, err.Error())
+		if err := r.Status().Update(ctx, group); err != nil {
+			l.Error(err, "Failed to update status")
+		}
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	}
+
+	group.Status.Rules = int32(len(desired))
+	group.Status.ObservedGeneration = group.Generation
+	setSecurityGroupReady(group, metav1.ConditionTrue, computev1.ReasonSecurityGroupReady,
+		fmt.Sprintf("Security group %s has %d rules", group.Status.GroupID, len(desired)))
+	if err := r.Status().Update(ctx, group); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: securityGroupResyncInterval}, nil
+}
+
+// finalize deletes the security group. AWS refuses while instances or other groups' rules still use it,
+// in which case the deletion is retried.
+func (r *SecurityGroupReconciler) finalize(ctx context.Context, group *computev1.SecurityGroup) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(group, securityGroupFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	if group.Status.GroupID != "" {
+		l.Info("Deleting security group", "groupID", group.Status.GroupID)
+		_, err := awsClient(group.Status.Region).DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{GroupId: aws.String(group.Status.GroupID)})
+		switch {
+		case err != nil && strings.Contains(err.Error(), "DependencyViolation"):
+			l.Info("Security group is still in use", "groupID", group.Status.GroupID)
+			setSecurityGroupReady(group, metav1.ConditionFalse, computev1.ReasonSecurityGroupInUse,
+				fmt.Sprintf("Security group %s is still used by instances or rules of other groups", group.Status.GroupID))
+			if err := r.Status().Update(ctx, group); err != nil {
+				l.Error(err, "Failed to update status")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: securityGroupInUseRetryInterval}, nil
+		case err != nil && !strings.Contains(err.Error(), "InvalidGroup.NotFound"):
+			l.Error(err, "Failed to delete security group")
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+	}
+	controllerutil.RemoveFinalizer(group, securityGroupFinalizer)
+	if err := r.Update(ctx, group); err != nil {
+		l.Error(err, "Failed to remove finalizer")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// desiredPermissions flattens the rules of the spec into one permission per peer, with its description.
+// Referenced SecurityGroups are resolved to their group IDs; they must have been created in the same VPC.
+func (r *SecurityGroupReconciler) desiredPermissions(ctx context.Context, group *computev1.SecurityGroup) (map[securityGroupPermission]string, error) {
+	groupIDs := map[string]string{group.Name: group.Status.GroupID}
+	resolve := func(name string) (string, error) {
+		if id, ok := groupIDs[name]; ok {
+			return id, nil
+		}
+		referenced := &computev1.SecurityGroup{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: group.Namespace, Name: name}, referenced); err != nil {
+			if errors.IsNotFound(err) {
+				return "", &securityGroupReferenceError{computev1.ReasonSecurityGroupRefNotFound, fmt.Sprintf("SecurityGroup %s not found", name)}
+			}
+			return "", err
+		}
+		if referenced.Spec.VpcID != group.Spec.VpcID {
+			return "", &securityGroupReferenceError{computev1.ReasonSecurityGroupRefInOtherVpc,
+				fmt.Sprintf("SecurityGroup %s is in VPC %s, not %s", name, referenced.Spec.VpcID, group.Spec.VpcID)}
+		}
+		if referenced.Status.GroupID == "" {
+			return "", &securityGroupReferenceError{computev1.ReasonSecurityGroupRefNotReady, fmt.Sprintf("SecurityGroup %s has not been created", name)}
+		}
+		groupIDs[name] = referenced.Status.GroupID
+		return referenced.Status.GroupID, nil
+	}
+
+	desired := map[securityGroupPermission]string{}
+	add := func(rules []computev1.SecurityGroupRule, egress bool) error {
+		for _, rule := range rules {
+			base := securityGroupPermission{egress: egress, protocol: rule.Protocol, fromPort: -1, toPort: -1}
+			if rule.Protocol == "all" {
+				base.protocol = "-1"
+			}
+			if rule.FromPort != nil {
+				base.fromPort = *rule.FromPort
+			}
+			if rule.ToPort != nil {
+				base.toPort = *rule.ToPort
+			}
+			for _, cidr := range rule.CIDRBlocks {
+				permission := base
+				permission.cidrIPv4 = cidr
+				desired[permission] = rule.Description
+			}
+			for _, cidr := range rule.IPv6CIDRBlocks {
+				permission := base
+				permission.cidrIPv6 = cidr
+				desired[permission] = rule.Description
+			}
+			for _, prefixList := range rule.PrefixListIDs {
+				permission := base
+				permission.prefixListID = prefixList
+				desired[permission] = rule.Description
+			}
+			for _, name := range rule.SecurityGroupRefs {
+				groupID, err := resolve(name)
+				if err != nil {
+					return err
+				}
+				permission := base
+				permission.groupID = groupID
+				desired[permission] = rule.Description
+			}
+		}
+		return nil
+	}
+	if err := add(group.Spec.Ingress, false); err != nil {
+		return nil, err
+	}
+	egress := group.Spec.Egress
+	if len(egress) == 0 {
+		// The rule AWS adds to every new group.
+		egress = []computev1.SecurityGroupRule{{Protocol: "all", CIDRBlocks: []string{"0.0.0.0/0"}}}
+	}
+	if err := add(egress, true); err != nil {
+		return nil, err
+	}
+	return desired, nil
+}
+
+// createSecurityGroup creates the security group in its VPC. A group already created for the SecurityGroup
+// is returned instead.
+func createSecurityGroup(ctx context.Context, api securityGroupAPI, group *computev1.SecurityGroup) (string, error) {
+	existing, err := api.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []ec2types.Filter{{Name: aws.String("tag:" + securityGroupUIDTag), Values: []string{string(group.UID)}}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe security groups: %w", err)
+	}
+	if len(existing.SecurityGroups) > 0 {
+		return aws.ToString(existing.SecurityGroups[0].GroupId), nil
+	}
+
+	name := group.Spec.GroupName
+	if name == "" {
+		name = fmt.Sprintf("%s-%s", group.Namespace, group.Name)
+	}
+	description := group.Spec.Description
+	if description == "" {
+		description = fmt.Sprintf("SecurityGroup %s/%s", group.Namespace, group.Name)
+	}
+	tags := []ec2types.Tag{{Key: aws.String(securityGroupUIDTag), Value: aws.String(string(group.UID))}}
+	for key, value := range group.Spec.Tags {
+		tags = append(tags, ec2types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	log.FromContext(ctx).Info("Creating security group", "name", name, "vpcID", group.Spec.VpcID)
+	output, err := api.CreateSecurityGroup(ctx, &ec2.CreateSecurityGroupInput{
+		GroupName:         aws.String(name),
+		Description:       aws.String(description),
+		VpcId:             aws.String(group.Spec.VpcID),
+		TagSpecifications: []ec2types.TagSpecification{{ResourceType: ec2types.ResourceTypeSecurityGroup, Tags: tags}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create security group %s: %w", name, err)
+	}
+	return aws.ToString(output.GroupId), nil
+}
+
+// syncSecurityGroupRules makes the rules of the group match the desired permissions: missing rules are
+// authorized, rules not desired are revoked, and descriptions that differ are updated in place.
+func syncSecurityGroupRules(ctx context.Context, api securityGroupAPI, groupID string, desired map[securityGroupPermission]string) error {
+	l := log.FromContext(ctx)
+
+	existing := map[securityGroupPermission]ec2types.SecurityGroupRule{}
+	paginator := ec2.NewDescribeSecurityGroupRulesPaginator(api, &ec2.DescribeSecurityGroupRulesInput{
+		Filters: []ec2types.Filter{{Name: aws.String("group-id"), Values: []string{groupID}}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to describe rules of security group %s: %w", groupID, err)
+		}
+		for _, rule := range page.SecurityGroupRules {
+			existing[permissionOf(rule)] = rule
+		}
+	}
+
+	var revokeIngress, revokeEgress []string
+	var updates []ec2types.SecurityGroupRuleUpdate
+	for permission, rule := range existing {
+		description, ok := desired[permission]
+		switch {
+		case !ok && permission.egress:
+			revokeEgress = append(revokeEgress, aws.ToString(rule.SecurityGroupRuleId))
+		case !ok:
+			revokeIngress = append(revokeIngress, aws.ToString(rule.SecurityGroupRuleId))
+		case aws.ToString(rule.Description) != description:
+			request := ruleRequest(permission)
+			request.Description = aws.String(description)
+			updates = append(updates, ec2types.SecurityGroupRuleUpdate{SecurityGroupRuleId: rule.SecurityGroupRuleId, SecurityGroupRule: request})
+		}
+	}
+	var authorizeIngress, authorizeEgress []ec2types.IpPermission
+	for _, permission := range sortedPermissions(desired) {
+		if _, ok := existing[permission]; ok {
+			continue
+		}
+		if permission.egress {
+			authorizeEgress = append(authorizeEgress, ipPermission(permission, desired[permission]))
+		} else {
+			authorizeIngress = append(authorizeIngress, ipPermission(permission, desired[permission]))
+		}
+	}
+
+	// New rules are added before old ones are revoked, so that a changed rule never interrupts traffic.
+	if len(authorizeIngress) > 0 {
+		l.Info("Authorizing ingress rules", "groupID", groupID, "rules", len(authorizeIngress))
+		if _, err := api.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId: aws.String(groupID), IpPermissions: authorizeIngress,
+		}); err != nil {
+			return fmt.Errorf("failed to authorize ingress rules: %w", err)
+		}
+	}
+	if len(authorizeEgress) > 0 {
+		l.Info("Authorizing egress rules", "groupID", groupID, "rules", len(authorizeEgress))
+		if _, err := api.AuthorizeSecurityGroupEgress(ctx, &ec2.AuthorizeSecurityGroupEgressInput{
+			GroupId: aws.String(groupID), IpPermissions: authorizeEgress,
+		}); err != nil {
+			return fmt.Errorf("failed to authorize egress rules: %w", err)
+		}
+	}
+	if len(updates) > 0 {
+		l.Info("Updating rule descriptions", "groupID", groupID, "rules", len(updates))
+		if _, err := api.ModifySecurityGroupRules(ctx, &ec2.ModifySecurityGroupRulesInput{
+			GroupId: aws.String(groupID), SecurityGroupRules: updates,
+		}); err != nil {
+			return fmt.Errorf("failed to update rule descriptions: %w", err)
+		}
+	}
+	if len(revokeIngress) > 0 {
+		l.Info("Revoking ingress rules", "groupID", groupID, "rules", revokeIngress)
+		if _, err := api.RevokeSecurityGroupIngress(ctx, &ec2.RevokeSecurityGroupIngressInput{
+			GroupId: aws.String(groupID), SecurityGroupRuleIds: revokeIngress,
+		}); err != nil {
+			return fmt.Errorf("failed to revoke ingress rules: %w", err)
+		}
+	}
+	if len(revokeEgress) > 0 {
+		l.Info("Revoking egress rules", "groupID", groupID, "rules", revokeEgress)
+		if _, err := api.RevokeSecurityGroupEgress(ctx, &ec2.RevokeSecurityGroupEgressInput{
+			GroupId: aws.String(groupID), SecurityGroupRuleIds: revokeEgress,
+		}); err != nil {
+			return fmt.Errorf("failed to revoke egress rules: %w", err)
+		}
+	}
+	return nil
+}
+
+// permissionOf identifies an existing rule of a security group.
+func permissionOf(rule ec2types.SecurityGroupRule) securityGroupPermission {
+	permission := securityGroupPermission{
+		egress:       aws.ToBool(rule.IsEgress),
+		protocol:     aws.ToString(rule.IpProtocol),
+		fromPort:     aws.ToInt32(rule.FromPort),
+		toPort:       aws.ToInt32(rule.ToPort),
+		cidrIPv4:     aws.ToString(rule.CidrIpv4),
+		cidrIPv6:     aws.ToString(rule.CidrIpv6),
+		prefixListID: aws.ToString(rule.PrefixListId),
+	}
+	if rule.ReferencedGroupInfo != nil {
+		permission.groupID = aws.ToString(rule.ReferencedGroupInfo.GroupId)
+	}
+	return permission
+}
+
+// ipPermission builds the request to authorize a single rule.
+func ipPermission(permission securityGroupPermission, description string) ec2types.IpPermission {
+	ipPermission := ec2types.IpPermission{
+		IpProtocol: aws.String(permission.protocol),
+		FromPort:   aws.Int32(permission.fromPort),
+		ToPort:     aws.Int32(permission.toPort),
+	}
+	var desc *string
+	if description != "" {
+		desc = aws.String(description)
+	}
+	switch {
+	case permission.cidrIPv4 != "":
+		ipPermission.IpRanges = []ec2types.IpRange{{CidrIp: aws.String(permission.cidrIPv4), Description: desc}}
+	case permission.cidrIPv6 != "":
+		ipPermission.Ipv6Ranges = []ec2types.Ipv6Range{{CidrIpv6: aws.String(permission.cidrIPv6), Description: desc}}
+	case permission.prefixListID != "":
+		ipPermission.PrefixListIds = []ec2types.PrefixListId{{PrefixListId: aws.String(permission.prefixListID), Description: desc}}
+	default:
+		ipPermission.UserIdGroupPairs = []ec2types.UserIdGroupPair{{GroupId: aws.String(permission.groupID), Description: desc}}
+	}
+	return ipPermission
+}
+
+// ruleRequest builds the request to modify a single rule in place.
+func ruleRequest(permission securityGroupPermission) *ec2types.SecurityGroupRuleRequest {
+	request := &ec2types.SecurityGroupRuleRequest{
+		IpProtocol: aws.String(permission.protocol),
+		FromPort:   aws.Int32(permission.fromPort),
+		ToPort:     aws.Int32(permission.toPort),
+	}
+	switch {
+	case permission.cidrIPv4 != "":
+		request.CidrIpv4 = aws.String(permission.cidrIPv4)
+	case permission.cidrIPv6 != "":
+		request.CidrIpv6 = aws.String(permission.cidrIPv6)
+	case permission.prefixListID != "":
+		request.PrefixListId = aws.String(permission.prefixListID)
+	default:
+		request.ReferencedGroupId = aws.String(permission.groupID)
+	}
+	return request
+}
+
+// sortedPermissions orders permissions so that requests are the same on every reconcile.
+func sortedPermissions(permissions map[securityGroupPermission]string) []securityGroupPermission {
+	sorted := make([]securityGroupPermission, 0, len(permissions))
+	for permission := range permissions {
+		sorted = append(sorted, permission)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return fmt.Sprint(sorted[i]) < fmt.Sprint(sorted[j])
+	})
+	return sorted
+}
+
+func setSecurityGroupReady(group *computev1.SecurityGroup, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&group.Status.Conditions, metav1.Condition{
+		Type:               computev1.ConditionSecurityGroupReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: group.Generation,
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// SecurityGroups are also watched through the groups their rules reference, so that a rule waiting for
+// another group is applied as soon as that group has been created.
+func (r *SecurityGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &computev1.SecurityGroup{}, securityGroupRefsField,
+		func(obj client.Object) []string {
+			group := obj.(*computev1.SecurityGroup)
+			var names []string
+			for _, rule := range slices.Concat(group.Spec.Ingress, group.Spec.Egress) {
+				names = append(names, rule.SecurityGroupRefs...)
+			}
+			return names
+		}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&computev1.SecurityGroup{}).
+		Watches(&computev1.SecurityGroup{}, handler.EnqueueRequestsFromMapFunc(r.groupsReferencing)).
+		Named("securitygroup").
+		Complete(r)
+}
+
+// groupsReferencing maps a SecurityGroup to reconcile requests for every SecurityGroup whose rules reference it.
+func (r *SecurityGroupReconciler) groupsReferencing(ctx context.Context, referenced client.Object) []reconcile.Request {
+	groups := &computev1.SecurityGroupList{}
+	if err := r.List(ctx, groups, client.InNamespace(referenced.GetNamespace()),
+		client.MatchingFields{securityGroupRefsField: referenced.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list SecurityGroups referencing SecurityGroup", "securityGroup", referenced.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(groups.Items))
+	for _, group := range groups.Items {
+		if group.Name != referenced.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&group)})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+// fakeSecurityGroups keeps the rules of a single group, and records every call changing them.
+type fakeSecurityGroups struct {
+	groups []ec2types.SecurityGroup
+	rules  map[string]ec2types.SecurityGroupRule
+	calls  []string
+	nextID int
+}
+
+func newFakeSecurityGroups() *fakeSecurityGroups {
+	f := &fakeSecurityGroups{rules: map[string]ec2types.SecurityGroupRule{}}
+	// The rule AWS adds to every new group.
+	f.add(true, ec2types.IpPermission{IpProtocol: aws.String("-1"), FromPort: aws.Int32(-1), ToPort: aws.Int32(-1),
+		IpRanges: []ec2types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}})
+	f.calls = nil
+	return f
+}
+
+func (f *fakeSecurityGroups) add(egress bool, permission ec2types.IpPermission) {
+	f.nextID++
+	rule := ec2types.SecurityGroupRule{
+		SecurityGroupRuleId: aws.String(fmt.Sprintf("sgr-%d", f.nextID)),
+		IsEgress:            aws.Bool(egress),
+		IpProtocol:          permission.IpProtocol,
+		FromPort:            permission.FromPort,
+		ToPort:              permission.ToPort,
+	}
+	switch {
+	case len(permission.IpRanges) > 0:
+		rule.CidrIpv4, rule.Description = permission.IpRanges[0].CidrIp, permission.IpRanges[0].Description
+	case len(permission.Ipv6Ranges) > 0:
+		rule.CidrIpv6, rule.Description = permission.Ipv6Ranges[0].CidrIpv6, permission.Ipv6Ranges[0].Description
+	case len(permission.PrefixListIds) > 0:
+		rule.PrefixListId, rule.Description = permission.PrefixListIds[0].PrefixListId, permission.PrefixListIds[0].Description
+	default:
+		rule.ReferencedGroupInfo = &ec2types.ReferencedSecurityGroup{GroupId: permission.UserIdGroupPairs[0].GroupId}
+		rule.Description = permission.UserIdGroupPairs[0].Description
+	}
+	f.rules[aws.ToString(rule.SecurityGroupRuleId)] = rule
+	f.calls = append(f.calls, "authorize "+aws.ToString(rule.SecurityGroupRuleId))
+}
+
+func (f *fakeSecurityGroups) DescribeSecurityGroups(_ context.Context, _ *ec2.DescribeSecurityGroupsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+	return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: f.groups}, nil
+}
+
+func (f *fakeSecurityGroups) CreateSecurityGroup(_ context.Context, params *ec2.CreateSecurityGroupInput, _ ...func(*ec2.Options)) (*ec2.CreateSecurityGroupOutput, error) {
+	f.groups = append(f.groups, ec2types.SecurityGroup{GroupId: aws.String("sg-0web"), GroupName: params.GroupName, VpcId: params.VpcId})
+	f.calls = append(f.calls, "create "+aws.ToString(params.GroupName))
+	return &ec2.CreateSecurityGroupOutput{GroupId: aws.String("sg-0web")}, nil
+}
+
+func (f *fakeSecurityGroups) DeleteSecurityGroup(_ context.Context, _ *ec2.DeleteSecurityGroupInput, _ ...func(*ec2.Options)) (*ec2.DeleteSecurityGroupOutput, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeSecurityGroups) DescribeSecurityGroupRules(_ context.Context, _ *ec2.DescribeSecurityGroupRulesInput, _ ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupRulesOutput, error) {
+	output := &ec2.DescribeSecurityGroupRulesOutput{}
+	for _, rule := range f.rules {
+		output.SecurityGroupRules = append(output.SecurityGroupRules, rule)
+	}
+	return output, nil
+}
+
+func (f *fakeSecurityGroups) AuthorizeSecurityGroupIngress(_ context.Context, params *ec2.AuthorizeSecurityGroupIngressInput, _ ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	for _, permission := range params.IpPermissions {
+		f.add(false, permission)
+	}
+	return &ec2.AuthorizeSecurityGroupIngressOutput{}, nil
+}
+
+func (f *fakeSecurityGroups) AuthorizeSecurityGroupEgress(_ context.Context, params *ec2.AuthorizeSecurityGroupEgressInput, _ ...func(*ec2.Options)) (*ec2.AuthorizeSecurityGroupEgressOutput, error) {
+	for _, permission := range params.IpPermissions {
+		f.add(true, permission)
+	}
+	return &ec2.AuthorizeSecurityGroupEgressOutput{}, nil
+}
+
+func (f *fakeSecurityGroups) revoke(ids []string) {
+	for _, id := range ids {
+		delete(f.rules, id)
+		f.calls = append(f.calls, "revoke "+id)
+	}
+}
+
+func (f *fakeSecurityGroups) RevokeSecurityGroupIngress(_ context.Context, params *ec2.RevokeSecurityGroupIngressInput, _ ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	f.revoke(params.SecurityGroupRuleIds)
+	return &ec2.RevokeSecurityGroupIngressOutput{}, nil
+}
+
+func (f *fakeSecurityGroups) RevokeSecurityGroupEgress(_ context.Context, params *ec2.RevokeSecurityGroupEgressInput, _ ...func(*ec2.Options)) (*ec2.RevokeSecurityGroupEgressOutput, error) {
+	f.revoke(params.SecurityGroupRuleIds)
+	return &ec2.RevokeSecurityGroupEgressOutput{}, nil
+}
+
+func (f *fakeSecurityGroups) ModifySecurityGroupRules(_ context.Context, params *ec2.ModifySecurityGroupRulesInput, _ ...func(*ec2.Options)) (*ec2.ModifySecurityGroupRulesOutput, error) {
+	for _, update := range params.SecurityGroupRules {
+		rule := f.rules[aws.ToString(update.SecurityGroupRuleId)]
+		rule.Description = update.SecurityGroupRule.Description
+		f.rules[aws.ToString(update.SecurityGroupRuleId)] = rule
+		f.calls = append(f.calls, "describe "+aws.ToString(update.SecurityGroupRuleId))
+	}
+	return &ec2.ModifySecurityGroupRulesOutput{}, nil
+}
+
+var _ = Describe("SecurityGroup Controller", func() {
+	ctx := context.Background()
+
+	var (
+		api        *fakeSecurityGroups
+		reconciler *SecurityGroupReconciler
+		group      *computev1.SecurityGroup
+	)
+
+	BeforeEach(func() {
+		api = newFakeSecurityGroups()
+		reconciler = &SecurityGroupReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		group = &computev1.SecurityGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "1234"},
+			Spec: computev1.SecurityGroupSpec{
+				Region: "eu-central-1",
+				VpcID:  "vpc-0abc",
+				Ingress: []computev1.SecurityGroupRule{
+					{Description: "HTTPS", Protocol: "tcp", FromPort: ptr.To[int32](443), ToPort: ptr.To[int32](443),
+						CIDRBlocks: []string{"0.0.0.0/0"}, IPv6CIDRBlocks: []string{"::/0"}},
+				},
+			},
+			Status: computev1.SecurityGroupStatus{GroupID: "sg-0web"},
+		}
+	})
+
+	It("should create the group once, named after the object", func() {
+		groupID, err := createSecurityGroup(ctx, api, group)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(groupID).To(Equal("sg-0web"))
+
+		groupID, err = createSecurityGroup(ctx, api, group)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(groupID).To(Equal("sg-0web"))
+		Expect(api.calls).To(Equal([]string{"create default-web"}))
+	})
+
+	It("should authorize one rule per peer, and keep the default egress rule", func() {
+		desired, err := reconciler.desiredPermissions(ctx, group)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(desired).To(HaveLen(3))
+
+		Expect(syncSecurityGroupRules(ctx, api, "sg-0web", desired)).To(Succeed())
+		Expect(api.calls).To(ConsistOf("authorize sgr-2", "authorize sgr-3"))
+		Expect(api.rules).To(HaveLen(3))
+
+		By("doing nothing when the rules match")
+		api.calls = nil
+		Expect(syncSecurityGroupRules(ctx, api, "sg-0web", desired)).To(Succeed())
+		Expect(api.calls).To(BeEmpty())
+	})
+
+	It("should change rules one by one, authorizing before revoking", func() {
+		desired, err := reconciler.desiredPermissions(ctx, group)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncSecurityGroupRules(ctx, api, "sg-0web", desired)).To(Succeed())
+		api.calls = nil
+
+		group.Spec.Ingress[0].Description = "TLS"
+		group.Spec.Ingress[0].IPv6CIDRBlocks = nil
+		group.Spec.Egress = []computev1.SecurityGroupRule{{Protocol: "tcp", FromPort: ptr.To[int32](5432), ToPort: ptr.To[int32](5432), PrefixListIDs: []string{"pl-0db"}}}
+		desired, err = reconciler.desiredPermissions(ctx, group)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncSecurityGroupRules(ctx, api, "sg-0web", desired)).To(Succeed())
+
+		Expect(api.calls).To(HaveLen(4))
+		Expect(api.calls[0]).To(HavePrefix("authorize"))
+		Expect(api.calls[1]).To(HavePrefix("describe"))
+		Expect(api.calls[2:]).To(ConsistOf(HavePrefix("revoke"), HavePrefix("revoke")))
+		Expect(api.rules).To(HaveLen(2))
+		for _, rule := range api.rules {
+			if !aws.ToBool(rule.IsEgress) {
+				Expect(aws.ToString(rule.Description)).To(Equal("TLS"))
+			}
+		}
+	})
+
+	Context("When rules reference other SecurityGroups", func() {
+		var lb *computev1.SecurityGroup
+
+		BeforeEach(func() {
+			lb = &computev1.SecurityGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "lb", Namespace: "default"},
+				Spec:       computev1.SecurityGroupSpec{Region: "eu-central-1", VpcID: "vpc-0abc"},
+			}
+			Expect(k8sClient.Create(ctx, lb)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, lb)).To(Succeed())
+			})
+			group.Spec.Ingress = []computev1.SecurityGroupRule{
+				{Protocol: "tcp", FromPort: ptr.To[int32](8080), ToPort: ptr.To[int32](8080), SecurityGroupRefs: []string{"lb", "web"}},
+			}
+		})
+
+		It("should wait for the referenced group to be created", func() {
+			var refErr *securityGroupReferenceError
+			_, err := reconciler.desiredPermissions(ctx, group)
+			Expect(errors.As(err, &refErr)).To(BeTrue())
+			Expect(refErr.reason).To(Equal(computev1.ReasonSecurityGroupRefNotReady))
+
+			lb.Status.GroupID = "sg-0lb"
+			Expect(k8sClient.Status().Update(ctx, lb)).To(Succeed())
+			desired, err := reconciler.desiredPermissions(ctx, group)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(desired).To(HaveKey(securityGroupPermission{protocol: "tcp", fromPort: 8080, toPort: 8080, groupID: "sg-0lb"}))
+			Expect(desired).To(HaveKey(securityGroupPermission{protocol: "tcp", fromPort: 8080, toPort: 8080, groupID: "sg-0web"}))
+			Expect(reconciler.groupsReferencing(ctx, lb)).To(BeEmpty(), "the fake client has no field index")
+		})
+
+		It("should refuse a group of another VPC", func() {
+			lb.Spec.VpcID = "vpc-0other"
+			Expect(k8sClient.Update(ctx, lb)).To(Succeed())
+
+			var refErr *securityGroupReferenceError
+			_, err := reconciler.desiredPermissions(ctx, group)
+			Expect(errors.As(err, &refErr)).To(BeTrue())
+			Expect(refErr.reason).To(Equal(computev1.ReasonSecurityGroupRefInOtherVpc))
+		})
+
+		It("should resolve the groups an Ec2Instance references", func() {
+			instance := &computev1.Ec2Instance{
+				ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"},
+				Spec:       computev1.Ec2InstanceSpec{Region: "eu-central-1", SecurityGroupRefs: []string{"lb"}},
+			}
+			var resolveErr *resolutionError
+			_, err := resolveSecurityGroupIDs(ctx, k8sClient, instance)
+			Expect(errors.As(err, &resolveErr)).To(BeTrue())
+			Expect(resolveErr.reason).To(Equal(computev1.ReasonSecurityGroupNotReady))
+
+			lb.Status.GroupID = "sg-0lb"
+			Expect(k8sClient.Status().Update(ctx, lb)).To(Succeed())
+			Expect(resolveSecurityGroupIDs(ctx, k8sClient, instance)).To(Equal([]string{"sg-0lb"}))
+
+			instance.Spec.Region = "us-east-1"
+			_, err = resolveSecurityGroupIDs(ctx, k8sClient, instance)
+			Expect(errors.As(err, &resolveErr)).To(BeTrue())
+			Expect(resolveErr.reason).To(Equal(computev1.ReasonSecurityGroupRegionConflict))
+		})
+	})
+})
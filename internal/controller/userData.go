@@ -0,0 +1,367 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+	"github.com/shkatara/ec2Operator/internal/cloudinit"
+)
+
+const (
+	// userDataReferencesIndexField is the field index used to find the Ec2Instances assembling their user data
+	// from a ConfigMap or Secret, or whose userData template looks up a value of an object, by kind/name.
+	userDataReferencesIndexField = ".userDataReferences"
+
+	// userDataBoundary separates the parts of multipart user data. It is fixed, so that the same parts
+	// always assemble to the same user data.
+	userDataBoundary = "==EC2OPERATOR-USERDATA-BOUNDARY=="
+)
+
+// userDataContentTypes maps the first line of a user data part to its MIME type, as cloud-init detects it.
+var userDataContentTypes = []struct{ prefix, contentType string }{
+	{"#!", "text/x-shellscript"},
+	{"#cloud-config", "text/cloud-config"},
+	{"#cloud-boothook", "text/cloud-boothook"},
+	{"#include", "text/x-include-url"},
+	{"#part-handler", "text/part-handler"},
+	{"## template: jinja", "text/jinja2"},
+}
+
+// userDataPart is a part of multipart user data.
+type userDataPart struct {
+	contentType string
+	content     string
+}
+
+// assembleUserData returns the user data of the resolved spec: the document rendered from cloudInit, userData,
+// rendered as a template if enabled, and the parts of userDataFrom. The user data must fit into what EC2 allows,
+// gzip compressed if needed. references are the objects the template looked up, also when rendering failed.
+func assembleUserData(ctx context.Context, c client.Client, resolved *computev1.Ec2Instance) (userData string, references []computev1.UserDataReference, err error) {
+	userData = resolved.Spec.UserData
+	if resolved.Spec.UserDataTemplate {
+		if userData, references, err = renderUserDataTemplate(ctx, c, resolved); err != nil {
+			return "", references, err
+		}
+	}
+	if userData, err = joinUserData(ctx, c, resolved, userData); err != nil {
+		return "", references, err
+	}
+	if _, err := cloudinit.Encode(userData); err != nil {
+		return "", references, &resolutionError{computev1.ReasonUserDataTooLarge, err.Error()}
+	}
+	return userData, references, nil
+}
+
+// joinUserData joins the parts of the user data, as a MIME multipart archive when there is more than one.
+func joinUserData(ctx context.Context, c client.Client, resolved *computev1.Ec2Instance, userData string) (string, error) {
+	if resolved.Spec.CloudInit == nil && len(resolved.Spec.UserDataFrom) == 0 {
+		return userData, nil
+	}
+
+	var parts []userDataPart
+	if resolved.Spec.CloudInit != nil {
+		document, err := cloudinit.Render(resolved.Spec.CloudInit)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, userDataPart{contentType: "text/cloud-config", content: document})
+	}
+	if userData != "" {
+		parts = append(parts, userDataPart{content: userData})
+	}
+	for _, source := range resolved.Spec.UserDataFrom {
+		content, err := readUserDataSource(ctx, c, resolved.Namespace, source)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, userDataPart{contentType: source.ContentType, content: content})
+	}
+	if len(parts) == 1 {
+		return parts[0].content, nil
+	}
+	return multipartUserData(parts)
+}
+
+// renderUserDataTemplate renders spec.userData as a template. A value that does not exist (yet) is a
+// resolutionError, as is a template that does not render; API errors are returned as they are.
+func renderUserDataTemplate(ctx context.Context, c client.Client, resolved *computev1.Ec2Instance) (string, []computev1.UserDataReference, error) {
+	resolver := &userDataTemplateResolver{ctx: ctx, c: c, namespace: resolved.Namespace}
+	userData, err := cloudinit.RenderTemplate(resolved.Spec.UserData, cloudinit.TemplateData{
+		Name:      resolved.Name,
+		Namespace: resolved.Namespace,
+		Region:    resolved.Spec.Region,
+		Labels:    resolved.Labels,
+	}, resolver)
+	var unresolved *resolutionError
+	switch {
+	case err == nil:
+		return userData, resolver.references, nil
+	case stderrors.As(err, &unresolved):
+		return "", resolver.references, unresolved
+	case resolver.err != nil:
+		return "", resolver.references, resolver.err
+	default:
+		return "", resolver.references, &resolutionError{computev1.ReasonUserDataTemplateInvalid, err.Error()}
+	}
+}
+
+// userDataTemplateResolver looks up the values of a userData template in the namespace of the instance,
+// and records the objects it looked up so that a change to any of them renders the template again.
+type userDataTemplateResolver struct {
+	ctx        context.Context
+	c          client.Client
+	namespace  string
+	references []computev1.UserDataReference
+	// err is the API error that stopped the rendering, if any.
+	err error
+}
+
+func (r *userDataTemplateResolver) PrivateIP(name string) (string, error) {
+	return r.instanceValue(name, "private IP", func(status *computev1.Ec2InstanceStatus) string { return status.PrivateIP })
+}
+
+func (r *userDataTemplateResolver) PublicIP(name string) (string, error) {
+	return r.instanceValue(name, "public IP", func(status *computev1.Ec2InstanceStatus) string { return status.PublicIP })
+}
+
+func (r *userDataTemplateResolver) InstanceID(name string) (string, error) {
+	return r.instanceValue(name, "instance ID", func(status *computev1.Ec2InstanceStatus) string { return status.InstanceID })
+}
+
+func (r *userDataTemplateResolver) ConfigMapKey(name, key string) (string, error) {
+	r.reference("ConfigMap", name)
+	return r.readKey(computev1.UserDataSource{ConfigMapKeyRef: &computev1.UserDataKeyReference{Name: name, Key: key}})
+}
+
+func (r *userDataTemplateResolver) SecretKey(name, key string) (string, error) {
+	r.reference("Secret", name)
+	return r.readKey(computev1.UserDataSource{SecretKeyRef: &computev1.UserDataKeyReference{Name: name, Key: key}})
+}
+
+// instanceValue reads a status field of another Ec2Instance, which is pending until the field is set.
+func (r *userDataTemplateResolver) instanceValue(name, what string, value func(*computev1.Ec2InstanceStatus) string) (string, error) {
+	r.reference("Ec2Instance", name)
+	instance := &computev1.Ec2Instance{}
+	if err := r.c.Get(r.ctx, types.NamespacedName{Namespace: r.namespace, Name: name}, instance); err != nil {
+		if errors.IsNotFound(err) {
+			return "", &resolutionError{computev1.ReasonUserDataReferenceNotFound, fmt.Sprintf("Ec2Instance %s not found", name)}
+		}
+		r.err = err
+		return "", err
+	}
+	if v := value(&instance.Status); v != "" {
+		return v, nil
+	}
+	return "", &resolutionError{computev1.ReasonUserDataReferencePending, fmt.Sprintf("Ec2Instance %s has no %s yet", name, what)}
+}
+
+// readKey reads a key of a ConfigMap or Secret like a part of spec.userDataFrom.
+func (r *userDataTemplateResolver) readKey(source computev1.UserDataSource) (string, error) {
+	content, err := readUserDataSource(r.ctx, r.c, r.namespace, source)
+	var unresolved *resolutionError
+	switch {
+	case stderrors.As(err, &unresolved):
+		return "", &resolutionError{computev1.ReasonUserDataReferenceNotFound, unresolved.message}
+	case err != nil:
+		r.err = err
+	}
+	return content, err
+}
+
+func (r *userDataTemplateResolver) reference(kind, name string) {
+	reference := computev1.UserDataReference{Kind: kind, Name: name}
+	if !slices.Contains(r.references, reference) {
+		r.references = append(r.references, reference)
+	}
+}
+
+// userDataReferenceKeys are the values of userDataReferencesIndexField for an Ec2Instance: the ConfigMaps and
+// Secrets of spec.userDataFrom, and the objects its userData template looked up when it was last rendered.
+func userDataReferenceKeys(ec2Instance *computev1.Ec2Instance) []string {
+	var keys []string
+	for _, source := range ec2Instance.Spec.UserDataFrom {
+		if source.ConfigMapKeyRef != nil {
+			keys = append(keys, "ConfigMap/"+source.ConfigMapKeyRef.Name)
+		}
+		if source.SecretKeyRef != nil {
+			keys = append(keys, "Secret/"+source.SecretKeyRef.Name)
+		}
+	}
+	for _, reference := range ec2Instance.Status.UserDataReferences {
+		keys = append(keys, reference.Kind+"/"+reference.Name)
+	}
+	return keys
+}
+
+// readUserDataSource reads the key of the ConfigMap or Secret of a user data part.
+func readUserDataSource(ctx context.Context, c client.Client, namespace string, source computev1.UserDataSource) (string, error) {
+	if ref := source.ConfigMapKeyRef; ref != nil {
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, configMap); err != nil {
+			if errors.IsNotFound(err) {
+				return "", &resolutionError{computev1.ReasonUserDataSourceNotFound, fmt.Sprintf("ConfigMap %s not found", ref.Name)}
+			}
+			return "", err
+		}
+		if content, ok := configMap.Data[ref.Key]; ok {
+			return content, nil
+		}
+		if content, ok := configMap.BinaryData[ref.Key]; ok {
+			return string(content), nil
+		}
+		return "", &resolutionError{computev1.ReasonUserDataSourceNotFound, fmt.Sprintf("ConfigMap %s has no key %s", ref.Name, ref.Key)}
+	}
+
+	ref := source.SecretKeyRef
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return "", &resolutionError{computev1.ReasonUserDataSourceNotFound, fmt.Sprintf("Secret %s not found", ref.Name)}
+		}
+		return "", err
+	}
+	content, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", &resolutionError{computev1.ReasonUserDataSourceNotFound, fmt.Sprintf("Secret %s has no key %s", ref.Name, ref.Key)}
+	}
+	return string(content), nil
+}
+
+// multipartUserData combines user data parts into a MIME multipart archive.
+func multipartUserData(parts []userDataPart) (string, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=\"%s\"\r\nMIME-Version: 1.0\r\n\r\n", userDataBoundary)
+
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary(userDataBoundary); err != nil {
+		return "", err
+	}
+	for i, part := range parts {
+		if strings.Contains(part.content, userDataBoundary) {
+			return "", fmt.Errorf("user data part %d contains the multipart boundary %s", i+1, userDataBoundary)
+		}
+		contentType := part.contentType
+		if contentType == "" {
+			contentType = userDataContentType(part.content)
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", contentType+`; charset="utf-8"`)
+		header.Set("MIME-Version", "1.0")
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="part-%03d"`, i+1))
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// userDataContentType detects the MIME type of a user data part from its first line.
+func userDataContentType(content string) string {
+	for _, known := range userDataContentTypes {
+		if strings.HasPrefix(content, known.prefix) {
+			return known.contentType
+		}
+	}
+	return "text/plain"
+}
+
+// userDataHash is the hash of user data recorded in status.userDataHash.
+func userDataHash(userData string) string {
+	sum := sha256.Sum256([]byte(userData))
+	return hex.EncodeToString(sum[:])
+}
+
+// trackedUserData tells whether the user data of the spec is rendered or assembled, and tracked after launch
+// through status.userDataHash. Plain userData is not.
+func trackedUserData(spec *computev1.Ec2InstanceSpec) bool {
+	return spec.CloudInit != nil || spec.UserDataTemplate || len(spec.UserDataFrom) > 0
+}
+
+// reconcileUserData renders and assembles the user data again and compares it with the user data the
+// instance was launched with. A change is reported in the UserDataUpToDate condition, and with the Replace
+// policy the instance is replaced; the next reconcile then launches it with the new user data.
+func (r *Ec2InstanceReconciler) reconcileUserData(ctx context.Context, ec2Instance *computev1.Ec2Instance, resolved *computev1.Ec2Instance) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	if !trackedUserData(&resolved.Spec) {
+		return ctrl.Result{}, nil
+	}
+	observed := ec2Instance.Status.DeepCopy()
+	result := ctrl.Result{}
+
+	condition := metav1.Condition{
+		Type:               computev1.ConditionUserDataUpToDate,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec2Instance.Generation,
+	}
+	userData, references, err := assembleUserData(ctx, r.Client, resolved)
+	ec2Instance.Status.UserDataReferences = references
+	var unresolved *resolutionError
+	switch {
+	case stderrors.As(err, &unresolved):
+		condition.Reason = unresolved.reason
+		condition.Message = unresolved.message
+	case err != nil:
+		l.Error(err, "Failed to assemble user data")
+		// Kubernetes will retry with backoff
+		return ctrl.Result{}, err
+	case userDataHash(userData) == ec2Instance.Status.UserDataHash:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = computev1.ReasonUserDataCurrent
+		condition.Message = "Instance runs the current user data"
+	case resolved.Spec.UserDataChangePolicy != computev1.UserDataChangeReplace:
+		condition.Reason = computev1.ReasonUserDataChanged
+		condition.Message = "User data changed since launch, the instance keeps running the user data it was launched with"
+	default:
+		l.Info("Replacing instance to run the changed user data", "instanceID", ec2Instance.Status.InstanceID)
+		condition.Reason = computev1.ReasonUserDataReplacing
+		condition.Message = fmt.Sprintf("Replacing instance %s to run the changed user data", ec2Instance.Status.InstanceID)
+		replaced, err := replaceInstance(ctx, ec2Instance)
+		if err != nil {
+			l.Error(err, "Failed to replace instance")
+			// Kubernetes will retry with backoff
+			return ctrl.Result{}, err
+		}
+		result.RequeueAfter = targetHealthPollInterval
+		if replaced {
+			result.RequeueAfter = time.Second
+		}
+	}
+	meta.SetStatusCondition(&ec2Instance.Status.Conditions, condition)
+
+	if equality.Semantic.DeepEqual(observed, &ec2Instance.Status) {
+		return result, nil
+	}
+	if err := r.Status().Update(ctx, ec2Instance); err != nil {
+		l.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
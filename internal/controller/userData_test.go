@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+	"github.com/shkatara/ec2Operator/internal/cloudinit"
+)
+
+// parseUserData reads multipart user data back into the content types and contents of its parts.
+func parseUserData(userData string) (contentTypes, contents []string) {
+	message, err := mail.ReadMessage(strings.NewReader(userData))
+	Expect(err).NotTo(HaveOccurred())
+	_, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	Expect(err).NotTo(HaveOccurred())
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return contentTypes, contents
+		}
+		Expect(err).NotTo(HaveOccurred())
+		content, err := io.ReadAll(part)
+		Expect(err).NotTo(HaveOccurred())
+		mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		Expect(err).NotTo(HaveOccurred())
+		contentTypes = append(contentTypes, mediaType)
+		contents = append(contents, string(content))
+	}
+}
+
+var _ = Describe("Instance user data", func() {
+	ctx := context.Background()
+
+	var (
+		reconciler *Ec2InstanceReconciler
+		instance   *computev1.Ec2Instance
+	)
+
+	BeforeEach(func() {
+		reconciler = &Ec2InstanceReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		instance = &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: computev1.Ec2InstanceSpec{
+				InstanceType: "t3.micro",
+				AMIId:        "ami-09042b2f6d07d164a",
+				Region:       "eu-central-1",
+				UserDataFrom: []computev1.UserDataSource{
+					{ConfigMapKeyRef: &computev1.UserDataKeyReference{Name: "web-bootstrap", Key: "cloud-config"}},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-bootstrap", Namespace: "default"},
+			Data:       map[string]string{"cloud-config": "#cloud-config\npackages: [httpd]\n"},
+		})).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.DeleteAllOf(ctx, &corev1.ConfigMap{}, client.InNamespace("default"))).To(Succeed())
+			Expect(k8sClient.DeleteAllOf(ctx, &corev1.Secret{}, client.InNamespace("default"))).To(Succeed())
+		})
+	})
+
+	It("should use a single part as is", func() {
+		Expect(assembleUserData(ctx, k8sClient, instance)).To(Equal("#cloud-config\npackages: [httpd]\n"))
+	})
+
+	It("should combine userData and the parts into a MIME multipart archive", func() {
+		instance.Spec.UserData = "#!/bin/bash\necho hello\n"
+		instance.Spec.UserDataFrom = append(instance.Spec.UserDataFrom, computev1.UserDataSource{
+			SecretKeyRef: &computev1.UserDataKeyReference{Name: "web-token", Key: "token"},
+			ContentType:  "text/x-shellscript",
+		})
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-token", Namespace: "default"},
+			Data:       map[string][]byte{"token": []byte("export TOKEN=s3cr3t\n")},
+		})).To(Succeed())
+
+		userData, _, err := assembleUserData(ctx, k8sClient, instance)
+		Expect(err).NotTo(HaveOccurred())
+		contentTypes, contents := parseUserData(userData)
+		Expect(contentTypes).To(Equal([]string{"text/x-shellscript", "text/cloud-config", "text/x-shellscript"}))
+		Expect(contents).To(Equal([]string{"#!/bin/bash\necho hello\n", "#cloud-config\npackages: [httpd]\n", "export TOKEN=s3cr3t\n"}))
+
+		again, _, err := assembleUserData(ctx, k8sClient, instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(userData))
+	})
+
+	It("should render cloudInit to #cloud-config as the first part", func() {
+		instance.Spec.CloudInit = &computev1.CloudInitConfig{
+			Users:    []computev1.CloudInitUser{{Name: "deploy", Sudo: true, SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA deploy"}}},
+			Packages: []string{"httpd"},
+			Mounts:   []computev1.CloudInitMount{{DeviceName: "/dev/sdf", MountPoint: "/data"}},
+			Runcmd:   []string{"systemctl enable --now httpd"},
+		}
+		document, err := cloudinit.Render(instance.Spec.CloudInit)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(document).To(Equal(`#cloud-config
+fs_setup:
+- device: /dev/sdf
+  filesystem: ext4
+mounts:
+- - /dev/sdf
+  - /data
+  - ext4
+  - defaults,nofail
+  - "0"
+  - "2"
+packages:
+- httpd
+runcmd:
+- systemctl enable --now httpd
+users:
+- default
+- name: deploy
+  ssh_authorized_keys:
+  - ssh-ed25519 AAAA deploy
+  sudo: ALL=(ALL) NOPASSWD:ALL
+`))
+
+		userData, _, err := assembleUserData(ctx, k8sClient, instance)
+		Expect(err).NotTo(HaveOccurred())
+		contentTypes, contents := parseUserData(userData)
+		Expect(contentTypes).To(Equal([]string{"text/cloud-config", "text/cloud-config"}))
+		Expect(contents[0]).To(Equal(document))
+	})
+
+	It("should gzip user data that does not fit into 16 KB otherwise", func() {
+		userData := strings.Repeat("echo hello\n", 2000)
+		encoded, err := cloudinit.Encode(userData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(encoded)).To(BeNumerically("<", cloudinit.MaxUserDataSize))
+		reader, err := gzip.NewReader(bytes.NewReader(encoded))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(io.ReadAll(reader)).To(BeEquivalentTo(userData))
+
+		Expect(cloudinit.Encode("#!/bin/bash\n")).To(BeEquivalentTo("#!/bin/bash\n"))
+	})
+
+	It("should report a missing Secret or key", func() {
+		instance.Spec.UserDataFrom[0].ConfigMapKeyRef.Key = "script"
+		var unresolved *resolutionError
+		_, _, err := assembleUserData(ctx, k8sClient, instance)
+		Expect(errors.As(err, &unresolved)).To(BeTrue())
+		Expect(unresolved.message).To(Equal("ConfigMap web-bootstrap has no key script"))
+
+		instance.Spec.UserDataFrom = []computev1.UserDataSource{{SecretKeyRef: &computev1.UserDataKeyReference{Name: "web-token", Key: "token"}}}
+		_, _, err = assembleUserData(ctx, k8sClient, instance)
+		Expect(errors.As(err, &unresolved)).To(BeTrue())
+		Expect(unresolved.message).To(Equal("Secret web-token not found"))
+	})
+
+	It("should render the userData template once the values it looks up exist", func() {
+		instance.Labels = map[string]string{"tier": "web"}
+		instance.Spec.UserDataFrom = nil
+		instance.Spec.UserDataTemplate = true
+		instance.Spec.UserData = `#!/bin/bash
+echo {{ .Namespace }}/{{ .Name }} {{ .Labels.tier }}
+export DB_HOST={{ privateIP "db" }}
+export DB_PASSWORD={{ secretKey "db-credentials" "password" }}
+`
+		_, references, err := assembleUserData(ctx, k8sClient, instance)
+		var unresolved *resolutionError
+		Expect(errors.As(err, &unresolved)).To(BeTrue())
+		Expect(unresolved.reason).To(Equal(computev1.ReasonUserDataReferenceNotFound))
+		Expect(unresolved.message).To(Equal("Ec2Instance db not found"))
+		Expect(references).To(Equal([]computev1.UserDataReference{{Kind: "Ec2Instance", Name: "db"}}))
+
+		db := &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Spec:       computev1.Ec2InstanceSpec{InstanceType: "t3.micro", AMIId: "ami-09042b2f6d07d164a", Region: "eu-central-1"},
+		}
+		Expect(k8sClient.Create(ctx, db)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, db)).To(Succeed())
+		})
+		_, _, err = assembleUserData(ctx, k8sClient, instance)
+		Expect(errors.As(err, &unresolved)).To(BeTrue())
+		Expect(unresolved.reason).To(Equal(computev1.ReasonUserDataReferencePending))
+		Expect(unresolved.message).To(Equal("Ec2Instance db has no private IP yet"))
+
+		db.Status = computev1.Ec2InstanceStatus{InstanceID: "i-0db", PrivateIP: "10.0.1.17"}
+		Expect(k8sClient.Status().Update(ctx, db)).To(Succeed())
+		_, references, err = assembleUserData(ctx, k8sClient, instance)
+		Expect(errors.As(err, &unresolved)).To(BeTrue())
+		Expect(unresolved.message).To(Equal("Secret db-credentials not found"))
+		Expect(references).To(HaveLen(2))
+
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db-credentials", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("s3cr3t")},
+		})).To(Succeed())
+		userData, references, err := assembleUserData(ctx, k8sClient, instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(userData).To(Equal("#!/bin/bash\necho default/web web\nexport DB_HOST=10.0.1.17\nexport DB_PASSWORD=s3cr3t\n"))
+		Expect(references).To(Equal([]computev1.UserDataReference{{Kind: "Ec2Instance", Name: "db"}, {Kind: "Secret", Name: "db-credentials"}}))
+		Expect(userDataReferenceKeys(&computev1.Ec2Instance{Status: computev1.Ec2InstanceStatus{UserDataReferences: references}})).
+			To(Equal([]string{"Ec2Instance/db", "Secret/db-credentials"}))
+
+		instance.Spec.UserData = "{{ .Labels.zone }}"
+		_, _, err = assembleUserData(ctx, k8sClient, instance)
+		Expect(errors.As(err, &unresolved)).To(BeTrue())
+		Expect(unresolved.reason).To(Equal(computev1.ReasonUserDataTemplateInvalid))
+	})
+
+	It("should report user data that changed since launch", func() {
+		Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		})
+		instance.Status = computev1.Ec2InstanceStatus{InstanceID: "i-0123", UserDataHash: userDataHash("#cloud-config\npackages: [httpd]\n")}
+		Expect(k8sClient.Status().Update(ctx, instance)).To(Succeed())
+
+		Expect(reconciler.reconcileUserData(ctx, instance, instance)).Error().NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(instance.Status.Conditions, computev1.ConditionUserDataUpToDate)).To(BeTrue())
+
+		configMap := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "web-bootstrap", Namespace: "default"}, configMap)).To(Succeed())
+		configMap.Data["cloud-config"] = "#cloud-config\npackages: [nginx]\n"
+		Expect(k8sClient.Update(ctx, configMap)).To(Succeed())
+
+		Expect(reconciler.reconcileUserData(ctx, instance, instance)).Error().NotTo(HaveOccurred())
+		condition := meta.FindStatusCondition(instance.Status.Conditions, computev1.ConditionUserDataUpToDate)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(computev1.ReasonUserDataChanged))
+		Expect(instance.Status.InstanceID).To(Equal("i-0123"))
+	})
+})
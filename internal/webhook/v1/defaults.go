@@ -0,0 +1,161 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+)
+
+const (
+	// DefaultsConfigMapName is the name of the ConfigMap holding Ec2Instance defaults. The operator reads
+	// it from its own namespace (cluster-wide defaults) and from the namespace of each Ec2Instance
+	// (namespace defaults, which win over the cluster-wide ones).
+	DefaultsConfigMapName = "ec2instance-defaults"
+	// DefaultsConfigMapKey is the key in the ConfigMap that holds a (partial) Ec2InstanceSpec as YAML.
+	DefaultsConfigMapKey = "spec"
+)
+
+// Tag keys the defaulter adds to every instance unless they are already set.
+const (
+	TagName      = "Name"
+	TagNamespace = "Namespace"
+	TagOwner     = "Owner"
+	TagManagedBy = "ManagedBy"
+)
+
+// invalidDefaultsError is returned when the defaults ConfigMap does not hold a valid Ec2InstanceSpec.
+type invalidDefaultsError struct {
+	configMap *corev1.ConfigMap
+	err       error
+}
+
+func (e *invalidDefaultsError) Error() string {
+	return fmt.Sprintf("failed to parse key %q of defaults ConfigMap %s/%s: %v", DefaultsConfigMapKey, e.configMap.Namespace, e.configMap.Name, e.err)
+}
+
+func (e *invalidDefaultsError) Unwrap() error {
+	return e.err
+}
+
+// loadDefaults reads the defaults ConfigMap in the given namespace.
+// A missing ConfigMap or key is not an error; it simply means there are no defaults to apply.
+// A ConfigMap that does not parse is an invalidDefaultsError.
+func loadDefaults(ctx context.Context, reader client.Reader, namespace string) (*computev1.Ec2InstanceSpec, error) {
+	if reader == nil || namespace == "" {
+		return nil, nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: DefaultsConfigMapName}, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get defaults ConfigMap %s/%s: %w", namespace, DefaultsConfigMapName, err)
+	}
+
+	raw, ok := cm.Data[DefaultsConfigMapKey]
+	if !ok {
+		return nil, nil
+	}
+
+	defaults := &computev1.Ec2InstanceSpec{}
+	if err := yaml.UnmarshalStrict([]byte(raw), defaults); err != nil {
+		return nil, &invalidDefaultsError{configMap: cm, err: err}
+	}
+	return defaults, nil
+}
+
+// applySpecDefaults fills every unset field of spec from defaults. Fields that are already set are left alone,
+// and tags are merged key by key so that spec tags win over default tags.
+func applySpecDefaults(spec, defaults *computev1.Ec2InstanceSpec) {
+	if defaults == nil {
+		return
+	}
+
+	setIfEmpty(&spec.InstanceType, defaults.InstanceType)
+	// amiId and image exclude each other, so they are only defaulted when the spec sets neither.
+	if spec.AMIId == "" && spec.Image == nil {
+		spec.AMIId = defaults.AMIId
+		spec.Image = defaults.Image.DeepCopy()
+	}
+	setIfEmpty(&spec.Region, defaults.Region)
+	setIfEmpty(&spec.AvailabilityZone, defaults.AvailabilityZone)
+	// keyPair and keyPairRef exclude each other, so keyPair is only defaulted when the spec sets neither.
+	if spec.KeyPairRef == "" {
+		setIfEmpty(&spec.KeyPair, defaults.KeyPair)
+	}
+	setIfEmpty(&spec.Subnet, defaults.Subnet)
+	setIfEmpty(&spec.IAMInstanceProfile, defaults.IAMInstanceProfile)
+	setIfEmpty(&spec.UserData, defaults.UserData)
+
+	if len(spec.SecurityGroups) == 0 && len(defaults.SecurityGroups) > 0 {
+		spec.SecurityGroups = append([]string(nil), defaults.SecurityGroups...)
+	}
+
+	// The storage block is taken over as a whole when the spec has none, otherwise only the
+	// unset root volume attributes are filled so that a spec can e.g. just ask for a bigger disk.
+	if isStorageEmpty(&spec.Storage) {
+		defaults.Storage.DeepCopyInto(&spec.Storage)
+	} else {
+		if spec.Storage.RootVolume.Size == 0 {
+			spec.Storage.RootVolume.Size = defaults.Storage.RootVolume.Size
+		}
+		setIfEmpty(&spec.Storage.RootVolume.Type, defaults.Storage.RootVolume.Type)
+	}
+
+	for key, value := range defaults.Tags {
+		setTagIfMissing(spec, key, value)
+	}
+}
+
+// applyDefaultTags adds the tags every operator-managed instance carries.
+func applyDefaultTags(ec2instance *computev1.Ec2Instance, owner string) {
+	setTagIfMissing(&ec2instance.Spec, TagName, ec2instance.Name)
+	setTagIfMissing(&ec2instance.Spec, TagNamespace, ec2instance.Namespace)
+	setTagIfMissing(&ec2instance.Spec, TagManagedBy, "ec2-operator")
+	if owner != "" {
+		setTagIfMissing(&ec2instance.Spec, TagOwner, owner)
+	}
+}
+
+func setTagIfMissing(spec *computev1.Ec2InstanceSpec, key, value string) {
+	if spec.Tags == nil {
+		spec.Tags = map[string]string{}
+	}
+	if _, ok := spec.Tags[key]; !ok {
+		spec.Tags[key] = value
+	}
+}
+
+func setIfEmpty(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+func isStorageEmpty(storage *computev1.StorageConfig) bool {
+	return storage.RootVolume == (computev1.VolumeConfig{}) && len(storage.AdditionalVolumes) == 0
+}
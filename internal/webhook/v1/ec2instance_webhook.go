@@ -0,0 +1,663 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+	"github.com/shkatara/ec2Operator/internal/cloudinit"
+)
+
+// nolint:unused
+// log is for logging in this package.
+var ec2instancelog = logf.Log.WithName("ec2instance-resource")
+
+var (
+	// amiIDPattern matches both the legacy 8 character and the current 17 character AMI IDs.
+	amiIDPattern = regexp.MustCompile(`^ami-([0-9a-f]{8}|[0-9a-f]{17})$`)
+	// instanceTypePattern matches "<family>.<size>", e.g. t3.medium or m7g.2xlarge.
+	instanceTypePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*\.[a-z0-9]+$`)
+	// availabilityZoneSuffixPattern matches what follows the region in an AZ name,
+	// e.g. "a" for eu-central-1a or "-lax-1a" for the us-west-2-lax-1a local zone.
+	availabilityZoneSuffixPattern = regexp.MustCompile(`^(-[a-z]+-[0-9]+)?[a-z]$`)
+	// linuxUserPattern matches the user names useradd accepts by default.
+	linuxUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+)
+
+// sshKeyPrefixes are the prefixes of the public key formats sshd accepts.
+var sshKeyPrefixes = []string{"ssh-", "ecdsa-sha2-", "sk-"}
+
+// volumeIOPSRanges are the provisioned IOPS limits of the volume types that support them.
+var volumeIOPSRanges = map[string][2]int32{
+	"gp3": {3000, 16000},
+	"io1": {100, 64000},
+	"io2": {100, 256000},
+}
+
+// minImageCheckInterval keeps image refresh checks from hammering the SSM and EC2 APIs.
+const minImageCheckInterval = 5 * time.Minute
+
+// supportedVolumeTypes are the EBS volume types accepted by RunInstances block device mappings.
+var supportedVolumeTypes = []string{"standard", "gp2", "gp3", "io1", "io2", "st1", "sc1"}
+
+// SetupEc2InstanceWebhookWithManager registers the webhook for Ec2Instance in the manager.
+// defaultsNamespace is the namespace holding the cluster-wide defaults ConfigMap, usually the operator's own.
+func SetupEc2InstanceWebhookWithManager(mgr ctrl.Manager, defaultsNamespace string) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&computev1.Ec2Instance{}).
+		WithValidator(&Ec2InstanceCustomValidator{}).
+		WithDefaulter(&Ec2InstanceCustomDefaulter{
+			// The API reader is used instead of the cached client so that the webhook does not
+			// start a cluster-wide ConfigMap informer just to read a handful of defaults.
+			Reader:            mgr.GetAPIReader(),
+			DefaultsNamespace: defaultsNamespace,
+			Recorder:          mgr.GetEventRecorderFor("ec2instance-defaulter"),
+		}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-compute-cloud-com-v1-ec2instance,mutating=true,failurePolicy=fail,sideEffects=None,groups=compute.cloud.com,resources=ec2instances,verbs=create,versions=v1,name=mec2instance-v1.kb.io,admissionReviewVersions=v1
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get
+
+// Ec2InstanceCustomDefaulter struct is responsible for setting default values on the custom resource of the
+// Kind Ec2Instance when those are created.
+//
+// Defaults come from the ec2instance-defaults ConfigMap in the Ec2Instance's namespace first and then from
+// the one in DefaultsNamespace, so teams no longer copy the same keyPair, securityGroups, subnet and storage
+// block into every manifest. Defaults are only applied on create: an update never changes what was launched.
+// Instances referencing an Ec2InstanceClass take their template from the class instead.
+// Cluster-wide defaults that do not parse are skipped with a warning event on their ConfigMap, so that
+// a typo does not block creating instances in every namespace.
+type Ec2InstanceCustomDefaulter struct {
+	Reader            client.Reader
+	DefaultsNamespace string
+	Recorder          record.EventRecorder
+}
+
+var _ webhook.CustomDefaulter = &Ec2InstanceCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind Ec2Instance.
+func (d *Ec2InstanceCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	ec2instance, ok := obj.(*computev1.Ec2Instance)
+	if !ok {
+		return fmt.Errorf("expected an Ec2Instance object but got %T", obj)
+	}
+	ec2instancelog.Info("Defaulting for Ec2Instance", "name", ec2instance.GetName())
+
+	// An Ec2InstanceClass is the template for instances referencing it. Filling fields from the defaults
+	// would turn them into overrides of the class, so such instances only get the default tags.
+	if ec2instance.Spec.ClassName == "" {
+		namespaceDefaults, err := loadDefaults(ctx, d.Reader, ec2instance.Namespace)
+		if err != nil {
+			return err
+		}
+		applySpecDefaults(&ec2instance.Spec, namespaceDefaults)
+
+		if d.DefaultsNamespace != ec2instance.Namespace {
+			clusterDefaults, err := loadDefaults(ctx, d.Reader, d.DefaultsNamespace)
+			var invalid *invalidDefaultsError
+			switch {
+			case stderrors.As(err, &invalid):
+				ec2instancelog.Error(err, "Skipping invalid cluster-wide defaults", "name", ec2instance.GetName())
+				if d.Recorder != nil {
+					d.Recorder.Event(invalid.configMap, corev1.EventTypeWarning, "InvalidDefaults",
+						fmt.Sprintf("Defaults are not applied to Ec2Instances: %v", invalid.err))
+				}
+			case err != nil:
+				return err
+			default:
+				applySpecDefaults(&ec2instance.Spec, clusterDefaults)
+			}
+		}
+	}
+
+	var owner string
+	if req, err := admission.RequestFromContext(ctx); err == nil {
+		owner = req.UserInfo.Username
+	}
+	applyDefaultTags(ec2instance, owner)
+
+	return nil
+}
+
+// NOTE: The 'path' attribute must follow a specific pattern and should not be modified directly here.
+// Modifying the path for an invalid path can cause API server errors; failing to locate the webhook.
+// +kubebuilder:webhook:path=/validate-compute-cloud-com-v1-ec2instance,mutating=false,failurePolicy=fail,sideEffects=None,groups=compute.cloud.com,resources=ec2instances,verbs=create;update,versions=v1,name=vec2instance-v1.kb.io,admissionReviewVersions=v1
+
+// Ec2InstanceCustomValidator struct is responsible for validating the Ec2Instance resource
+// when it is created or updated.
+//
+// Bad specs would otherwise only fail deep inside RunInstances (or not at all), so the
+// validator rejects them at admission time with errors pointing at the offending field.
+type Ec2InstanceCustomValidator struct{}
+
+var _ webhook.CustomValidator = &Ec2InstanceCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type Ec2Instance.
+func (v *Ec2InstanceCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	ec2instance, ok := obj.(*computev1.Ec2Instance)
+	if !ok {
+		return nil, fmt.Errorf("expected a Ec2Instance object but got %T", obj)
+	}
+	ec2instancelog.Info("Validation for Ec2Instance upon creation", "name", ec2instance.GetName())
+
+	specPath := field.NewPath("spec")
+	allErrs := validateEc2InstanceSpec(&ec2instance.Spec, specPath)
+	allErrs = append(allErrs, validateDependsOn(ec2instance.Name, ec2instance.Spec.DependsOn, specPath.Child("dependsOn"))...)
+
+	return nil, toInvalidError(ec2instance, allErrs)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type Ec2Instance.
+func (v *Ec2InstanceCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	ec2instance, ok := newObj.(*computev1.Ec2Instance)
+	if !ok {
+		return nil, fmt.Errorf("expected a Ec2Instance object for the newObj but got %T", newObj)
+	}
+	oldEc2instance, ok := oldObj.(*computev1.Ec2Instance)
+	if !ok {
+		return nil, fmt.Errorf("expected a Ec2Instance object for the oldObj but got %T", oldObj)
+	}
+	ec2instancelog.Info("Validation for Ec2Instance upon update", "name", ec2instance.GetName())
+
+	// Let objects that are already being deleted through so that the finalizer can always be removed.
+	if !ec2instance.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	specPath := field.NewPath("spec")
+	allErrs := validateEc2InstanceSpec(&ec2instance.Spec, specPath)
+	allErrs = append(allErrs, validateDependsOn(ec2instance.Name, ec2instance.Spec.DependsOn, specPath.Child("dependsOn"))...)
+	allErrs = append(allErrs, validateEc2InstanceSpecUpdate(&ec2instance.Spec, &oldEc2instance.Spec, specPath)...)
+
+	return nil, toInvalidError(ec2instance, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type Ec2Instance.
+func (v *Ec2InstanceCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	// Deletion is always allowed; the finalizer takes care of terminating the instance,
+	// once the instances depending on it are gone.
+	return nil, nil
+}
+
+// toInvalidError wraps the field errors into the standard Invalid API error, or returns nil if there are none.
+func toInvalidError(ec2instance *computev1.Ec2Instance, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: computev1.GroupVersion.Group, Kind: "Ec2Instance"},
+		ec2instance.Name, allErrs)
+}
+
+// validateEc2InstanceSpec checks the spec on its own, independent of any previous version of the object.
+func validateEc2InstanceSpec(spec *computev1.Ec2InstanceSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// With a class, missing fields are filled from it when the instance is launched.
+	requireField := spec.ClassName == ""
+
+	if spec.InstanceType == "" {
+		if requireField {
+			allErrs = append(allErrs, field.Required(fldPath.Child("instanceType"), "instance type must be set, e.g. t3.micro"))
+		}
+	} else if !instanceTypePattern.MatchString(spec.InstanceType) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("instanceType"), spec.InstanceType, "must be of the form <family>.<size>, e.g. t3.micro"))
+	}
+
+	switch {
+	case spec.AMIId != "" && spec.Image != nil:
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("image"), "only one of amiId and image may be set"))
+	case spec.Image != nil:
+		allErrs = append(allErrs, validateImageSelector(spec.Image, fldPath.Child("image"))...)
+	case spec.AMIId == "":
+		if requireField {
+			allErrs = append(allErrs, field.Required(fldPath.Child("amiId"), "AMI ID or image must be set"))
+		}
+	case !amiIDPattern.MatchString(spec.AMIId):
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("amiId"), spec.AMIId, "must be of the form ami-<8 or 17 hex characters>"))
+	}
+
+	if spec.Region == "" && requireField {
+		allErrs = append(allErrs, field.Required(fldPath.Child("region"), "region must be set, e.g. eu-central-1"))
+	}
+
+	if spec.AvailabilityZone != "" && spec.Region != "" {
+		suffix, inRegion := strings.CutPrefix(spec.AvailabilityZone, spec.Region)
+		if !inRegion || !availabilityZoneSuffixPattern.MatchString(suffix) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("availabilityZone"), spec.AvailabilityZone,
+				fmt.Sprintf("availability zone is not in region %q", spec.Region)))
+		}
+	}
+
+	for i, sg := range spec.SecurityGroups {
+		if !strings.HasPrefix(sg, "sg-") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("securityGroups").Index(i), sg, "must be a security group ID of the form sg-<id>"))
+		}
+	}
+
+	if spec.KeyPair != "" && spec.KeyPairRef != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("keyPairRef"), "only one of keyPair and keyPairRef may be set"))
+	}
+
+	if ref := spec.WriteConnectionSecretToRef; ref != nil && ref.IncludePrivateKey && spec.KeyPairRef == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("keyPairRef"), "the private key can only be included for a KeyPair referenced by keyPairRef"))
+	}
+
+	if spec.Subnet != "" && !strings.HasPrefix(spec.Subnet, "subnet-") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("subnet"), spec.Subnet, "must be a subnet ID of the form subnet-<id>"))
+	}
+
+	allErrs = append(allErrs, validateStorageConfig(&spec.Storage, fldPath.Child("storage"))...)
+	allErrs = append(allErrs, validateVolumeAttachments(spec, fldPath.Child("volumes"))...)
+	if spec.Service != nil {
+		allErrs = append(allErrs, validateInstanceService(spec.Service, fldPath.Child("service"))...)
+	}
+	if spec.DNS != nil {
+		allErrs = append(allErrs, validateInstanceDNS(spec.DNS, fldPath.Child("dns"))...)
+	}
+	if spec.HealthCheck != nil && spec.HealthCheck.HTTP != nil {
+		if path := spec.HealthCheck.HTTP.Path; path != "" && !strings.HasPrefix(path, "/") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("healthCheck", "http", "path"), path, "must start with /"))
+		}
+	}
+	if spec.Remediation != nil && spec.HealthCheck == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("healthCheck"), "remediation acts on failed health checks, which must be configured"))
+	}
+	allErrs = append(allErrs, validateUserDataFrom(spec.UserDataFrom, fldPath.Child("userDataFrom"))...)
+	if spec.UserDataTemplate {
+		// The values the template looks up are only known to the controller; the syntax is checked here.
+		if _, err := cloudinit.ParseTemplate(spec.UserData, nil); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("userData"), "", err.Error()))
+		}
+	}
+	if spec.CloudInit != nil {
+		allErrs = append(allErrs, validateCloudInit(spec, fldPath.Child("cloudInit"))...)
+	}
+
+	return allErrs
+}
+
+// validateInstanceService requires a valid Service name, and unique port names when there are several ports,
+// as the Service would otherwise be rejected only when the operator creates it.
+func validateInstanceService(service *computev1.InstanceService, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if service.Name != "" {
+		for _, msg := range validation.IsDNS1035Label(service.Name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("name"), service.Name, msg))
+		}
+	}
+
+	seenNames := map[string]bool{}
+	for i, port := range service.Ports {
+		namePath := fldPath.Child("ports").Index(i).Child("name")
+		switch {
+		case port.Name == "":
+			if len(service.Ports) > 1 {
+				allErrs = append(allErrs, field.Required(namePath, "ports must be named when there are several"))
+			}
+		case seenNames[port.Name]:
+			allErrs = append(allErrs, field.Duplicate(namePath, port.Name))
+		default:
+			seenNames[port.Name] = true
+			for _, msg := range validation.IsValidPortName(port.Name) {
+				allErrs = append(allErrs, field.Invalid(namePath, port.Name, msg))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateCloudInit checks the users, files and mounts of spec.cloudInit, and that the rendered #cloud-config
+// fits into the user data EC2 allows. Without a class, mounts must name a volume of the spec.
+func validateCloudInit(spec *computev1.Ec2InstanceSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	config := spec.CloudInit
+
+	for i, user := range config.Users {
+		userPath := fldPath.Child("users").Index(i)
+		if !linuxUserPattern.MatchString(user.Name) {
+			allErrs = append(allErrs, field.Invalid(userPath.Child("name"), user.Name, "must be a valid Linux user name, e.g. deploy"))
+		}
+		for j, key := range user.SSHAuthorizedKeys {
+			if !slices.ContainsFunc(sshKeyPrefixes, func(prefix string) bool { return strings.HasPrefix(key, prefix) }) {
+				allErrs = append(allErrs, field.Invalid(userPath.Child("sshAuthorizedKeys").Index(j), key, "must be an OpenSSH public key, e.g. ssh-ed25519 AAAA..."))
+			}
+		}
+	}
+	for i, file := range config.WriteFiles {
+		if !strings.HasPrefix(file.Path, "/") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("writeFiles").Index(i).Child("path"), file.Path, "must be an absolute path"))
+		}
+	}
+
+	devices := map[string]bool{}
+	for _, volume := range spec.Storage.AdditionalVolumes {
+		devices[volume.DeviceName] = true
+	}
+	for _, attachment := range spec.Volumes {
+		devices[attachment.DeviceName] = true
+	}
+	for i, mount := range config.Mounts {
+		mountPath := fldPath.Child("mounts").Index(i)
+		if spec.ClassName == "" && !devices[mount.DeviceName] {
+			allErrs = append(allErrs, field.NotFound(mountPath.Child("deviceName"), mount.DeviceName))
+		}
+		if !strings.HasPrefix(mount.MountPoint, "/") {
+			allErrs = append(allErrs, field.Invalid(mountPath.Child("mountPoint"), mount.MountPoint, "must be an absolute path"))
+		}
+	}
+
+	document, err := cloudinit.Render(config)
+	if err == nil {
+		_, err = cloudinit.Encode(document)
+	}
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", err.Error()))
+	}
+	return allErrs
+}
+
+// validateDependsOn forbids an instance to depend on itself; it would never be launched.
+// Longer cycles are only known to the controller, which reports them in the DependenciesReady condition.
+func validateDependsOn(name string, dependencies []computev1.InstanceDependency, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for i, dependency := range dependencies {
+		if dependency.Name == name {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("name"), dependency.Name, "an instance cannot depend on itself"))
+		}
+	}
+	return allErrs
+}
+
+// validateUserDataFrom requires every part of the user data to come from either a ConfigMap or a Secret.
+func validateUserDataFrom(sources []computev1.UserDataSource, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for i, source := range sources {
+		if (source.ConfigMapKeyRef == nil) == (source.SecretKeyRef == nil) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), source, "exactly one of configMapKeyRef and secretKeyRef must be set"))
+		}
+	}
+	return allErrs
+}
+
+// validateInstanceDNS requires a fully qualified record name, which may start with a wildcard label.
+// Route 53 would otherwise only reject the record when the operator writes it.
+func validateInstanceDNS(dns *computev1.InstanceDNS, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	name := strings.TrimPrefix(strings.TrimSuffix(dns.RecordName, "."), "*.")
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("recordName"), dns.RecordName, msg))
+	}
+	if !strings.Contains(name, ".") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("recordName"), dns.RecordName, "must be a fully qualified name, e.g. web.example.com"))
+	}
+	return allErrs
+}
+
+// validateVolumeAttachments requires a device name for every EbsVolume, not used by the storage volumes or another EbsVolume.
+func validateVolumeAttachments(spec *computev1.Ec2InstanceSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seenDevices := map[string]bool{spec.Storage.RootVolume.DeviceName: true}
+	for _, volume := range spec.Storage.AdditionalVolumes {
+		seenDevices[volume.DeviceName] = true
+	}
+	for i, attachment := range spec.Volumes {
+		devicePath := fldPath.Index(i).Child("deviceName")
+		switch {
+		case attachment.DeviceName == "":
+			allErrs = append(allErrs, field.Required(devicePath, "EbsVolumes need a device name, e.g. /dev/sdh"))
+		case seenDevices[attachment.DeviceName]:
+			allErrs = append(allErrs, field.Duplicate(devicePath, attachment.DeviceName))
+		default:
+			seenDevices[attachment.DeviceName] = true
+		}
+	}
+	return allErrs
+}
+
+// validateImageSelector requires exactly one of an Ec2Image, an SSM parameter or a name filter with owners.
+// Owners are required so that an image published by an arbitrary account can never match.
+func validateImageSelector(image *computev1.ImageSelector, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	usesFilters := image.Name != "" || len(image.Owners) > 0 || image.Architecture != ""
+	switch {
+	case image.Ec2Image != "" && (image.SSMParameter != "" || usesFilters):
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("ec2Image"), "may not be combined with ssmParameter, owners, name or architecture"))
+	case image.Ec2Image != "":
+	case image.SSMParameter != "" && usesFilters:
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("ssmParameter"), "may not be combined with owners, name or architecture"))
+	case image.SSMParameter != "":
+		if !strings.HasPrefix(image.SSMParameter, "/") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ssmParameter"), image.SSMParameter, "must be a parameter path starting with /"))
+		}
+	case !usesFilters:
+		allErrs = append(allErrs, field.Required(fldPath, "either ec2Image, ssmParameter or owners and name must be set"))
+	default:
+		if image.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("name"), "name pattern must be set, e.g. al2023-ami-2023.*"))
+		}
+		if len(image.Owners) == 0 {
+			allErrs = append(allErrs, field.Required(fldPath.Child("owners"), "owners must be set, e.g. amazon or an account ID"))
+		}
+	}
+
+	if image.CheckInterval != nil && image.CheckInterval.Duration < minImageCheckInterval {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("checkInterval"), image.CheckInterval.Duration.String(),
+			fmt.Sprintf("must be at least %s", minImageCheckInterval)))
+	}
+	if window := image.MaintenanceWindow; window != nil {
+		windowPath := fldPath.Child("maintenanceWindow")
+		if window.Duration.Duration <= 0 || window.Duration.Duration > 7*24*time.Hour {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("duration"), window.Duration.Duration.String(), "must be greater than 0 and at most 168h"))
+		}
+		if _, err := time.Parse("15:04", window.StartTime); err != nil {
+			allErrs = append(allErrs, field.Invalid(windowPath.Child("startTime"), window.StartTime, "must be a time of day as HH:MM"))
+		}
+	}
+
+	return allErrs
+}
+
+// imageSource strips the refresh settings from an image selector, leaving what decides the AMI.
+func imageSource(image *computev1.ImageSelector) *computev1.ImageSelector {
+	if image == nil {
+		return nil
+	}
+	return &computev1.ImageSelector{
+		Ec2Image:     image.Ec2Image,
+		SSMParameter: image.SSMParameter,
+		Owners:       image.Owners,
+		Name:         image.Name,
+		Architecture: image.Architecture,
+	}
+}
+
+// validateStorageConfig checks the root and additional volumes, including device name collisions between them.
+func validateStorageConfig(storage *computev1.StorageConfig, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	rootPath := fldPath.Child("rootVolume")
+	if storage.RootVolume.Size < 0 {
+		allErrs = append(allErrs, field.Invalid(rootPath.Child("size"), storage.RootVolume.Size, "must not be negative"))
+	}
+	allErrs = append(allErrs, validateVolumeType(storage.RootVolume.Type, rootPath.Child("type"))...)
+	allErrs = append(allErrs, validateVolumePerformance(&storage.RootVolume, rootPath)...)
+	if storage.RootVolume.DeletionPolicy != "" {
+		allErrs = append(allErrs, field.Forbidden(rootPath.Child("deletionPolicy"), "the root volume is always deleted with the instance"))
+	}
+
+	seenDevices := map[string]*field.Path{}
+	if storage.RootVolume.DeviceName != "" {
+		seenDevices[storage.RootVolume.DeviceName] = rootPath.Child("deviceName")
+	}
+
+	for i, volume := range storage.AdditionalVolumes {
+		volumePath := fldPath.Child("additionalVolumes").Index(i)
+
+		if volume.Size <= 0 {
+			allErrs = append(allErrs, field.Invalid(volumePath.Child("size"), volume.Size, "must be greater than 0"))
+		}
+		allErrs = append(allErrs, validateVolumeType(volume.Type, volumePath.Child("type"))...)
+		allErrs = append(allErrs, validateVolumePerformance(&volume, volumePath)...)
+
+		if volume.DeviceName == "" {
+			allErrs = append(allErrs, field.Required(volumePath.Child("deviceName"), "additional volumes need a device name, e.g. /dev/sdf"))
+			continue
+		}
+		if first, ok := seenDevices[volume.DeviceName]; ok {
+			allErrs = append(allErrs, field.Duplicate(volumePath.Child("deviceName"), fmt.Sprintf("%s (already used by %s)", volume.DeviceName, first)))
+			continue
+		}
+		seenDevices[volume.DeviceName] = volumePath.Child("deviceName")
+	}
+
+	return allErrs
+}
+
+// validateVolumeType accepts an empty type (the AWS default) or one of the supported EBS volume types.
+func validateVolumeType(volumeType string, fldPath *field.Path) field.ErrorList {
+	if volumeType == "" {
+		return nil
+	}
+	for _, supported := range supportedVolumeTypes {
+		if volumeType == supported {
+			return nil
+		}
+	}
+	return field.ErrorList{field.NotSupported(fldPath, volumeType, supportedVolumeTypes)}
+}
+
+// validateVolumePerformance checks IOPS and throughput against the ranges of the volume type,
+// and that a KMS key is only given for encrypted volumes.
+func validateVolumePerformance(volume *computev1.VolumeConfig, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if volume.IOPS != 0 {
+		if limits, ok := volumeIOPSRanges[volume.Type]; !ok {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("iops"), volume.IOPS, "IOPS can only be set for io1, io2 and gp3 volumes"))
+		} else if volume.IOPS < limits[0] || volume.IOPS > limits[1] {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("iops"), volume.IOPS,
+				fmt.Sprintf("must be between %d and %d for %s volumes", limits[0], limits[1], volume.Type)))
+		}
+	}
+
+	if volume.Throughput != 0 {
+		if volume.Type != "gp3" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("throughput"), volume.Throughput, "throughput can only be set for gp3 volumes"))
+		} else if volume.Throughput < 125 || volume.Throughput > 1000 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("throughput"), volume.Throughput, "must be between 125 and 1000 MiB/s"))
+		}
+	}
+
+	if volume.KMSKeyID != "" && !volume.Encrypted {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("kmsKeyId"), volume.KMSKeyID, "requires encrypted to be true"))
+	}
+
+	return allErrs
+}
+
+// validateVolumesUpdate rejects shrinking a volume and changing its encryption, which ModifyVolume cannot do.
+// Volumes are matched by device name; the root volume is always matched with the root volume.
+func validateVolumesUpdate(newStorage, oldStorage *computev1.StorageConfig, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	oldVolumes := map[string]computev1.VolumeConfig{}
+	for _, volume := range oldStorage.AdditionalVolumes {
+		oldVolumes[volume.DeviceName] = volume
+	}
+
+	check := func(newVolume, oldVolume computev1.VolumeConfig, volumePath *field.Path) {
+		if newVolume.Size < oldVolume.Size {
+			allErrs = append(allErrs, field.Forbidden(volumePath.Child("size"),
+				fmt.Sprintf("volumes cannot be shrunk (from %d to %d GiB)", oldVolume.Size, newVolume.Size)))
+		}
+		if newVolume.Encrypted != oldVolume.Encrypted {
+			allErrs = append(allErrs, field.Forbidden(volumePath.Child("encrypted"), "encryption cannot be changed once the volume exists"))
+		}
+		if newVolume.KMSKeyID != oldVolume.KMSKeyID {
+			allErrs = append(allErrs, field.Forbidden(volumePath.Child("kmsKeyId"), "the KMS key cannot be changed once the volume exists"))
+		}
+	}
+
+	check(newStorage.RootVolume, oldStorage.RootVolume, fldPath.Child("rootVolume"))
+	for i, volume := range newStorage.AdditionalVolumes {
+		if oldVolume, ok := oldVolumes[volume.DeviceName]; ok {
+			check(volume, oldVolume, fldPath.Child("additionalVolumes").Index(i))
+		}
+	}
+
+	return allErrs
+}
+
+// validateEc2InstanceSpecUpdate rejects changes that the operator cannot apply to a launched instance.
+func validateEc2InstanceSpecUpdate(newSpec, oldSpec *computev1.Ec2InstanceSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	immutable := []struct {
+		name     string
+		old, new string
+	}{
+		{"className", oldSpec.ClassName, newSpec.ClassName},
+		{"region", oldSpec.Region, newSpec.Region},
+		{"availabilityZone", oldSpec.AvailabilityZone, newSpec.AvailabilityZone},
+		{"subnet", oldSpec.Subnet, newSpec.Subnet},
+		{"keyPair", oldSpec.KeyPair, newSpec.KeyPair},
+		{"keyPairRef", oldSpec.KeyPairRef, newSpec.KeyPairRef},
+		{"amiId", oldSpec.AMIId, newSpec.AMIId},
+	}
+	for _, f := range immutable {
+		if f.old != f.new {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child(f.name), "field is immutable once the instance has been requested"))
+		}
+	}
+
+	// Only the refresh settings of an image may change, what the image resolves to may not.
+	if !equality.Semantic.DeepEqual(imageSource(oldSpec.Image), imageSource(newSpec.Image)) {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("image"), "field is immutable once the instance has been requested, except for its refresh settings"))
+	}
+
+	allErrs = append(allErrs, validateVolumesUpdate(&newSpec.Storage, &oldSpec.Storage, fldPath.Child("storage"))...)
+
+	return allErrs
+}
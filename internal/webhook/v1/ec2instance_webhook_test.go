@@ -0,0 +1,455 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/record"
+
+	computev1 "github.com/shkatara/ec2Operator/api/v1"
+	// TODO (user): Add any additional imports if needed
+)
+
+// operatorNamespace holds the cluster-wide defaults in these tests.
+const operatorNamespace = "ec2operator-system"
+
+var _ = Describe("Ec2Instance Webhook", func() {
+	var (
+		obj       *computev1.Ec2Instance
+		oldObj    *computev1.Ec2Instance
+		validator Ec2InstanceCustomValidator
+		defaulter Ec2InstanceCustomDefaulter
+	)
+
+	BeforeEach(func() {
+		obj = &computev1.Ec2Instance{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-server-1", Namespace: "default"},
+			Spec: computev1.Ec2InstanceSpec{
+				InstanceType:     "t3.medium",
+				AMIId:            "ami-09042b2f6d07d164a",
+				Region:           "eu-central-1",
+				AvailabilityZone: "eu-central-1a",
+				SecurityGroups:   []string{"sg-09f5c9270d3d1d5f6"},
+				Subnet:           "subnet-0d417570cce95f348",
+				Storage: computev1.StorageConfig{
+					RootVolume: computev1.VolumeConfig{Size: 30, Type: "gp3"},
+					AdditionalVolumes: []computev1.VolumeConfig{
+						{Size: 100, Type: "gp3", DeviceName: "/dev/sdf"},
+					},
+				},
+			},
+		}
+		oldObj = obj.DeepCopy()
+		validator = Ec2InstanceCustomValidator{}
+		Expect(validator).NotTo(BeNil(), "Expected validator to be initialized")
+		defaulter = Ec2InstanceCustomDefaulter{Reader: k8sClient, DefaultsNamespace: operatorNamespace}
+		Expect(defaulter).NotTo(BeNil(), "Expected defaulter to be initialized")
+	})
+
+	Context("When creating Ec2Instance under Defaulting Webhook", func() {
+		createDefaults := func(namespace, spec string) {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			if err := k8sClient.Create(ctx, ns); err != nil && !apierrors.IsAlreadyExists(err) {
+				Expect(err).NotTo(HaveOccurred())
+			}
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: DefaultsConfigMapName, Namespace: namespace},
+				Data:       map[string]string{DefaultsConfigMapKey: spec},
+			}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, cm)).To(Succeed())
+			})
+		}
+
+		It("Should add the default tags", func() {
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Tags).To(HaveKeyWithValue(TagName, "web-server-1"))
+			Expect(obj.Spec.Tags).To(HaveKeyWithValue(TagNamespace, "default"))
+			Expect(obj.Spec.Tags).To(HaveKeyWithValue(TagManagedBy, "ec2-operator"))
+		})
+
+		It("Should keep a Name tag set in the spec", func() {
+			obj.Spec.Tags = map[string]string{TagName: "k8s-managed-web-server"}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Tags).To(HaveKeyWithValue(TagName, "k8s-managed-web-server"))
+		})
+
+		It("Should fill unset fields from namespace defaults before cluster defaults", func() {
+			createDefaults(operatorNamespace, `
+keyPair: cluster-kp
+subnet: subnet-0cluster
+securityGroups: [sg-0cluster]
+tags:
+  CostCenter: platform
+  Team: platform
+`)
+			createDefaults("default", `
+keyPair: team-kp
+storage:
+  rootVolume:
+    size: 50
+    type: gp3
+tags:
+  Team: web
+`)
+			obj.Spec.KeyPair = ""
+			obj.Spec.Subnet = ""
+			obj.Spec.SecurityGroups = nil
+			obj.Spec.Storage = computev1.StorageConfig{}
+
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.KeyPair).To(Equal("team-kp"))
+			Expect(obj.Spec.Subnet).To(Equal("subnet-0cluster"))
+			Expect(obj.Spec.SecurityGroups).To(ConsistOf("sg-0cluster"))
+			Expect(obj.Spec.Storage.RootVolume).To(Equal(computev1.VolumeConfig{Size: 50, Type: "gp3"}))
+			Expect(obj.Spec.Tags).To(HaveKeyWithValue("Team", "web"))
+			Expect(obj.Spec.Tags).To(HaveKeyWithValue("CostCenter", "platform"))
+		})
+
+		It("Should not override fields set in the spec", func() {
+			createDefaults("default", `
+subnet: subnet-0team
+storage:
+  rootVolume:
+    size: 50
+    type: gp2
+`)
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Subnet).To(Equal("subnet-0d417570cce95f348"))
+			Expect(obj.Spec.Storage.RootVolume).To(Equal(computev1.VolumeConfig{Size: 30, Type: "gp3"}))
+		})
+
+		It("Should fail on a malformed defaults ConfigMap", func() {
+			createDefaults("default", "keyPairs: typo")
+			Expect(defaulter.Default(ctx, obj)).To(MatchError(ContainSubstring("failed to parse")))
+		})
+
+		It("Should skip malformed cluster-wide defaults with a warning event", func() {
+			createDefaults(operatorNamespace, "keyPairs: typo")
+			recorder := record.NewFakeRecorder(1)
+			defaulter.Recorder = recorder
+			obj.Spec.KeyPair = ""
+
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.KeyPair).To(BeEmpty())
+			Expect(obj.Spec.Tags).To(HaveKeyWithValue(TagManagedBy, "ec2-operator"))
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning InvalidDefaults Defaults are not applied to Ec2Instances: ")))
+		})
+	})
+
+	Context("When creating Ec2Instance under Validating Webhook", func() {
+		It("Should admit a valid spec", func() {
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
+		})
+
+		It("Should deny creation if the instance type is empty", func() {
+			obj.Spec.InstanceType = ""
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.instanceType: Required value")))
+		})
+
+		It("Should deny creation if the AMI ID is malformed", func() {
+			obj.Spec.AMIId = "ami-xyz"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.amiId: Invalid value")))
+		})
+
+		It("Should admit an image resolved from an SSM parameter", func() {
+			obj.Spec.AMIId = ""
+			obj.Spec.Image = &computev1.ImageSelector{SSMParameter: "/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64"}
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
+		})
+
+		It("Should deny creation if both the AMI ID and an image are set", func() {
+			obj.Spec.Image = &computev1.ImageSelector{SSMParameter: "/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-x86_64"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.image: Forbidden: only one of amiId and image may be set")))
+		})
+
+		It("Should deny creation if an image filter has no owners", func() {
+			obj.Spec.AMIId = ""
+			obj.Spec.Image = &computev1.ImageSelector{Name: "al2023-ami-2023.*", Architecture: "x86_64"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.image.owners: Required value")))
+		})
+
+		It("Should deny creation if an image mixes an SSM parameter and filters", func() {
+			obj.Spec.AMIId = ""
+			obj.Spec.Image = &computev1.ImageSelector{SSMParameter: "/aws/service/x", Owners: []string{"amazon"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.image.ssmParameter: Forbidden")))
+		})
+
+		It("Should admit an image baked by an Ec2Image", func() {
+			obj.Spec.AMIId = ""
+			obj.Spec.Image = &computev1.ImageSelector{Ec2Image: "golden-web"}
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
+		})
+
+		It("Should deny creation if an image mixes an Ec2Image and an SSM parameter", func() {
+			obj.Spec.AMIId = ""
+			obj.Spec.Image = &computev1.ImageSelector{Ec2Image: "golden-web", SSMParameter: "/aws/service/x"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.image.ec2Image: Forbidden")))
+		})
+
+		It("Should deny creation if both a key pair and a KeyPair are referenced", func() {
+			obj.Spec.KeyPair = "vmskp"
+			obj.Spec.KeyPairRef = "web"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.keyPairRef: Forbidden")))
+		})
+
+		It("Should deny including the private key in the connection secret without a KeyPair", func() {
+			obj.Spec.WriteConnectionSecretToRef = &computev1.ConnectionSecretReference{Name: "web-conn", IncludePrivateKey: true}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.keyPairRef: Required")))
+		})
+
+		It("Should deny a service with several unnamed ports", func() {
+			obj.Spec.Service = &computev1.InstanceService{Ports: []computev1.InstanceServicePort{{Port: 80}, {Name: "https", Port: 443}}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.service.ports[0].name: Required")))
+		})
+
+		It("Should deny a user data part referencing both a ConfigMap and a Secret", func() {
+			ref := &computev1.UserDataKeyReference{Name: "bootstrap", Key: "script"}
+			obj.Spec.UserDataFrom = []computev1.UserDataSource{{ConfigMapKeyRef: ref}, {ConfigMapKeyRef: ref, SecretKeyRef: ref}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.userDataFrom[1]: Invalid value")))
+		})
+
+		It("Should deny cloud-init mounts of volumes the instance does not have", func() {
+			obj.Spec.CloudInit = &computev1.CloudInitConfig{
+				Users:  []computev1.CloudInitUser{{Name: "deploy", SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA deploy"}}},
+				Mounts: []computev1.CloudInitMount{{DeviceName: obj.Spec.Storage.AdditionalVolumes[0].DeviceName, MountPoint: "/data"}},
+			}
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
+
+			obj.Spec.CloudInit.Mounts[0].DeviceName = "/dev/sdz"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cloudInit.mounts[0].deviceName: Not found")))
+		})
+
+		It("Should deny a cloud-init configuration too large for EC2", func() {
+			obj.Spec.CloudInit = &computev1.CloudInitConfig{
+				WriteFiles: []computev1.CloudInitFile{{Path: "/etc/random", Content: rand.String(64 * 1024)}},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("gzip compressed, more than the 16384 bytes EC2 allows")))
+		})
+
+		It("Should deny an HTTP health probe path that is not absolute", func() {
+			obj.Spec.HealthCheck = &computev1.InstanceHealthCheck{HTTP: &computev1.HTTPHealthProbe{Port: 80, Path: "healthz"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.healthCheck.http.path: Invalid value")))
+		})
+
+		It("Should deny remediation without health checks", func() {
+			obj.Spec.Remediation = &computev1.InstanceRemediation{Action: computev1.RemediationReboot}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.healthCheck: Required value")))
+		})
+
+		It("Should deny an instance depending on itself", func() {
+			obj.Name = "db"
+			obj.Spec.DependsOn = []computev1.InstanceDependency{{Name: "vault"}, {Name: "db"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.dependsOn[1].name: Invalid value: \"db\": an instance cannot depend on itself")))
+		})
+
+		It("Should deny a userData template that does not parse", func() {
+			obj.Spec.UserDataTemplate = true
+			obj.Spec.UserData = "#!/bin/bash\necho {{ privateIP \"db\" }} {{ .Name }}\n"
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
+
+			obj.Spec.UserData = "#!/bin/bash\necho {{ lookup \"db\" }}\n"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring(`spec.userData: Invalid value: "": template: userData:2: function "lookup" not defined`)))
+		})
+
+		It("Should deny a DNS record name that is not fully qualified", func() {
+			obj.Spec.DNS = &computev1.InstanceDNS{HostedZoneID: "Z0123456789", RecordName: "web"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.dns.recordName: Invalid value")))
+
+			obj.Spec.DNS.RecordName = "web.example.com."
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
+		})
+
+		It("Should deny creation if the availability zone is not in the region", func() {
+			obj.Spec.AvailabilityZone = "us-east-1a"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.availabilityZone: Invalid value")))
+		})
+
+		It("Should admit a local zone of the region", func() {
+			obj.Spec.Region = "us-west-2"
+			obj.Spec.AvailabilityZone = "us-west-2-lax-1a"
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
+		})
+
+		It("Should deny creation if an additional volume has no device name", func() {
+			obj.Spec.Storage.AdditionalVolumes[0].DeviceName = ""
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.additionalVolumes[0].deviceName: Required value")))
+		})
+
+		It("Should deny creation if a volume size is negative", func() {
+			obj.Spec.Storage.RootVolume.Size = -1
+			obj.Spec.Storage.AdditionalVolumes[0].Size = -5
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.rootVolume.size: Invalid value")))
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.additionalVolumes[0].size: Invalid value")))
+		})
+
+		It("Should deny creation if device names are duplicated", func() {
+			obj.Spec.Storage.AdditionalVolumes = append(obj.Spec.Storage.AdditionalVolumes,
+				computev1.VolumeConfig{Size: 10, DeviceName: "/dev/sdf"})
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.additionalVolumes[1].deviceName: Duplicate value")))
+		})
+
+		It("Should deny creation if the volume type is not supported", func() {
+			obj.Spec.Storage.RootVolume.Type = "gp9"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.rootVolume.type: Unsupported value")))
+		})
+
+		It("Should admit provisioned IOPS and throughput on gp3", func() {
+			obj.Spec.Storage.AdditionalVolumes[0].IOPS = 6000
+			obj.Spec.Storage.AdditionalVolumes[0].Throughput = 250
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
+		})
+
+		It("Should deny IOPS and throughput the volume type does not support", func() {
+			obj.Spec.Storage.RootVolume.Type = "gp2"
+			obj.Spec.Storage.RootVolume.IOPS = 3000
+			obj.Spec.Storage.AdditionalVolumes[0].Throughput = 2000
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.rootVolume.iops: Invalid value")))
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.additionalVolumes[0].throughput: Invalid value")))
+		})
+
+		It("Should deny a KMS key on an unencrypted volume", func() {
+			obj.Spec.Storage.AdditionalVolumes[0].KMSKeyID = "alias/ebs"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.additionalVolumes[0].kmsKeyId: Invalid value")))
+		})
+
+		It("Should deny EbsVolumes without a device name or sharing one with a storage volume", func() {
+			obj.Spec.Volumes = []computev1.EbsVolumeAttachment{
+				{Name: "data"},
+				{Name: "logs", DeviceName: obj.Spec.Storage.AdditionalVolumes[0].DeviceName},
+				{Name: "cache", DeviceName: "/dev/sdh"},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.volumes[0].deviceName: Required value")))
+			Expect(err).To(MatchError(ContainSubstring("spec.volumes[1].deviceName: Duplicate value")))
+			Expect(err).NotTo(MatchError(ContainSubstring("spec.volumes[2]")))
+		})
+
+		It("Should deny a deletion policy on the root volume", func() {
+			obj.Spec.Storage.RootVolume.DeletionPolicy = computev1.VolumeDeletionPolicyRetain
+			obj.Spec.Storage.AdditionalVolumes[0].DeletionPolicy = computev1.VolumeDeletionPolicyRetain
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.rootVolume.deletionPolicy: Forbidden")))
+			Expect(err).NotTo(MatchError(ContainSubstring("additionalVolumes[0].deletionPolicy")))
+		})
+	})
+
+	Context("When updating Ec2Instance under Validating Webhook", func() {
+		It("Should deny changing immutable fields", func() {
+			obj.Spec.Region = "eu-west-1"
+			obj.Spec.AvailabilityZone = "eu-west-1a"
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.region: Forbidden")))
+			Expect(err).To(MatchError(ContainSubstring("spec.availabilityZone: Forbidden")))
+		})
+
+		It("Should deny changing the image", func() {
+			oldObj.Spec.AMIId, obj.Spec.AMIId = "", ""
+			oldObj.Spec.Image = &computev1.ImageSelector{Owners: []string{"amazon"}, Name: "al2023-ami-2023.*"}
+			obj.Spec.Image = &computev1.ImageSelector{Owners: []string{"amazon"}, Name: "al2023-ami-minimal-*"}
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.image: Forbidden")))
+		})
+
+		It("Should admit changing the refresh settings of the image", func() {
+			oldObj.Spec.AMIId, obj.Spec.AMIId = "", ""
+			oldObj.Spec.Image = &computev1.ImageSelector{SSMParameter: "/aws/service/x"}
+			obj.Spec.Image = &computev1.ImageSelector{
+				SSMParameter: "/aws/service/x",
+				Refresh:      computev1.ImageRefreshOnNewVersion,
+				MaintenanceWindow: &computev1.MaintenanceWindow{
+					Days:      []computev1.MaintenanceDay{"Sunday"},
+					StartTime: "02:00",
+					Duration:  metav1.Duration{Duration: 2 * time.Hour},
+				},
+			}
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(BeNil())
+		})
+
+		It("Should deny a maintenance window without duration and a too short check interval", func() {
+			oldObj.Spec.AMIId, obj.Spec.AMIId = "", ""
+			oldObj.Spec.Image = &computev1.ImageSelector{SSMParameter: "/aws/service/x"}
+			obj.Spec.Image = &computev1.ImageSelector{
+				SSMParameter:      "/aws/service/x",
+				CheckInterval:     &metav1.Duration{Duration: time.Second},
+				MaintenanceWindow: &computev1.MaintenanceWindow{StartTime: "02:00"},
+			}
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.image.checkInterval: Invalid value")))
+			Expect(err).To(MatchError(ContainSubstring("spec.image.maintenanceWindow.duration: Invalid value")))
+		})
+
+		It("Should deny shrinking the root volume", func() {
+			obj.Spec.Storage.RootVolume.Size = 20
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.rootVolume.size: Forbidden")))
+		})
+
+		It("Should deny shrinking an additional volume and changing its encryption", func() {
+			obj.Spec.Storage.AdditionalVolumes[0].Size = 50
+			obj.Spec.Storage.AdditionalVolumes[0].Encrypted = true
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.additionalVolumes[0].size: Forbidden")))
+			Expect(err).To(MatchError(ContainSubstring("spec.storage.additionalVolumes[0].encrypted: Forbidden")))
+		})
+
+		It("Should admit changing the type and performance of a volume", func() {
+			obj.Spec.Storage.AdditionalVolumes[0].Type = "io2"
+			obj.Spec.Storage.AdditionalVolumes[0].IOPS = 10000
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(BeNil())
+		})
+
+		It("Should admit growing the root volume and changing tags", func() {
+			obj.Spec.Storage.RootVolume.Size = 50
+			obj.Spec.Tags = map[string]string{"Environment": "staging"}
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(BeNil())
+		})
+	})
+})